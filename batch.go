@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Batch collects metrics for atomic registration via Set.RegisterBatch.
+//
+// Metrics returned from Batch methods are registered in the Set only if RegisterBatch returns nil error.
+type Batch struct {
+	names   []string
+	metrics []metric
+}
+
+// NewCounter adds new counter with the given name to b and returns it.
+func (b *Batch) NewCounter(name string) *Counter {
+	c := &Counter{}
+	b.add(name, c)
+	return c
+}
+
+// NewFloatCounter adds new FloatCounter with the given name to b and returns it.
+func (b *Batch) NewFloatCounter(name string) *FloatCounter {
+	c := &FloatCounter{}
+	b.add(name, c)
+	return c
+}
+
+// NewGauge adds new gauge with the given name to b and returns it. The gauge calls f to obtain its value.
+//
+// f may be nil. See NewGauge for details.
+func (b *Batch) NewGauge(name string, f func() float64) *Gauge {
+	g := &Gauge{
+		f: f,
+	}
+	b.add(name, g)
+	return g
+}
+
+// NewHistogram adds new histogram with the given name to b and returns it.
+func (b *Batch) NewHistogram(name string) *Histogram {
+	h := &Histogram{}
+	b.add(name, h)
+	return h
+}
+
+// NewSummary adds new summary with the given name to b and returns it.
+func (b *Batch) NewSummary(name string) *Summary {
+	return b.NewSummaryExt(name, defaultSummaryWindow, defaultSummaryQuantiles)
+}
+
+// NewSummaryExt adds new summary with the given name, window and quantiles to b and returns it.
+func (b *Batch) NewSummaryExt(name string, window time.Duration, quantiles []float64) *Summary {
+	sm := newSummary(window, quantiles)
+	b.add(name, sm)
+	return sm
+}
+
+func (b *Batch) add(name string, m metric) {
+	b.names = append(b.names, name)
+	b.metrics = append(b.metrics, m)
+}
+
+// RegisterBatch registers metrics added to the Batch inside f atomically in s.
+//
+// Either all the metrics are registered or none of them. An error is returned if any of metric names is invalid,
+// if it is already registered in s or if the limit set via SetMaxMetrics would be exceeded.
+// This prevents from exposing partially initialized metric families on `/metrics` page during startup.
+//
+// f is called without holding s locks.
+func (s *Set) RegisterBatch(f func(b *Batch)) error {
+	var b Batch
+	f(&b)
+
+	seen := make(map[string]struct{})
+	checkName := func(name string) error {
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("metric %q is added to the batch multiple times", name)
+		}
+		seen[name] = struct{}{}
+		if s.m.get(name) != nil {
+			return fmt.Errorf("metric %q is already registered", name)
+		}
+		return nil
+	}
+	for _, name := range b.names {
+		if err := validateMetric(name); err != nil {
+			return fmt.Errorf("invalid metric name %q: %w", name, err)
+		}
+	}
+
+	s.mu.Lock()
+	if s.maxMetrics > 0 && s.metricsCount+len(b.names) > s.maxMetrics {
+		maxMetrics := s.maxMetrics
+		s.mu.Unlock()
+		return fmt.Errorf("cannot register %d metrics, since this would exceed the limit of %d metrics", len(b.names), maxMetrics)
+	}
+	for i, name := range b.names {
+		if err := checkName(name); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		if sm, ok := b.metrics[i].(*Summary); ok {
+			for _, q := range sm.quantiles {
+				if err := checkName(addTag(name, fmt.Sprintf(`quantile="%g"`, q))); err != nil {
+					s.mu.Unlock()
+					return err
+				}
+			}
+		}
+	}
+	for i, name := range b.names {
+		m := b.metrics[i]
+		s.mustRegisterLocked(name, m, false)
+		if sm, ok := m.(*Summary); ok {
+			registerSummaryLocked(sm)
+			s.registerSummaryQuantilesLocked(name, sm)
+			s.summaries = append(s.summaries, sm)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, name := range b.names {
+		s.notifyRegister(name)
+	}
+	return nil
+}
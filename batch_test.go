@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetRegisterBatch(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("existing_total").Inc()
+
+	var c *Counter
+	err := s.RegisterBatch(func(b *Batch) {
+		c = b.NewCounter("requests_total")
+		b.NewGauge("queue_size", nil).Set(3)
+		b.NewSummaryExt("duration_seconds", defaultSummaryWindow, []float64{0.5}).Update(1)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c.Add(2)
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	resultExpected := `duration_seconds_sum 1
+duration_seconds_count 1
+duration_seconds{quantile="0.5"} 1
+existing_total 1
+queue_size 3
+requests_total 2
+`
+	f(resultExpected)
+
+	// Failed batches mustn't register any metrics.
+	fail := func(addMetrics func(b *Batch)) {
+		t.Helper()
+		if err := s.RegisterBatch(addMetrics); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		f(resultExpected)
+	}
+	fail(func(b *Batch) {
+		b.NewCounter("foo_total")
+		b.NewCounter("existing_total")
+	})
+	fail(func(b *Batch) {
+		b.NewCounter("foo_total")
+		b.NewHistogram("foo_total")
+	})
+	fail(func(b *Batch) {
+		b.NewCounter("foo_total")
+		b.NewCounter("invalid{")
+	})
+	fail(func(b *Batch) {
+		b.NewCounter("foo_total")
+		b.NewSummary("duration_seconds")
+	})
+}
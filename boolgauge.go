@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// NewBoolGauge registers and returns new BoolGauge with the given name.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned BoolGauge is safe to use from concurrent goroutines.
+func NewBoolGauge(name string) *BoolGauge {
+	return defaultSet().NewBoolGauge(name)
+}
+
+// BoolGauge is a gauge, which exposes 1 for true and 0 for false.
+//
+// It is useful for exposing states such as leader election status or feature flags.
+//
+// The initial value for BoolGauge is false.
+type BoolGauge struct {
+	n uint32
+}
+
+// Set sets bg value to v.
+func (bg *BoolGauge) Set(v bool) {
+	n := uint32(0)
+	if v {
+		n = 1
+	}
+	atomic.StoreUint32(&bg.n, n)
+}
+
+// True sets bg value to true.
+func (bg *BoolGauge) True() {
+	bg.Set(true)
+}
+
+// False sets bg value to false.
+func (bg *BoolGauge) False() {
+	bg.Set(false)
+}
+
+// Get returns the current value for bg.
+func (bg *BoolGauge) Get() bool {
+	return atomic.LoadUint32(&bg.n) != 0
+}
+
+func (bg *BoolGauge) marshalTo(prefix string, w io.Writer) {
+	n := atomic.LoadUint32(&bg.n)
+	fmt.Fprintf(w, "%s %d\n", prefix, n)
+}
+
+func (bg *BoolGauge) metricType() string {
+	return "gauge"
+}
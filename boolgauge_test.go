@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestBoolGauge(t *testing.T) {
+	s := NewSet()
+	bg := s.NewBoolGauge("is_leader")
+	if bg.Get() {
+		t.Fatalf("unexpected initial value; got true; want false")
+	}
+	testMarshalTo(t, bg, "is_leader", "is_leader 0\n")
+
+	bg.True()
+	if !bg.Get() {
+		t.Fatalf("unexpected value after True call; got false; want true")
+	}
+	testMarshalTo(t, bg, "is_leader", "is_leader 1\n")
+
+	bg.False()
+	testMarshalTo(t, bg, "is_leader", "is_leader 0\n")
+
+	bg.Set(true)
+	testMarshalTo(t, bg, `is_leader{node="a"}`, `is_leader{node="a"} 1`+"\n")
+}
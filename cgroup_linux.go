@@ -0,0 +1,294 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// cgroupRoot is the mount point for cgroup v2 unified hierarchy.
+const cgroupRoot = "/sys/fs/cgroup"
+
+var cgroupErrLogged uint32
+
+// writeCgroupMetrics writes `process_cgroup_*` metrics for cgroup v2 of the current process to w.
+//
+// It also writes `process_cpu_cores_available` and `process_cpu_throttled_seconds_total` metrics,
+// which take into account CPU limits for both cgroup v1 and cgroup v2.
+func writeCgroupMetrics(w io.Writer) {
+	var cs *cgroupStats
+	if dir := getCgroupV2Dir("/proc/self/cgroup", cgroupRoot); dir != "" {
+		cs = readCgroupStats(dir, getCgroupStats)
+		if cs != nil {
+			writeCgroupV2Metrics(w, cs)
+		}
+	} else if dir := getCgroupV1CPUDir("/proc/self/cgroup", cgroupRoot); dir != "" {
+		cs = readCgroupStats(dir, getCgroupV1CPUStats)
+	}
+	writeCPUCoresMetrics(w, cs)
+}
+
+// readCgroupStats reads cgroup stats from dir with getStats.
+//
+// nil is returned on error.
+func readCgroupStats(dir string, getStats func(dir string) (*cgroupStats, error)) *cgroupStats {
+	cs, err := getStats(dir)
+	if err != nil {
+		// Do not spam the logs with errors - this error cannot be fixed without process restart.
+		if atomic.CompareAndSwapUint32(&cgroupErrLogged, 0, 1) {
+			log.Printf("ERROR: metrics: cannot read cgroup stats from %q, so cgroup metrics won't be updated until the error is fixed: %s", dir, err)
+		}
+		return nil
+	}
+	return cs
+}
+
+func writeCgroupV2Metrics(w io.Writer, cs *cgroupStats) {
+	if cs.memoryLimit > 0 {
+		WriteGaugeUint64(w, "process_cgroup_memory_limit_bytes", cs.memoryLimit)
+	}
+	if cs.hasMemoryUsage {
+		WriteGaugeUint64(w, "process_cgroup_memory_usage_bytes", cs.memoryUsage)
+	}
+	if cs.cpuLimitCores > 0 {
+		WriteGaugeFloat64(w, "process_cgroup_cpu_limit_cores", cs.cpuLimitCores)
+	}
+	WriteCounterFloat64(w, "process_cgroup_cpu_usage_seconds_total", float64(cs.cpuUsageUsec)/1e6)
+	WriteCounterUint64(w, "process_cgroup_cpu_periods_total", cs.cpuPeriods)
+	WriteCounterUint64(w, "process_cgroup_cpu_throttled_periods_total", cs.cpuThrottledPeriods)
+	WriteCounterFloat64(w, "process_cgroup_cpu_throttled_seconds_total", float64(cs.cpuThrottledUsec)/1e6)
+}
+
+// writeCPUCoresMetrics writes the number of CPU cores available to the process and CPU throttling time according to cs to w.
+//
+// cs may be nil if the process doesn't run under cgroup with cpu controller.
+func writeCPUCoresMetrics(w io.Writer, cs *cgroupStats) {
+	WriteGaugeFloat64(w, "process_cpu_cores_available", getCPUCoresAvailable(cs))
+	if cs != nil {
+		WriteCounterFloat64(w, "process_cpu_throttled_seconds_total", float64(cs.cpuThrottledUsec)/1e6)
+	}
+}
+
+// getCPUCoresAvailable returns the number of CPU cores available to the process according to cs.
+//
+// The number may be fractional if CPU quota is set.
+func getCPUCoresAvailable(cs *cgroupStats) float64 {
+	cores := float64(runtime.NumCPU())
+	if cs != nil && cs.cpuLimitCores > 0 && cs.cpuLimitCores < cores {
+		return cs.cpuLimitCores
+	}
+	return cores
+}
+
+// getCgroupV2Dir returns the directory for cgroup v2 of the current process.
+//
+// cgroupPath must point to /proc/self/cgroup, while root must point to cgroup v2 mount point.
+// An empty string is returned if cgroup v2 isn't used.
+func getCgroupV2Dir(cgroupPath, root string) string {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return ""
+	}
+	data, err := ioutil.ReadFile(cgroupPath)
+	if err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		path := strings.TrimPrefix(sc.Text(), "0::")
+		if len(path) == len(sc.Text()) {
+			continue
+		}
+		dir := filepath.Join(root, path)
+		if _, err := os.Stat(filepath.Join(dir, "cpu.stat")); err != nil {
+			// The cgroup path may be invisible in the current cgroup namespace, e.g. inside containers.
+			return root
+		}
+		return dir
+	}
+	return ""
+}
+
+type cgroupStats struct {
+	// memoryLimit is zero if memory isn't limited.
+	memoryLimit    uint64
+	memoryUsage    uint64
+	hasMemoryUsage bool
+
+	// cpuLimitCores is zero if CPU isn't limited.
+	cpuLimitCores       float64
+	cpuUsageUsec        uint64
+	cpuPeriods          uint64
+	cpuThrottledPeriods uint64
+	cpuThrottledUsec    uint64
+}
+
+// getCgroupStats reads stats from cgroup v2 files at dir.
+//
+// memory.* and cpu.max files are optional, since they are missing at the root cgroup and in cgroups without enabled controllers.
+func getCgroupStats(dir string) (*cgroupStats, error) {
+	var cs cgroupStats
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse number from %q in cpu.stat: %w", s, err)
+		}
+		switch fields[0] {
+		case "usage_usec":
+			cs.cpuUsageUsec = v
+		case "nr_periods":
+			cs.cpuPeriods = v
+		case "nr_throttled":
+			cs.cpuThrottledPeriods = v
+		case "throttled_usec":
+			cs.cpuThrottledUsec = v
+		}
+	}
+
+	if s, ok := readCgroupFile(dir, "cpu.max"); ok {
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected number of fields in cpu.max %q; got %d; want 2", s, len(fields))
+		}
+		if fields[0] != "max" {
+			quota, err := strconv.ParseUint(fields[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse quota from cpu.max %q: %w", s, err)
+			}
+			period, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil || period == 0 {
+				return nil, fmt.Errorf("cannot parse period from cpu.max %q: %v", s, err)
+			}
+			cs.cpuLimitCores = float64(quota) / float64(period)
+		}
+	}
+
+	if s, ok := readCgroupFile(dir, "memory.max"); ok && s != "max" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse memory.max %q: %w", s, err)
+		}
+		cs.memoryLimit = v
+	}
+	if s, ok := readCgroupFile(dir, "memory.current"); ok {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse memory.current %q: %w", s, err)
+		}
+		cs.memoryUsage = v
+		cs.hasMemoryUsage = true
+	}
+	return &cs, nil
+}
+
+// getCgroupV1CPUDir returns the directory for cgroup v1 cpu controller of the current process.
+//
+// cgroupPath must point to /proc/self/cgroup, while root must point to cgroup v1 mount point.
+// An empty string is returned if cgroup v1 cpu controller isn't used.
+func getCgroupV1CPUDir(cgroupPath, root string) string {
+	data, err := ioutil.ReadFile(cgroupPath)
+	if err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		// The line has the form `hierarchy-ID:controller-list:cgroup-path`
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 || !hasController(parts[1], "cpu") {
+			continue
+		}
+		root := filepath.Join(root, "cpu")
+		dir := filepath.Join(root, parts[2])
+		if _, err := os.Stat(filepath.Join(dir, "cpu.stat")); err == nil {
+			return dir
+		}
+		if _, err := os.Stat(filepath.Join(root, "cpu.stat")); err == nil {
+			// The cgroup path may be invisible in the current cgroup namespace, e.g. inside containers.
+			return root
+		}
+		return ""
+	}
+	return ""
+}
+
+func hasController(controllers, name string) bool {
+	for _, c := range strings.Split(controllers, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getCgroupV1CPUStats reads CPU quota and throttling stats from cgroup v1 cpu controller files at dir.
+func getCgroupV1CPUStats(dir string) (*cgroupStats, error) {
+	var cs cgroupStats
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse number from %q in cpu.stat: %w", s, err)
+		}
+		switch fields[0] {
+		case "nr_periods":
+			cs.cpuPeriods = v
+		case "nr_throttled":
+			cs.cpuThrottledPeriods = v
+		case "throttled_time":
+			// throttled_time is in nanoseconds
+			cs.cpuThrottledUsec = v / 1e3
+		}
+	}
+
+	quotaStr, ok := readCgroupFile(dir, "cpu.cfs_quota_us")
+	if !ok || quotaStr == "-1" {
+		return &cs, nil
+	}
+	quota, err := strconv.ParseUint(quotaStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse cpu.cfs_quota_us %q: %w", quotaStr, err)
+	}
+	periodStr, _ := readCgroupFile(dir, "cpu.cfs_period_us")
+	period, err := strconv.ParseUint(periodStr, 10, 64)
+	if err != nil || period == 0 {
+		return nil, fmt.Errorf("cannot parse cpu.cfs_period_us %q: %v", periodStr, err)
+	}
+	cs.cpuLimitCores = float64(quota) / float64(period)
+	return &cs, nil
+}
+
+// readCgroupFile returns trimmed contents of the file with the given name at dir.
+//
+// false is returned if the file cannot be read.
+func readCgroupFile(dir, name string) (string, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGetCgroupV2Dir(t *testing.T) {
+	f := func(cgroupPath, root, want string) {
+		t.Helper()
+		got := getCgroupV2Dir(cgroupPath, root)
+		if got != want {
+			t.Fatalf("unexpected result: %q, want: %q at getCgroupV2Dir", got, want)
+		}
+	}
+	f("testdata/cgroup/limited/proc_self_cgroup", "testdata/cgroup/limited", "testdata/cgroup/limited/app")
+
+	// The cgroup path is missing in the current cgroup namespace
+	f("testdata/cgroup/unlimited/proc_self_cgroup", "testdata/cgroup/unlimited", "testdata/cgroup/unlimited")
+
+	// cgroup v1
+	f("testdata/cgroup/bad/proc_self_cgroup", "testdata/cgroup/bad", "")
+	f("testdata/cgroup/bad/proc_self_cgroup", "testdata/cgroup/limited", "")
+}
+
+func TestGetCgroupStats(t *testing.T) {
+	f := func(want cgroupStats, dir string, wantErr bool) {
+		t.Helper()
+		got, err := getCgroupStats(dir)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != nil && *got != want {
+			t.Fatalf("unexpected result: %+v, want: %+v at getCgroupStats", *got, want)
+		}
+	}
+	f(cgroupStats{
+		memoryLimit:         536870912,
+		memoryUsage:         268435456,
+		hasMemoryUsage:      true,
+		cpuLimitCores:       1.5,
+		cpuUsageUsec:        1500000,
+		cpuPeriods:          100,
+		cpuThrottledPeriods: 10,
+		cpuThrottledUsec:    250000,
+	}, "testdata/cgroup/limited/app", false)
+	f(cgroupStats{
+		cpuUsageUsec: 2000000,
+	}, "testdata/cgroup/unlimited", false)
+	f(cgroupStats{}, "testdata/cgroup/bad", true)
+	f(cgroupStats{}, "testdata/cgroup/missing", true)
+}
+
+func TestGetCgroupV1CPUDir(t *testing.T) {
+	f := func(cgroupPath, root, want string) {
+		t.Helper()
+		got := getCgroupV1CPUDir(cgroupPath, root)
+		if got != want {
+			t.Fatalf("unexpected result: %q, want: %q at getCgroupV1CPUDir", got, want)
+		}
+	}
+	f("testdata/cgroup/v1/proc_self_cgroup", "testdata/cgroup/v1", "testdata/cgroup/v1/cpu/app")
+
+	// The cgroup path is missing in the current cgroup namespace
+	f("testdata/cgroup/v1/proc_self_cgroup_missing", "testdata/cgroup/v1", "testdata/cgroup/v1/cpu")
+
+	// missing cpu controller
+	f("testdata/cgroup/limited/proc_self_cgroup", "testdata/cgroup/v1", "")
+	f("testdata/cgroup/v1/proc_self_cgroup", "testdata/cgroup/limited", "")
+}
+
+func TestGetCgroupV1CPUStats(t *testing.T) {
+	f := func(want cgroupStats, dir string, wantErr bool) {
+		t.Helper()
+		got, err := getCgroupV1CPUStats(dir)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != nil && *got != want {
+			t.Fatalf("unexpected result: %+v, want: %+v at getCgroupV1CPUStats", *got, want)
+		}
+	}
+	f(cgroupStats{
+		cpuLimitCores:       0.5,
+		cpuPeriods:          50,
+		cpuThrottledPeriods: 5,
+		cpuThrottledUsec:    1500000,
+	}, "testdata/cgroup/v1/cpu/app", false)
+	f(cgroupStats{}, "testdata/cgroup/v1/cpu", false)
+	f(cgroupStats{}, "testdata/cgroup/bad", true)
+}
+
+func TestGetCPUCoresAvailable(t *testing.T) {
+	f := func(cs *cgroupStats, want float64) {
+		t.Helper()
+		got := getCPUCoresAvailable(cs)
+		if got != want {
+			t.Fatalf("unexpected result: %v, want: %v at getCPUCoresAvailable", got, want)
+		}
+	}
+	numCPU := float64(runtime.NumCPU())
+	f(nil, numCPU)
+	f(&cgroupStats{}, numCPU)
+	f(&cgroupStats{cpuLimitCores: 0.5}, 0.5)
+	f(&cgroupStats{cpuLimitCores: numCPU + 1}, numCPU)
+}
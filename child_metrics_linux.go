@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// childProcStats contains summary stats for child processes.
+type childProcStats struct {
+	children uint64
+	utime    uint64
+	stime    uint64
+	rss      uint64
+}
+
+func writeChildProcessMetrics(w io.Writer) {
+	cs, err := getChildProcStats("/proc", os.Getpid())
+	if err != nil {
+		log.Printf("ERROR: metrics: cannot determine child process stats: %s", err)
+		return
+	}
+	utime := float64(cs.utime) / userHZ
+	stime := float64(cs.stime) / userHZ
+	WriteCounterFloat64(w, "process_children_cpu_seconds_system_total", stime)
+	WriteCounterFloat64(w, "process_children_cpu_seconds_total", utime+stime)
+	WriteCounterFloat64(w, "process_children_cpu_seconds_user_total", utime)
+	WriteGaugeUint64(w, "process_children_resident_memory_bytes", cs.rss*pageSizeBytes)
+	WriteGaugeUint64(w, "process_num_children", cs.children)
+}
+
+// getChildProcStats returns summary stats for descendants of the process with the given pid according to procDir.
+//
+// CPU time includes the time of already terminated children, which were waited for, and the time of running descendants.
+// Running descendants are found by walking procDir for processes with matching parent pid.
+func getChildProcStats(procDir string, pid int) (*childProcStats, error) {
+	statFilepath := filepath.Join(procDir, strconv.Itoa(pid), "stat")
+	data, err := ioutil.ReadFile(statFilepath)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := parseChildStat(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", statFilepath, err)
+	}
+	cs := &childProcStats{
+		utime: ps.cutime,
+		stime: ps.cstime,
+	}
+
+	fis, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[int][]*childStat)
+	for _, fi := range fis {
+		if _, err := strconv.Atoi(fi.Name()); err != nil {
+			// Skip non-process entries such as /proc/meminfo
+			continue
+		}
+		statFilepath := filepath.Join(procDir, fi.Name(), "stat")
+		data, err := ioutil.ReadFile(statFilepath)
+		if err != nil {
+			// The process may exit after reading procDir.
+			continue
+		}
+		ps, err := parseChildStat(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", statFilepath, err)
+		}
+		m[ps.ppid] = append(m[ps.ppid], ps)
+	}
+
+	// The CPU time of terminated grandchildren is already accounted in cutime and cstime of running children.
+	pending := m[pid]
+	for len(pending) > 0 {
+		ps := pending[len(pending)-1]
+		pending = append(pending[:len(pending)-1], m[ps.pid]...)
+		cs.children++
+		cs.utime += ps.utime + ps.cutime
+		cs.stime += ps.stime + ps.cstime
+		cs.rss += ps.rss
+	}
+	return cs, nil
+}
+
+// childStat contains fields from /proc/<pid>/stat needed for child process stats.
+type childStat struct {
+	pid    int
+	ppid   int
+	utime  uint64
+	stime  uint64
+	cutime uint64
+	cstime uint64
+	rss    uint64
+}
+
+// parseChildStat parses /proc/<pid>/stat contents.
+//
+// See http://man7.org/linux/man-pages/man5/proc.5.html
+func parseChildStat(data []byte) (*childStat, error) {
+	n := bytes.IndexByte(data, ' ')
+	m := bytes.LastIndex(data, []byte(") "))
+	if n < 0 || m < n {
+		return nil, fmt.Errorf("cannot find process name in parentheses in %q", data)
+	}
+	// rss is the 24th field, while the fields start from the 3rd field after the process name.
+	fields := bytes.Fields(data[m+2:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("unexpected number of fields after process name in %q; got %d; want at least 22", data, len(fields))
+	}
+	pid, err := strconv.Atoi(string(data[:n]))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse pid: %w", err)
+	}
+	ppid, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse ppid: %w", err)
+	}
+	var values [5]uint64
+	for i, idx := range []int{11, 12, 13, 14, 21} {
+		// cutime, cstime and rss are signed according to proc(5).
+		v, err := strconv.ParseInt(string(fields[idx]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse field #%d: %w", idx+3, err)
+		}
+		if v > 0 {
+			values[i] = uint64(v)
+		}
+	}
+	return &childStat{
+		pid:    pid,
+		ppid:   ppid,
+		utime:  values[0],
+		stime:  values[1],
+		cutime: values[2],
+		cstime: values[3],
+		rss:    values[4],
+	}, nil
+}
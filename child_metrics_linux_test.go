@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetChildProcStats(t *testing.T) {
+	f := func(want *childProcStats, path string, pid int, wantErr bool) {
+		t.Helper()
+		got, err := getChildProcStats(path, pid)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result: %+v, want: %+v at getChildProcStats", got, want)
+		}
+	}
+	f(&childProcStats{children: 2, utime: 1260, stime: 325, rss: 400}, "testdata/proc", 100, false)
+	f(&childProcStats{children: 1, utime: 210, stime: 105, rss: 100}, "testdata/proc", 101, false)
+	f(&childProcStats{}, "testdata/proc", 102, false)
+	f(nil, "testdata/proc", 1000, true)
+	f(nil, "testdata/proc_bad", 100, true)
+	f(nil, "testdata/bad_path", 100, true)
+}
+
+func TestWriteChildProcessMetrics(t *testing.T) {
+	var bb bytes.Buffer
+	WriteChildProcessMetrics(&bb)
+	if !strings.Contains(bb.String(), "process_num_children 0\n") {
+		t.Fatalf("missing process_num_children metric in the output:\n%s", bb.String())
+	}
+
+	// Child process metrics mustn't split metric families written by WriteProcessMetrics.
+	ExposeMetadata(true)
+	defer ExposeMetadata(false)
+	bb.Reset()
+	WriteProcessMetrics(&bb)
+	WriteChildProcessMetrics(&bb)
+	checkUniqueMetadata(t, bb.String())
+}
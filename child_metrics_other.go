@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package metrics
+
+import (
+	"io"
+)
+
+func writeChildProcessMetrics(w io.Writer) {
+	// TODO: implement it
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of the current time and tickers for this package.
+//
+// The default Clock uses the system time. It may be replaced via SetClock in tests
+// in order to advance time deterministically instead of relying on time.Sleep.
+type Clock interface {
+	// Now must return the current time.
+	Now() time.Time
+
+	// NewTicker must return a channel, which receives ticks every d, and a function for stopping the ticker.
+	NewTicker(d time.Duration) (<-chan time.Time, func())
+}
+
+// SetClock sets the Clock used by this package.
+//
+// The Clock is used by UpdateDuration methods, Timer, Rate, Summary window rotation and periodic metrics push.
+// Pass nil in order to restore the system clock.
+//
+// Summary window rotation and periodic metrics push obtain tickers from the Clock at start,
+// so SetClock must be called before creating summaries and initializing metrics push.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clock.Store(&clockHolder{
+		c: c,
+	})
+}
+
+func getClock() Clock {
+	return clock.Load().(*clockHolder).c
+}
+
+func now() time.Time {
+	return getClock().Now()
+}
+
+func since(t time.Time) time.Duration {
+	return now().Sub(t)
+}
+
+var clock atomic.Value
+
+func init() {
+	SetClock(nil)
+}
+
+// clockHolder allows storing distinct Clock implementations in atomic.Value.
+type clockHolder struct {
+	c Clock
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
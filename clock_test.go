@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock, which advances only on Advance calls.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	ch       chan time.Time
+	interval time.Duration
+	next     time.Time
+	stopped  bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now: time.Unix(1700000000, 0),
+	}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	t := fc.now
+	fc.mu.Unlock()
+	return t
+}
+
+func (fc *fakeClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	fc.mu.Lock()
+	ft := &fakeTicker{
+		ch:       make(chan time.Time),
+		interval: d,
+		next:     fc.now.Add(d),
+	}
+	fc.tickers = append(fc.tickers, ft)
+	fc.mu.Unlock()
+	stop := func() {
+		fc.mu.Lock()
+		ft.stopped = true
+		fc.mu.Unlock()
+	}
+	return ft.ch, stop
+}
+
+// Advance advances fc by d and synchronously delivers ticks to the tickers, which became due.
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	fc.now = fc.now.Add(d)
+	now := fc.now
+	var due []*fakeTicker
+	for _, ft := range fc.tickers {
+		if !ft.stopped && !ft.next.After(now) {
+			due = append(due, ft)
+			ft.next = now.Add(ft.interval)
+		}
+	}
+	fc.mu.Unlock()
+	for _, ft := range due {
+		ft.ch <- now
+	}
+}
+
+func (fc *fakeClock) waitForTickers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fc.mu.Lock()
+		tickers := len(fc.tickers)
+		fc.mu.Unlock()
+		if tickers >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for %d tickers; got %d tickers", n, tickers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSetClockUpdateDuration(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	s := NewSet()
+	h := s.NewHistogram("histogram")
+	sm := s.NewSummary("summary")
+	nh := s.NewNativeHistogram("native_histogram")
+
+	startTime := fc.Now()
+	fc.Advance(1500 * time.Millisecond)
+	h.UpdateDuration(startTime)
+	sm.UpdateDuration(startTime)
+	nh.UpdateDuration(startTime)
+
+	tm := StartTimer()
+	fc.Advance(500 * time.Millisecond)
+	tm.ObserveTo(h)
+
+	testMarshalTo(t, h, "histogram", `histogram_bucket{vmrange="4.642e-01...5.275e-01"} 1
+histogram_bucket{vmrange="1.468e+00...1.668e+00"} 1
+histogram_sum 2
+histogram_count 2
+`)
+	if q := sm.Quantile(1); q != 1.5 {
+		t.Fatalf("unexpected summary max; got %v; want 1.5", q)
+	}
+	testMarshalTo(t, nh, "native_histogram", "native_histogram_sum 1.5\nnative_histogram_count 1\n")
+}
+
+func TestSetClockSummaryWindow(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	// Use unique window in order to start new rotation goroutine with the fake clock.
+	const window = 13*time.Minute + 17*time.Second
+	s := NewSet()
+	sm := s.NewSummaryExt("summary_fake_clock", window, []float64{1})
+	defer s.UnregisterAllMetrics()
+	fc.waitForTickers(t, 1)
+
+	sm.Update(42)
+	fc.Advance(window / 2)
+	if q := sm.Quantile(1); q != 42 {
+		t.Fatalf("unexpected summary max after the first rotation; got %v; want 42", q)
+	}
+	fc.Advance(window / 2)
+
+	// The second tick is delivered, but the rotation may be still in progress.
+	deadline := time.Now().Add(5 * time.Second)
+	for !math.IsNaN(sm.Quantile(1)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("summary values must be dropped after the full window")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
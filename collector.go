@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"io"
+)
+
+// Collector collects metrics at scrape time.
+//
+// This is useful for pull-style exporters, which read metric values from external sources such as kernel stats
+// on every scrape instead of updating pre-registered gauges.
+type Collector interface {
+	// Collect must write the collected metrics to w.
+	//
+	// Collect may be called concurrently from multiple goroutines.
+	Collect(w ExpositionWriter)
+}
+
+// ExpositionWriter is used by Collector for writing metrics.
+//
+// It is also an io.Writer accepting metrics in Prometheus text exposition format,
+// so it can be passed to WriteSummary, WriteHistogram, WriteGaugeWithLabels and other Write* functions.
+type ExpositionWriter interface {
+	io.Writer
+
+	// WriteGauge writes gauge metric with the given name and value.
+	//
+	// name may contain labels, e.g. `foo{bar="baz"}`.
+	WriteGauge(name string, value float64)
+
+	// WriteCounter writes counter metric with the given name and value.
+	//
+	// name may contain labels, e.g. `foo_total{bar="baz"}`.
+	WriteCounter(name string, value float64)
+}
+
+// RegisterCollector registers c in the default set.
+//
+// See Set.RegisterCollector for details.
+func RegisterCollector(c Collector) {
+	defaultSet().RegisterCollector(c)
+}
+
+// RegisterCollector registers c in s.
+//
+// c.Collect is called at s.WritePrometheus and at the rest of functions writing metrics from s
+// in the same way as callbacks passed to RegisterMetricsWriter. The registered collector can be removed
+// via s.UnregisterAllMetrics.
+func (s *Set) RegisterCollector(c Collector) {
+	s.RegisterMetricsWriter(func(w io.Writer) {
+		c.Collect(&expositionWriter{
+			w: w,
+		})
+	})
+}
+
+type expositionWriter struct {
+	w io.Writer
+}
+
+func (ew *expositionWriter) Write(p []byte) (int, error) {
+	return ew.w.Write(p)
+}
+
+func (ew *expositionWriter) WriteGauge(name string, value float64) {
+	WriteGaugeFloat64(ew.w, name, value)
+}
+
+func (ew *expositionWriter) WriteCounter(name string, value float64) {
+	WriteCounterFloat64(ew.w, name, value)
+}
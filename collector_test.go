@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testCollector struct {
+	calls int
+}
+
+func (tc *testCollector) Collect(w ExpositionWriter) {
+	tc.calls++
+	w.WriteGauge(`disk_free_bytes{device="sda"}`, 1024)
+	w.WriteCounter("disk_reads_total", float64(tc.calls))
+	WriteGaugeWithLabels(w, "disk_temperature_celsius", map[string]string{"device": "sda"}, 42.5)
+}
+
+func TestSetRegisterCollector(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	tc := &testCollector{}
+	s.RegisterCollector(tc)
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// Metrics must be collected at every scrape.
+	f(`foo_total 1
+disk_free_bytes{device="sda"} 1024
+disk_reads_total 1
+disk_temperature_celsius{device="sda"} 42.5
+`)
+	f(`foo_total 1
+disk_free_bytes{device="sda"} 1024
+disk_reads_total 2
+disk_temperature_celsius{device="sda"} 42.5
+`)
+
+	s.UnregisterAllMetrics()
+	f("")
+	if tc.calls != 2 {
+		t.Fatalf("unexpected number of Collect calls; got %d; want 2", tc.calls)
+	}
+}
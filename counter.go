@@ -17,7 +17,7 @@ import (
 //
 // The returned counter is safe to use from concurrent goroutines.
 func NewCounter(name string) *Counter {
-	return defaultSet.NewCounter(name)
+	return defaultSet().NewCounter(name)
 }
 
 // Counter is a counter.
@@ -25,25 +25,31 @@ func NewCounter(name string) *Counter {
 // It may be used as a gauge if Dec and Set are called.
 type Counter struct {
 	n uint64
+
+	accessTracker
 }
 
 // Inc increments c.
 func (c *Counter) Inc() {
+	c.markAccessed()
 	atomic.AddUint64(&c.n, 1)
 }
 
 // Dec decrements c.
 func (c *Counter) Dec() {
+	c.markAccessed()
 	atomic.AddUint64(&c.n, ^uint64(0))
 }
 
 // Add adds n to c.
 func (c *Counter) Add(n int) {
+	c.markAccessed()
 	atomic.AddUint64(&c.n, uint64(n))
 }
 
 // AddInt64 adds n to c.
 func (c *Counter) AddInt64(n int64) {
+	c.markAccessed()
 	atomic.AddUint64(&c.n, uint64(n))
 }
 
@@ -54,9 +60,18 @@ func (c *Counter) Get() uint64 {
 
 // Set sets c value to n.
 func (c *Counter) Set(n uint64) {
+	c.markAccessed()
 	atomic.StoreUint64(&c.n, n)
 }
 
+// GetAndReset atomically returns the current value for c and resets it to zero.
+//
+// This is useful for delta-based reporting, since there is no race between Get and Set(0) calls.
+func (c *Counter) GetAndReset() uint64 {
+	c.markAccessed()
+	return atomic.SwapUint64(&c.n, 0)
+}
+
 // marshalTo marshals c with the given prefix to w.
 func (c *Counter) marshalTo(prefix string, w io.Writer) {
 	v := c.Get()
@@ -82,5 +97,5 @@ func (c *Counter) metricType() string {
 //
 // Performance tip: prefer NewCounter instead of GetOrCreateCounter.
 func GetOrCreateCounter(name string) *Counter {
-	return defaultSet.GetOrCreateCounter(name)
+	return defaultSet().GetOrCreateCounter(name)
 }
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -29,6 +30,40 @@ func TestCounterSerial(t *testing.T) {
 	testMarshalTo(t, c, "foobar", "foobar 125\n")
 }
 
+func TestCounterGetAndReset(t *testing.T) {
+	var c Counter
+	c.Add(5)
+	if n := c.GetAndReset(); n != 5 {
+		t.Fatalf("unexpected counter value; got %d; want 5", n)
+	}
+	if n := c.Get(); n != 0 {
+		t.Fatalf("unexpected counter value after reset; got %d; want 0", n)
+	}
+
+	// Verify that concurrent increments aren't lost.
+	var total uint64
+	var totalLock sync.Mutex
+	err := testConcurrent(func() error {
+		for i := 0; i < 1000; i++ {
+			c.Inc()
+			if i%10 == 0 {
+				n := c.GetAndReset()
+				totalLock.Lock()
+				total += n
+				totalLock.Unlock()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total += c.GetAndReset()
+	if total != 5000 {
+		t.Fatalf("unexpected total value; got %d; want 5000", total)
+	}
+}
+
 func TestCounterConcurrent(t *testing.T) {
 	name := "CounterConcurrent"
 	c := NewCounter(name)
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ExposeCreatedSeries allows enabling `_created` series for counters, histograms and summaries globally.
+//
+// The `_created` series contains the unix timestamp in seconds when the metric has been registered or reset via ResetAll.
+// This allows downstream systems to correctly handle counter resets in short-lived jobs.
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#counter
+//
+// The `_total` suffix is removed from counter names, so `requests_total` counter is accompanied by `requests_created` series.
+//
+// It is safe to call this method multiple times. It is allowed to change it in runtime.
+// ExposeCreatedSeries is set to false by default.
+func ExposeCreatedSeries(v bool) {
+	n := 0
+	if v {
+		n = 1
+	}
+	atomic.StoreUint32(&exposeCreatedSeries, uint32(n))
+}
+
+func isCreatedSeriesEnabled() bool {
+	n := atomic.LoadUint32(&exposeCreatedSeries)
+	return n != 0
+}
+
+var exposeCreatedSeries uint32
+
+// resetCreated sets nm creation timestamp to the current time.
+func (nm *namedMetric) resetCreated() {
+	atomic.StoreInt64(&nm.created, now().UnixNano()/1e6)
+}
+
+// writeCreatedSeriesIfNeeded writes `_created` series for nm to w if this is globally enabled via ExposeCreatedSeries().
+func writeCreatedSeriesIfNeeded(w io.Writer, nm *namedMetric) {
+	if !isCreatedSeriesEnabled() || nm.isAux {
+		return
+	}
+	switch nm.metric.metricType() {
+	case "counter", "histogram", "summary":
+	default:
+		return
+	}
+	family, labels := splitMetricName(nm.name)
+	family = strings.TrimSuffix(family, "_total")
+	created := float64(atomic.LoadInt64(&nm.created)) / 1e3
+	fmt.Fprintf(w, "%s_created%s %s\n", family, labels, strconv.FormatFloat(created, 'f', -1, 64))
+}
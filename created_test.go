@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExposeCreatedSeries(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo"}`).Add(1)
+	fc.Advance(1500 * time.Millisecond)
+	s.NewHistogram("response_size").Update(1)
+	s.NewSummaryExt("duration_seconds", defaultSummaryWindow, []float64{0.5}).Update(2)
+	s.NewGauge("temperature", nil).Set(3)
+	s.NewSummary("empty_summary")
+
+	ExposeCreatedSeries(true)
+	defer ExposeCreatedSeries(false)
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(`duration_seconds_sum 2
+duration_seconds_count 1
+duration_seconds_created 1700000001.5
+duration_seconds{quantile="0.5"} 2
+requests_total{path="/foo"} 1
+requests_created{path="/foo"} 1700000000
+response_size_bucket{vmrange="8.799e-01...1.000e+00"} 1
+response_size_sum 1
+response_size_count 1
+response_size_created 1700000001.5
+temperature 3
+`)
+
+	// The creation timestamp must be updated on reset.
+	fc.Advance(time.Second)
+	s.ResetAll()
+	f(`requests_total{path="/foo"} 0
+requests_created{path="/foo"} 1700000002.5
+temperature 3
+`)
+
+	// OpenMetrics
+	var bb bytes.Buffer
+	s.WriteOpenMetrics(&bb)
+	resultExpected := `# TYPE requests counter
+requests_total{path="/foo"} 0
+requests_created{path="/foo"} 1700000002.5
+# TYPE temperature gauge
+temperature 3
+# EOF
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected OpenMetrics output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+)
+
+// Marshaler must be implemented by custom metrics registered via RegisterMetric.
+type Marshaler interface {
+	// MarshalTo must write metric samples to w in Prometheus text exposition format without comments and metadata.
+	//
+	// prefix contains the metric name passed to RegisterMetric. Every written line must start with prefix
+	// or with prefix plus suffix such as prefix_sum, and must end with \n.
+	MarshalTo(prefix string, w io.Writer)
+
+	// MetricType must return the metric type such as "counter", "gauge", "histogram" or "summary".
+	//
+	// The metric type is exposed in `# TYPE` metadata if metadata exposition is enabled via ExposeMetadata().
+	MetricType() string
+}
+
+// RegisterMetric registers custom metric m with the given name in the default set.
+//
+// See Set.RegisterMetric for details.
+func RegisterMetric(name string, m Marshaler) {
+	defaultSet().RegisterMetric(name, m)
+}
+
+// RegisterMetric registers custom metric m with the given name in s.
+//
+// This allows third-party metric types such as t-digest summaries to be exported by s.WritePrometheus
+// in the order of metric names together with the rest of metrics in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// m must be safe for concurrent calls. The registered metric can be removed via s.UnregisterMetric(name).
+func (s *Set) RegisterMetric(name string, m Marshaler) {
+	if m == nil {
+		panic(fmt.Errorf("BUG: custom metric %q cannot be nil", name))
+	}
+	cm := &customMetric{
+		m: m,
+	}
+	s.registerMetric(name, cm)
+}
+
+// customMetric adapts Marshaler to metric interface.
+type customMetric struct {
+	m Marshaler
+}
+
+func (cm *customMetric) marshalTo(prefix string, w io.Writer) {
+	cm.m.MarshalTo(prefix, w)
+}
+
+func (cm *customMetric) metricType() string {
+	return cm.m.MetricType()
+}
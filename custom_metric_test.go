@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type testCustomMetric struct {
+	sum   float64
+	count uint64
+}
+
+func (tm *testCustomMetric) MarshalTo(prefix string, w io.Writer) {
+	name, labels := splitMetricName(prefix)
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, tm.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, tm.count)
+}
+
+func (tm *testCustomMetric) MetricType() string {
+	return "summary"
+}
+
+func TestSetRegisterMetric(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("aaa_total").Set(1)
+	s.RegisterMetric(`bbb{foo="bar"}`, &testCustomMetric{
+		sum:   1.5,
+		count: 3,
+	})
+	s.NewCounter("ccc_total").Set(2)
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(`aaa_total 1
+bbb_sum{foo="bar"} 1.5
+bbb_count{foo="bar"} 3
+ccc_total 2
+`)
+
+	ExposeMetadata(true)
+	f(`# HELP aaa_total
+# TYPE aaa_total counter
+aaa_total 1
+# HELP bbb
+# TYPE bbb summary
+bbb_sum{foo="bar"} 1.5
+bbb_count{foo="bar"} 3
+# HELP ccc_total
+# TYPE ccc_total counter
+ccc_total 2
+`)
+	ExposeMetadata(false)
+
+	if !s.UnregisterMetric(`bbb{foo="bar"}`) {
+		t.Fatalf("cannot unregister custom metric")
+	}
+	f(`aaa_total 1
+ccc_total 2
+`)
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// isQuotedMetricName returns true if name has the form `{"metric_name",labels...}` according to Prometheus UTF-8 syntax.
+func isQuotedMetricName(name string) bool {
+	return strings.HasPrefix(name, `{"`)
+}
+
+// isLegacyMetricName returns true if name can be written without quotes in Prometheus text exposition format.
+func isLegacyMetricName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// appendMetricName appends name to dst. The name is quoted if it cannot be written as is.
+func appendMetricName(dst []byte, name string) []byte {
+	if isLegacyMetricName(name) {
+		return append(dst, name...)
+	}
+	return strconv.AppendQuote(dst, name)
+}
+
+// escapeMetricNames appends lines from src in Prometheus text exposition format to dst
+// with metric names escaped according to Prometheus UTF-8 syntax and returns the result.
+//
+// Metric names, which cannot be written as is, are quoted and moved inside curly braces, e.g. `{"my.metric",label="value"} 1`.
+// Metric names in `# HELP` and `# TYPE` comments are quoted, e.g. `# TYPE "my.metric" counter`.
+func escapeMetricNames(dst, src []byte) []byte {
+	visitLines(src, func(line []byte) {
+		s := string(line)
+		switch {
+		case bytes.HasPrefix(line, helpPrefixBytes) || bytes.HasPrefix(line, typePrefixBytes):
+			prefix := s[:len(helpPrefixBytes)]
+			name, tail := splitMetadataName(s[len(prefix):])
+			dst = append(dst, prefix...)
+			dst = appendMetricName(dst, name)
+			dst = append(dst, tail...)
+		case bytes.HasPrefix(line, bashBytes):
+			// Copy the rest of comments as is
+			dst = append(dst, line...)
+		default:
+			dst = appendEscapedSample(dst, s)
+		}
+		dst = append(dst, '\n')
+	})
+	return dst
+}
+
+// appendEscapedSample appends sample line s with escaped metric name to dst.
+func appendEscapedSample(dst []byte, s string) []byte {
+	var name, tail string
+	hasLabels := false
+	if isQuotedMetricName(s) {
+		nameLocal, tailLocal, err := readQuotedString(s[1:])
+		if err != nil || tailLocal == "" {
+			return append(dst, s...)
+		}
+		name = nameLocal
+		hasLabels = strings.HasPrefix(tailLocal, ",")
+		tail = tailLocal[1:]
+	} else {
+		n := strings.IndexAny(s, "{ ")
+		if n < 0 {
+			return append(dst, s...)
+		}
+		name = s[:n]
+		tail = s[n:]
+		if strings.HasPrefix(tail, "{}") {
+			tail = tail[2:]
+		} else if strings.HasPrefix(tail, "{") {
+			hasLabels = true
+			tail = tail[1:]
+		}
+	}
+	if isLegacyMetricName(name) {
+		dst = append(dst, name...)
+		if hasLabels {
+			dst = append(dst, '{')
+		}
+		return append(dst, tail...)
+	}
+	dst = append(dst, '{')
+	dst = strconv.AppendQuote(dst, name)
+	if hasLabels {
+		dst = append(dst, ',')
+	} else {
+		dst = append(dst, '}')
+	}
+	return append(dst, tail...)
+}
+
+// splitMetadataName splits s from `# HELP` or `# TYPE` comment into metric name and the tail after it.
+func splitMetadataName(s string) (string, string) {
+	if strings.HasPrefix(s, `"`) {
+		name, tail, err := readQuotedString(s)
+		if err == nil {
+			return name, tail
+		}
+	}
+	n := strings.IndexByte(s, ' ')
+	if n < 0 {
+		return s, ""
+	}
+	return s[:n], s[n:]
+}
+
+// insertAfterOpeningQuote appends line to dst with str inserted just after the first double quote in line.
+func insertAfterOpeningQuote(dst []byte, line []byte, str string) []byte {
+	n := bytes.IndexByte(line, '"')
+	dst = append(dst, line[:n+1]...)
+	dst = append(dst, str...)
+	return append(dst, line[n+1:]...)
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fdTypes contains the list of file descriptor types exposed via `process_open_fds{type="..."}` metrics.
+var fdTypes = []string{"anon_inode", "eventfd", "file", "other", "pipe", "socket"}
+
+// writeFDTypeMetrics writes process_open_fds{type="..."} metrics to w.
+//
+// It also writes process_max_fds metric if writeMaxFDs is set.
+// False is returned if the metrics cannot be obtained.
+func writeFDTypeMetrics(w io.Writer, writeMaxFDs bool) bool {
+	m, err := getOpenFDsByType("/proc/self/fd")
+	if err != nil {
+		log.Printf("ERROR: metrics: cannot determine open file descriptors by type: %s", err)
+		return false
+	}
+	if writeMaxFDs {
+		maxOpenFDs, err := getMaxFilesLimit("/proc/self/limits")
+		if err != nil {
+			log.Printf("ERROR: metrics: cannot determine the limit on open file descritors: %s", err)
+			return false
+		}
+		WriteGaugeUint64(w, "process_max_fds", maxOpenFDs)
+	}
+	WriteMetadataIfNeeded(w, "process_open_fds", "gauge")
+	for _, fdType := range fdTypes {
+		fmt.Fprintf(w, "process_open_fds{type=%q} %d\n", fdType, m[fdType])
+	}
+	return true
+}
+
+// getOpenFDsByType returns the number of open file descriptors at path grouped by type.
+func getOpenFDsByType(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := make(map[string]uint64, len(fdTypes))
+	for {
+		names, err := f.Readdirnames(512)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error at Readdirnames: %s", err)
+		}
+		for _, name := range names {
+			target, err := os.Readlink(filepath.Join(path, name))
+			if err != nil {
+				// The file descriptor may be closed after reading path.
+				continue
+			}
+			m[getFDType(target)]++
+		}
+	}
+	return m, nil
+}
+
+// getFDType returns the type of file descriptor with the given link target at /proc/self/fd.
+func getFDType(target string) string {
+	switch {
+	case strings.HasPrefix(target, "/"):
+		return "file"
+	case strings.HasPrefix(target, "socket:"):
+		return "socket"
+	case strings.HasPrefix(target, "pipe:"):
+		return "pipe"
+	case target == "anon_inode:[eventfd]":
+		return "eventfd"
+	case strings.HasPrefix(target, "anon_inode:"):
+		return "anon_inode"
+	default:
+		return "other"
+	}
+}
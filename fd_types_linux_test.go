@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestGetOpenFDsByType(t *testing.T) {
+	dir := t.TempDir()
+	targets := []string{
+		"/dev/null",
+		"/var/log/app.log",
+		"socket:[12345]",
+		"socket:[12346]",
+		"socket:[12347]",
+		"pipe:[23456]",
+		"anon_inode:[eventfd]",
+		"anon_inode:[eventpoll]",
+		"anon_inode:inotify",
+		"net:[4026531840]",
+	}
+	for i, target := range targets {
+		if err := os.Symlink(target, filepath.Join(dir, strconv.Itoa(i))); err != nil {
+			t.Fatalf("cannot create symlink: %s", err)
+		}
+	}
+
+	m, err := getOpenFDsByType(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	mExpected := map[string]uint64{
+		"anon_inode": 2,
+		"eventfd":    1,
+		"file":       2,
+		"other":      1,
+		"pipe":       1,
+		"socket":     3,
+	}
+	if !reflect.DeepEqual(m, mExpected) {
+		t.Fatalf("unexpected result: %v, want: %v", m, mExpected)
+	}
+
+	if _, err := getOpenFDsByType("testdata/bad_path"); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package metrics
+
+import (
+	"io"
+)
+
+func writeFDTypeMetrics(_ io.Writer, _ bool) bool {
+	// TODO: implement it
+	return false
+}
@@ -17,7 +17,7 @@ import (
 //
 // The returned counter is safe to use from concurrent goroutines.
 func NewFloatCounter(name string) *FloatCounter {
-	return defaultSet.NewFloatCounter(name)
+	return defaultSet().NewFloatCounter(name)
 }
 
 // FloatCounter is a float64 counter guarded by RWmutex.
@@ -26,10 +26,13 @@ func NewFloatCounter(name string) *FloatCounter {
 type FloatCounter struct {
 	mu sync.Mutex
 	n  float64
+
+	accessTracker
 }
 
 // Add adds n to fc.
 func (fc *FloatCounter) Add(n float64) {
+	fc.markAccessed()
 	fc.mu.Lock()
 	fc.n += n
 	fc.mu.Unlock()
@@ -37,6 +40,7 @@ func (fc *FloatCounter) Add(n float64) {
 
 // Sub substracts n from fc.
 func (fc *FloatCounter) Sub(n float64) {
+	fc.markAccessed()
 	fc.mu.Lock()
 	fc.n -= n
 	fc.mu.Unlock()
@@ -52,11 +56,24 @@ func (fc *FloatCounter) Get() float64 {
 
 // Set sets fc value to n.
 func (fc *FloatCounter) Set(n float64) {
+	fc.markAccessed()
 	fc.mu.Lock()
 	fc.n = n
 	fc.mu.Unlock()
 }
 
+// GetAndReset atomically returns the current value for fc and resets it to zero.
+//
+// This is useful for delta-based reporting, since there is no race between Get and Set(0) calls.
+func (fc *FloatCounter) GetAndReset() float64 {
+	fc.markAccessed()
+	fc.mu.Lock()
+	n := fc.n
+	fc.n = 0
+	fc.mu.Unlock()
+	return n
+}
+
 // marshalTo marshals fc with the given prefix to w.
 func (fc *FloatCounter) marshalTo(prefix string, w io.Writer) {
 	v := fc.Get()
@@ -82,5 +99,5 @@ func (fc *FloatCounter) metricType() string {
 //
 // Performance tip: prefer NewFloatCounter instead of GetOrCreateFloatCounter.
 func GetOrCreateFloatCounter(name string) *FloatCounter {
-	return defaultSet.GetOrCreateFloatCounter(name)
+	return defaultSet().GetOrCreateFloatCounter(name)
 }
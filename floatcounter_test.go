@@ -29,6 +29,17 @@ func TestFloatCounterSerial(t *testing.T) {
 	testMarshalTo(t, c, "foobar", "foobar 125.002\n")
 }
 
+func TestFloatCounterGetAndReset(t *testing.T) {
+	var fc FloatCounter
+	fc.Add(1.5)
+	if n := fc.GetAndReset(); n != 1.5 {
+		t.Fatalf("unexpected counter value; got %g; want 1.5", n)
+	}
+	if n := fc.Get(); n != 0 {
+		t.Fatalf("unexpected counter value after reset; got %g; want 0", n)
+	}
+}
+
 func TestFloatCounterConcurrent(t *testing.T) {
 	name := "FloatCounterConcurrent"
 	c := NewFloatCounter(name)
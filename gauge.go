@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // NewGauge registers and returns gauge with the given name, which calls f to obtain gauge value.
@@ -23,7 +25,57 @@ import (
 //
 // See also FloatCounter for working with floating-point values.
 func NewGauge(name string, f func() float64) *Gauge {
-	return defaultSet.NewGauge(name, f)
+	return defaultSet().NewGauge(name, f)
+}
+
+// NewCachedGauge registers and returns gauge with the given name, which calls f to obtain gauge value.
+//
+// The value returned by f is cached for the given ttl, so f is called at most once per ttl
+// regardless of the number of scrapes. This is useful for expensive callbacks
+// such as directory size calculation.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// f must be safe for concurrent calls.
+//
+// The returned gauge is safe to use from concurrent goroutines.
+func NewCachedGauge(name string, f func() float64, ttl time.Duration) *Gauge {
+	return defaultSet().NewCachedGauge(name, f, ttl)
+}
+
+// newCachedGaugeFunc returns a function, which calls f at most once per ttl and returns the cached value between the calls.
+//
+// Concurrent callers wait for the in-flight f call instead of calling f simultaneously.
+func newCachedGaugeFunc(f func() float64, ttl time.Duration) func() float64 {
+	if f == nil {
+		panic(fmt.Errorf("BUG: f cannot be nil for cached gauge"))
+	}
+	if ttl <= 0 {
+		panic(fmt.Errorf("BUG: ttl must be positive for cached gauge; got %s", ttl))
+	}
+	var (
+		mu       sync.Mutex
+		value    float64
+		deadline time.Time
+		hasValue bool
+	)
+	return func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+
+		currentTime := now()
+		if !hasValue || !currentTime.Before(deadline) {
+			value = f()
+			deadline = currentTime.Add(ttl)
+			hasValue = true
+		}
+		return value
+	}
 }
 
 // Gauge is a float64 gauge.
@@ -33,6 +85,8 @@ type Gauge struct {
 
 	// f is a callback, which is called for returning the gauge value.
 	f func() float64
+
+	accessTracker
 }
 
 // Get returns the current value for g.
@@ -51,6 +105,7 @@ func (g *Gauge) Set(v float64) {
 	if g.f != nil {
 		panic(fmt.Errorf("cannot call Set on gauge created with non-nil callback"))
 	}
+	g.markAccessed()
 	n := math.Float64bits(v)
 	atomic.StoreUint64(&g.valueBits, n)
 }
@@ -76,6 +131,7 @@ func (g *Gauge) Add(fAdd float64) {
 	if g.f != nil {
 		panic(fmt.Errorf("cannot call Set on gauge created with non-nil callback"))
 	}
+	g.markAccessed()
 	for {
 		n := atomic.LoadUint64(&g.valueBits)
 		f := math.Float64frombits(n)
@@ -118,5 +174,52 @@ func (g *Gauge) metricType() string {
 //
 // See also FloatCounter for working with floating-point values.
 func GetOrCreateGauge(name string, f func() float64) *Gauge {
-	return defaultSet.GetOrCreateGauge(name, f)
+	return defaultSet().GetOrCreateGauge(name, f)
+}
+
+// NewGaugeVec creates and returns new GaugeVec with the given name and labelNames.
+//
+// name must be valid Prometheus-compatible metric name without labels.
+//
+// The returned GaugeVec is safe to use from concurrent goroutines.
+func NewGaugeVec(name string, labelNames []string) *GaugeVec {
+	return defaultSet().NewGaugeVec(name, labelNames)
+}
+
+// GaugeVec is a set of gauges with the same name partitioned by label values.
+//
+// Gauges for the given label values are created on the first access
+// and are cached in GaugeVec, so subsequent accesses are fast.
+type GaugeVec struct {
+	mv *metricVec
+}
+
+// WithLabelValues returns gauge for the given labelValues.
+//
+// The number of labelValues must match the number of label names passed to NewGaugeVec.
+//
+// The returned gauge is created with nil callback, so its value may be changed via Set(), Inc(), Dec() and Add() calls.
+func (gv *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	return gv.WithLabelValuesFunc(nil, labelValues...)
+}
+
+// WithLabelValuesFunc returns gauge for the given labelValues, which calls f to obtain gauge value.
+//
+// The number of labelValues must match the number of label names passed to NewGaugeVec.
+//
+// f is ignored if the gauge for the given labelValues already exists.
+// f must be safe for concurrent calls.
+func (gv *GaugeVec) WithLabelValuesFunc(f func() float64, labelValues ...string) *Gauge {
+	m := gv.mv.getOrCreate(labelValues, func(name string) metric {
+		return gv.mv.s.GetOrCreateGauge(name, f)
+	})
+	return m.(*Gauge)
+}
+
+// DeleteLabelValues unregisters gauge for the given labelValues.
+//
+// True is returned if the gauge has been removed.
+// False is returned if there is no gauge for the given labelValues.
+func (gv *GaugeVec) DeleteLabelValues(labelValues ...string) bool {
+	return gv.mv.deleteLabelValues(labelValues)
 }
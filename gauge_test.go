@@ -1,9 +1,11 @@
 package metrics
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestGaugeError(t *testing.T) {
@@ -131,3 +133,81 @@ func TestGaugeConcurrent(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestGaugeVec(t *testing.T) {
+	s := NewSet()
+	gv := s.NewGaugeVec("queue_size", []string{"queue", "topic"})
+
+	g := gv.WithLabelValues("foo", "bar")
+	g.Set(12)
+	if g2 := gv.WithLabelValues("foo", "bar"); g2 != g {
+		t.Fatalf("WithLabelValues must return the same gauge for the same label values")
+	}
+	gv.WithLabelValuesFunc(func() float64 { return 34 }, "baz", "x")
+
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	result := bb.String()
+	resultExpected := `queue_size{queue="baz",topic="x"} 34
+queue_size{queue="foo",topic="bar"} 12
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	if !gv.DeleteLabelValues("foo", "bar") {
+		t.Fatalf("DeleteLabelValues must return true for existing gauge")
+	}
+	if gv.DeleteLabelValues("foo", "bar") {
+		t.Fatalf("DeleteLabelValues must return false for missing gauge")
+	}
+	bb.Reset()
+	s.WritePrometheus(&bb)
+	result = bb.String()
+	resultExpected = `queue_size{queue="baz",topic="x"} 34
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected result after DeleteLabelValues; got\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	expectPanic(t, "WithLabelValues_invalid_count", func() {
+		gv.WithLabelValues("foo")
+	})
+	expectPanic(t, "NewGaugeVec_invalid_label_name", func() {
+		s.NewGaugeVec("foo", []string{"bar-baz"})
+	})
+}
+
+func TestCachedGauge(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	calls := 0
+	s := NewSet()
+	g := s.NewCachedGauge("cached_gauge", func() float64 {
+		calls++
+		return float64(calls)
+	}, time.Minute)
+
+	f := func(vExpected float64, callsExpected int) {
+		t.Helper()
+		if v := g.Get(); v != vExpected {
+			t.Fatalf("unexpected gauge value; got %v; want %v", v, vExpected)
+		}
+		if calls != callsExpected {
+			t.Fatalf("unexpected number of callback calls; got %d; want %d", calls, callsExpected)
+		}
+	}
+	f(1, 1)
+	f(1, 1)
+	fc.Advance(59 * time.Second)
+	f(1, 1)
+	testMarshalTo(t, g, "cached_gauge", "cached_gauge 1\n")
+	fc.Advance(time.Second)
+	f(2, 2)
+	f(2, 2)
+
+	expectPanic(t, "NewCachedGauge(nil)", func() { s.NewCachedGauge("nil_callback", nil, time.Minute) })
+	expectPanic(t, "NewCachedGauge(ttl=0)", func() { s.NewCachedGauge("zero_ttl", func() float64 { return 0 }, 0) })
+}
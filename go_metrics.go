@@ -8,6 +8,7 @@ import (
 	"runtime"
 	runtimemetrics "runtime/metrics"
 	"strings"
+	"sync"
 
 	"github.com/valyala/histogram"
 )
@@ -18,9 +19,17 @@ var runtimeMetrics = [][2]string{
 	{"/sync/mutex/wait/total:seconds", "go_mutex_wait_seconds_total"},
 	{"/cpu/classes/gc/mark/assist:cpu-seconds", "go_gc_mark_assist_cpu_seconds_total"},
 	{"/cpu/classes/gc/total:cpu-seconds", "go_gc_cpu_seconds_total"},
-	{"/gc/pauses:seconds", "go_gc_pauses_seconds"},
+	{"/sched/pauses/total/gc:seconds", "go_gc_pauses_seconds"},
 	{"/cpu/classes/scavenge/total:cpu-seconds", "go_scavenge_cpu_seconds_total"},
 	{"/gc/gomemlimit:bytes", "go_memlimit_bytes"},
+	{"/gc/gogc:percent", "go_gogc_percent"},
+}
+
+// runtimeMetricFallbacks contains runtime metrics, which are used instead of the corresponding runtimeMetrics
+// if they aren't supported by the current Go runtime.
+var runtimeMetricFallbacks = map[string]string{
+	// /gc/pauses:seconds is deprecated in favor of /sched/pauses/total/gc:seconds since Go1.22.
+	"/sched/pauses/total/gc:seconds": "/gc/pauses:seconds",
 }
 
 var supportedRuntimeMetrics = initSupportedRuntimeMetrics(runtimeMetrics)
@@ -33,8 +42,15 @@ func initSupportedRuntimeMetrics(rms [][2]string) [][2]string {
 	var supportedMetrics [][2]string
 	for _, rm := range rms {
 		metricName := rm[0]
+		if _, ok := exposedMetrics[metricName]; !ok {
+			if fallbackName, ok := runtimeMetricFallbacks[metricName]; ok {
+				if _, ok := exposedMetrics[fallbackName]; ok {
+					metricName = fallbackName
+				}
+			}
+		}
 		if _, ok := exposedMetrics[metricName]; ok {
-			supportedMetrics = append(supportedMetrics, rm)
+			supportedMetrics = append(supportedMetrics, [2]string{metricName, rm[1]})
 		} else {
 			log.Printf("github.com/VictoriaMetrics/metrics: do not expose %s metric, since the corresponding metric %s isn't supported in the current Go runtime", rm[1], metricName)
 		}
@@ -123,6 +139,11 @@ func writeRuntimeMetric(w io.Writer, name string, sample *runtimemetrics.Sample)
 		panic(fmt.Errorf("BUG: unexpected runtimemetrics.KindBad for sample.Name=%q", sample.Name))
 	case runtimemetrics.KindUint64:
 		v := sample.Value.Uint64()
+		if sample.Name == "/gc/gogc:percent" && int64(v) < 0 {
+			// Go runtime exposes -1 as uint64 when GC is disabled via GOGC=off. Expose it as -1.
+			WriteGaugeFloat64(w, name, -1)
+			return
+		}
 		if strings.HasSuffix(name, "_total") {
 			WriteCounterUint64(w, name, v)
 		} else {
@@ -180,5 +201,68 @@ func writeRuntimeHistogramMetric(w io.Writer, name string, h *runtimemetrics.Flo
 	fmt.Fprintf(w, `%s_bucket{le="+Inf"} %d`+"\n", name, totalCount)
 }
 
+func writeAllRuntimeMetrics(w io.Writer, matcher func(name string) bool) {
+	rms := getAllRuntimeMetrics()
+	samples := make([]runtimemetrics.Sample, 0, len(rms))
+	names := make([]string, 0, len(rms))
+	for _, rm := range rms {
+		if matcher != nil && !matcher(rm[0]) {
+			continue
+		}
+		samples = append(samples, runtimemetrics.Sample{
+			Name: rm[0],
+		})
+		names = append(names, rm[1])
+	}
+	runtimemetrics.Read(samples)
+	for i := range samples {
+		if samples[i].Value.Kind() == runtimemetrics.KindBad {
+			// The metric isn't supported by the current Go runtime.
+			continue
+		}
+		writeRuntimeMetric(w, names[i], &samples[i])
+	}
+}
+
+var (
+	allRuntimeMetrics     [][2]string
+	allRuntimeMetricsOnce sync.Once
+)
+
+// getAllRuntimeMetrics returns pairs of names for all the runtime metrics supported by the current Go runtime.
+//
+// The first name is the runtime metric name, while the second name is the corresponding Prometheus metric name.
+func getAllRuntimeMetrics() [][2]string {
+	allRuntimeMetricsOnce.Do(func() {
+		for _, d := range runtimemetrics.All() {
+			allRuntimeMetrics = append(allRuntimeMetrics, [2]string{d.Name, getRuntimeMetricName(&d)})
+		}
+	})
+	return allRuntimeMetrics
+}
+
+// getRuntimeMetricName converts the name of the runtime metric described by d to Prometheus-compatible name.
+//
+// For example, `/memory/classes/heap/free:bytes` is converted to `go_memory_classes_heap_free_bytes`,
+// while `/gc/heap/allocs:bytes` is converted to `go_gc_heap_allocs_bytes_total`, since it is cumulative.
+func getRuntimeMetricName(d *runtimemetrics.Description) string {
+	b := []byte("go_")
+	for _, c := range strings.TrimPrefix(d.Name, "/") {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b = append(b, byte(c))
+			continue
+		}
+		// Replace all the other chars such as `/`, `:`, `-` and `*` with `_`. Do not repeat `_` chars.
+		if b[len(b)-1] != '_' {
+			b = append(b, '_')
+		}
+	}
+	name := strings.TrimSuffix(string(b), "_")
+	if d.Cumulative && d.Kind != runtimemetrics.KindFloat64Histogram && !isCounterName(name) {
+		name += "_total"
+	}
+	return name
+}
+
 // Limit the number of buckets for Go runtime histograms in order to prevent from high cardinality issues at scraper side.
 const maxRuntimeHistogramBuckets = 30
@@ -3,6 +3,8 @@ package metrics
 import (
 	"bytes"
 	"math"
+	"reflect"
+	"runtime/debug"
 	runtimemetrics "runtime/metrics"
 	"strings"
 	"testing"
@@ -69,3 +71,79 @@ foo_bucket{le="5"} 6
 foo_bucket{le="+Inf"} 6
 `)
 }
+
+func TestGetRuntimeMetricName(t *testing.T) {
+	f := func(name string, kind runtimemetrics.ValueKind, cumulative bool, resultExpected string) {
+		t.Helper()
+		d := &runtimemetrics.Description{
+			Name:       name,
+			Kind:       kind,
+			Cumulative: cumulative,
+		}
+		result := getRuntimeMetricName(d)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f("/memory/classes/heap/free:bytes", runtimemetrics.KindUint64, false, "go_memory_classes_heap_free_bytes")
+	f("/gc/heap/allocs:bytes", runtimemetrics.KindUint64, true, "go_gc_heap_allocs_bytes_total")
+	f("/cpu/classes/gc/mark/assist:cpu-seconds", runtimemetrics.KindFloat64, true, "go_cpu_classes_gc_mark_assist_cpu_seconds_total")
+	f("/sync/mutex/wait/total:seconds", runtimemetrics.KindFloat64, true, "go_sync_mutex_wait_total_seconds_total")
+	f("/gc/pauses:seconds", runtimemetrics.KindFloat64Histogram, true, "go_gc_pauses_seconds")
+	f("/godebug/non-default-behavior/x509sha1:events", runtimemetrics.KindUint64, true, "go_godebug_non_default_behavior_x509sha1_events_total")
+	f("/foo/*/bar:items", runtimemetrics.KindUint64, false, "go_foo_bar_items")
+}
+
+func TestWriteGoRuntimeMetrics(t *testing.T) {
+	var bb bytes.Buffer
+	WriteGoRuntimeMetrics(&bb, nil)
+	for _, line := range strings.Split(strings.TrimSpace(bb.String()), "\n") {
+		if _, err := parseSample(line); err != nil {
+			t.Fatalf("cannot parse %q: %s", line, err)
+		}
+	}
+
+	bb.Reset()
+	WriteGoRuntimeMetrics(&bb, func(name string) bool {
+		return name == "/memory/classes/heap/free:bytes"
+	})
+	if !strings.HasPrefix(bb.String(), "go_memory_classes_heap_free_bytes ") || strings.Count(bb.String(), "\n") != 1 {
+		t.Fatalf("unexpected output:\n%s", bb.String())
+	}
+}
+
+func TestInitSupportedRuntimeMetricsFallback(t *testing.T) {
+	runtimeMetricFallbacks["/unsupported/metric:bytes"] = "/gc/heap/goal:bytes"
+	defer delete(runtimeMetricFallbacks, "/unsupported/metric:bytes")
+
+	rms := initSupportedRuntimeMetrics([][2]string{
+		{"/unsupported/metric:bytes", "foo_bytes"},
+		{"/unsupported/other:bytes", "bar_bytes"},
+		{"/gc/heap/goal:bytes", "baz_bytes"},
+	})
+	rmsExpected := [][2]string{
+		{"/gc/heap/goal:bytes", "foo_bytes"},
+		{"/gc/heap/goal:bytes", "baz_bytes"},
+	}
+	if !reflect.DeepEqual(rms, rmsExpected) {
+		t.Fatalf("unexpected result; got %v; want %v", rms, rmsExpected)
+	}
+}
+
+func TestWriteRuntimeMetricGOGC(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	samples := []runtimemetrics.Sample{{
+		Name: "/gc/gogc:percent",
+	}}
+	runtimemetrics.Read(samples)
+	if samples[0].Value.Kind() == runtimemetrics.KindBad {
+		t.Skipf("/gc/gogc:percent isn't supported by the current Go runtime")
+	}
+	var bb bytes.Buffer
+	writeRuntimeMetric(&bb, "go_gogc_percent", &samples[0])
+	if result := bb.String(); result != "go_gogc_percent -1\n" {
+		t.Fatalf("unexpected result; got %q; want %q", result, "go_gogc_percent -1\n")
+	}
+}
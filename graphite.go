@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GraphiteLabelsMode defines how metric labels are mapped to Graphite paths.
+type GraphiteLabelsMode int
+
+const (
+	// GraphiteLabelsAsTags writes labels as Graphite tags, e.g. `requests_total;path=/foo;code=200`.
+	//
+	// See https://graphite.readthedocs.io/en/latest/tags.html
+	GraphiteLabelsAsTags GraphiteLabelsMode = iota
+
+	// GraphiteLabelsAsPath appends label names and values to the path, e.g. `requests_total.path._foo.code.200`.
+	GraphiteLabelsAsPath
+
+	// GraphiteLabelsAsValuesPath appends only label values to the path, e.g. `requests_total._foo.200`.
+	GraphiteLabelsAsValuesPath
+)
+
+// GraphiteOptions contains options for writing and pushing metrics in Graphite plaintext protocol.
+type GraphiteOptions struct {
+	// Prefix is an optional prefix for all the Graphite paths, e.g. `myapp.host1.`.
+	Prefix string
+
+	// LabelsMode defines how metric labels are mapped to Graphite paths.
+	//
+	// By default labels are written as Graphite tags.
+	LabelsMode GraphiteLabelsMode
+
+	// Optional WaitGroup for waiting until the push worker created by InitPushGraphite is stopped.
+	WaitGroup *sync.WaitGroup
+}
+
+// WriteGraphite writes all the metrics from s to w in Graphite plaintext protocol.
+//
+// Every sample is written as `path value timestamp` line, where path is built from the sample name and labels
+// according to opts.LabelsMode. Characters, which have special meaning in Graphite paths, are replaced with `_`.
+// Samples with NaN or Inf values are skipped.
+//
+// opts may contain additional configuration options if non-nil.
+//
+// Output of metrics writers registered via RegisterMetricsWriter isn't written to w.
+//
+// See https://graphite.readthedocs.io/en/latest/feeding-carbon.html#the-plaintext-protocol
+func (s *Set) WriteGraphite(w io.Writer, opts *GraphiteOptions) {
+	if opts == nil {
+		opts = &GraphiteOptions{}
+	}
+	timestamp := now().Unix()
+	bb := getBytesBuffer()
+	s.Visit(func(_ string, value MetricValue) {
+		for i := range value.Samples {
+			bb.B = appendGraphiteLine(bb.B, opts, &value.Samples[i], timestamp)
+		}
+	})
+	w.Write(bb.B)
+	putBytesBuffer(bb)
+}
+
+// InitPushGraphite sets up periodic push for metrics from s to the Graphite plaintext protocol listener at addr
+// with the given interval.
+//
+// addr must have the form `host:port`, e.g. `carbon:2003`. The metrics are sent over TCP.
+//
+// The periodic push is stopped when ctx is canceled.
+// It is possible to wait until the background metrics push worker is stopped on a WaitGroup passed via opts.WaitGroup.
+//
+// opts may contain additional configuration options if non-nil.
+func (s *Set) InitPushGraphite(ctx context.Context, addr string, interval time.Duration, opts *GraphiteOptions) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid Graphite addr=%q: %w", addr, err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive; got %s", interval)
+	}
+	var wg *sync.WaitGroup
+	if opts != nil {
+		wg = opts.WaitGroup
+		if wg != nil {
+			wg.Add(1)
+		}
+	}
+	go func() {
+		tickerCh, stopTicker := getClock().NewTicker(interval)
+		defer stopTicker()
+		stopCh := ctx.Done()
+		for {
+			select {
+			case <-tickerCh:
+				ctxLocal, cancel := context.WithTimeout(ctx, interval+time.Second)
+				err := s.PushGraphite(ctxLocal, addr, opts)
+				cancel()
+				if err != nil {
+					log.Printf("ERROR: metrics.push: %s", err)
+				}
+			case <-stopCh:
+				if wg != nil {
+					wg.Done()
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// PushGraphite pushes metrics from s to the Graphite plaintext protocol listener at addr over TCP.
+//
+// opts may contain additional configuration options if non-nil.
+func (s *Set) PushGraphite(ctx context.Context, addr string, opts *GraphiteOptions) error {
+	bb := getBytesBuffer()
+	defer putBytesBuffer(bb)
+	s.WriteGraphite(bb, opts)
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot connect to Graphite at %q: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+	if _, err := conn.Write(bb.B); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("cannot send %d bytes to Graphite at %q: %w", len(bb.B), addr, err)
+	}
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("cannot close connection to Graphite at %q: %w", addr, err)
+	}
+	return nil
+}
+
+func appendGraphiteLine(dst []byte, opts *GraphiteOptions, sample *Sample, timestamp int64) []byte {
+	v := sample.Value
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return dst
+	}
+	dst = append(dst, opts.Prefix...)
+	dst = appendGraphiteSanitized(dst, getMetricFamily(sample.Name))
+	for _, l := range sample.Labels {
+		switch opts.LabelsMode {
+		case GraphiteLabelsAsPath:
+			dst = append(dst, '.')
+			dst = appendGraphiteSanitized(dst, l.Name)
+			dst = append(dst, '.')
+			dst = appendGraphiteSanitized(dst, l.Value)
+		case GraphiteLabelsAsValuesPath:
+			dst = append(dst, '.')
+			dst = appendGraphiteSanitized(dst, l.Value)
+		default:
+			if l.Value == "" {
+				// Graphite doesn't support tags with empty values.
+				continue
+			}
+			dst = append(dst, ';')
+			dst = appendGraphiteSanitized(dst, l.Name)
+			dst = append(dst, '=')
+			dst = appendGraphiteTagValue(dst, l.Value)
+		}
+	}
+	dst = append(dst, ' ')
+	dst = strconv.AppendFloat(dst, v, 'g', -1, 64)
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, timestamp, 10)
+	return append(dst, '\n')
+}
+
+// appendGraphiteSanitized appends s to dst, replacing chars, which are unsafe for Graphite path nodes, with `_`.
+func appendGraphiteSanitized(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isGraphiteSafeChar(c) {
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// appendGraphiteTagValue appends tag value s to dst, replacing chars, which are unsafe for Graphite tag values, with `_`.
+func appendGraphiteTagValue(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == ';' || c == '~' || c <= ' ' {
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+func isGraphiteSafeChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == ':' || c == '+'
+}
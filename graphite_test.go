@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSetWriteGraphite(t *testing.T) {
+	SetClock(newFakeClock())
+	defer SetClock(nil)
+
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo",code="200"}`).Add(123)
+	s.NewGauge("temperature", nil).Set(1.5)
+	s.NewHistogram("response_size").Update(1)
+
+	f := func(opts *GraphiteOptions, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WriteGraphite(&bb, opts)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(nil, `requests_total;path=/foo;code=200 123 1700000000
+response_size_bucket;vmrange=8.799e-01...1.000e+00 1 1700000000
+response_size_sum 1 1700000000
+response_size_count 1 1700000000
+temperature 1.5 1700000000
+`)
+	f(&GraphiteOptions{
+		Prefix:     "app.",
+		LabelsMode: GraphiteLabelsAsPath,
+	}, `app.requests_total.path._foo.code.200 123 1700000000
+app.response_size_bucket.vmrange.8_799e-01___1_000e+00 1 1700000000
+app.response_size_sum 1 1700000000
+app.response_size_count 1 1700000000
+app.temperature 1.5 1700000000
+`)
+	f(&GraphiteOptions{
+		LabelsMode: GraphiteLabelsAsValuesPath,
+	}, `requests_total._foo.200 123 1700000000
+response_size_bucket.8_799e-01___1_000e+00 1 1700000000
+response_size_sum 1 1700000000
+response_size_count 1 1700000000
+temperature 1.5 1700000000
+`)
+}
+
+func TestSetPushGraphite(t *testing.T) {
+	SetClock(newFakeClock())
+	defer SetClock(nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start listener: %s", err)
+	}
+	defer ln.Close()
+	resultCh := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			resultCh <- err.Error()
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		_ = conn.Close()
+		resultCh <- string(data)
+	}()
+
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo"}`).Add(1)
+	if err := s.PushGraphite(context.Background(), ln.Addr().String(), nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resultExpected := "requests_total;path=/foo 1 1700000000\n"
+	if result := <-resultCh; result != resultExpected {
+		t.Fatalf("unexpected data received;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	if err := s.InitPushGraphite(context.Background(), "missing-port", time.Second, nil); err == nil {
+		t.Fatalf("expecting non-nil error for invalid addr")
+	}
+}
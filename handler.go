@@ -0,0 +1,505 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TextContentType is the Content-Type for the output generated by WritePrometheus.
+const TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// HandlerOptions is the options for Handler.
+type HandlerOptions struct {
+	// ExposeProcessMetrics enables exposing various `go_*` and `process_*` metrics for the current process.
+	//
+	// It is ignored by Set.Handler.
+	ExposeProcessMetrics bool
+
+	// DisableCompression disables gzip compression of responses.
+	//
+	// By default responses are gzip-compressed if the client sends `Accept-Encoding: gzip` request header.
+	DisableCompression bool
+
+	// BasicAuthUsername and BasicAuthPassword are credentials, which must be passed by clients via HTTP basic auth.
+	//
+	// Basic auth is disabled if BasicAuthUsername is empty.
+	BasicAuthUsername string
+	BasicAuthPassword string
+
+	// BearerToken is the token, which must be passed by clients via `Authorization: Bearer <token>` request header.
+	//
+	// Bearer token auth is disabled if BearerToken is empty.
+	BearerToken string
+
+	// Authorize is an optional callback, which must return true if the request r is allowed to read metrics.
+	Authorize func(r *http.Request) bool
+
+	// MaxConcurrentScrapes limits the number of concurrently generated responses.
+	//
+	// Requests exceeding the limit wait for a free slot during ScrapeTimeout or until the client cancels the request.
+	// Then they receive `503 Service Unavailable` response. There is no limit by default.
+	MaxConcurrentScrapes int
+
+	// ScrapeTimeout limits the duration of metrics generation.
+	//
+	// If metrics aren't generated in time, e.g. because of slow Gauge callbacks, then the handler stops waiting for them
+	// and returns the already generated metrics with `X-Metrics-Partial-Response: true` response header.
+	// Prometheus text exposition format responses additionally end with `# metrics: partial response` comment,
+	// while OpenMetrics responses miss the trailing `# EOF` line.
+	//
+	// Slow callbacks cannot be interrupted, so they continue running in background and occupy MaxConcurrentScrapes slots
+	// until they finish. There is no timeout by default.
+	ScrapeTimeout time.Duration
+}
+
+// isAuthEnabled returns true if at least a single auth method is configured in opts.
+func (opts *HandlerOptions) isAuthEnabled() bool {
+	return opts.BasicAuthUsername != "" || opts.BearerToken != "" || opts.Authorize != nil
+}
+
+// isAuthorized returns true if r passes at least a single auth method configured in opts.
+func (opts *HandlerOptions) isAuthorized(r *http.Request) bool {
+	if opts.BasicAuthUsername != "" {
+		username, password, ok := r.BasicAuth()
+		if ok && secureCompare(username, opts.BasicAuthUsername) && secureCompare(password, opts.BasicAuthPassword) {
+			return true
+		}
+	}
+	if opts.BearerToken != "" {
+		auth := r.Header.Get("Authorization")
+		if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") && secureCompare(auth[len("Bearer "):], opts.BearerToken) {
+			return true
+		}
+	}
+	if opts.Authorize != nil && opts.Authorize(r) {
+		return true
+	}
+	return false
+}
+
+// secureCompare compares a and b in constant time in order to prevent from timing attacks.
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Handler returns http.Handler, which serves metrics from the default set, all the registered sets and metrics writers.
+//
+// The exposition format is selected according to the Accept request header:
+//
+//   - Prometheus protobuf format is served if it is preferred by the client. See WritePrometheusProtobuf.
+//   - OpenMetrics text format is served if it is preferred by the client. See WriteOpenMetrics.
+//   - Prometheus text format is served otherwise. See WritePrometheus.
+//
+// This allows using a single endpoint for Prometheus, OpenTelemetry collector Prometheus receiver and vmagent.
+//
+// The response is gzip-compressed if the client accepts it, unless opts.DisableCompression is set.
+//
+// Only the requested metric families are served if `name[]` query args are passed, e.g. `/metrics?name[]=foo&name[]=bar`.
+// Metric families are matched by exact names by default. Pass `match=prefix` query arg in order to match them by name prefixes.
+// Metrics registered in sets are generated only if they belong to the requested metric families, so filtered scrapes
+// do not reset MaxGauge and MinGauge values for other metric families. This allows keeping heavyweight debug metrics
+// at the same endpoint, while scraping them only on demand. The output of callbacks registered via RegisterMetricsWriter
+// and process metrics is generated on every scrape and then filtered.
+//
+// Requests must be authorized if opts contain BasicAuthUsername, BearerToken or Authorize. A request is authorized
+// if it passes at least a single configured auth method. Unauthorized requests receive `401 Unauthorized` response.
+//
+// The handler exposes its own stats via `metrics_http_scrapes_total`, `metrics_http_scrape_errors_total`
+// and `metrics_http_scrape_duration_seconds` metrics at WriteProcessMetrics. Scrape errors include unauthorized requests,
+// requests with invalid query args and failed writes of the response to the client, e.g. because of client timeout.
+//
+// This eliminates the boilerplate code around WritePrometheus in the most cases:
+//
+//	http.Handle("/metrics", metrics.Handler(metrics.HandlerOptions{ExposeProcessMetrics: true}))
+func Handler(opts HandlerOptions) http.Handler {
+	exposeProcessMetrics := opts.ExposeProcessMetrics
+	writeText := func(w io.Writer, keep func(name string) bool) {
+		writeGlobalPrometheus(w, exposeProcessMetrics, keep)
+	}
+	writeOpenMetrics := func(w io.Writer, keep func(name string) bool) {
+		writeGlobalOpenMetrics(w, exposeProcessMetrics, keep)
+	}
+	writeProtobuf := func(w io.Writer, keep func(name string) bool) {
+		writeGlobalPrometheusProtobuf(w, exposeProcessMetrics, keep)
+	}
+	return newMetricsHandler(opts, writeText, writeOpenMetrics, writeProtobuf)
+}
+
+// Handler returns http.Handler, which serves metrics from s.
+//
+// The exposition format and the response compression are selected according to the request headers. See Handler for details.
+func (s *Set) Handler(opts HandlerOptions) http.Handler {
+	writeText := func(w io.Writer, keep func(name string) bool) {
+		s.writePrometheusFiltered(w, keep)
+	}
+	writeOpenMetrics := func(w io.Writer, keep func(name string) bool) {
+		var ow openMetricsWriter
+		s.addToOpenMetricsWriter(&ow, "", keep)
+		ow.writeTo(w)
+	}
+	writeProtobuf := func(w io.Writer, keep func(name string) bool) {
+		s.writePrometheusProtobuf(w, "", keep)
+	}
+	return newMetricsHandler(opts, writeText, writeOpenMetrics, writeProtobuf)
+}
+
+// newMetricsHandler returns metricsHandler with the given opts and metrics writers.
+//
+// Metrics writers must write only metrics, for which keep returns true, if keep isn't nil. See Set.writePrometheusFiltered.
+func newMetricsHandler(opts HandlerOptions, writeText, writeOpenMetrics, writeProtobuf func(w io.Writer, keep func(name string) bool)) *metricsHandler {
+	if opts.MaxConcurrentScrapes < 0 {
+		panic(fmt.Errorf("BUG: MaxConcurrentScrapes cannot be negative; got %d", opts.MaxConcurrentScrapes))
+	}
+	if opts.ScrapeTimeout < 0 {
+		panic(fmt.Errorf("BUG: ScrapeTimeout cannot be negative; got %s", opts.ScrapeTimeout))
+	}
+	var concurrencyCh chan struct{}
+	if opts.MaxConcurrentScrapes > 0 {
+		concurrencyCh = make(chan struct{}, opts.MaxConcurrentScrapes)
+	}
+	return &metricsHandler{
+		concurrencyCh:     concurrencyCh,
+		opts:              opts,
+		writeText:         writeText,
+		writeOpenMetrics:  writeOpenMetrics,
+		writeProtobuf:     writeProtobuf,
+		scrapesTotal:      handlerMetricsSet.GetOrCreateCounter("metrics_http_scrapes_total"),
+		scrapeErrorsTotal: handlerMetricsSet.GetOrCreateCounter("metrics_http_scrape_errors_total"),
+		scrapeDuration:    handlerMetricsSet.GetOrCreateHistogram("metrics_http_scrape_duration_seconds"),
+	}
+}
+
+type metricsHandler struct {
+	opts HandlerOptions
+
+	// concurrencyCh limits the number of concurrent scrapes. It is nil if the number of concurrent scrapes isn't limited.
+	concurrencyCh chan struct{}
+
+	writeText        func(w io.Writer, keep func(name string) bool)
+	writeOpenMetrics func(w io.Writer, keep func(name string) bool)
+	writeProtobuf    func(w io.Writer, keep func(name string) bool)
+
+	scrapesTotal      *Counter
+	scrapeErrorsTotal *Counter
+	scrapeDuration    *Histogram
+}
+
+func (mh *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	startTime := now()
+	mh.scrapesTotal.Inc()
+	if !mh.serveHTTP(w, r) {
+		mh.scrapeErrorsTotal.Inc()
+	}
+	mh.scrapeDuration.UpdateDuration(startTime)
+}
+
+// serveHTTP serves metrics to w. It returns false if the request cannot be served successfully.
+func (mh *metricsHandler) serveHTTP(w http.ResponseWriter, r *http.Request) bool {
+	if mh.opts.isAuthEnabled() && !mh.opts.isAuthorized(r) {
+		if mh.opts.BasicAuthUsername != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		} else if mh.opts.BearerToken != "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	ff, err := newFamilyFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if !mh.acquireScrapeSlot(r) {
+		http.Error(w, fmt.Sprintf("too many concurrent scrapes; the limit is %d", mh.opts.MaxConcurrentScrapes), http.StatusServiceUnavailable)
+		return false
+	}
+
+	var contentType string
+	var writeMetricsFiltered func(w io.Writer, keep func(name string) bool)
+	format := negotiateFormat(r.Header.Get("Accept"))
+	switch format {
+	case formatProtobuf:
+		contentType = ProtobufContentType
+		writeMetricsFiltered = mh.writeProtobuf
+	case formatOpenMetrics:
+		contentType = OpenMetricsContentType
+		writeMetricsFiltered = mh.writeOpenMetrics
+	default:
+		contentType = TextContentType
+		writeMetricsFiltered = mh.writeText
+	}
+	var keep func(name string) bool
+	if ff != nil {
+		// Skip non-matching metrics from sets before generating them, so they aren't calculated needlessly.
+		// The output is filtered below, since metrics writers and process metrics are written unconditionally.
+		keep = ff.keepMetric
+	}
+	writeMetrics := func(w io.Writer) {
+		writeMetricsFiltered(w, keep)
+	}
+
+	// Collect the response in a buffer, so slow clients do not slow down metrics generation.
+	bb := getBytesBuffer()
+	defer putBytesBuffer(bb)
+	isPartial := mh.collectMetrics(bb, writeMetrics, format)
+	if ff != nil {
+		bbTmp := getBytesBuffer()
+		bbTmp.B = append(bbTmp.B[:0], bb.B...)
+		if format == formatProtobuf {
+			bb.B = ff.filterProtobuf(bb.B[:0], bbTmp.B)
+		} else {
+			bb.B = ff.filterText(bb.B[:0], bbTmp.B)
+		}
+		putBytesBuffer(bbTmp)
+	}
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	if isPartial {
+		h.Set("X-Metrics-Partial-Response", "true")
+	}
+	h.Add("Vary", "Accept")
+	if !mh.opts.DisableCompression {
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			bbTmp := getBytesBuffer()
+			bbTmp.B = append(bbTmp.B[:0], bb.B...)
+			bb.B = bb.B[:0]
+			zw := getGzipWriter(bb)
+			if _, err := zw.Write(bbTmp.B); err != nil {
+				panic(fmt.Errorf("BUG: cannot write %d bytes to gzip writer: %s", len(bbTmp.B), err))
+			}
+			if err := zw.Close(); err != nil {
+				panic(fmt.Errorf("BUG: cannot flush metrics to gzip writer: %s", err))
+			}
+			putGzipWriter(zw)
+			putBytesBuffer(bbTmp)
+			h.Set("Content-Encoding", "gzip")
+		}
+	}
+	h.Set("Content-Length", strconv.Itoa(len(bb.B)))
+	if _, err := w.Write(bb.B); err != nil {
+		// The client closed the connection or timed out.
+		return false
+	}
+	return !isPartial
+}
+
+// acquireScrapeSlot waits for a free slot for concurrent scrape. It returns false if there are no free slots
+// during ScrapeTimeout or if the client cancels the request r.
+//
+// releaseScrapeSlot must be called when the scrape is finished if true is returned.
+func (mh *metricsHandler) acquireScrapeSlot(r *http.Request) bool {
+	if mh.concurrencyCh == nil {
+		return true
+	}
+	select {
+	case mh.concurrencyCh <- struct{}{}:
+		return true
+	default:
+	}
+	var timeoutCh <-chan time.Time
+	if mh.opts.ScrapeTimeout > 0 {
+		tickerCh, stop := getClock().NewTicker(mh.opts.ScrapeTimeout)
+		defer stop()
+		timeoutCh = tickerCh
+	}
+	select {
+	case mh.concurrencyCh <- struct{}{}:
+		return true
+	case <-r.Context().Done():
+		return false
+	case <-timeoutCh:
+		return false
+	}
+}
+
+func (mh *metricsHandler) releaseScrapeSlot() {
+	if mh.concurrencyCh != nil {
+		<-mh.concurrencyCh
+	}
+}
+
+// collectMetrics writes metrics to bb with writeMetrics and releases the scrape slot after that.
+//
+// It returns true if writeMetrics didn't finish during ScrapeTimeout. In this case bb contains partial response
+// in the given format.
+func (mh *metricsHandler) collectMetrics(bb *bytesBuffer, writeMetrics func(w io.Writer), format int) bool {
+	if mh.opts.ScrapeTimeout <= 0 {
+		writeMetrics(bb)
+		mh.releaseScrapeSlot()
+		return false
+	}
+
+	var sb scrapeBuffer
+	doneCh := make(chan struct{})
+	go func() {
+		writeMetrics(&sb)
+		mh.releaseScrapeSlot()
+		close(doneCh)
+	}()
+	tickerCh, stop := getClock().NewTicker(mh.opts.ScrapeTimeout)
+	defer stop()
+	isPartial := false
+	select {
+	case <-doneCh:
+	case <-tickerCh:
+		isPartial = true
+	}
+	bb.B = sb.finish(bb.B[:0])
+	if isPartial {
+		bb.B = truncatePartialResponse(bb.B, format)
+	}
+	return isPartial
+}
+
+// truncatePartialResponse removes the incomplete tail from data in the given format and returns the result.
+//
+// The partial response marker is appended to the result for Prometheus text exposition format.
+func truncatePartialResponse(data []byte, format int) []byte {
+	if format == formatProtobuf {
+		n := 0
+		for n < len(data) {
+			size, sizeLen := binary.Uvarint(data[n:])
+			if sizeLen <= 0 || size > uint64(len(data)-n-sizeLen) {
+				break
+			}
+			n += sizeLen + int(size)
+		}
+		return data[:n]
+	}
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	if format == formatText {
+		data = append(data, "# metrics: partial response\n"...)
+	}
+	return data
+}
+
+// scrapeBuffer collects metrics, which are written concurrently with the scrape timeout.
+type scrapeBuffer struct {
+	mu       sync.Mutex
+	b        []byte
+	finished bool
+}
+
+// Write implements io.Writer.
+//
+// The data is dropped after finish call.
+func (sb *scrapeBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	if !sb.finished {
+		sb.b = append(sb.b, p...)
+	}
+	sb.mu.Unlock()
+	return len(p), nil
+}
+
+// finish appends the data collected in sb to dst and returns the result. Subsequent writes to sb are dropped.
+func (sb *scrapeBuffer) finish(dst []byte) []byte {
+	sb.mu.Lock()
+	sb.finished = true
+	dst = append(dst, sb.b...)
+	sb.mu.Unlock()
+	return dst
+}
+
+var handlerMetricsSet = NewSet()
+
+func writeHandlerMetrics(w io.Writer) {
+	handlerMetricsSet.WritePrometheus(w)
+}
+
+// acceptsGzip returns true if the given Accept-Encoding header value allows gzip encoding.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			n := strings.IndexByte(param, '=')
+			if n < 0 || strings.ToLower(strings.TrimSpace(param[:n])) != "q" {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(param[n+1:]), 64)
+			if err == nil {
+				q = v
+			}
+		}
+		if q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Exposition formats, which can be served by Handler.
+const (
+	formatText = iota
+	formatOpenMetrics
+	formatProtobuf
+)
+
+// negotiateFormat returns exposition format for the given Accept header value.
+//
+// The format with the highest q-value is returned. The first format in the header wins if q-values are equal.
+func negotiateFormat(accept string) int {
+	format := formatText
+	bestQ := -1.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		proto := ""
+		encoding := ""
+		for _, param := range params[1:] {
+			n := strings.IndexByte(param, '=')
+			if n < 0 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(param[:n]))
+			value := strings.Trim(strings.TrimSpace(param[n+1:]), `"`)
+			switch key {
+			case "q":
+				v, err := strconv.ParseFloat(value, 64)
+				if err == nil {
+					q = v
+				}
+			case "proto":
+				proto = value
+			case "encoding":
+				encoding = value
+			}
+		}
+		var f int
+		switch mediaType {
+		case "application/vnd.google.protobuf":
+			if proto != "io.prometheus.client.MetricFamily" || encoding != "delimited" {
+				continue
+			}
+			f = formatProtobuf
+		case "application/openmetrics-text":
+			f = formatOpenMetrics
+		case "text/plain", "text/*", "*/*":
+			f = formatText
+		default:
+			continue
+		}
+		if q > bestQ && q > 0 {
+			format = f
+			bestQ = q
+		}
+	}
+	return format
+}
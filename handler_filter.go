@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// familyFilter selects metric families requested via `name[]` and `match` query args.
+type familyFilter struct {
+	names  []string
+	prefix bool
+}
+
+// newFamilyFilter returns filter for the given query args.
+//
+// nil is returned if query args do not contain `name[]`, so all the metric families must be exposed.
+func newFamilyFilter(args url.Values) (*familyFilter, error) {
+	names := args["name[]"]
+	prefix := false
+	switch match := args.Get("match"); match {
+	case "", "exact":
+	case "prefix":
+		prefix = true
+	default:
+		return nil, fmt.Errorf("unsupported match=%q; supported values: exact, prefix", match)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return &familyFilter{
+		names:  names,
+		prefix: prefix,
+	}, nil
+}
+
+// sampleSuffixes contains suffixes, which may be added to metric family name in sample names.
+var sampleSuffixes = []string{"_bucket", "_sum", "_count", "_total", "_created"}
+
+// matchName returns true if the metric family or sample with the given name must be exposed.
+func (ff *familyFilter) matchName(name string) bool {
+	for _, s := range ff.names {
+		if ff.prefix {
+			if strings.HasPrefix(name, s) {
+				return true
+			}
+			continue
+		}
+		if name == s {
+			return true
+		}
+		if strings.HasPrefix(name, s) {
+			suffix := name[len(s):]
+			for _, sampleSuffix := range sampleSuffixes {
+				if suffix == sampleSuffix {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// keepMetric returns true if the metric registered with the given name may belong to the matching metric families.
+//
+// It may return true for non-matching metrics, e.g. for summaries, since samples are filtered by filterText
+// and filterProtobuf after that.
+func (ff *familyFilter) keepMetric(name string) bool {
+	family := getMetricFamily(name)
+	if ff.matchName(family) {
+		return true
+	}
+	for _, s := range ff.names {
+		// Samples such as `foo_sum` and `foo_bucket` may be requested for `foo` summary or histogram.
+		if !strings.HasPrefix(s, family) {
+			continue
+		}
+		if ff.prefix {
+			return true
+		}
+		suffix := s[len(family):]
+		for _, sampleSuffix := range sampleSuffixes {
+			if suffix == sampleSuffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterText appends lines from src in Prometheus or OpenMetrics text exposition format to dst
+// if they belong to the matching metric families and returns the result.
+//
+// Comments other than `# HELP`, `# TYPE` and `# UNIT` such as `# EOF` are kept as is.
+func (ff *familyFilter) filterText(dst, src []byte) []byte {
+	visitLines(src, func(line []byte) {
+		s := string(line)
+		var name string
+		switch {
+		case bytes.HasPrefix(line, helpPrefixBytes) || bytes.HasPrefix(line, typePrefixBytes) || strings.HasPrefix(s, "# UNIT "):
+			name, _ = splitMetadataName(s[len("# HELP "):])
+		case bytes.HasPrefix(line, bashBytes):
+			dst = append(dst, line...)
+			dst = append(dst, '\n')
+			return
+		default:
+			name = getSampleName(s)
+		}
+		if ff.matchName(name) {
+			dst = append(dst, line...)
+			dst = append(dst, '\n')
+		}
+	})
+	return dst
+}
+
+// getSampleName returns metric name for the sample line s in Prometheus text exposition format.
+func getSampleName(s string) string {
+	if isQuotedMetricName(s) {
+		name, _, err := readQuotedString(s[1:])
+		if err != nil {
+			return ""
+		}
+		return name
+	}
+	n := strings.IndexAny(s, "{ ")
+	if n < 0 {
+		return s
+	}
+	return s[:n]
+}
+
+// filterProtobuf appends length-delimited MetricFamily messages from src to dst
+// if they belong to the matching metric families and returns the result.
+func (ff *familyFilter) filterProtobuf(dst, src []byte) []byte {
+	for len(src) > 0 {
+		size, n := binary.Uvarint(src)
+		if n <= 0 || size > uint64(len(src)-n) {
+			panic(fmt.Errorf("BUG: cannot read MetricFamily length from %d bytes", len(src)))
+		}
+		msg := src[:n+int(size)]
+		if ff.matchName(getProtobufFamilyName(msg[n:])) {
+			dst = append(dst, msg...)
+		}
+		src = src[len(msg):]
+	}
+	return dst
+}
+
+// getProtobufFamilyName returns the name field from the marshaled MetricFamily message.
+func getProtobufFamilyName(msg []byte) string {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return ""
+		}
+		msg = msg[n:]
+		switch tag & 7 {
+		case 0:
+			_, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return ""
+			}
+		case 1:
+			n = 8
+		case 2:
+			size, nLocal := binary.Uvarint(msg)
+			if nLocal <= 0 || size > uint64(len(msg)-nLocal) {
+				return ""
+			}
+			if tag>>3 == 1 {
+				return string(msg[nLocal : nLocal+int(size)])
+			}
+			n = nLocal + int(size)
+		case 5:
+			n = 4
+		default:
+			return ""
+		}
+		if n > len(msg) {
+			return ""
+		}
+		msg = msg[n:]
+	}
+	return ""
+}
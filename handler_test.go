@@ -0,0 +1,398 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	f := func(accept string, formatExpected int) {
+		t.Helper()
+		if format := negotiateFormat(accept); format != formatExpected {
+			t.Fatalf("unexpected format for Accept: %q; got %d; want %d", accept, format, formatExpected)
+		}
+	}
+	f("", formatText)
+	f("*/*", formatText)
+	f("text/plain", formatText)
+	f("application/json", formatText)
+	f("application/openmetrics-text; version=1.0.0", formatOpenMetrics)
+	f("application/vnd.google.protobuf", formatText)
+
+	// Prometheus Accept header
+	f("application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,"+
+		"application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.3,*/*;q=0.2", formatProtobuf)
+	f("application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.3,*/*;q=0.2", formatOpenMetrics)
+	f("text/plain;version=0.0.4;q=0.9,application/openmetrics-text;q=0.5", formatText)
+	f("application/openmetrics-text;q=0", formatText)
+}
+
+func TestSetHandler(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	h := s.Handler(HandlerOptions{})
+
+	f := func(accept, contentTypeExpected, bodyExpected string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if contentType := w.Header().Get("Content-Type"); contentType != contentTypeExpected {
+			t.Fatalf("unexpected Content-Type; got %q; want %q", contentType, contentTypeExpected)
+		}
+		if body := w.Body.String(); body != bodyExpected {
+			t.Fatalf("unexpected body;\ngot\n%q\nwant\n%q", body, bodyExpected)
+		}
+	}
+
+	f("", TextContentType, "foo_total 1\n")
+	f("application/openmetrics-text", OpenMetricsContentType, "# TYPE foo counter\nfoo_total 1\n# EOF\n")
+	f("application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited", ProtobufContentType,
+		"\x1a\n\tfoo_total\x18\x00\"\v\x1a\t\t\x00\x00\x00\x00\x00\x00\xf0?")
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	f := func(acceptEncoding string, resultExpected bool) {
+		t.Helper()
+		if result := acceptsGzip(acceptEncoding); result != resultExpected {
+			t.Fatalf("unexpected result for Accept-Encoding: %q; got %v; want %v", acceptEncoding, result, resultExpected)
+		}
+	}
+	f("", false)
+	f("identity", false)
+	f("br, deflate", false)
+	f("gzip", true)
+	f("GZIP", true)
+	f("deflate, gzip;q=0.5", true)
+	f("*", true)
+	f("gzip;q=0", false)
+}
+
+func TestSetHandlerGzip(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+
+	f := func(opts HandlerOptions, acceptEncoding, contentEncodingExpected string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		s.Handler(opts).ServeHTTP(w, r)
+		if contentEncoding := w.Header().Get("Content-Encoding"); contentEncoding != contentEncodingExpected {
+			t.Fatalf("unexpected Content-Encoding; got %q; want %q", contentEncoding, contentEncodingExpected)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != TextContentType {
+			t.Fatalf("unexpected Content-Type; got %q; want %q", contentType, TextContentType)
+		}
+		var body io.Reader = w.Body
+		if contentEncodingExpected == "gzip" {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("cannot open gzip reader: %s", err)
+			}
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("cannot read response body: %s", err)
+		}
+		if string(data) != "foo_total 1\n" {
+			t.Fatalf("unexpected body; got %q; want %q", data, "foo_total 1\n")
+		}
+	}
+
+	f(HandlerOptions{}, "", "")
+	f(HandlerOptions{}, "gzip", "gzip")
+	f(HandlerOptions{DisableCompression: true}, "gzip", "")
+}
+
+func TestSetHandlerFilter(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	s.NewGauge("foo_debug_size", func() float64 { return 2 })
+	s.NewHistogram(`bar{x="y"}`).Update(1)
+	s.NewCounter(`{"my.metric"}`).Inc()
+	h := s.Handler(HandlerOptions{})
+
+	f := func(query, accept string, statusCodeExpected int, bodyExpected string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+		if statusCodeExpected != http.StatusOK {
+			return
+		}
+		if body := w.Body.String(); body != bodyExpected {
+			t.Fatalf("unexpected body;\ngot\n%q\nwant\n%q", body, bodyExpected)
+		}
+	}
+
+	// exact match
+	f("name[]=foo_total", "", http.StatusOK, "foo_total 1\n")
+	f("name[]=foo_total&match=exact", "", http.StatusOK, "foo_total 1\n")
+	f("name[]=foo", "", http.StatusOK, "foo_total 1\n")
+	f("name[]=fo", "", http.StatusOK, "")
+	f("name[]=bar&name[]=my.metric", "", http.StatusOK, `bar_bucket{x="y",vmrange="8.799e-01...1.000e+00"} 1
+bar_sum{x="y"} 1
+bar_count{x="y"} 1
+{"my.metric"} 1
+`)
+
+	// prefix match
+	f("name[]=foo&match=prefix", "", http.StatusOK, "foo_debug_size 2\nfoo_total 1\n")
+	f("name[]=missing&match=prefix", "", http.StatusOK, "")
+
+	// OpenMetrics format
+	f("name[]=foo", "application/openmetrics-text", http.StatusOK, "# TYPE foo counter\nfoo_total 1\n# EOF\n")
+
+	// protobuf format
+	f("name[]=foo_total", "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited",
+		http.StatusOK, "\x1a\n\tfoo_total\x18\x00\"\v\x1a\t\t\x00\x00\x00\x00\x00\x00\xf0?")
+
+	// invalid match
+	f("name[]=foo&match=regexp", "", http.StatusBadRequest, "")
+}
+
+func TestFamilyFilterKeepMetric(t *testing.T) {
+	f := func(query, name string, resultExpected bool) {
+		t.Helper()
+		args, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("cannot parse query: %s", err)
+		}
+		ff, err := newFamilyFilter(args)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := ff.keepMetric(name); result != resultExpected {
+			t.Fatalf("unexpected result for keepMetric(%q) with %q; got %v; want %v", name, query, result, resultExpected)
+		}
+	}
+
+	f("name[]=foo", "foo", true)
+	f("name[]=foo", `foo_total{bar="baz"}`, true)
+	f("name[]=foo", "foobar", false)
+	f("name[]=foo_sum", `foo{bar="baz"}`, true)
+	f("name[]=foo_bar", "foo", false)
+	f("name[]=my.metric", `{"my.metric",bar="baz"}`, true)
+
+	f("name[]=foo&match=prefix", "foobar", true)
+	f("name[]=foo_s&match=prefix", "foo", true)
+	f("name[]=foo&match=prefix", "bar", false)
+}
+
+func TestHandlerFilterSkipsMetrics(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	mg := s.NewMaxGauge("bar_max")
+	debugCalls := 0
+	s.NewGauge("debug_size", func() float64 {
+		debugCalls++
+		return 1
+	})
+	RegisterSetExt(s, &RegisterSetOpts{
+		Prefix: "app_",
+	})
+	defer UnregisterSet(s, false)
+
+	handlers := []http.Handler{
+		s.Handler(HandlerOptions{}),
+		Handler(HandlerOptions{}),
+	}
+	for _, h := range handlers {
+		for _, accept := range []string{"", "application/openmetrics-text", ProtobufContentType} {
+			mg.Update(10)
+			r := httptest.NewRequest(http.MethodGet, "/metrics?name[]=foo&name[]=app_foo", nil)
+			r.Header.Set("Accept", accept)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			// Non-matching metrics must not be generated
+			if debugCalls != 0 {
+				t.Fatalf("unexpected calls for the callback of non-matching gauge for Accept=%q: %d", accept, debugCalls)
+			}
+			if v := mg.Get(); v != 10 {
+				t.Fatalf("unexpected MaxGauge value after filtered scrape for Accept=%q; got %v; want 10", accept, v)
+			}
+		}
+	}
+}
+
+func TestSetHandlerAuth(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+
+	f := func(opts HandlerOptions, setAuth func(r *http.Request), statusCodeExpected int, wwwAuthenticateExpected string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if setAuth != nil {
+			setAuth(r)
+		}
+		w := httptest.NewRecorder()
+		s.Handler(opts).ServeHTTP(w, r)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+		if v := w.Header().Get("WWW-Authenticate"); v != wwwAuthenticateExpected {
+			t.Fatalf("unexpected WWW-Authenticate header; got %q; want %q", v, wwwAuthenticateExpected)
+		}
+	}
+	basicAuth := func(username, password string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.SetBasicAuth(username, password)
+		}
+	}
+	bearerToken := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	// auth is disabled
+	f(HandlerOptions{}, nil, http.StatusOK, "")
+
+	// basic auth
+	basicOpts := HandlerOptions{
+		BasicAuthUsername: "user",
+		BasicAuthPassword: "pass",
+	}
+	f(basicOpts, nil, http.StatusUnauthorized, `Basic realm="metrics"`)
+	f(basicOpts, basicAuth("user", "bad"), http.StatusUnauthorized, `Basic realm="metrics"`)
+	f(basicOpts, basicAuth("user", "pass"), http.StatusOK, "")
+
+	// bearer token
+	bearerOpts := HandlerOptions{
+		BearerToken: "secret",
+	}
+	f(bearerOpts, nil, http.StatusUnauthorized, `Bearer realm="metrics"`)
+	f(bearerOpts, bearerToken("bad"), http.StatusUnauthorized, `Bearer realm="metrics"`)
+	f(bearerOpts, bearerToken("secret"), http.StatusOK, "")
+
+	// authorize callback
+	authorizeOpts := HandlerOptions{
+		Authorize: func(r *http.Request) bool {
+			return r.Header.Get("X-Scraper") == "ok"
+		},
+	}
+	f(authorizeOpts, nil, http.StatusUnauthorized, "")
+	f(authorizeOpts, func(r *http.Request) {
+		r.Header.Set("X-Scraper", "ok")
+	}, http.StatusOK, "")
+
+	// any of the configured auth methods is enough
+	allOpts := HandlerOptions{
+		BasicAuthUsername: "user",
+		BasicAuthPassword: "pass",
+		BearerToken:       "secret",
+	}
+	f(allOpts, basicAuth("user", "pass"), http.StatusOK, "")
+	f(allOpts, bearerToken("secret"), http.StatusOK, "")
+	f(allOpts, bearerToken("pass"), http.StatusUnauthorized, `Basic realm="metrics"`)
+}
+
+func TestHandlerSelfMetrics(t *testing.T) {
+	s := NewSet()
+	h := s.Handler(HandlerOptions{
+		BearerToken: "secret",
+	})
+	scrapesTotal := handlerMetricsSet.GetOrCreateCounter("metrics_http_scrapes_total")
+	scrapeErrorsTotal := handlerMetricsSet.GetOrCreateCounter("metrics_http_scrape_errors_total")
+	scrapesStart := scrapesTotal.Get()
+	errorsStart := scrapeErrorsTotal.Get()
+
+	serve := func(token string) {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	serve("secret")
+	serve("bad")
+	serve("secret")
+
+	if n := scrapesTotal.Get() - scrapesStart; n != 3 {
+		t.Fatalf("unexpected number of scrapes; got %d; want 3", n)
+	}
+	if n := scrapeErrorsTotal.Get() - errorsStart; n != 1 {
+		t.Fatalf("unexpected number of scrape errors; got %d; want 1", n)
+	}
+
+	var bb bytes.Buffer
+	WriteProcessMetrics(&bb)
+	for _, name := range []string{"metrics_http_scrapes_total ", "metrics_http_scrape_errors_total ", "metrics_http_scrape_duration_seconds_count "} {
+		if !strings.Contains(bb.String(), "\n"+name) {
+			t.Fatalf("missing %q in the output of WriteProcessMetrics:\n%s", name, bb.String())
+		}
+	}
+}
+
+func TestSetHandlerScrapeTimeout(t *testing.T) {
+	s := NewSet()
+	unblockCh := make(chan struct{})
+	s.NewGauge("slow_gauge", func() float64 {
+		<-unblockCh
+		return 1
+	})
+	h := s.Handler(HandlerOptions{
+		MaxConcurrentScrapes: 1,
+		ScrapeTimeout:        50 * time.Millisecond,
+	})
+
+	f := func(statusCodeExpected int, isPartialExpected bool, bodyExpected string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+		}
+		if isPartial := w.Header().Get("X-Metrics-Partial-Response") == "true"; isPartial != isPartialExpected {
+			t.Fatalf("unexpected partial response marker; got %v; want %v", isPartial, isPartialExpected)
+		}
+		if statusCodeExpected != http.StatusOK {
+			return
+		}
+		if body := w.Body.String(); body != bodyExpected {
+			t.Fatalf("unexpected body;\ngot\n%q\nwant\n%q", body, bodyExpected)
+		}
+	}
+
+	// The slow callback exceeds the scrape timeout.
+	f(http.StatusOK, true, "# metrics: partial response\n")
+
+	// The slow callback still occupies the only scrape slot.
+	f(http.StatusServiceUnavailable, false, "")
+
+	// The slot is released after the slow callback finishes.
+	close(unblockCh)
+	f(http.StatusOK, false, "slow_gauge 1\n")
+}
+
+func TestTruncatePartialResponse(t *testing.T) {
+	f := func(data string, format int, resultExpected string) {
+		t.Helper()
+		result := truncatePartialResponse([]byte(data), format)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%q\nwant\n%q", result, resultExpected)
+		}
+	}
+	f("", formatText, "# metrics: partial response\n")
+	f("foo 1\nbar", formatText, "foo 1\n# metrics: partial response\n")
+	f("# TYPE foo gauge\nfoo 1\nba", formatOpenMetrics, "# TYPE foo gauge\nfoo 1\n")
+	f("\x02ab\x03cd", formatProtobuf, "\x02ab")
+	f("\x02ab\x80", formatProtobuf, "\x02ab")
+}
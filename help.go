@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SetHelp sets help text for the metric family with the given name in the default set.
+//
+// See Set.SetHelp for details.
+func SetHelp(name, help string) {
+	defaultSet().SetHelp(name, help)
+}
+
+// SetHelp sets help text for the metric family with the given name in s.
+//
+// name may contain labels - they are ignored, since help text is shared among all the metrics in the family.
+// The help text is exposed in `# HELP` lines when metadata exposition is enabled via ExposeMetadata(true).
+// It may be set before or after the registration of the metrics in the family.
+// Pass empty help in order to remove the help text for the given name.
+func (s *Set) SetHelp(name, help string) {
+	if err := validateMetric(name); err != nil {
+		panic(fmt.Errorf("BUG: invalid metric name %q: %s", name, err))
+	}
+	family := getMetricFamily(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copy s.help on modification, so it can be read without locks by the writers.
+	m := make(map[string]string, len(s.help)+1)
+	for k, v := range s.help {
+		m[k] = v
+	}
+	if help == "" {
+		delete(m, family)
+	} else {
+		m[family] = help
+	}
+	s.help = m
+}
+
+// getHelp returns help texts for metric families in s.
+//
+// The returned map mustn't be modified.
+func (s *Set) getHelp() map[string]string {
+	s.mu.Lock()
+	m := s.help
+	s.mu.Unlock()
+	return m
+}
+
+// writeMetadataIfNeeded writes HELP and TYPE metadata with the given help text for the given metricName and metricType
+// if this is enabled for w. See isMetadataEnabledFor.
+func writeMetadataIfNeeded(w io.Writer, metricName, metricType, help string) {
+	if !isMetadataEnabledFor(w) {
+		return
+	}
+	metricFamily := getMetricFamily(metricName)
+	if help == "" {
+		fmt.Fprintf(w, "# HELP %s\n", metricFamily)
+	} else {
+		fmt.Fprintf(w, "# HELP %s %s\n", metricFamily, helpEscaper.Replace(help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", metricFamily, metricType)
+}
+
+// helpEscaper escapes help text according to Prometheus text exposition format.
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetSetHelp(t *testing.T) {
+	s := NewSet()
+	s.SetHelp("requests_total", "The total number of requests")
+	s.NewCounter(`requests_total{path="/foo"}`).Add(1)
+	s.NewCounter(`requests_total{path="/bar"}`).Add(2)
+	s.NewGauge("temperature", nil).Set(3)
+	s.SetHelp(`temperature{room="a"}`, "Temperature in \\degrees\nCelsius")
+	s.NewGauge("queue_size", nil).Set(4)
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheusWithOptions(&bb, &WriteOptions{
+			ExposeMetadata: true,
+		})
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(`# HELP queue_size
+# TYPE queue_size gauge
+queue_size 4
+# HELP requests_total The total number of requests
+# TYPE requests_total counter
+requests_total{path="/bar"} 2
+requests_total{path="/foo"} 1
+# HELP temperature Temperature in \\degrees\nCelsius
+# TYPE temperature gauge
+temperature 3
+`)
+
+	// Remove help
+	s.SetHelp("temperature", "")
+	f(`# HELP queue_size
+# TYPE queue_size gauge
+queue_size 4
+# HELP requests_total The total number of requests
+# TYPE requests_total counter
+requests_total{path="/bar"} 2
+requests_total{path="/foo"} 1
+# HELP temperature
+# TYPE temperature gauge
+temperature 3
+`)
+
+	expectPanic(t, "SetHelp(invalid name)", func() { s.SetHelp("foo{", "bar") })
+}
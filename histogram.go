@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -63,10 +65,44 @@ type Histogram struct {
 
 	// sum is the sum of all the values put into Histogram
 	sum float64
+
+	// exportedBucketsPerDecimal is the number of exported buckets per decimal.
+	//
+	// Zero value means bucketsPerDecimal. See HistogramOpts.BucketsPerDecimal.
+	exportedBucketsPerDecimal int
+
+	accessTracker
+}
+
+// HistogramOpts contains options for NewHistogramExt.
+type HistogramOpts struct {
+	// BucketsPerDecimal is the number of exported buckets per each decimal range such as [1..10], [10..100], etc.
+	//
+	// It must be a divisor of 18: 1, 2, 3, 6, 9 or 18.
+	// Smaller values result in fewer exported series at the cost of lower accuracy.
+	// Buckets with smaller BucketsPerDecimal are aligned with the default buckets,
+	// so they can be aggregated with histograms with the default resolution.
+	//
+	// By default 18 buckets per decimal are exported.
+	BucketsPerDecimal int
+}
+
+func newHistogram(opts *HistogramOpts) *Histogram {
+	h := &Histogram{}
+	if opts == nil || opts.BucketsPerDecimal == 0 {
+		return h
+	}
+	n := opts.BucketsPerDecimal
+	if n < 0 || bucketsPerDecimal%n != 0 {
+		panic(fmt.Errorf("BUG: BucketsPerDecimal must be a divisor of %d; got %d", bucketsPerDecimal, n))
+	}
+	h.exportedBucketsPerDecimal = n
+	return h
 }
 
 // Reset resets the given histogram.
 func (h *Histogram) Reset() {
+	h.markAccessed()
 	h.mu.Lock()
 	for _, db := range h.decimalBuckets[:] {
 		if db == nil {
@@ -86,6 +122,7 @@ func (h *Histogram) Reset() {
 //
 // Negative values and NaNs are ignored.
 func (h *Histogram) Update(v float64) {
+	h.markAccessed()
 	if math.IsNaN(v) || v < 0 {
 		// Skip NaNs and negative values.
 		return
@@ -117,19 +154,67 @@ func (h *Histogram) Update(v float64) {
 	h.mu.Unlock()
 }
 
-// Merge merges src to h
+// Merge merges src to h.
+//
+// It merges decimal buckets, lower and upper buckets and sum from src into h.
+// This allows aggregating per-worker histograms into a single histogram before the exposition.
+//
+// It is safe calling Merge concurrently with updating both h and src.
 func (h *Histogram) Merge(src *Histogram) {
+	h.markAccessed()
+	// Make a copy of src under its lock and then merge it into h under h lock.
+	// This prevents from deadlock when h.Merge(src) and src.Merge(h) are called concurrently
+	// or when h is merged into itself.
+	h.mergeCopy(src.getCopy(false))
+}
+
+// mergeAndReset merges src to h and resets src.
+//
+// src is reset atomically with obtaining its state, so concurrent updates to src aren't lost.
+func (h *Histogram) mergeAndReset(src *Histogram) {
+	h.markAccessed()
+	h.mergeCopy(src.getCopy(true))
+}
+
+// getCopy returns a copy of h. h is reset if reset is set.
+func (h *Histogram) getCopy(reset bool) *Histogram {
+	var hCopy Histogram
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	hCopy.lower = h.lower
+	hCopy.upper = h.upper
+	hCopy.sum = h.sum
+	for i, db := range h.decimalBuckets[:] {
+		if db == nil {
+			continue
+		}
+		if reset {
+			// Move the buckets to the copy instead of copying them, since h is reset.
+			hCopy.decimalBuckets[i] = db
+			h.decimalBuckets[i] = nil
+			continue
+		}
+		dbCopy := *db
+		hCopy.decimalBuckets[i] = &dbCopy
+	}
+	if reset {
+		h.lower = 0
+		h.upper = 0
+		h.sum = 0
+	}
+	h.mu.Unlock()
+	return &hCopy
+}
 
-	src.mu.Lock()
-	defer src.mu.Unlock()
+// mergeCopy merges srcCopy obtained via getCopy to h.
+func (h *Histogram) mergeCopy(srcCopy *Histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	h.lower += src.lower
-	h.upper += src.upper
-	h.sum += src.sum
+	h.lower += srcCopy.lower
+	h.upper += srcCopy.upper
+	h.sum += srcCopy.sum
 
-	for i, dbSrc := range src.decimalBuckets {
+	for i, dbSrc := range srcCopy.decimalBuckets[:] {
 		if dbSrc == nil {
 			continue
 		}
@@ -151,8 +236,14 @@ func (h *Histogram) Merge(src *Histogram) {
 // isn't included in the bucket, while the upper bound is included.
 // This is required to be compatible with Prometheus-style histogram buckets
 // with `le` (less or equal) labels.
+//
+// The number of buckets per decimal depends on HistogramOpts.BucketsPerDecimal passed to NewHistogramExt.
 func (h *Histogram) VisitNonZeroBuckets(f func(vmrange string, count uint64)) {
 	h.mu.Lock()
+	step := 1
+	if h.exportedBucketsPerDecimal > 0 {
+		step = bucketsPerDecimal / h.exportedBucketsPerDecimal
+	}
 	if h.lower > 0 {
 		f(lowerBucketRange, h.lower)
 	}
@@ -160,10 +251,14 @@ func (h *Histogram) VisitNonZeroBuckets(f func(vmrange string, count uint64)) {
 		if db == nil {
 			continue
 		}
-		for offset, count := range db[:] {
+		for offset := 0; offset < bucketsPerDecimal; offset += step {
+			count := uint64(0)
+			for _, n := range db[offset : offset+step] {
+				count += n
+			}
 			if count > 0 {
 				bucketIdx := decimalBucketIdx*bucketsPerDecimal + offset
-				vmrange := getVMRange(bucketIdx)
+				vmrange := getVMRangeExt(bucketIdx, step)
 				f(vmrange, count)
 			}
 		}
@@ -174,6 +269,56 @@ func (h *Histogram) VisitNonZeroBuckets(f func(vmrange string, count uint64)) {
 	h.mu.Unlock()
 }
 
+// Quantile returns an estimated value for the given quantile phi over all the values passed to h.
+//
+// phi must be in the range [0..1]. The value is estimated with linear interpolation
+// inside the bucket containing the quantile, so the relative error doesn't exceed
+// the bucket width, e.g. 13.6% for the default buckets.
+// Values outside the range [10^-9..10^18] are estimated as the corresponding range bound.
+//
+// NaN is returned if h is empty.
+func (h *Histogram) Quantile(phi float64) float64 {
+	validateQuantiles([]float64{phi})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	total := h.lower + h.upper
+	for _, db := range h.decimalBuckets[:] {
+		if db == nil {
+			continue
+		}
+		for _, count := range db[:] {
+			total += count
+		}
+	}
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := phi * float64(total)
+	if h.lower > 0 && rank <= float64(h.lower) {
+		return math.Pow10(e10Min)
+	}
+	n := h.lower
+	for decimalBucketIdx, db := range h.decimalBuckets[:] {
+		if db == nil {
+			continue
+		}
+		for offset, count := range db[:] {
+			if count == 0 {
+				continue
+			}
+			if float64(n+count) >= rank {
+				bucketIdx := decimalBucketIdx*bucketsPerDecimal + offset
+				start := math.Pow(10, e10Min+float64(bucketIdx)/bucketsPerDecimal)
+				end := start * bucketMultiplier
+				return start + (end-start)*(rank-float64(n))/float64(count)
+			}
+			n += count
+		}
+	}
+	return math.Pow10(e10Max)
+}
+
 // NewHistogram creates and returns new histogram with the given name.
 //
 // name must be valid Prometheus-compatible metric with possible labels.
@@ -185,7 +330,23 @@ func (h *Histogram) VisitNonZeroBuckets(f func(vmrange string, count uint64)) {
 //
 // The returned histogram is safe to use from concurrent goroutines.
 func NewHistogram(name string) *Histogram {
-	return defaultSet.NewHistogram(name)
+	return defaultSet().NewHistogram(name)
+}
+
+// NewHistogramExt creates and returns new histogram with the given name and opts.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// opts may contain additional configuration options if non-nil.
+//
+// The returned histogram is safe to use from concurrent goroutines.
+func NewHistogramExt(name string, opts *HistogramOpts) *Histogram {
+	return defaultSet().NewHistogramExt(name, opts)
 }
 
 // GetOrCreateHistogram returns registered histogram with the given name
@@ -203,12 +364,48 @@ func NewHistogram(name string) *Histogram {
 //
 // Performance tip: prefer NewHistogram instead of GetOrCreateHistogram.
 func GetOrCreateHistogram(name string) *Histogram {
-	return defaultSet.GetOrCreateHistogram(name)
+	return defaultSet().GetOrCreateHistogram(name)
+}
+
+// NewHistogramVec creates and returns new HistogramVec with the given name and labelNames.
+//
+// name must be valid Prometheus-compatible metric name without labels.
+//
+// The returned HistogramVec is safe to use from concurrent goroutines.
+func NewHistogramVec(name string, labelNames []string) *HistogramVec {
+	return defaultSet().NewHistogramVec(name, labelNames)
+}
+
+// HistogramVec is a set of histograms with the same name partitioned by label values.
+//
+// Histograms for the given label values are created on the first access
+// and are cached in HistogramVec, so subsequent accesses do not need
+// constructing metric name and looking it up in the Set.
+type HistogramVec struct {
+	mv *metricVec
+}
+
+// WithLabelValues returns histogram for the given labelValues.
+//
+// The number of labelValues must match the number of label names passed to NewHistogramVec.
+func (hv *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	m := hv.mv.getOrCreate(labelValues, func(name string) metric {
+		return hv.mv.s.GetOrCreateHistogram(name)
+	})
+	return m.(*Histogram)
+}
+
+// DeleteLabelValues unregisters histogram for the given labelValues.
+//
+// True is returned if the histogram has been removed.
+// False is returned if there is no histogram for the given labelValues.
+func (hv *HistogramVec) DeleteLabelValues(labelValues ...string) bool {
+	return hv.mv.deleteLabelValues(labelValues)
 }
 
 // UpdateDuration updates request duration based on the given startTime.
 func (h *Histogram) UpdateDuration(startTime time.Time) {
-	d := time.Since(startTime).Seconds()
+	d := since(startTime).Seconds()
 	h.Update(d)
 }
 
@@ -217,6 +414,16 @@ func getVMRange(bucketIdx int) string {
 	return bucketRanges[bucketIdx]
 }
 
+// getVMRangeExt returns vmrange for n adjacent buckets starting from bucketIdx.
+func getVMRangeExt(bucketIdx, n int) string {
+	if n == 1 {
+		return getVMRange(bucketIdx)
+	}
+	start := getVMRange(bucketIdx)
+	end := getVMRange(bucketIdx + n - 1)
+	return start[:strings.Index(start, "...")] + end[strings.Index(end, "..."):]
+}
+
 func initBucketRanges() {
 	v := math.Pow10(e10Min)
 	start := fmt.Sprintf("%.3e", v)
@@ -268,3 +475,34 @@ func (h *Histogram) getSum() float64 {
 func (h *Histogram) metricType() string {
 	return "histogram"
 }
+
+func (h *Histogram) protobufType() uint64 {
+	return protobufTypeHistogram
+}
+
+// marshalProtobuf appends io.prometheus.client.Histogram message for h to dst.
+//
+// vmrange buckets are converted to cumulative buckets with upper bounds in the same way as for OpenMetrics output.
+// dst is returned unchanged if h is empty.
+func (h *Histogram) marshalProtobuf(dst []byte) []byte {
+	var buckets, b []byte
+	cumulativeCount := uint64(0)
+	h.VisitNonZeroBuckets(func(vmrange string, count uint64) {
+		cumulativeCount += count
+		upperBound, err := strconv.ParseFloat(vmrange[strings.Index(vmrange, "...")+len("..."):], 64)
+		if err != nil {
+			panic(fmt.Errorf("BUG: cannot parse upper bound for vmrange %q: %s", vmrange, err))
+		}
+		b = appendProtobufVarint(b[:0], 1, cumulativeCount)
+		b = appendProtobufDouble(b, 2, upperBound)
+		buckets = appendProtobufMessage(buckets, 3, b)
+	})
+	if cumulativeCount == 0 {
+		return dst
+	}
+	var hp []byte
+	hp = appendProtobufVarint(hp, 1, cumulativeCount)
+	hp = appendProtobufDouble(hp, 2, h.getSum())
+	hp = append(hp, buckets...)
+	return appendProtobufMessage(dst, 7, hp)
+}
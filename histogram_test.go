@@ -39,6 +39,121 @@ prefix_count 240
 `)
 }
 
+func TestHistogramMergeOutliers(t *testing.T) {
+	var h, src Histogram
+	h.Update(0)
+	src.Update(1e-20)
+	src.Update(1e30)
+	src.Update(2)
+	h.Merge(&src)
+
+	// Merging histogram into itself must double its counters.
+	h.Merge(&h)
+
+	testMarshalTo(t, &h, "prefix", `prefix_bucket{vmrange="0...1.000e-09"} 4
+prefix_bucket{vmrange="1.896e+00...2.154e+00"} 2
+prefix_bucket{vmrange="1.000e+18...+Inf"} 2
+prefix_sum 2e+30
+prefix_count 8
+`)
+
+	// Source histogram must remain unchanged.
+	testMarshalTo(t, &src, "src", `src_bucket{vmrange="0...1.000e-09"} 1
+src_bucket{vmrange="1.896e+00...2.154e+00"} 1
+src_bucket{vmrange="1.000e+18...+Inf"} 1
+src_sum 1e+30
+src_count 3
+`)
+}
+
+func TestHistogramMergeConcurrent(t *testing.T) {
+	var a, b Histogram
+	a.Update(1)
+	b.Update(1)
+	err := testConcurrent(func() error {
+		for i := 0; i < 100; i++ {
+			a.Merge(&b)
+			b.Merge(&a)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistogramExt(t *testing.T) {
+	s := NewSet()
+	h := s.NewHistogramExt("foo", &HistogramOpts{
+		BucketsPerDecimal: 3,
+	})
+	for i := 98; i < 218; i++ {
+		h.Update(float64(i))
+	}
+	testMarshalTo(t, h, "prefix", `prefix_bucket{vmrange="4.642e+01...1.000e+02"} 3
+prefix_bucket{vmrange="1.000e+02...2.154e+02"} 115
+prefix_bucket{vmrange="2.154e+02...4.642e+02"} 2
+prefix_sum 18900
+prefix_count 120
+`)
+
+	// A single bucket per decimal
+	h = s.NewHistogramExt("bar", &HistogramOpts{
+		BucketsPerDecimal: 1,
+	})
+	h.Update(5)
+	h.Update(10)
+	h.Update(11)
+	testMarshalTo(t, h, "prefix", `prefix_bucket{vmrange="1.000e+00...1.000e+01"} 2
+prefix_bucket{vmrange="1.000e+01...1.000e+02"} 1
+prefix_sum 26
+prefix_count 3
+`)
+
+	expectPanic(t, "NewHistogramExt_invalid_buckets_per_decimal", func() {
+		s.NewHistogramExt("baz", &HistogramOpts{
+			BucketsPerDecimal: 4,
+		})
+	})
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var h Histogram
+	if q := h.Quantile(0.5); !math.IsNaN(q) {
+		t.Fatalf("unexpected quantile for empty histogram; got %v; want NaN", q)
+	}
+	expectPanic(t, "Quantile(-1)", func() { h.Quantile(-1) })
+	expectPanic(t, "Quantile(1.1)", func() { h.Quantile(1.1) })
+
+	for i := 1; i <= 1000; i++ {
+		h.Update(float64(i))
+	}
+	f := func(phi, qExpected float64) {
+		t.Helper()
+		q := h.Quantile(phi)
+		if math.Abs(q-qExpected) > qExpected*0.136 {
+			t.Fatalf("unexpected quantile %v; got %v; want %v", phi, q, qExpected)
+		}
+	}
+	f(0, 1)
+	f(0.1, 100)
+	f(0.5, 500)
+	f(0.9, 900)
+	f(0.99, 990)
+	f(1, 1000)
+
+	// Values outside the supported range
+	h.Reset()
+	h.Update(1e-12)
+	h.Update(1e20)
+	if q := h.Quantile(0); q != 1e-9 {
+		t.Fatalf("unexpected quantile for the lower bucket; got %v; want 1e-9", q)
+	}
+	if q := h.Quantile(1); q != 1e18 {
+		t.Fatalf("unexpected quantile for the upper bucket; got %v; want 1e18", q)
+	}
+}
+
 func TestGetVMRange(t *testing.T) {
 	f := func(bucketIdx int, vmrangeExpected string) {
 		t.Helper()
@@ -227,3 +342,34 @@ func testGetOrCreateHistogram(name string) error {
 	}
 	return nil
 }
+
+func TestHistogramVec(t *testing.T) {
+	s := NewSet()
+	hv := s.NewHistogramVec("request_duration_seconds", []string{"path"})
+	h := hv.WithLabelValues("/foo")
+	h.Update(123)
+	if h2 := hv.WithLabelValues("/foo"); h2 != h {
+		t.Fatalf("WithLabelValues must return the same histogram for the same label values")
+	}
+	if h2 := s.GetOrCreateHistogram(`request_duration_seconds{path="/foo"}`); h2 != h {
+		t.Fatalf("HistogramVec must register histograms in the Set")
+	}
+
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	result := bb.String()
+	resultExpected := `request_duration_seconds_bucket{path="/foo",vmrange="1.136e+02...1.292e+02"} 1
+request_duration_seconds_sum{path="/foo"} 123
+request_duration_seconds_count{path="/foo"} 1
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	if !hv.DeleteLabelValues("/foo") {
+		t.Fatalf("DeleteLabelValues must return true for existing histogram")
+	}
+	if mns := s.ListMetricNames(); len(mns) != 0 {
+		t.Fatalf("unexpected metrics after DeleteLabelValues: %q", mns)
+	}
+}
@@ -15,3 +15,16 @@ func BenchmarkHistogramUpdate(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkHistogramVecUpdate(b *testing.B) {
+	s := NewSet()
+	hv := s.NewHistogramVec("BenchmarkHistogramVecUpdate", []string{"path", "method"})
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			hv.WithLabelValues("/foo/bar", "GET").Update(float64(i))
+			i++
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package metrics
+
+// OnRegister registers f callback, which is called with the metric name after every metric registration in s.
+//
+// The callback is called for metrics registered after the OnRegister call. It isn't called for auxiliary metrics
+// such as summary quantiles. This allows logging, auditing or mirroring registrations into a secondary system.
+//
+// f is called without holding s locks, so it may access s. f must be safe for concurrent calls.
+// It is OK to register multiple callbacks - they are called sequentially in the registration order.
+func (s *Set) OnRegister(f func(name string)) {
+	s.mu.Lock()
+	s.registerHooks = append(s.registerHooks, f)
+	s.mu.Unlock()
+}
+
+// OnUnregister registers f callback, which is called with the metric name after every metric unregistration in s.
+//
+// The callback is called for metrics unregistered via UnregisterMetric, UnregisterAllMetrics, RenameMetric
+// or due to idle metric expiration configured via SetMetricTTL.
+//
+// f is called without holding s locks, so it may access s. f must be safe for concurrent calls.
+// It is OK to register multiple callbacks - they are called sequentially in the registration order.
+func (s *Set) OnUnregister(f func(name string)) {
+	s.mu.Lock()
+	s.unregisterHooks = append(s.unregisterHooks, f)
+	s.mu.Unlock()
+}
+
+// notifyRegister calls callbacks registered via OnRegister for the given name.
+//
+// It must be called without holding s.mu.
+func (s *Set) notifyRegister(name string) {
+	s.mu.Lock()
+	hooks := s.registerHooks
+	s.mu.Unlock()
+	for _, f := range hooks {
+		f(name)
+	}
+}
+
+// notifyUnregister calls callbacks registered via OnUnregister for the given name.
+//
+// It must be called without holding s.mu.
+func (s *Set) notifyUnregister(name string) {
+	s.mu.Lock()
+	hooks := s.unregisterHooks
+	s.mu.Unlock()
+	for _, f := range hooks {
+		f(name)
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSetRegistrationHooks(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("before_hooks_total")
+
+	var mu sync.Mutex
+	var events []string
+	s.OnRegister(func(name string) {
+		// Make sure the callback can access s.
+		s.ListMetricNames()
+		mu.Lock()
+		events = append(events, "register "+name)
+		mu.Unlock()
+	})
+	s.OnUnregister(func(name string) {
+		mu.Lock()
+		events = append(events, "unregister "+name)
+		mu.Unlock()
+	})
+
+	s.NewCounter("foo_total")
+	s.GetOrCreateGauge("bar", nil)
+	s.GetOrCreateGauge("bar", nil)
+	s.NewSummary("baz")
+	if err := s.RenameMetric("foo_total", "foo2_total"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.UnregisterMetric("bar")
+	s.UnregisterMetric("missing")
+
+	eventsExpected := []string{
+		"register foo_total",
+		"register bar",
+		"register baz",
+		"unregister foo_total",
+		"register foo2_total",
+		"unregister bar",
+	}
+	if !reflect.DeepEqual(events, eventsExpected) {
+		t.Fatalf("unexpected events;\ngot\n%q\nwant\n%q", events, eventsExpected)
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// WriteInfluxLineProtocol writes all the metrics from s to w in InfluxDB line protocol.
+//
+// Every sample is written as a separate line with the measurement name equal to measurementPrefix + sample name,
+// sample labels as tags and the sample value in the `value` field. For example:
+//
+//	requests_total,path=/foo value=123 1700000000000000000
+//
+// Histograms and summaries are written as multiple measurements in the same way as in Prometheus text exposition format,
+// e.g. `response_size_bucket,vmrange=...`, `response_size_sum` and `response_size_count`.
+// Samples with NaN or Inf values are skipped, since InfluxDB line protocol doesn't support them.
+//
+// Output of metrics writers registered via RegisterMetricsWriter isn't written to w.
+//
+// See https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/
+func (s *Set) WriteInfluxLineProtocol(w io.Writer, measurementPrefix string) {
+	timestamp := now().UnixNano()
+	bb := getBytesBuffer()
+	s.Visit(func(_ string, value MetricValue) {
+		for i := range value.Samples {
+			sample := &value.Samples[i]
+			bb.B = appendInfluxLine(bb.B, measurementPrefix, sample, timestamp)
+		}
+	})
+	w.Write(bb.B)
+	putBytesBuffer(bb)
+}
+
+func appendInfluxLine(dst []byte, measurementPrefix string, sample *Sample, timestamp int64) []byte {
+	v := sample.Value
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return dst
+	}
+	dst = appendInfluxEscaped(dst, measurementPrefix+getMetricFamily(sample.Name), false)
+	labels := append([]Label{}, sample.Labels...)
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	for _, l := range labels {
+		if l.Value == "" {
+			// InfluxDB line protocol doesn't support empty tag values.
+			continue
+		}
+		dst = append(dst, ',')
+		dst = appendInfluxEscaped(dst, l.Name, true)
+		dst = append(dst, '=')
+		dst = appendInfluxEscaped(dst, l.Value, true)
+	}
+	dst = append(dst, " value="...)
+	dst = strconv.AppendFloat(dst, v, 'g', -1, 64)
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, timestamp, 10)
+	return append(dst, '\n')
+}
+
+// appendInfluxEscaped appends s to dst with escaped commas and spaces.
+//
+// Equal signs are escaped additionally if isTag is set.
+func appendInfluxEscaped(dst []byte, s string, isTag bool) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case ',', ' ':
+			dst = append(dst, '\\')
+		case '=':
+			if isTag {
+				dst = append(dst, '\\')
+			}
+		case '\n':
+			// Newlines cannot be escaped in InfluxDB line protocol.
+			c = ' '
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestSetWriteInfluxLineProtocol(t *testing.T) {
+	SetClock(newFakeClock())
+	defer SetClock(nil)
+
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo bar",code="200"}`).Add(123)
+	s.NewGauge("temperature", nil).Set(math.NaN())
+	s.NewFloatCounter(`bytes_total{host="a,b=c"}`).Add(1.5)
+	s.NewHistogram("response_size").Update(1)
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewCounter("errors_total").Add(2)
+
+	var bb bytes.Buffer
+	s.WriteInfluxLineProtocol(&bb, "app_")
+	result := bb.String()
+	resultExpected := `app_bytes_total,host=a\,b\=c value=1.5 1700000000000000000
+app_requests_total,code=200,path=/foo\ bar value=123 1700000000000000000
+app_response_size_bucket,vmrange=8.799e-01...1.000e+00 value=1 1700000000000000000
+app_response_size_sum value=1 1700000000000000000
+app_response_size_count value=1 1700000000000000000
+app_errors_total,tenant=foo value=2 1700000000000000000
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
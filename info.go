@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+// NewInfo registers and returns new Info metric with the given name and labels.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Info is safe to use from concurrent goroutines.
+func NewInfo(name string, labels map[string]string) *Info {
+	return defaultSet().NewInfo(name, labels)
+}
+
+// Info is a metric, which always has value 1 and exposes information via its labels.
+//
+// For example, the following metric is exposed for NewInfo("build_info", map[string]string{"version": "1.2.3", "commit": "abc"}):
+//
+//	build_info{commit="abc",version="1.2.3"} 1
+type Info struct {
+	// v contains *infoLabels
+	v atomic.Value
+}
+
+type infoLabels struct {
+	m map[string]string
+
+	// s contains labels from m marshaled in the form `k1="v1",k2="v2"`.
+	s string
+}
+
+// Set atomically replaces labels for i with the given labels.
+func (i *Info) Set(labels map[string]string) {
+	m := make(map[string]string, len(labels))
+	names := make([]string, 0, len(labels))
+	for name, value := range labels {
+		if err := validateIdent(name); err != nil {
+			panic(fmt.Errorf("BUG: invalid label name %q: %s", name, err))
+		}
+		m[name] = value
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var dst []byte
+	for j, name := range names {
+		if j > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendLabel(dst, name, m[name])
+	}
+	i.v.Store(&infoLabels{
+		m: m,
+		s: string(dst),
+	})
+}
+
+// Get returns a copy of labels for i.
+func (i *Info) Get() map[string]string {
+	il := i.getLabels()
+	m := make(map[string]string, len(il.m))
+	for name, value := range il.m {
+		m[name] = value
+	}
+	return m
+}
+
+func (i *Info) getLabels() *infoLabels {
+	v := i.v.Load()
+	if v == nil {
+		return &infoLabels{}
+	}
+	return v.(*infoLabels)
+}
+
+func (i *Info) marshalTo(prefix string, w io.Writer) {
+	name := prefix
+	if il := i.getLabels(); il.s != "" {
+		name = addTag(prefix, il.s)
+	}
+	fmt.Fprintf(w, "%s 1\n", name)
+}
+
+func (i *Info) metricType() string {
+	return "gauge"
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	s := NewSet()
+	labels := map[string]string{
+		"version": "1.2.3",
+		"commit":  "abc",
+	}
+	i := s.NewInfo("build_info", labels)
+	testMarshalTo(t, i, "build_info", `build_info{commit="abc",version="1.2.3"} 1`+"\n")
+	testMarshalTo(t, i, `build_info{job="x"}`, `build_info{job="x",commit="abc",version="1.2.3"} 1`+"\n")
+
+	// Modifications of labels passed to NewInfo mustn't change i.
+	labels["version"] = "foo"
+	if m := i.Get(); !reflect.DeepEqual(m, map[string]string{"version": "1.2.3", "commit": "abc"}) {
+		t.Fatalf("unexpected labels: %v", m)
+	}
+
+	i.Set(map[string]string{"version": `1.2.4"`})
+	testMarshalTo(t, i, "build_info", `build_info{version="1.2.4\""} 1`+"\n")
+
+	i.Set(nil)
+	testMarshalTo(t, i, "build_info", "build_info 1\n")
+
+	expectPanic(t, "Set_invalid_label_name", func() {
+		i.Set(map[string]string{"foo-bar": "baz"})
+	})
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// InstrumentOptions is the options for InstrumentHandler.
+type InstrumentOptions struct {
+	// Set is the set for registering metrics. Metrics are registered in the default set if Set is nil.
+	Set *Set
+
+	// GetPath is an optional callback, which must return the value for `path` label for the request r.
+	//
+	// The callback must return route patterns such as `/users/:id` instead of raw request paths,
+	// since every distinct path value creates new time series. Raw paths allow clients to create
+	// unlimited number of time series by requesting random urls.
+	//
+	// By default `path` label is set to an empty string for all the requests.
+	GetPath func(r *http.Request) string
+}
+
+// InstrumentHandler returns http.Handler, which serves requests with next and records the following metrics for them:
+//
+//   - http_requests_total{code,method,path} - the number of served requests
+//   - http_request_duration_seconds{code,method,path} - Histogram of request durations
+//   - http_response_size_bytes{code,method,path} - Histogram of response body sizes
+//   - http_requests_in_flight{method,path} - the number of requests, which are being served
+//
+// Non-standard request methods are recorded as `method="other"`. The `path` label is empty
+// unless InstrumentOptions.GetPath is set.
+//
+// Example:
+//
+//	http.Handle("/api/", metrics.InstrumentHandler(apiHandler, metrics.InstrumentOptions{
+//	    GetPath: func(r *http.Request) string {
+//	        return "/api/"
+//	    },
+//	}))
+func InstrumentHandler(next http.Handler, opts InstrumentOptions) http.Handler {
+	s := opts.Set
+	if s == nil {
+		s = defaultSet()
+	}
+	getPath := opts.GetPath
+	if getPath == nil {
+		getPath = func(r *http.Request) string {
+			return ""
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := now()
+		labels := appendLabel(nil, "method", getRequestMethod(r))
+		labels = append(labels, ',')
+		labels = appendLabel(labels, "path", getPath(r))
+
+		inFlight := s.GetOrCreateGauge("http_requests_in_flight{"+string(labels)+"}", nil)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		iw := &instrumentedResponseWriter{
+			ResponseWriter: w,
+		}
+		next.ServeHTTP(iw, r)
+
+		codeLabels := appendLabel(nil, "code", strconv.Itoa(iw.getStatusCode()))
+		codeLabels = append(codeLabels, ',')
+		codeLabels = append(codeLabels, labels...)
+		suffix := "{" + string(codeLabels) + "}"
+		s.GetOrCreateCounter("http_requests_total" + suffix).Inc()
+		s.GetOrCreateHistogram("http_request_duration_seconds" + suffix).UpdateDuration(startTime)
+		s.GetOrCreateHistogram("http_response_size_bytes" + suffix).Update(float64(iw.bytesWritten))
+	})
+}
+
+// getRequestMethod returns the value for `method` label for r.
+//
+// Non-standard methods are replaced with `other` in order to limit the number of time series.
+func getRequestMethod(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return r.Method
+	default:
+		return "other"
+	}
+}
+
+// instrumentedResponseWriter tracks the status code and the number of bytes written to the response.
+type instrumentedResponseWriter struct {
+	http.ResponseWriter
+
+	statusCode   int
+	bytesWritten int
+}
+
+func (iw *instrumentedResponseWriter) WriteHeader(statusCode int) {
+	if iw.statusCode == 0 {
+		iw.statusCode = statusCode
+	}
+	iw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (iw *instrumentedResponseWriter) Write(p []byte) (int, error) {
+	if iw.statusCode == 0 {
+		iw.statusCode = http.StatusOK
+	}
+	n, err := iw.ResponseWriter.Write(p)
+	iw.bytesWritten += n
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying http.ResponseWriter supports it.
+func (iw *instrumentedResponseWriter) Flush() {
+	if f, ok := iw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying http.ResponseWriter supports it.
+//
+// This is needed for websocket libraries, which take over the connection.
+func (iw *instrumentedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := iw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the underlying http.ResponseWriter doesn't implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && iw.statusCode == 0 {
+		// The handler takes over the connection, so net/http doesn't write the response.
+		iw.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter. It is used by http.ResponseController.
+func (iw *instrumentedResponseWriter) Unwrap() http.ResponseWriter {
+	return iw.ResponseWriter
+}
+
+func (iw *instrumentedResponseWriter) getStatusCode() int {
+	if iw.statusCode == 0 {
+		// The handler didn't write anything, so net/http responds with 200 OK.
+		return http.StatusOK
+	}
+	return iw.statusCode
+}
+
+// InstrumentRoundTripper returns http.RoundTripper, which sends requests via rt and records the following metrics for them:
+//
+//   - http_client_requests_total{host,method,code} - the number of requests, which received responses
+//   - http_client_request_duration_seconds{host,method} - Histogram of durations until response headers are received
+//   - http_client_request_errors_total{host,method} - the number of requests, which failed without response
+//
+// http.DefaultTransport is used if rt is nil. Metrics are registered in the default set if s is nil.
+//
+// Example:
+//
+//	client := &http.Client{
+//	    Transport: metrics.InstrumentRoundTripper(nil, nil),
+//	}
+func InstrumentRoundTripper(rt http.RoundTripper, s *Set) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if s == nil {
+		s = defaultSet()
+	}
+	return &instrumentedRoundTripper{
+		rt: rt,
+		s:  s,
+	}
+}
+
+type instrumentedRoundTripper struct {
+	rt http.RoundTripper
+	s  *Set
+}
+
+func (irt *instrumentedRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	startTime := now()
+	labels := appendLabel(nil, "host", r.URL.Host)
+	labels = append(labels, ',')
+	labels = appendLabel(labels, "method", getRequestMethod(r))
+	suffix := "{" + string(labels) + "}"
+
+	resp, err := irt.rt.RoundTrip(r)
+	irt.s.GetOrCreateHistogram("http_client_request_duration_seconds" + suffix).UpdateDuration(startTime)
+	if err != nil {
+		irt.s.GetOrCreateCounter("http_client_request_errors_total" + suffix).Inc()
+		return resp, err
+	}
+	labels = append(labels, ',')
+	labels = appendLabel(labels, "code", strconv.Itoa(resp.StatusCode))
+	irt.s.GetOrCreateCounter("http_client_requests_total{" + string(labels) + "}").Inc()
+	return resp, nil
+}
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	s := NewSet()
+	var inFlight float64
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = s.GetOrCreateGauge(`http_requests_in_flight{method="GET",path="/api/\"x\""}`, nil).Get()
+		if r.URL.Query().Get("fail") != "" {
+			http.Error(w, "fail", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+	h := InstrumentHandler(next, InstrumentOptions{
+		Set: s,
+		GetPath: func(r *http.Request) string {
+			return r.URL.Path
+		},
+	})
+
+	serve := func(method, url string) {
+		r := httptest.NewRequest(method, url, nil)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	serve(http.MethodGet, `/api/"x"`)
+	if inFlight != 1 {
+		t.Fatalf("unexpected number of in-flight requests during request processing; got %v; want 1", inFlight)
+	}
+	serve(http.MethodGet, `/api/"x"`)
+	serve(http.MethodGet, `/api/"x"?fail=1`)
+	serve("FOO", `/api/"x"`)
+
+	var bb bytes.Buffer
+	s.WritePrometheusFiltered(&bb, func(name string) bool {
+		return strings.HasPrefix(name, "http_requests_")
+	})
+	resultExpected := `http_requests_in_flight{method="GET",path="/api/\"x\""} 0
+http_requests_in_flight{method="other",path="/api/\"x\""} 0
+http_requests_total{code="200",method="GET",path="/api/\"x\""} 2
+http_requests_total{code="200",method="other",path="/api/\"x\""} 1
+http_requests_total{code="400",method="GET",path="/api/\"x\""} 1
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	sizes := s.GetOrCreateHistogram(`http_response_size_bytes{code="200",method="GET",path="/api/\"x\""}`)
+	if n, sum := getHistogramCount(sizes), sizes.getSum(); n != 2 || sum != 10 {
+		t.Fatalf("unexpected response sizes; got count=%d, sum=%v; want count=2, sum=10", n, sum)
+	}
+	durations := s.GetOrCreateHistogram(`http_request_duration_seconds{code="400",method="GET",path="/api/\"x\""}`)
+	if n := getHistogramCount(durations); n != 1 {
+		t.Fatalf("unexpected number of request durations; got %d; want 1", n)
+	}
+}
+
+func getHistogramCount(h *Histogram) uint64 {
+	n := uint64(0)
+	h.VisitNonZeroBuckets(func(_ string, count uint64) {
+		n += count
+	})
+	return n
+}
+
+func TestInstrumentHandlerGetPath(t *testing.T) {
+	s := NewSet()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := InstrumentHandler(next, InstrumentOptions{
+		Set: s,
+		GetPath: func(r *http.Request) string {
+			return "/users/:id"
+		},
+	})
+	for _, url := range []string{"/users/1", "/users/2"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, url, nil))
+	}
+	if n := s.GetOrCreateCounter(`http_requests_total{code="200",method="POST",path="/users/:id"}`).Get(); n != 2 {
+		t.Fatalf("unexpected number of requests; got %d; want 2", n)
+	}
+}
+
+func TestInstrumentHandlerDefaultPath(t *testing.T) {
+	s := NewSet()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := InstrumentHandler(next, InstrumentOptions{
+		Set: s,
+	})
+	for _, url := range []string{"/foo", "/bar/baz"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+	if n := s.GetOrCreateCounter(`http_requests_total{code="200",method="GET",path=""}`).Get(); n != 2 {
+		t.Fatalf("unexpected number of requests; got %d; want 2", n)
+	}
+}
+
+func TestInstrumentHandlerHijack(t *testing.T) {
+	s := NewSet()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			t.Errorf("http.ResponseWriter doesn't implement http.Hijacker")
+			return
+		}
+		conn, bw, err := h.Hijack()
+		if err != nil {
+			t.Errorf("cannot hijack connection: %s", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = bw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		_ = bw.Flush()
+	})
+	ih := InstrumentHandler(next, InstrumentOptions{
+		Set: s,
+	})
+	doneCh := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ih.ServeHTTP(w, r)
+		close(doneCh)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	<-doneCh
+	if n := s.GetOrCreateCounter(`http_requests_total{code="101",method="GET",path=""}`).Get(); n != 1 {
+		t.Fatalf("unexpected number of requests; got %d; want 1", n)
+	}
+
+	// httptest.ResponseRecorder doesn't support hijacking
+	iw := &instrumentedResponseWriter{
+		ResponseWriter: httptest.NewRecorder(),
+	}
+	if _, _, err := iw.Hijack(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestInstrumentRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	s := NewSet()
+	client := &http.Client{
+		Transport: InstrumentRoundTripper(nil, s),
+	}
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		_ = resp.Body.Close()
+	}
+	// Send the request to the closed port.
+	srvClosed := httptest.NewServer(http.NotFoundHandler())
+	srvClosed.Close()
+	hostClosed := strings.TrimPrefix(srvClosed.URL, "http://")
+	if _, err := client.Get(srvClosed.URL); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+
+	f := func(name string, nExpected uint64) {
+		t.Helper()
+		if n := s.GetOrCreateCounter(name).Get(); n != nExpected {
+			t.Fatalf("unexpected value for %s; got %d; want %d", name, n, nExpected)
+		}
+	}
+	f(`http_client_requests_total{host="`+host+`",method="GET",code="200"}`, 2)
+	f(`http_client_requests_total{host="`+host+`",method="GET",code="404"}`, 1)
+	f(`http_client_request_errors_total{host="`+host+`",method="GET"}`, 0)
+	f(`http_client_request_errors_total{host="`+hostClosed+`",method="GET"}`, 1)
+
+	durations := s.GetOrCreateHistogram(`http_client_request_duration_seconds{host="` + host + `",method="GET"}`)
+	if n := getHistogramCount(durations); n != 3 {
+		t.Fatalf("unexpected number of request durations; got %d; want 3", n)
+	}
+}
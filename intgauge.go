@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// NewInt64Gauge registers and returns new Int64Gauge with the given name.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Int64Gauge is safe to use from concurrent goroutines.
+func NewInt64Gauge(name string) *Int64Gauge {
+	return defaultSet().NewInt64Gauge(name)
+}
+
+// Int64Gauge is an int64 gauge.
+//
+// Unlike Gauge, it stores and marshals values without float64 conversion,
+// so big values such as byte totals are exposed without precision loss.
+type Int64Gauge struct {
+	n int64
+}
+
+// Set sets g value to n.
+func (g *Int64Gauge) Set(n int64) {
+	atomic.StoreInt64(&g.n, n)
+}
+
+// Add adds n to g. n may be positive and negative.
+func (g *Int64Gauge) Add(n int64) {
+	atomic.AddInt64(&g.n, n)
+}
+
+// Inc increments g by 1.
+func (g *Int64Gauge) Inc() {
+	atomic.AddInt64(&g.n, 1)
+}
+
+// Dec decrements g by 1.
+func (g *Int64Gauge) Dec() {
+	atomic.AddInt64(&g.n, -1)
+}
+
+// Get returns the current value for g.
+func (g *Int64Gauge) Get() int64 {
+	return atomic.LoadInt64(&g.n)
+}
+
+func (g *Int64Gauge) marshalTo(prefix string, w io.Writer) {
+	v := g.Get()
+	fmt.Fprintf(w, "%s %d\n", prefix, v)
+}
+
+func (g *Int64Gauge) metricType() string {
+	return "gauge"
+}
+
+// NewUint64Gauge registers and returns new Uint64Gauge with the given name.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Uint64Gauge is safe to use from concurrent goroutines.
+func NewUint64Gauge(name string) *Uint64Gauge {
+	return defaultSet().NewUint64Gauge(name)
+}
+
+// Uint64Gauge is an uint64 gauge.
+//
+// Unlike Gauge, it stores and marshals values without float64 conversion,
+// so big values such as byte totals are exposed without precision loss.
+type Uint64Gauge struct {
+	n uint64
+}
+
+// Set sets g value to n.
+func (g *Uint64Gauge) Set(n uint64) {
+	atomic.StoreUint64(&g.n, n)
+}
+
+// Add adds n to g.
+func (g *Uint64Gauge) Add(n uint64) {
+	atomic.AddUint64(&g.n, n)
+}
+
+// Sub subtracts n from g.
+func (g *Uint64Gauge) Sub(n uint64) {
+	atomic.AddUint64(&g.n, ^(n - 1))
+}
+
+// Inc increments g by 1.
+func (g *Uint64Gauge) Inc() {
+	atomic.AddUint64(&g.n, 1)
+}
+
+// Dec decrements g by 1.
+func (g *Uint64Gauge) Dec() {
+	atomic.AddUint64(&g.n, ^uint64(0))
+}
+
+// Get returns the current value for g.
+func (g *Uint64Gauge) Get() uint64 {
+	return atomic.LoadUint64(&g.n)
+}
+
+func (g *Uint64Gauge) marshalTo(prefix string, w io.Writer) {
+	v := g.Get()
+	fmt.Fprintf(w, "%s %d\n", prefix, v)
+}
+
+func (g *Uint64Gauge) metricType() string {
+	return "gauge"
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInt64Gauge(t *testing.T) {
+	s := NewSet()
+	g := s.NewInt64Gauge("foo")
+	g.Set(math.MaxInt64 - 1)
+	g.Inc()
+	if n := g.Get(); n != math.MaxInt64 {
+		t.Fatalf("unexpected value; got %d; want %d", n, int64(math.MaxInt64))
+	}
+	testMarshalTo(t, g, "foo", "foo 9223372036854775807\n")
+
+	g.Set(0)
+	g.Dec()
+	g.Add(-10)
+	if n := g.Get(); n != -11 {
+		t.Fatalf("unexpected value; got %d; want -11", n)
+	}
+	testMarshalTo(t, g, "foo", "foo -11\n")
+}
+
+func TestUint64Gauge(t *testing.T) {
+	s := NewSet()
+	g := s.NewUint64Gauge("foo")
+	g.Set(math.MaxUint64 - 1)
+	g.Inc()
+	if n := g.Get(); n != math.MaxUint64 {
+		t.Fatalf("unexpected value; got %d; want %d", n, uint64(math.MaxUint64))
+	}
+	testMarshalTo(t, g, "foo", "foo 18446744073709551615\n")
+
+	g.Set(10)
+	g.Dec()
+	g.Add(5)
+	g.Sub(3)
+	if n := g.Get(); n != 11 {
+		t.Fatalf("unexpected value; got %d; want 11", n)
+	}
+	testMarshalTo(t, g, "foo", "foo 11\n")
+}
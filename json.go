@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// WriteJSON writes all the metrics from s to w as JSON document.
+//
+// The document has the following structure:
+//
+//	{"metrics":[
+//	  {"name":"requests_total","labels":{"path":"/foo"},"type":"counter","value":123},
+//	  {"name":"response_size","type":"histogram","buckets":[{"vmrange":"8.799e-01...1.000e+00","count":1}],"sum":1,"count":1},
+//	  {"name":"duration_seconds","type":"summary","quantiles":[{"quantile":0.5,"value":0.2}],"sum":0.2,"count":1}
+//	]}
+//
+// Metrics without a single value, such as metrics written by write callbacks, contain "samples" list instead of "value".
+// NaN and Inf values are written as "NaN", "+Inf" and "-Inf" strings.
+//
+// This is useful for consumers that aren't Prometheus-aware such as custom dashboards or log pipelines.
+// Output of metrics writers registered via RegisterMetricsWriter isn't included in the document.
+func (s *Set) WriteJSON(w io.Writer) {
+	doc := jsonDocument{
+		Metrics: []*jsonMetric{},
+	}
+	s.Visit(func(_ string, value MetricValue) {
+		doc.Metrics = append(doc.Metrics, newJSONMetric(&value))
+	})
+	data, err := json.Marshal(&doc)
+	if err != nil {
+		panic(fmt.Errorf("BUG: cannot marshal metrics to JSON: %s", err))
+	}
+	data = append(data, '\n')
+	w.Write(data)
+}
+
+type jsonDocument struct {
+	Metrics []*jsonMetric `json:"metrics"`
+}
+
+type jsonMetric struct {
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Type      string            `json:"type"`
+	Value     *jsonFloat        `json:"value,omitempty"`
+	Buckets   []jsonBucket      `json:"buckets,omitempty"`
+	Quantiles []jsonQuantile    `json:"quantiles,omitempty"`
+	Sum       *jsonFloat        `json:"sum,omitempty"`
+	Count     *jsonFloat        `json:"count,omitempty"`
+	Samples   []jsonSample      `json:"samples,omitempty"`
+}
+
+type jsonBucket struct {
+	VMRange string `json:"vmrange"`
+	Count   uint64 `json:"count"`
+}
+
+type jsonQuantile struct {
+	Quantile jsonFloat `json:"quantile"`
+	Value    jsonFloat `json:"value"`
+}
+
+type jsonSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  jsonFloat         `json:"value"`
+}
+
+// jsonFloat is float64, which is marshaled to JSON string if it is NaN or Inf.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+func newJSONMetric(mv *MetricValue) *jsonMetric {
+	jm := &jsonMetric{
+		Name:   mv.Family,
+		Labels: labelsToMap(mv.Labels),
+		Type:   mv.Type,
+	}
+	switch mv.Type {
+	case "histogram", "summary":
+		for i := range mv.Samples {
+			sample := &mv.Samples[i]
+			v := jsonFloat(sample.Value)
+			sampleFamily := getMetricFamily(sample.Name)
+			switch {
+			case sampleFamily == mv.Family+"_sum":
+				jm.Sum = &v
+			case sampleFamily == mv.Family+"_count":
+				jm.Count = &v
+			case sampleFamily == mv.Family+"_bucket":
+				jm.Buckets = append(jm.Buckets, jsonBucket{
+					VMRange: getLabelValue(sample.Labels, "vmrange"),
+					Count:   uint64(sample.Value),
+				})
+			case sampleFamily == mv.Family:
+				q, err := strconv.ParseFloat(getLabelValue(sample.Labels, "quantile"), 64)
+				if err != nil {
+					panic(fmt.Errorf("BUG: cannot parse quantile for %q: %s", sample.Name, err))
+				}
+				jm.Quantiles = append(jm.Quantiles, jsonQuantile{
+					Quantile: jsonFloat(q),
+					Value:    v,
+				})
+			}
+		}
+		return jm
+	}
+
+	if len(mv.Samples) == 1 && getMetricFamily(mv.Samples[0].Name) == mv.Family {
+		v := jsonFloat(mv.Samples[0].Value)
+		jm.Value = &v
+		return jm
+	}
+	for _, sample := range mv.Samples {
+		jm.Samples = append(jm.Samples, jsonSample{
+			Name:   getMetricFamily(sample.Name),
+			Labels: labelsToMap(sample.Labels),
+			Value:  jsonFloat(sample.Value),
+		})
+	}
+	return jm
+}
+
+func labelsToMap(labels []Label) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Name] = l.Value
+	}
+	return m
+}
+
+func getLabelValue(labels []Label, name string) string {
+	for _, l := range labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
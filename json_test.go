@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestSetWriteJSON(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo"}`).Add(123)
+	s.NewGauge("temperature", nil).Set(math.NaN())
+	s.NewHistogram("response_size").Update(1)
+	s.NewSummaryExt("duration_seconds", defaultSummaryWindow, []float64{0.5}).Update(0.25)
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewFloatCounter("bytes_total").Add(1.5)
+
+	var bb bytes.Buffer
+	s.WriteJSON(&bb)
+	result := bb.String()
+	resultExpected := `{"metrics":[` +
+		`{"name":"duration_seconds","type":"summary","quantiles":[{"quantile":0.5,"value":0.25}],"sum":0.25,"count":1},` +
+		`{"name":"requests_total","labels":{"path":"/foo"},"type":"counter","value":123},` +
+		`{"name":"response_size","type":"histogram","buckets":[{"vmrange":"8.799e-01...1.000e+00","count":1}],"sum":1,"count":1},` +
+		`{"name":"temperature","type":"gauge","value":"NaN"},` +
+		`{"name":"bytes_total","labels":{"tenant":"foo"},"type":"counter","value":1.5}` +
+		"]}\n"
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Empty set
+	bb.Reset()
+	NewSet().WriteJSON(&bb)
+	if result := bb.String(); result != "{\"metrics\":[]}\n" {
+		t.Fatalf("unexpected output for empty set: %s", result)
+	}
+}
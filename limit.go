@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SetMaxMetrics limits the number of metrics in s to n.
+//
+// New metrics beyond the limit aren't registered in s, so they aren't exposed. Functions such as NewCounter
+// and GetOrCreateCounter return usable metrics in this case, but updates of these metrics are lost.
+// onLimit is called with the metric name on every rejected registration if it is non-nil.
+// The number of rejected registrations is exposed via metrics_set_limit_exceeded_total if ExposeSelfMetrics is enabled.
+//
+// This protects the process from unbounded growth of the number of metrics caused by user-controlled label values.
+// Summary quantiles aren't counted towards the limit. Metrics already registered in s aren't removed if n is smaller
+// than the number of registered metrics.
+//
+// onLimit is called without holding s locks, so it may access s. Pass zero n in order to disable the limit.
+// There is no limit by default.
+func (s *Set) SetMaxMetrics(n int, onLimit func(name string)) {
+	if n < 0 {
+		panic(fmt.Errorf("BUG: n cannot be negative; got %d", n))
+	}
+	s.mu.Lock()
+	s.maxMetrics = n
+	s.onLimit = onLimit
+	s.mu.Unlock()
+}
+
+func (s *Set) isLimitExceededLocked() bool {
+	return s.maxMetrics > 0 && s.metricsCount >= s.maxMetrics
+}
+
+// notifyRegisterOrLimit calls OnRegister callbacks for the metric with the given name if ok is true.
+//
+// Otherwise it registers rejected registration for the metric with the given name.
+//
+// It must be called without holding s.mu.
+func (s *Set) notifyRegisterOrLimit(name string, ok bool) {
+	if ok {
+		s.notifyRegister(name)
+		return
+	}
+	atomic.AddUint64(&s.limitExceeded, 1)
+	s.mu.Lock()
+	onLimit := s.onLimit
+	s.mu.Unlock()
+	if onLimit != nil {
+		onLimit(name)
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSetSetMaxMetrics(t *testing.T) {
+	s := NewSet()
+	var rejected []string
+	s.SetMaxMetrics(3, func(name string) {
+		rejected = append(rejected, name)
+	})
+
+	s.NewCounter("a_total").Inc()
+	s.NewSummary("b")
+	s.GetOrCreateCounter("c_total").Inc()
+	// The following metrics exceed the limit
+	s.NewCounter("d_total").Inc()
+	s.GetOrCreateCounter("e_total").Inc()
+	s.GetOrCreateSummary("f")
+	// Already registered metric must be returned
+	s.GetOrCreateCounter("c_total").Inc()
+
+	rejectedExpected := []string{"d_total", "e_total", "f"}
+	if !reflect.DeepEqual(rejected, rejectedExpected) {
+		t.Fatalf("unexpected rejected metrics; got %q; want %q", rejected, rejectedExpected)
+	}
+	namesExpected := []string{"a_total", "b", "c_total"}
+	if names := s.ListMetricNames(); !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected metric names; got %q; want %q", names, namesExpected)
+	}
+	if err := s.RegisterBatch(func(b *Batch) { b.NewCounter("g_total") }); err == nil {
+		t.Fatalf("expecting non-nil error when exceeding the limit in RegisterBatch")
+	}
+
+	// Unregistering metrics frees room for new metrics
+	s.UnregisterMetric("b")
+	s.NewCounter("h_total").Inc()
+	namesExpected = []string{"a_total", "c_total", "h_total"}
+	if names := s.ListMetricNames(); !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected metric names; got %q; want %q", names, namesExpected)
+	}
+
+	s.ExposeSelfMetrics(true)
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	resultExpected := `a_total 1
+c_total 2
+h_total 1
+metrics_set_entries 3
+metrics_set_writes_total 0
+metrics_set_limit_exceeded_total 3
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestSetSetMaxMetricsVec(t *testing.T) {
+	s := NewSet()
+	s.SetMaxMetrics(10, nil)
+	gv := s.NewGaugeVec("requests_in_flight", []string{"path"})
+	hv := s.NewHistogramVec("request_duration_seconds", []string{"path"})
+	for i := 0; i < 1000; i++ {
+		path := fmt.Sprintf("/path/%d", i)
+		gv.WithLabelValues(path).Set(1)
+		hv.WithLabelValues(path).Update(1)
+	}
+	if n := len(s.ListMetricNames()); n != 10 {
+		t.Fatalf("unexpected number of registered metrics; got %d; want 10", n)
+	}
+
+	// Metrics rejected because of the limit mustn't be cached in vecs.
+	nCached := len(gv.mv.m) + len(hv.mv.m)
+	nKeys := len(gv.mv.keys) + len(hv.mv.keys)
+	if nCached != 10 || nKeys != 10 {
+		t.Fatalf("unexpected number of cached metrics in vecs; got %d metrics and %d keys; want 10", nCached, nKeys)
+	}
+
+	// Cached metrics must remain registered.
+	gv.WithLabelValues("/path/0").Set(2)
+	if v, ok := s.GetGaugeValue(`requests_in_flight{path="/path/0"}`); !ok || v != 2 {
+		t.Fatalf("unexpected value for the cached gauge; got %v, ok=%v; want 2, ok=true", v, ok)
+	}
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+)
+
+// Metric is a read-only view of a metric registered in a Set.
+//
+// It is returned from Set.GetMetric and can be used for building introspection and debug tooling.
+type Metric interface {
+	// Name returns the metric name with labels as it was passed at registration.
+	Name() string
+
+	// Type returns the metric type such as "counter", "gauge", "histogram" or "summary".
+	Type() string
+
+	// Samples returns point-in-time samples exported by the metric.
+	//
+	// The returned samples aren't changed by subsequent updates of the metric.
+	Samples() []Sample
+}
+
+// Sample is a single sample exported by a Metric.
+type Sample struct {
+	// Name is the sample name with labels, e.g. `foo_bucket{vmrange="1.000e+00...1.136e+00"}`.
+	Name string
+
+	// Labels contains the sample labels.
+	Labels []Label
+
+	// Value is the sample value.
+	Value float64
+}
+
+// Label is a label name and value pair.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// GetMetric returns a metric with the given name from the default set.
+//
+// See Set.GetMetric for details.
+func GetMetric(name string) (Metric, bool) {
+	return defaultSet().GetMetric(name)
+}
+
+// GetMetric returns a metric with the given name from s.
+//
+// False is returned if s doesn't contain a metric with the given name.
+// Auxiliary metrics such as summary_metric{quantile="..."} cannot be obtained directly -
+// they are returned in Samples of the parent summary metric.
+func (s *Set) GetMetric(name string) (Metric, bool) {
+	nm := s.m.get(name)
+	if nm == nil || nm.isAux {
+		return nil, false
+	}
+	return &metricView{
+		name:   nm.name,
+		metric: nm.metric,
+	}, true
+}
+
+// metricView implements Metric.
+type metricView struct {
+	name   string
+	metric metric
+}
+
+func (mv *metricView) Name() string {
+	return mv.name
+}
+
+func (mv *metricView) Type() string {
+	return mv.metric.metricType()
+}
+
+func (mv *metricView) Samples() []Sample {
+	return getMetricSamples(mv.name, mv.metric, "")
+}
+
+// getMetricSamples returns point-in-time samples exported by m with the given name.
+//
+// extraLabels are added to all the returned samples if non-empty.
+func getMetricSamples(name string, m metric, extraLabels string) []Sample {
+	var bb bytes.Buffer
+	if sm, ok := m.(*Summary); ok {
+		marshalSummaryQuantiles(&bb, name, sm)
+	}
+	// Marshal a snapshot of the metric, since marshalTo may reset metrics such as MaxGauge.
+	mCopy := snapshotMetric(name, m)
+	mCopy.marshalTo(name, &bb)
+
+	data := bb.Bytes()
+	if extraLabels != "" {
+		data = addExtraLabels(nil, data, extraLabels)
+	}
+	var samples []Sample
+	visitLines(data, func(line []byte) {
+		if line[0] == '#' {
+			return
+		}
+		// Custom metrics and write callbacks may generate invalid lines, so skip them instead of crashing the app.
+		s, err := parseSample(string(line))
+		if err != nil {
+			log.Printf("ERROR: metrics: cannot parse sample generated by metric %q: %s", name, err)
+			return
+		}
+		samples = append(samples, Sample{
+			Name:   s.fullName(),
+			Labels: publicLabels(s.labels),
+			Value:  s.value,
+		})
+	})
+	return samples
+}
+
+func publicLabels(labels []label) []Label {
+	if len(labels) == 0 {
+		return nil
+	}
+	dst := make([]Label, len(labels))
+	for i, l := range labels {
+		dst[i] = Label{
+			Name:  l.name,
+			Value: l.value,
+		}
+	}
+	return dst
+}
+
+// marshalSummaryQuantiles writes quantile samples for sm with the given name to bb.
+func marshalSummaryQuantiles(bb *bytes.Buffer, name string, sm *Summary) {
+	sm.mu.Lock()
+	quantileValues := append([]float64{}, sm.quantileValues...)
+	sm.mu.Unlock()
+	for i, q := range sm.quantiles {
+		v := quantileValues[i]
+		if math.IsNaN(v) {
+			continue
+		}
+		fmt.Fprintf(bb, "%s %g\n", addTag(name, fmt.Sprintf(`quantile="%g"`, q)), v)
+	}
+}
+
+// GetCounterValue returns the value of Counter with the given name in s.
+//
+// False is returned if s doesn't contain Counter with the given name.
+func (s *Set) GetCounterValue(name string) (uint64, bool) {
+	c, ok := s.getMetricByName(name).(*Counter)
+	if !ok {
+		return 0, false
+	}
+	return c.Get(), true
+}
+
+// GetFloatCounterValue returns the value of FloatCounter with the given name in s.
+//
+// False is returned if s doesn't contain FloatCounter with the given name.
+func (s *Set) GetFloatCounterValue(name string) (float64, bool) {
+	fc, ok := s.getMetricByName(name).(*FloatCounter)
+	if !ok {
+		return 0, false
+	}
+	return fc.Get(), true
+}
+
+// GetGaugeValue returns the value of Gauge with the given name in s.
+//
+// The gauge callback is called if the Gauge has been created with non-nil callback.
+// False is returned if s doesn't contain Gauge with the given name.
+func (s *Set) GetGaugeValue(name string) (float64, bool) {
+	g, ok := s.getMetricByName(name).(*Gauge)
+	if !ok {
+		return 0, false
+	}
+	return g.Get(), true
+}
+
+// getMetricByName returns metric with the given name from s.
+//
+// nil is returned if s doesn't contain metric with the given name.
+func (s *Set) getMetricByName(name string) metric {
+	nm := s.m.get(name)
+	if nm == nil {
+		return nil
+	}
+	return nm.metric
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSetGetMetric(t *testing.T) {
+	s := NewSet()
+	c := s.NewCounter(`foo_total{bar="baz"}`)
+	c.Add(12)
+	mg := s.NewMaxGauge("max_gauge")
+	mg.Update(3)
+	h := s.NewHistogram("hist")
+	h.Update(1)
+	sm := s.NewSummaryExt("summary", defaultSummaryWindow, []float64{0.5})
+	sm.Update(2)
+	sm.updateQuantiles()
+
+	f := func(name, typeExpected string, samplesExpected []Sample) {
+		t.Helper()
+		m, ok := s.GetMetric(name)
+		if !ok {
+			t.Fatalf("cannot find metric %q", name)
+		}
+		if m.Name() != name {
+			t.Fatalf("unexpected name; got %q; want %q", m.Name(), name)
+		}
+		if m.Type() != typeExpected {
+			t.Fatalf("unexpected type for %q; got %q; want %q", name, m.Type(), typeExpected)
+		}
+		samples := m.Samples()
+		if !reflect.DeepEqual(samples, samplesExpected) {
+			t.Fatalf("unexpected samples for %q;\ngot\n%v\nwant\n%v", name, samples, samplesExpected)
+		}
+	}
+	f(`foo_total{bar="baz"}`, "counter", []Sample{
+		{Name: `foo_total{bar="baz"}`, Labels: []Label{{Name: "bar", Value: "baz"}}, Value: 12},
+	})
+	f("hist", "histogram", []Sample{
+		{Name: `hist_bucket{vmrange="8.799e-01...1.000e+00"}`, Labels: []Label{{Name: "vmrange", Value: "8.799e-01...1.000e+00"}}, Value: 1},
+		{Name: "hist_sum", Value: 1},
+		{Name: "hist_count", Value: 1},
+	})
+	f("summary", "summary", []Sample{
+		{Name: `summary{quantile="0.5"}`, Labels: []Label{{Name: "quantile", Value: "0.5"}}, Value: 2},
+		{Name: "summary_sum", Value: 2},
+		{Name: "summary_count", Value: 1},
+	})
+
+	// Samples mustn't reset MaxGauge
+	for i := 0; i < 2; i++ {
+		f("max_gauge", "gauge", []Sample{
+			{Name: "max_gauge", Value: 3},
+		})
+	}
+
+	// Missing and auxiliary metrics
+	if _, ok := s.GetMetric("missing"); ok {
+		t.Fatalf("expecting missing metric")
+	}
+	if _, ok := s.GetMetric(`summary{quantile="0.5"}`); ok {
+		t.Fatalf("expecting auxiliary metric to be missing")
+	}
+}
+
+type testInvalidMetric struct{}
+
+func (tm *testInvalidMetric) MarshalTo(prefix string, w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s foo\n", prefix)
+	fmt.Fprintf(w, "%s{bad 1\n", prefix)
+	fmt.Fprintf(w, "%s 2\n", prefix)
+}
+
+func (tm *testInvalidMetric) MetricType() string {
+	return "gauge"
+}
+
+func TestSetGetMetricInvalidSamples(t *testing.T) {
+	s := NewSet()
+	s.RegisterMetric("invalid", &testInvalidMetric{})
+	m, ok := s.GetMetric("invalid")
+	if !ok {
+		t.Fatalf("cannot find metric %q", "invalid")
+	}
+	samples := m.Samples()
+	samplesExpected := []Sample{
+		{Name: "invalid", Value: 2},
+	}
+	if !reflect.DeepEqual(samples, samplesExpected) {
+		t.Fatalf("unexpected samples;\ngot\n%v\nwant\n%v", samples, samplesExpected)
+	}
+}
+
+func TestSetGetValue(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("requests_total").Add(12)
+	s.NewFloatCounter("bytes_total").Add(1.5)
+	s.NewGauge("temperature", func() float64 { return 36.6 })
+
+	if n, ok := s.GetCounterValue("requests_total"); !ok || n != 12 {
+		t.Fatalf("unexpected counter value; got %d, %v; want 12, true", n, ok)
+	}
+	if v, ok := s.GetFloatCounterValue("bytes_total"); !ok || v != 1.5 {
+		t.Fatalf("unexpected float counter value; got %v, %v; want 1.5, true", v, ok)
+	}
+	if v, ok := s.GetGaugeValue("temperature"); !ok || v != 36.6 {
+		t.Fatalf("unexpected gauge value; got %v, %v; want 36.6, true", v, ok)
+	}
+
+	// Missing metrics and type mismatch
+	if _, ok := s.GetCounterValue("missing"); ok {
+		t.Fatalf("expecting missing counter")
+	}
+	if _, ok := s.GetCounterValue("bytes_total"); ok {
+		t.Fatalf("expecting false for FloatCounter passed to GetCounterValue")
+	}
+	if _, ok := s.GetFloatCounterValue("temperature"); ok {
+		t.Fatalf("expecting false for Gauge passed to GetFloatCounterValue")
+	}
+	if _, ok := s.GetGaugeValue("requests_total"); ok {
+		t.Fatalf("expecting false for Counter passed to GetGaugeValue")
+	}
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// NewMaxGauge registers and returns new MaxGauge with the given name.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned MaxGauge is safe to use from concurrent goroutines.
+func NewMaxGauge(name string) *MaxGauge {
+	return defaultSet().NewMaxGauge(name)
+}
+
+// MaxGauge is a gauge, which exposes the maximum value passed to Update since the previous scrape.
+//
+// The value is reset after every WritePrometheus call, so every scrape returns the maximum value
+// over the interval since the previous scrape. This is useful for tracking peak queue depth or peak latency.
+//
+// MaxGauge isn't exposed if there were no Update calls since the previous scrape.
+type MaxGauge struct {
+	mu       sync.Mutex
+	max      float64
+	hasValue bool
+}
+
+// Update updates mg with v if v is bigger than the maximum value since the previous scrape.
+//
+// NaNs are ignored.
+func (mg *MaxGauge) Update(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	mg.mu.Lock()
+	if !mg.hasValue || v > mg.max {
+		mg.max = v
+		mg.hasValue = true
+	}
+	mg.mu.Unlock()
+}
+
+// Get returns the maximum value passed to Update since the previous scrape.
+//
+// 0 is returned if there were no Update calls since the previous scrape.
+func (mg *MaxGauge) Get() float64 {
+	mg.mu.Lock()
+	v := mg.max
+	mg.mu.Unlock()
+	return v
+}
+
+func (mg *MaxGauge) marshalTo(prefix string, w io.Writer) {
+	mg.mu.Lock()
+	v := mg.max
+	hasValue := mg.hasValue
+	mg.max = 0
+	mg.hasValue = false
+	mg.mu.Unlock()
+
+	if !hasValue {
+		return
+	}
+	if float64(int64(v)) == v {
+		// Marshal integer values without scientific notation
+		fmt.Fprintf(w, "%s %d\n", prefix, int64(v))
+	} else {
+		fmt.Fprintf(w, "%s %g\n", prefix, v)
+	}
+}
+
+func (mg *MaxGauge) metricType() string {
+	return "gauge"
+}
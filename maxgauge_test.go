@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMaxGauge(t *testing.T) {
+	s := NewSet()
+	mg := s.NewMaxGauge("queue_size_max")
+
+	// Verify that MaxGauge without updates isn't marshaled.
+	testMarshalTo(t, mg, "queue_size_max", "")
+
+	for _, v := range []float64{-3, 5, 1.5, math.NaN(), 2} {
+		mg.Update(v)
+	}
+	if v := mg.Get(); v != 5 {
+		t.Fatalf("unexpected value; got %g; want 5", v)
+	}
+	testMarshalTo(t, mg, "queue_size_max", "queue_size_max 5\n")
+
+	// The value must be reset after the scrape.
+	if v := mg.Get(); v != 0 {
+		t.Fatalf("unexpected value after the scrape; got %g; want 0", v)
+	}
+	testMarshalTo(t, mg, "queue_size_max", "")
+
+	mg.Update(-1.5)
+	testMarshalTo(t, mg, "queue_size_max", "queue_size_max -1.5\n")
+}
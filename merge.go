@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"fmt"
+)
+
+// Merge moves metrics from src into s.
+//
+// Counters and histograms from src are added to the corresponding metrics in s and are reset in src.
+// The values are obtained and reset atomically, so concurrent updates to src aren't lost and repeated merges
+// of the same src don't count its values multiple times. Gauges in s are replaced with the values from src.
+// MaxGauge and MinGauge are updated with the values from src.
+// Metrics missing in s are registered in s with the same names unless the limit set via SetMaxMetrics is exceeded.
+//
+// This allows aggregating per-worker sets into a global set before the exposition.
+//
+// Metrics, which cannot be merged, such as summaries and custom metrics registered via RegisterMetric, are skipped.
+// Metrics from child sets of src and metrics writers registered in src aren't merged.
+// Merge panics if metrics with the same name have distinct types in s and src.
+func (s *Set) Merge(src *Set) {
+	if src == s {
+		panic(fmt.Errorf("BUG: cannot merge the set into itself"))
+	}
+	sa, _ := src.getSortedMetrics()
+	for _, nm := range sa {
+		if nm.isAux || !isMergeableMetric(nm.metric) {
+			continue
+		}
+		dst := s.getOrRegisterForMerge(nm.name, nm.metric)
+		mergeMetric(nm.name, dst, nm.metric)
+	}
+}
+
+// isMergeableMetric returns true if m can be merged via Set.Merge.
+func isMergeableMetric(m metric) bool {
+	switch m.(type) {
+	case *Counter, *FloatCounter, *Gauge, *Int64Gauge, *Uint64Gauge, *BoolGauge, *MaxGauge, *MinGauge, *Histogram, *NativeHistogram:
+		return true
+	default:
+		return false
+	}
+}
+
+// getOrRegisterForMerge returns metric with the given name from s.
+//
+// If s doesn't contain the metric, then an empty metric of src type is registered in s.
+func (s *Set) getOrRegisterForMerge(name string, src metric) metric {
+	if nm := s.m.get(name); nm != nil {
+		return nm.metric
+	}
+
+	var m metric
+	switch t := src.(type) {
+	case *Counter:
+		m = &Counter{}
+	case *FloatCounter:
+		m = &FloatCounter{}
+	case *Gauge:
+		m = &Gauge{}
+	case *Int64Gauge:
+		m = &Int64Gauge{}
+	case *Uint64Gauge:
+		m = &Uint64Gauge{}
+	case *BoolGauge:
+		m = &BoolGauge{}
+	case *MaxGauge:
+		m = &MaxGauge{}
+	case *MinGauge:
+		m = &MinGauge{}
+	case *Histogram:
+		m = &Histogram{
+			exportedBucketsPerDecimal: t.exportedBucketsPerDecimal,
+		}
+	case *NativeHistogram:
+		m = newNativeHistogram(t.Schema())
+	default:
+		panic(fmt.Errorf("BUG: cannot merge metric %q of type %T", name, src))
+	}
+
+	s.mu.Lock()
+	if nm := s.m.get(name); nm != nil {
+		// The metric has been registered concurrently.
+		s.mu.Unlock()
+		return nm.metric
+	}
+	ok := s.mustRegisterLocked(name, m, false)
+	s.mu.Unlock()
+
+	s.notifyRegisterOrLimit(name, ok)
+	return m
+}
+
+// mergeMetric merges src metric with the given name into dst.
+func mergeMetric(name string, dst, src metric) {
+	typeMismatch := func() {
+		panic(fmt.Errorf("BUG: cannot merge metric %q of type %T into metric of type %T", name, src, dst))
+	}
+	switch t := src.(type) {
+	case *Counter:
+		d, ok := dst.(*Counter)
+		if !ok {
+			typeMismatch()
+		}
+		d.AddInt64(int64(t.GetAndReset()))
+	case *FloatCounter:
+		d, ok := dst.(*FloatCounter)
+		if !ok {
+			typeMismatch()
+		}
+		d.Add(t.GetAndReset())
+	case *Gauge:
+		d, ok := dst.(*Gauge)
+		if !ok {
+			typeMismatch()
+		}
+		d.Set(t.Get())
+	case *Int64Gauge:
+		d, ok := dst.(*Int64Gauge)
+		if !ok {
+			typeMismatch()
+		}
+		d.Set(t.Get())
+	case *Uint64Gauge:
+		d, ok := dst.(*Uint64Gauge)
+		if !ok {
+			typeMismatch()
+		}
+		d.Set(t.Get())
+	case *BoolGauge:
+		d, ok := dst.(*BoolGauge)
+		if !ok {
+			typeMismatch()
+		}
+		d.Set(t.Get())
+	case *MaxGauge:
+		d, ok := dst.(*MaxGauge)
+		if !ok {
+			typeMismatch()
+		}
+		t.mu.Lock()
+		v, hasValue := t.max, t.hasValue
+		t.mu.Unlock()
+		if hasValue {
+			d.Update(v)
+		}
+	case *MinGauge:
+		d, ok := dst.(*MinGauge)
+		if !ok {
+			typeMismatch()
+		}
+		t.mu.Lock()
+		v, hasValue := t.min, t.hasValue
+		t.mu.Unlock()
+		if hasValue {
+			d.Update(v)
+		}
+	case *Histogram:
+		d, ok := dst.(*Histogram)
+		if !ok {
+			typeMismatch()
+		}
+		d.mergeAndReset(t)
+	case *NativeHistogram:
+		d, ok := dst.(*NativeHistogram)
+		if !ok {
+			typeMismatch()
+		}
+		d.mergeAndReset(name, t)
+	default:
+		panic(fmt.Errorf("BUG: cannot merge metric %q of type %T", name, src))
+	}
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestSetMerge(t *testing.T) {
+	dst := NewSet()
+	dst.NewCounter("requests_total").Add(1)
+	dst.NewFloatCounter("bytes_total").Add(1.5)
+	dst.NewGauge("queue_size", nil).Set(10)
+	dst.NewHistogram("response_size").Update(10)
+
+	for i := 0; i < 2; i++ {
+		src := NewSet()
+		src.NewCounter("requests_total").Add(2)
+		src.NewFloatCounter("bytes_total").Add(0.25)
+		src.NewGauge("queue_size", nil).Set(3)
+		src.NewHistogram("response_size").Update(10)
+		src.NewMaxGauge("max_latency").Update(float64(i + 5))
+		src.NewNativeHistogram("native_size").Update(4)
+		src.NewCounter(`errors_total{code="500"}`).Add(1)
+		dst.Merge(src)
+	}
+
+	var bb bytes.Buffer
+	dst.WritePrometheus(&bb)
+	result := bb.String()
+	resultExpected := `bytes_total 2
+errors_total{code="500"} 2
+max_latency 6
+native_size_sum 8
+native_size_count 2
+queue_size 3
+requests_total 5
+response_size_bucket{vmrange="8.799e+00...1.000e+01"} 3
+response_size_sum 30
+response_size_count 3
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Repeated merges of the same src mustn't count its values multiple times
+	dst = NewSet()
+	src := NewSet()
+	src.NewCounter("requests_total").Add(2)
+	dst.Merge(src)
+	dst.Merge(src)
+	if n := dst.GetOrCreateCounter("requests_total").Get(); n != 2 {
+		t.Fatalf("unexpected requests_total after repeated merges; got %d; want 2", n)
+	}
+	if n := src.GetOrCreateCounter("requests_total").Get(); n != 0 {
+		t.Fatalf("unexpected requests_total in src after merge; got %d; want 0", n)
+	}
+
+	// Repeated merges of the same src with updates between merges
+	dst = NewSet()
+	src = NewSet()
+	c := src.NewCounter("requests_total")
+	fc := src.NewFloatCounter("bytes_total")
+	h := src.NewHistogram("response_size")
+	nh := src.NewNativeHistogram("native_size")
+	g := src.NewGauge("queue_size", nil)
+	for i := 0; i < 3; i++ {
+		c.Add(2)
+		fc.Add(0.5)
+		h.Update(10)
+		nh.Update(4)
+		g.Set(float64(i))
+		dst.Merge(src)
+	}
+	bb.Reset()
+	dst.WritePrometheus(&bb)
+	result = bb.String()
+	resultExpected = `bytes_total 1.5
+native_size_sum 12
+native_size_count 3
+queue_size 2
+requests_total 6
+response_size_bucket{vmrange="8.799e+00...1.000e+01"} 3
+response_size_sum 30
+response_size_count 3
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output after repeated merges;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Unsupported metric types must be skipped
+	src = NewSet()
+	src.NewSummary("duration_seconds").Update(1)
+	src.RegisterMetric("custom", &testCustomMetric{})
+	src.NewCounter("requests_total").Add(1)
+	dst.Merge(src)
+	if _, ok := dst.GetMetric("duration_seconds"); ok {
+		t.Fatalf("summary mustn't be merged")
+	}
+	if _, ok := dst.GetMetric("custom"); ok {
+		t.Fatalf("custom metric mustn't be merged")
+	}
+	if n := dst.GetOrCreateCounter("requests_total").Get(); n != 7 {
+		t.Fatalf("unexpected requests_total after merge; got %d; want 7", n)
+	}
+
+	// Type mismatch
+	src = NewSet()
+	src.NewFloatCounter("requests_total").Add(1)
+	expectPanic(t, "Merge(type mismatch)", func() { dst.Merge(src) })
+
+	// Self-merge
+	expectPanic(t, "Merge(self)", func() { dst.Merge(dst) })
+}
+
+func TestSetMergeConcurrent(t *testing.T) {
+	const workers = 4
+	const iterations = 10000
+	dst := NewSet()
+	src := NewSet()
+	c := src.NewCounter("requests_total")
+	fc := src.NewFloatCounter("bytes_total")
+	h := src.NewHistogram("response_size")
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				c.Inc()
+				fc.Add(1)
+				h.Update(1)
+			}
+		}()
+	}
+	doneCh := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(doneCh)
+	}()
+	for {
+		select {
+		case <-doneCh:
+			dst.Merge(src)
+			if n := dst.GetOrCreateCounter("requests_total").Get(); n != workers*iterations {
+				t.Fatalf("unexpected requests_total; got %d; want %d", n, workers*iterations)
+			}
+			if n := dst.GetOrCreateFloatCounter("bytes_total").Get(); n != workers*iterations {
+				t.Fatalf("unexpected bytes_total; got %v; want %d", n, workers*iterations)
+			}
+			if n := getHistogramCount(dst.GetOrCreateHistogram("response_size")); n != workers*iterations {
+				t.Fatalf("unexpected response_size count; got %d; want %d", n, workers*iterations)
+			}
+			return
+		default:
+			// Updates to src made concurrently with Merge mustn't be lost.
+			dst.Merge(src)
+		}
+	}
+}
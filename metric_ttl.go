@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// SetMetricTTL enables automatic unregistering of metrics in s, which weren't accessed for longer than ttl.
+//
+// A metric is accessed when it is updated or when it is obtained via GetOrCreate* functions or *Vec types.
+// Only metrics created via GetOrCreate* functions and *Vec types are unregistered, since they are re-registered
+// on the next access via the same functions. Metrics created via New* functions, gauges with callbacks
+// and metrics registered via other functions are never unregistered. This prevents from unbounded growth
+// of the number of metrics created dynamically for per-user or per-path series.
+//
+// Idle metrics are detected and unregistered during s.WritePrometheus and s.WritePrometheusProtobuf calls,
+// so accesses are tracked with the precision of the interval between these calls.
+// Metrics obtained via GetOrCreate* functions mustn't be cached by the caller for longer than ttl without updates,
+// since updates to unregistered metrics are lost.
+//
+// The ttl applies only to metrics registered in s. It doesn't apply to child sets.
+// Pass zero ttl in order to disable automatic unregistering. It is disabled by default.
+func (s *Set) SetMetricTTL(ttl time.Duration) {
+	if ttl < 0 {
+		panic(fmt.Errorf("BUG: ttl cannot be negative; got %s", ttl))
+	}
+	s.mu.Lock()
+	s.metricTTL = ttl
+	s.mu.Unlock()
+}
+
+// accessTracker tracks accesses to metrics, which may be unregistered by Set.SetMetricTTL.
+//
+// It is embedded into metric types, which can be created via GetOrCreate* functions.
+type accessTracker struct {
+	accessed uint32
+}
+
+// markAccessed marks the metric as accessed.
+func (at *accessTracker) markAccessed() {
+	// Check the flag before the update in order to avoid cache line contention on frequently updated metrics.
+	if atomic.LoadUint32(&at.accessed) == 0 {
+		atomic.StoreUint32(&at.accessed, 1)
+	}
+}
+
+// getAndResetAccessed returns true if the metric has been accessed since the previous call.
+func (at *accessTracker) getAndResetAccessed() bool {
+	return atomic.SwapUint32(&at.accessed, 0) != 0
+}
+
+type accessedMetric interface {
+	markAccessed()
+	getAndResetAccessed() bool
+}
+
+// markMetricAccessed marks m as accessed if it tracks accesses.
+func markMetricAccessed(m metric) {
+	if am, ok := m.(accessedMetric); ok {
+		am.markAccessed()
+	}
+}
+
+// removeIdleMetrics unregisters expirable metrics in s, which weren't accessed during the configured ttl.
+func (s *Set) removeIdleMetrics() {
+	currentTime := now()
+
+	s.mu.Lock()
+	ttl := s.metricTTL
+	if ttl <= 0 {
+		s.mu.Unlock()
+		return
+	}
+	var removed []*namedMetric
+	for _, nm := range s.a {
+		if !nm.expirable {
+			continue
+		}
+		am := nm.metric.(accessedMetric)
+		if am.getAndResetAccessed() || nm.lastAccess.IsZero() {
+			nm.lastAccess = currentTime
+			continue
+		}
+		if currentTime.Sub(nm.lastAccess) > ttl {
+			removed = append(removed, nm)
+		}
+	}
+	removedVecs := make([][]*metricVec, len(removed))
+	for i, nm := range removed {
+		s.unregisterMetricLocked(nm)
+		removedVecs[i] = s.vecs[getMetricFamily(nm.name)]
+	}
+	s.mu.Unlock()
+
+	// Remove the unregistered metrics from vecs without holding s.mu,
+	// since metricVec.deleteLabelValues locks s.mu under metricVec.mu.
+	for i, nm := range removed {
+		for _, mv := range removedVecs[i] {
+			mv.forgetMetric(nm.name, nm.metric)
+		}
+		s.notifyUnregister(nm.name)
+	}
+}
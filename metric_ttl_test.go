@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSetMetricTTL(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	s := NewSet()
+	s.SetMetricTTL(time.Minute)
+	active := s.GetOrCreateCounter(`active_total`)
+	s.GetOrCreateCounter(`idle_total`).Inc()
+	zeroGauge := s.GetOrCreateGauge(`zero_gauge`, nil)
+	gv := s.NewGaugeVec("path_gauge", []string{"path"})
+	gv.WithLabelValues("/foo").Set(1)
+	s.GetOrCreateSummary("idle_summary").Update(1)
+
+	writeMetrics := func() string {
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		return bb.String()
+	}
+
+	writeMetrics()
+	for i := 0; i < 3; i++ {
+		fc.Advance(30 * time.Second)
+		active.Inc()
+		// Updates with the same value must prevent from expiration.
+		zeroGauge.Set(0)
+		writeMetrics()
+	}
+
+	result := writeMetrics()
+	resultExpected := `active_total 3
+zero_gauge 0
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+	}
+	if names := s.ListMetricNames(); len(names) != 2 {
+		t.Fatalf("unexpected metric names after expiration: %q", names)
+	}
+	if n, nKeys := len(gv.mv.m), len(gv.mv.keys); n != 0 || nKeys != 0 {
+		t.Fatalf("expired metric must be removed from vec cache; got %d cached metrics and %d keys", n, nKeys)
+	}
+
+	// The expired metric must be re-created on the next access.
+	gv.WithLabelValues("/foo").Set(2)
+	s.GetOrCreateCounter(`idle_total`).Inc()
+	result = writeMetrics()
+	resultExpected = `active_total 3
+idle_total 1
+path_gauge{path="/foo"} 2
+zero_gauge 0
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Disabled ttl mustn't remove metrics.
+	s.SetMetricTTL(0)
+	fc.Advance(time.Hour)
+	if result := writeMetrics(); result != resultExpected {
+		t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestSetMetricTTLNonExpirable(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	s := NewSet()
+	s.SetMetricTTL(10 * time.Minute)
+	c := s.NewCounter("requests_total")
+	g := s.NewGauge("temperature", nil)
+	s.NewGauge("start_time_seconds", func() float64 {
+		return 123
+	})
+	s.GetOrCreateGauge("uptime_seconds", func() float64 {
+		return 456
+	})
+	sm := s.NewSummaryExt("duration_seconds", time.Hour, []float64{1})
+	sm.Update(1)
+
+	writeMetrics := func() string {
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		return bb.String()
+	}
+	for i := 0; i < 30; i++ {
+		writeMetrics()
+		fc.Advance(time.Minute)
+	}
+
+	// Handles for metrics created via New* functions must remain usable past ttl.
+	c.Inc()
+	g.Set(5)
+	result := writeMetrics()
+	resultExpected := `duration_seconds_sum 1
+duration_seconds_count 1
+duration_seconds{quantile="1"} 1
+requests_total 1
+start_time_seconds 123
+temperature 5
+uptime_seconds 456
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+	}
+}
@@ -13,19 +13,36 @@
 package metrics
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 type namedMetric struct {
+	// created is the creation timestamp in milliseconds for the metric. It must be accessed atomically.
+	//
+	// It is put at the top of the struct in order to guarantee 64-bit alignment for atomic operations on 32-bit platforms.
+	created int64
+
 	name   string
 	metric metric
 	isAux  bool
+
+	// sortKey is used for ordering metrics during exposition. See getMetricSortKey.
+	sortKey string
+
+	// expirable is set for metrics created via GetOrCreate* functions, which may be unregistered by Set.SetMetricTTL.
+	// Such metrics must implement accessedMetric interface.
+	expirable bool
+
+	// lastAccess is the last time the metric was seen accessed. It is used for detecting idle metrics.
+	lastAccess time.Time
 }
 
 type metric interface {
@@ -33,23 +50,58 @@ type metric interface {
 	metricType() string
 }
 
-var defaultSet = NewSet()
+// defaultSetValue holds the default set. It may be replaced via SetDefaultSet.
+var defaultSetValue atomic.Value
+
+func defaultSet() *Set {
+	return defaultSetValue.Load().(*Set)
+}
 
 func init() {
-	RegisterSet(defaultSet)
+	SetDefaultSet(NewSet())
 }
 
 var (
-	registeredSets     = make(map[*Set]struct{})
+	// registeredSets contains registered sets with their RegisterSetOpts.
+	registeredSets     = make(map[*Set]*RegisterSetOpts)
 	registeredSetsLock sync.Mutex
 )
 
 // RegisterSet registers the given set s for metrics export via global WritePrometheus() call.
 //
-// See also UnregisterSet.
+// See also RegisterSetExt and UnregisterSet.
 func RegisterSet(s *Set) {
+	RegisterSetExt(s, nil)
+}
+
+// RegisterSetOpts contains options for RegisterSetExt.
+type RegisterSetOpts struct {
+	// Prefix is prepended to names of all the metrics from the set at global WritePrometheus() call, e.g. `myapp_`.
+	//
+	// This allows namespacing generic metric names of embedded libraries by the host application.
+	Prefix string
+}
+
+// RegisterSetExt registers the given set s with the given opts for metrics export via global WritePrometheus() call.
+//
+// opts may contain additional configuration options if non-nil.
+// Registering already registered s replaces its opts.
+//
+// See also UnregisterSet.
+func RegisterSetExt(s *Set, opts *RegisterSetOpts) {
+	if opts == nil {
+		opts = &RegisterSetOpts{}
+	} else {
+		optsCopy := *opts
+		opts = &optsCopy
+	}
+	if opts.Prefix != "" {
+		if err := validateIdent(opts.Prefix); err != nil {
+			panic(fmt.Errorf("BUG: invalid metric name prefix %q: %s", opts.Prefix, err))
+		}
+	}
 	registeredSetsLock.Lock()
-	registeredSets[s] = struct{}{}
+	registeredSets[s] = opts
 	registeredSetsLock.Unlock()
 }
 
@@ -69,13 +121,13 @@ func UnregisterSet(s *Set, destroySet bool) {
 
 // RegisterMetricsWriter registers writeMetrics callback for including metrics in the output generated by WritePrometheus.
 //
-// The writeMetrics callback must write metrics to w in Prometheus text exposition format without timestamps and trailing comments.
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format without trailing comments.
 // The last line generated by writeMetrics must end with \n.
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md#text-based-format
 //
 // It is OK to register multiple writeMetrics callbacks - all of them will be called sequentially for gererating the output at WritePrometheus.
 func RegisterMetricsWriter(writeMetrics func(w io.Writer)) {
-	defaultSet.RegisterMetricsWriter(writeMetrics)
+	defaultSet().RegisterMetricsWriter(writeMetrics)
 }
 
 // WritePrometheus writes all the metrics in Prometheus format from the default set, all the added sets and metrics writers to w.
@@ -92,24 +144,100 @@ func RegisterMetricsWriter(writeMetrics func(w io.Writer)) {
 //	    metrics.WritePrometheus(w, true)
 //	})
 func WritePrometheus(w io.Writer, exposeProcessMetrics bool) {
+	writeGlobalPrometheus(w, exposeProcessMetrics, nil)
+}
+
+// writeGlobalPrometheus writes metrics from all the registered sets and metrics writers to w in Prometheus format.
+//
+// Only metrics from sets, for which keep returns true, are written. All the metrics are written if keep is nil.
+func writeGlobalPrometheus(w io.Writer, exposeProcessMetrics bool, keep func(name string) bool) {
+	for _, rs := range getRegisteredSets() {
+		setKeep := rs.getKeep(keep)
+		if rs.prefix == "" {
+			rs.s.writePrometheusFiltered(w, setKeep)
+			continue
+		}
+		var bb bytes.Buffer
+		rs.s.writePrometheusFiltered(newMetadataWriter(&bb, isMetadataEnabledFor(w)), setKeep)
+		w.Write(addMetricNamePrefix(nil, bb.Bytes(), rs.prefix))
+	}
+	if exposeProcessMetrics {
+		WriteProcessMetrics(w)
+	}
+}
+
+// registeredSet is a set registered via RegisterSetExt.
+type registeredSet struct {
+	s      *Set
+	prefix string
+}
+
+// getKeep returns keep func for metric names in rs.s, which takes into account rs.prefix.
+func (rs *registeredSet) getKeep(keep func(name string) bool) func(name string) bool {
+	if keep == nil || rs.prefix == "" {
+		return keep
+	}
+	prefix := rs.prefix
+	return func(name string) bool {
+		return keep(prefix + name)
+	}
+}
+
+// getRegisteredSets returns registered sets in stable order.
+func getRegisteredSets() []registeredSet {
 	registeredSetsLock.Lock()
-	sets := make([]*Set, 0, len(registeredSets))
-	for s := range registeredSets {
-		sets = append(sets, s)
+	sets := make([]registeredSet, 0, len(registeredSets))
+	for s, opts := range registeredSets {
+		sets = append(sets, registeredSet{
+			s:      s,
+			prefix: opts.Prefix,
+		})
 	}
 	registeredSetsLock.Unlock()
 
 	sort.Slice(sets, func(i, j int) bool {
-		return uintptr(unsafe.Pointer(sets[i])) < uintptr(unsafe.Pointer(sets[j]))
+		return uintptr(unsafe.Pointer(sets[i].s)) < uintptr(unsafe.Pointer(sets[j].s))
 	})
-	for _, s := range sets {
-		s.WritePrometheus(w)
-	}
-	if exposeProcessMetrics {
-		WriteProcessMetrics(w)
-	}
+	return sets
+}
+
+// addMetricNamePrefix appends lines from src in Prometheus text exposition format to dst
+// with the prefix prepended to metric names and returns the result.
+//
+// The prefix is also prepended to metric names in `# HELP` and `# TYPE` comments.
+func addMetricNamePrefix(dst, src []byte, prefix string) []byte {
+	visitLines(src, func(line []byte) {
+		switch {
+		case bytes.HasPrefix(line, helpPrefixBytes) || bytes.HasPrefix(line, typePrefixBytes):
+			n := len(helpPrefixBytes)
+			if line[n] == '"' {
+				dst = insertAfterOpeningQuote(dst, line, prefix)
+			} else {
+				dst = append(dst, line[:n]...)
+				dst = append(dst, prefix...)
+				dst = append(dst, line[n:]...)
+			}
+		case bytes.HasPrefix(line, bashBytes):
+			// Copy the rest of comments as is
+			dst = append(dst, line...)
+		case bytes.HasPrefix(line, quotedNamePrefixBytes):
+			dst = insertAfterOpeningQuote(dst, line, prefix)
+		default:
+			dst = append(dst, prefix...)
+			dst = append(dst, line...)
+		}
+		dst = append(dst, '\n')
+	})
+	return dst
 }
 
+var (
+	helpPrefixBytes = []byte("# HELP ")
+	typePrefixBytes = []byte("# TYPE ")
+
+	quotedNamePrefixBytes = []byte(`{"`)
+)
+
 // WriteProcessMetrics writes additional process metrics in Prometheus format to w.
 //
 // The following `go_*` and `process_*` metrics are exposed for the currently
@@ -163,11 +291,16 @@ func WritePrometheus(w io.Writer, exposeProcessMetrics bool) {
 //
 //   - go_gc_cpu_seconds_total - summary time spent in GC
 //
-//   - go_gc_pauses_seconds - duration of GC pauses
+//   - go_gc_pauses_seconds - histogram of stop-the-world pause durations caused by GC; unlike go_gc_duration_seconds,
+//     it can be aggregated across multiple instances
+//
+//   - go_gc_duration_seconds - quantiles for the durations of the last 256 GC pauses
 //
 //   - go_scavenge_cpu_seconds_total - CPU time spent on returning the memory to OS
 //
-//   - go_memlimit_bytes - the GOMEMLIMIT env var value
+//   - go_memlimit_bytes - the GOMEMLIMIT env var value or the value set via debug.SetMemoryLimit
+//
+//   - go_gogc_percent - the GOGC env var value or the value set via debug.SetGCPercent; -1 if GC is disabled
 //
 //   - go_memstats_alloc_bytes - memory usage for Go objects in the heap
 //
@@ -229,11 +362,111 @@ func WritePrometheus(w io.Writer, exposeProcessMetrics bool) {
 //	    metrics.WriteProcessMetrics(w)
 //	})
 //
+// Additional `process_*` metrics can be enabled via WriteProcessMetricsExt. See ProcessMetricsOptions for details.
+//
 // See also WriteFDMetrics.
 func WriteProcessMetrics(w io.Writer) {
+	WriteProcessMetricsExt(w, &ProcessMetricsOptions{
+		DisableFDCount: true,
+	})
+}
+
+// ProcessMetricsOptions contains options for WriteProcessMetricsExt.
+//
+// Collectors, which may noticeably increase scrape latency or which expose metrics beyond the process itself,
+// are disabled by default and must be enabled explicitly.
+type ProcessMetricsOptions struct {
+	// DisableFDCount disables writing `process_max_fds` and `process_open_fds` metrics.
+	//
+	// Counting open file descriptors may be expensive for processes with big number of open files.
+	// See WriteFDMetrics.
+	DisableFDCount bool
+
+	// EnableFDTypes enables writing `process_open_fds{type="..."}` metrics with the number of open file descriptors
+	// per type such as socket, pipe, file, eventfd and anon_inode (Linux only).
+	//
+	// This helps determining the source of file descriptor leaks. It is disabled by default,
+	// since it requires resolving every open file descriptor.
+	//
+	// The unlabeled `process_open_fds` metric isn't written when this option is enabled,
+	// so `sum(process_open_fds)` returns the total number of open file descriptors.
+	EnableFDTypes bool
+
+	// EnableNetworkMetrics enables writing the following metrics (Linux only):
+	//
+	//   - process_network_receive_bytes_total{interface="..."} - the number of bytes received via the given network interface
+	//   - process_network_transmit_bytes_total{interface="..."} - the number of bytes transmitted via the given network interface
+	//
+	// These metrics are read from /proc/self/net/dev, so they contain totals for all the processes in the network namespace
+	// of the current process. They are equal to host-wide totals if the process runs in the host network namespace.
+	EnableNetworkMetrics bool
+
+	// EnableSchedstat enables writing the following metrics (Linux only):
+	//
+	//   - process_schedstat_running_seconds_total - the time threads of the process spent running on CPU
+	//   - process_schedstat_waiting_seconds_total - the time threads of the process spent waiting in the run queue for CPU
+	//   - process_schedstat_timeslices_total - the number of timeslices threads of the process ran on CPU
+	//
+	// Reading scheduler stats requires reading a file per every thread of the process.
+	EnableSchedstat bool
+
+	// EnableNUMA enables writing `process_numa_resident_bytes{node="..."}` metrics with the resident memory
+	// of the process per NUMA node according to /proc/self/numa_maps (Linux only).
+	//
+	// Reading numa_maps is expensive for processes with big number of memory mappings.
+	EnableNUMA bool
+
+	// EnableSmaps enables writing the following metrics obtained from /proc/self/smaps_rollup (Linux only):
+	//
+	//   - process_anon_rss_bytes - RSS for anonymous memory
+	//   - process_pagecache_rss_bytes - RSS for file-backed and shared memory
+	//   - process_hugepages_anon_bytes - anonymous memory backed by transparent huge pages
+	//   - process_hugepages_shmem_bytes - shared memory backed by transparent huge pages
+	//   - process_hugepages_file_bytes - file-backed memory backed by transparent huge pages
+	//   - process_hugetlb_bytes - memory backed by hugetlbfs pages
+	//
+	// smaps_rollup is expensive to read for processes with big number of memory mappings,
+	// so the metrics are updated in background every SmapsRefreshInterval.
+	EnableSmaps bool
+
+	// SmapsRefreshInterval is the interval for updating metrics enabled via EnableSmaps.
+	//
+	// The metrics are updated in background, so the scrape doesn't wait for reading smaps_rollup.
+	// By default the metrics are updated every minute.
+	SmapsRefreshInterval time.Duration
+
+	// EnableCgroupMetrics enables writing the following metrics (Linux only):
+	//
+	//   - process_cpu_cores_available - the number of CPU cores available to the process according to cgroup CPU quota
+	//   - process_cpu_throttled_seconds_total - the time the process was throttled because of cgroup CPU quota
+	//   - process_cgroup_memory_limit_bytes - the memory limit for cgroup v2 of the process (if the limit is set)
+	//   - process_cgroup_memory_usage_bytes - the memory usage for cgroup v2 of the process
+	//   - process_cgroup_cpu_limit_cores - the CPU limit in cores for cgroup v2 of the process (if the limit is set)
+	//   - process_cgroup_cpu_usage_seconds_total - CPU time spent by cgroup v2 of the process
+	//   - process_cgroup_cpu_periods_total - the number of CPU enforcement periods for cgroup v2 of the process
+	//   - process_cgroup_cpu_throttled_periods_total - the number of periods when cgroup v2 of the process was throttled
+	//   - process_cgroup_cpu_throttled_seconds_total - the time cgroup v2 of the process was throttled
+	EnableCgroupMetrics bool
+}
+
+// WriteProcessMetricsExt writes `go_*` and `process_*` metrics for the current process to w according to opts.
+//
+// Unlike WriteProcessMetrics, it also writes metrics from WriteFDMetrics unless opts.DisableFDCount is set.
+// See WriteProcessMetrics for the list of exposed metrics and ProcessMetricsOptions for additional metrics.
+//
+// opts may be nil. In this case only the default collectors are used.
+func WriteProcessMetricsExt(w io.Writer, opts *ProcessMetricsOptions) {
+	if opts == nil {
+		opts = &ProcessMetricsOptions{}
+	}
 	writeGoMetrics(w)
-	writeProcessMetrics(w)
+	writeProcessMetrics(w, opts)
+	fdTypesWritten := opts.EnableFDTypes && writeFDTypeMetrics(w, !opts.DisableFDCount)
+	if !opts.DisableFDCount && !fdTypesWritten {
+		writeFDMetrics(w)
+	}
 	writePushMetrics(w)
+	writeHandlerMetrics(w)
 }
 
 // WriteFDMetrics writes `process_max_fds` and `process_open_fds` metrics to w.
@@ -241,34 +474,132 @@ func WriteFDMetrics(w io.Writer) {
 	writeFDMetrics(w)
 }
 
+// WriteGoRuntimeMetrics writes all the metrics supported by runtime/metrics package in the current Go runtime to w.
+//
+// Runtime metric names are converted to Prometheus-compatible names with `go_` prefix.
+// For example, `/memory/classes/heap/free:bytes` is written as `go_memory_classes_heap_free_bytes`.
+// `_total` suffix is added to names of cumulative metrics. Histograms are written with the reduced number of buckets.
+// See https://pkg.go.dev/runtime/metrics#hdr-Supported_metrics for the list of runtime metrics.
+//
+// Only runtime metrics with names matching the matcher are written. All the metrics are written if matcher is nil.
+// For example, the following code writes only `/memory/classes/*` metrics:
+//
+//	metrics.WriteGoRuntimeMetrics(w, func(name string) bool {
+//	    return strings.HasPrefix(name, "/memory/classes/")
+//	})
+//
+// Some of the written metrics may have the same names as metrics written by WriteProcessMetrics,
+// e.g. `go_gc_pauses_seconds`. Exclude them with the matcher if both functions are used for the same output.
+func WriteGoRuntimeMetrics(w io.Writer, matcher func(name string) bool) {
+	writeAllRuntimeMetrics(w, matcher)
+}
+
+// WriteThreadCPUMetrics writes CPU time metrics per thread name for the current process to w.
+//
+// The following metrics are written for every distinct thread name (comm):
+//
+//   - process_thread_cpu_seconds_total{comm="..."} - CPU time spent by threads with the given name
+//   - process_thread_cpu_seconds_system_total{comm="..."} - CPU time spent by threads with the given name in syscalls
+//   - process_thread_cpu_seconds_user_total{comm="..."} - CPU time spent by threads with the given name in userspace
+//   - process_threads{comm="..."} - the number of threads with the given name
+//
+// This helps determining threads, which consume CPU, such as threads created by cgo code.
+// Metrics for the given name may decrease when threads exit. Go runtime threads share the process name.
+//
+// It is expensive to obtain these metrics for processes with many threads, so they aren't written by WriteProcessMetrics.
+// Register them explicitly if needed:
+//
+//	metrics.RegisterMetricsWriter(metrics.WriteThreadCPUMetrics)
+//
+// The metrics are supported only on Linux.
+func WriteThreadCPUMetrics(w io.Writer) {
+	writeThreadCPUMetrics(w)
+}
+
+// WriteChildProcessMetrics writes summary metrics for child processes of the current process to w.
+//
+// The following metrics are written:
+//
+//   - process_children_cpu_seconds_total - CPU time spent by child processes
+//   - process_children_cpu_seconds_system_total - CPU time spent by child processes in syscalls
+//   - process_children_cpu_seconds_user_total - CPU time spent by child processes in userspace
+//   - process_children_resident_memory_bytes - RSS of running child processes
+//   - process_num_children - the number of running child processes
+//
+// The metrics have distinct names from the corresponding metrics written by WriteProcessMetrics,
+// so they can be written together without splitting metric families.
+//
+// The metrics cover all the descendants of the current process, e.g. forked workers and exec'ed helpers.
+// CPU time includes the time of running descendants and the time of terminated children, which were waited for.
+// The CPU time may decrease when a child process terminates and isn't waited for.
+//
+// It is expensive to obtain these metrics, since all the processes in /proc must be inspected,
+// so they aren't written by WriteProcessMetrics. Register them explicitly if needed:
+//
+//	metrics.RegisterMetricsWriter(metrics.WriteChildProcessMetrics)
+//
+// The metrics are supported only on Linux.
+func WriteChildProcessMetrics(w io.Writer) {
+	writeChildProcessMetrics(w)
+}
+
 // UnregisterMetric removes metric with the given name from default set.
 //
 // See also UnregisterAllMetrics.
 func UnregisterMetric(name string) bool {
-	return defaultSet.UnregisterMetric(name)
+	return defaultSet().UnregisterMetric(name)
 }
 
 // UnregisterAllMetrics unregisters all the metrics from default set.
 //
 // It also unregisters writeMetrics callbacks passed to RegisterMetricsWriter.
 func UnregisterAllMetrics() {
-	defaultSet.UnregisterAllMetrics()
+	defaultSet().UnregisterAllMetrics()
+}
+
+// ResetAll resets counters, histograms and summaries in default set.
+//
+// See Set.ResetAll for details.
+func ResetAll() {
+	defaultSet().ResetAll()
 }
 
 // ListMetricNames returns sorted list of all the metric names from default set.
 func ListMetricNames() []string {
-	return defaultSet.ListMetricNames()
+	return defaultSet().ListMetricNames()
 }
 
 // GetDefaultSet returns the default metrics set.
+//
+// See also SetDefaultSet.
 func GetDefaultSet() *Set {
-	return defaultSet
+	return defaultSet()
+}
+
+// SetDefaultSet replaces the default metrics set with s.
+//
+// This allows redirecting metrics registered via package-level functions such as NewCounter and GetOrCreateCounter
+// into an application-controlled set, e.g. a set with common labels or with idle metrics expiration.
+//
+// s is registered for metrics export via global WritePrometheus() call. Metrics registered in the previous
+// default set aren't moved to s, and the previous default set remains registered for the export.
+// It can be unregistered via UnregisterSet if needed.
+//
+// SetDefaultSet should be called at program start before registering metrics via package-level functions.
+func SetDefaultSet(s *Set) {
+	if s == nil {
+		panic(fmt.Errorf("BUG: default set cannot be nil"))
+	}
+	RegisterSet(s)
+	defaultSetValue.Store(s)
 }
 
 // ExposeMetadata allows enabling adding TYPE and HELP metadata to the exposed metrics globally.
 //
 // It is safe to call this method multiple times. It is allowed to change it in runtime.
 // ExposeMetadata is set to false by default.
+//
+// Use WritePrometheusWithOptions for exposing metadata independently per handler.
 func ExposeMetadata(v bool) {
 	n := 0
 	if v {
@@ -308,6 +639,44 @@ func WriteCounterFloat64(w io.Writer, name string, value float64) {
 	writeMetricFloat64(w, name, "counter", value)
 }
 
+// WriteGaugeUint64WithTimestamp writes gauge metric with the given name, value and timestamp to w in Prometheus text exposition format.
+//
+// The timestamp is written in milliseconds after the value. This is useful when re-exporting metrics collected from external systems.
+func WriteGaugeUint64WithTimestamp(w io.Writer, name string, value uint64, timestamp time.Time) {
+	writeMetricUint64WithTimestamp(w, name, "gauge", value, timestamp)
+}
+
+// WriteGaugeFloat64WithTimestamp writes gauge metric with the given name, value and timestamp to w in Prometheus text exposition format.
+//
+// The timestamp is written in milliseconds after the value. This is useful when re-exporting metrics collected from external systems.
+func WriteGaugeFloat64WithTimestamp(w io.Writer, name string, value float64, timestamp time.Time) {
+	writeMetricFloat64WithTimestamp(w, name, "gauge", value, timestamp)
+}
+
+// WriteCounterUint64WithTimestamp writes counter metric with the given name, value and timestamp to w in Prometheus text exposition format.
+//
+// The timestamp is written in milliseconds after the value. This is useful when re-exporting metrics collected from external systems.
+func WriteCounterUint64WithTimestamp(w io.Writer, name string, value uint64, timestamp time.Time) {
+	writeMetricUint64WithTimestamp(w, name, "counter", value, timestamp)
+}
+
+// WriteCounterFloat64WithTimestamp writes counter metric with the given name, value and timestamp to w in Prometheus text exposition format.
+//
+// The timestamp is written in milliseconds after the value. This is useful when re-exporting metrics collected from external systems.
+func WriteCounterFloat64WithTimestamp(w io.Writer, name string, value float64, timestamp time.Time) {
+	writeMetricFloat64WithTimestamp(w, name, "counter", value, timestamp)
+}
+
+func writeMetricUint64WithTimestamp(w io.Writer, metricName, metricType string, value uint64, timestamp time.Time) {
+	WriteMetadataIfNeeded(w, metricName, metricType)
+	fmt.Fprintf(w, "%s %d %d\n", metricName, value, timestamp.UnixNano()/1e6)
+}
+
+func writeMetricFloat64WithTimestamp(w io.Writer, metricName, metricType string, value float64, timestamp time.Time) {
+	WriteMetadataIfNeeded(w, metricName, metricType)
+	fmt.Fprintf(w, "%s %g %d\n", metricName, value, timestamp.UnixNano()/1e6)
+}
+
 func writeMetricUint64(w io.Writer, metricName, metricType string, value uint64) {
 	WriteMetadataIfNeeded(w, metricName, metricType)
 	fmt.Fprintf(w, "%s %d\n", metricName, value)
@@ -320,20 +689,44 @@ func writeMetricFloat64(w io.Writer, metricName, metricType string, value float6
 
 // WriteMetadataIfNeeded writes HELP and TYPE metadata for the given metricName and metricType if this is globally enabled via ExposeMetadata().
 //
+// The global setting is overridden by WriteOptions if w is passed to metrics writers by WritePrometheusWithOptions.
+//
 // If the metadata exposition isn't enabled, then this function is no-op.
 func WriteMetadataIfNeeded(w io.Writer, metricName, metricType string) {
-	if !isMetadataEnabled() {
-		return
-	}
-	metricFamily := getMetricFamily(metricName)
-	fmt.Fprintf(w, "# HELP %s\n", metricFamily)
-	fmt.Fprintf(w, "# TYPE %s %s\n", metricFamily, metricType)
+	writeMetadataIfNeeded(w, metricName, metricType, "")
 }
 
 func getMetricFamily(metricName string) string {
-	n := strings.IndexByte(metricName, '{')
-	if n < 0 {
-		return metricName
+	family, _ := splitMetricName(metricName)
+	return family
+}
+
+// getMetricSortKey returns the key for ordering the metric with the given name during exposition.
+//
+// Metrics are grouped by metric family, so every family is exposed as a single contiguous block
+// with a single HELP and TYPE metadata. Auxiliary summary quantiles are put after the parent summary,
+// so all the series for the summary are contiguous.
+func getMetricSortKey(name string, isAux bool) string {
+	family := getMetricFamily(name)
+	parent := name
+	auxMarker := "0"
+	if isAux {
+		parent = getSummaryName(name)
+		auxMarker = "1"
+	}
+	return family + "\x00" + parent + "\x00" + auxMarker + name
+}
+
+// getSummaryName returns the name of the parent summary for the given name of auxiliary summary quantile.
+//
+// Quantile names are created via addTag(summaryName, `quantile="..."`).
+func getSummaryName(quantileName string) string {
+	n := strings.LastIndex(quantileName, `quantile="`)
+	if n <= 0 {
+		return quantileName
+	}
+	if quantileName[n-1] == '{' {
+		return quantileName[:n-1]
 	}
-	return metricName[:n]
+	return quantileName[:n-1] + "}"
 }
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// metricsMapShards is the number of shards in metricsMap.
+//
+// It must be a power of 2.
+const metricsMapShards = 64
+
+// metricsMap maps metric names to namedMetric.
+//
+// The map is split into shards with distinct locks in order to reduce lock contention
+// when metrics are looked up by name from many goroutines, e.g. via GetOrCreateCounter.
+type metricsMap struct {
+	shards [metricsMapShards]metricsMapShard
+}
+
+type metricsMapShard struct {
+	mu sync.Mutex
+	m  map[string]*namedMetric
+
+	// The padding prevents false sharing between adjacent shards on platforms with cache lines up to 128 bytes.
+	_ [128 - unsafe.Sizeof(sync.Mutex{}) - unsafe.Sizeof(map[string]*namedMetric(nil))]byte
+}
+
+func newMetricsMap() *metricsMap {
+	var mm metricsMap
+	for i := range mm.shards {
+		mm.shards[i].m = make(map[string]*namedMetric)
+	}
+	return &mm
+}
+
+func (mm *metricsMap) getShard(name string) *metricsMapShard {
+	// Use inlined FNV-1a hash in order to avoid memory allocations.
+	h := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= 16777619
+	}
+	return &mm.shards[h&(metricsMapShards-1)]
+}
+
+// get returns namedMetric for the given name.
+//
+// nil is returned if there is no metric with the given name.
+func (mm *metricsMap) get(name string) *namedMetric {
+	shard := mm.getShard(name)
+	shard.mu.Lock()
+	nm := shard.m[name]
+	shard.mu.Unlock()
+	return nm
+}
+
+// add adds nm to mm.
+func (mm *metricsMap) add(nm *namedMetric) {
+	shard := mm.getShard(nm.name)
+	shard.mu.Lock()
+	shard.m[nm.name] = nm
+	shard.mu.Unlock()
+}
+
+// delete removes metric with the given name from mm.
+func (mm *metricsMap) delete(name string) {
+	shard := mm.getShard(name)
+	shard.mu.Lock()
+	delete(shard.m, name)
+	shard.mu.Unlock()
+}
+
+// len returns the number of metrics in mm.
+func (mm *metricsMap) len() int {
+	n := 0
+	for i := range mm.shards {
+		shard := &mm.shards[i]
+		shard.mu.Lock()
+		n += len(shard.m)
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// forEach calls f for every metric in mm.
+//
+// f is called under shard lock, so it mustn't access mm.
+func (mm *metricsMap) forEach(f func(nm *namedMetric)) {
+	for i := range mm.shards {
+		shard := &mm.shards[i]
+		shard.mu.Lock()
+		for _, nm := range shard.m {
+			f(nm)
+		}
+		shard.mu.Unlock()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -84,13 +85,65 @@ func TestWriteMetrics(t *testing.T) {
 	})
 }
 
+func TestWriteMetricsWithTimestamp(t *testing.T) {
+	timestamp := time.Unix(1700000000, 123e6)
+	f := func(writeMetric func(w io.Writer), sExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		writeMetric(&bb)
+		if s := bb.String(); s != sExpected {
+			t.Fatalf("unexpected value; got\n%s\nwant\n%s", s, sExpected)
+		}
+	}
+	f(func(w io.Writer) {
+		WriteGaugeUint64WithTimestamp(w, "foo", 123, timestamp)
+	}, "foo 123 1700000000123\n")
+	f(func(w io.Writer) {
+		WriteGaugeFloat64WithTimestamp(w, `foo{bar="baz"}`, 1.23, timestamp)
+	}, `foo{bar="baz"} 1.23 1700000000123`+"\n")
+	f(func(w io.Writer) {
+		WriteCounterUint64WithTimestamp(w, "foo_total", 123, timestamp)
+	}, "foo_total 123 1700000000123\n")
+	f(func(w io.Writer) {
+		WriteCounterFloat64WithTimestamp(w, "foo_total", 1.23, timestamp)
+	}, "foo_total 1.23 1700000000123\n")
+}
+
 func TestGetDefaultSet(t *testing.T) {
 	s := GetDefaultSet()
-	if s != defaultSet {
-		t.Fatalf("GetDefaultSet must return defaultSet=%p, but returned %p", defaultSet, s)
+	if s != defaultSet() {
+		t.Fatalf("GetDefaultSet must return defaultSet=%p, but returned %p", defaultSet(), s)
 	}
 }
 
+func TestSetDefaultSet(t *testing.T) {
+	prevSet := GetDefaultSet()
+	defer SetDefaultSet(prevSet)
+
+	s := NewSet()
+	SetDefaultSet(s)
+	defer UnregisterSet(s, true)
+	if GetDefaultSet() != s {
+		t.Fatalf("GetDefaultSet must return the set passed to SetDefaultSet")
+	}
+
+	NewCounter("TestSetDefaultSet_total").Inc()
+	if names := s.ListMetricNames(); len(names) != 1 || names[0] != "TestSetDefaultSet_total" {
+		t.Fatalf("unexpected metric names in the default set: %q", names)
+	}
+	if _, ok := prevSet.GetMetric("TestSetDefaultSet_total"); ok {
+		t.Fatalf("the metric mustn't be registered in the previous default set")
+	}
+
+	var bb bytes.Buffer
+	WritePrometheus(&bb, false)
+	if !strings.Contains(bb.String(), "TestSetDefaultSet_total 1\n") {
+		t.Fatalf("missing metric from the default set in WritePrometheus output:\n%s", bb.String())
+	}
+
+	expectPanic(t, "SetDefaultSet(nil)", func() { SetDefaultSet(nil) })
+}
+
 func TestUnregisterAllMetrics(t *testing.T) {
 	for j := 0; j < 3; j++ {
 		for i := 0; i < 10; i++ {
@@ -157,6 +210,38 @@ func TestRegisterUnregisterSet(t *testing.T) {
 	}
 }
 
+func TestRegisterSetExt(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo"}`).Set(123)
+	RegisterSetExt(s, &RegisterSetOpts{
+		Prefix: "myapp_",
+	})
+	defer UnregisterSet(s, true)
+
+	f := func(expectedLines ...string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WritePrometheus(&bb, false)
+		data := bb.String()
+		for _, line := range expectedLines {
+			if !strings.Contains(data, line) {
+				t.Fatalf("missing %q in\n%s", line, data)
+			}
+		}
+	}
+	f("myapp_requests_total{path=\"/foo\"} 123\n")
+
+	ExposeMetadata(true)
+	f("# HELP myapp_requests_total\n# TYPE myapp_requests_total counter\nmyapp_requests_total{path=\"/foo\"} 123\n")
+	ExposeMetadata(false)
+
+	expectPanic(t, "RegisterSetExt(invalid prefix)", func() {
+		RegisterSetExt(s, &RegisterSetOpts{
+			Prefix: "my-app",
+		})
+	})
+}
+
 func TestInvalidName(t *testing.T) {
 	f := func(name string) {
 		t.Helper()
@@ -294,3 +379,72 @@ func testMarshalTo(t *testing.T, m metric, prefix, resultExpected string) {
 		t.Fatalf("unexpected marshaled metric;\ngot\n%q\nwant\n%q", result, resultExpected)
 	}
 }
+
+func TestWriteProcessMetricsExt(t *testing.T) {
+	f := func(opts *ProcessMetricsOptions, namesExpected, namesUnexpected []string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteProcessMetricsExt(&bb, opts)
+		result := bb.String()
+		for _, name := range namesExpected {
+			if !strings.Contains(result, "\n"+name) {
+				t.Fatalf("missing %q in the output:\n%s", name, result)
+			}
+		}
+		for _, name := range namesUnexpected {
+			if strings.Contains(result, "\n"+name) {
+				t.Fatalf("unexpected %q in the output:\n%s", name, result)
+			}
+		}
+	}
+
+	f(&ProcessMetricsOptions{
+		DisableFDCount: true,
+	}, []string{"go_goroutines "}, []string{"process_open_fds ", "process_network_", "process_schedstat_", "process_anon_rss_bytes ", "process_cpu_cores_available "})
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	f(nil, []string{"go_goroutines ", "process_open_fds ", "process_io_read_bytes_total "}, []string{"process_numa_", "process_schedstat_", "process_open_fds{", "process_network_", "process_anon_rss_bytes ", "process_cpu_cores_available "})
+	f(&ProcessMetricsOptions{
+		EnableSchedstat:      true,
+		EnableNetworkMetrics: true,
+		EnableSmaps:          true,
+		EnableCgroupMetrics:  true,
+	}, []string{"process_open_fds ", "process_schedstat_running_seconds_total ", `process_network_receive_bytes_total{interface="lo"} `, "process_anon_rss_bytes ", "process_cpu_cores_available "}, nil)
+	f(&ProcessMetricsOptions{
+		DisableFDCount: true,
+		EnableFDTypes:  true,
+	}, []string{`process_open_fds{type="file"} `, `process_open_fds{type="socket"} `}, []string{"process_open_fds ", "process_max_fds "})
+	f(&ProcessMetricsOptions{
+		EnableFDTypes: true,
+	}, []string{`process_open_fds{type="file"} `, "process_max_fds "}, []string{"process_open_fds "})
+}
+
+func TestWriteProcessMetricsExtMetadata(t *testing.T) {
+	ExposeMetadata(true)
+	defer ExposeMetadata(false)
+
+	var bb bytes.Buffer
+	WriteProcessMetricsExt(&bb, &ProcessMetricsOptions{
+		EnableFDTypes: true,
+	})
+	checkUniqueMetadata(t, bb.String())
+}
+
+// checkUniqueMetadata verifies that every metric family in data has a single `# TYPE` line,
+// since strict parsers reject repeated metadata.
+func checkUniqueMetadata(t *testing.T, data string) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(data, "\n") {
+		if !strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if seen[fields[2]] {
+			t.Fatalf("duplicate metadata for %q in the output:\n%s", fields[2], data)
+		}
+		seen[fields[2]] = true
+	}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// NewMinGauge registers and returns new MinGauge with the given name.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned MinGauge is safe to use from concurrent goroutines.
+func NewMinGauge(name string) *MinGauge {
+	return defaultSet().NewMinGauge(name)
+}
+
+// MinGauge is a gauge, which exposes the minimum value passed to Update since the previous scrape.
+//
+// The value is reset after every WritePrometheus call, so every scrape returns the minimum value
+// over the interval since the previous scrape. This is useful for tracking the lowest free capacity or the lowest throughput.
+//
+// MinGauge isn't exposed if there were no Update calls since the previous scrape,
+// in the same way as Summary quantiles aren't exposed when there are no observations.
+type MinGauge struct {
+	mu       sync.Mutex
+	min      float64
+	hasValue bool
+}
+
+// Update updates mg with v if v is smaller than the minimum value since the previous scrape.
+//
+// NaNs are ignored.
+func (mg *MinGauge) Update(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	mg.mu.Lock()
+	if !mg.hasValue || v < mg.min {
+		mg.min = v
+		mg.hasValue = true
+	}
+	mg.mu.Unlock()
+}
+
+// Get returns the minimum value passed to Update since the previous scrape.
+//
+// 0 is returned if there were no Update calls since the previous scrape.
+func (mg *MinGauge) Get() float64 {
+	mg.mu.Lock()
+	v := mg.min
+	mg.mu.Unlock()
+	return v
+}
+
+func (mg *MinGauge) marshalTo(prefix string, w io.Writer) {
+	mg.mu.Lock()
+	v := mg.min
+	hasValue := mg.hasValue
+	mg.min = 0
+	mg.hasValue = false
+	mg.mu.Unlock()
+
+	if !hasValue {
+		return
+	}
+	if float64(int64(v)) == v {
+		// Marshal integer values without scientific notation
+		fmt.Fprintf(w, "%s %d\n", prefix, int64(v))
+	} else {
+		fmt.Fprintf(w, "%s %g\n", prefix, v)
+	}
+}
+
+func (mg *MinGauge) metricType() string {
+	return "gauge"
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMinGauge(t *testing.T) {
+	s := NewSet()
+	mg := s.NewMinGauge("free_slots_min")
+
+	// Verify that MinGauge without updates isn't marshaled.
+	testMarshalTo(t, mg, "free_slots_min", "")
+
+	for _, v := range []float64{3, 5, -1.5, math.NaN(), 2} {
+		mg.Update(v)
+	}
+	if v := mg.Get(); v != -1.5 {
+		t.Fatalf("unexpected value; got %g; want -1.5", v)
+	}
+	testMarshalTo(t, mg, "free_slots_min", "free_slots_min -1.5\n")
+
+	// The value must be reset after the scrape.
+	if v := mg.Get(); v != 0 {
+		t.Fatalf("unexpected value after the scrape; got %g; want 0", v)
+	}
+	testMarshalTo(t, mg, "free_slots_min", "")
+
+	mg.Update(10)
+	testMarshalTo(t, mg, "free_slots_min", "free_slots_min 10\n")
+}
@@ -0,0 +1,298 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultNativeHistogramSchema is the default schema for NativeHistogram.
+	//
+	// It results in 8 buckets per each power of 2 with the growth factor of 2^(1/8)=1.09 between adjacent buckets.
+	defaultNativeHistogramSchema = 3
+
+	minNativeHistogramSchema = -4
+	maxNativeHistogramSchema = 8
+
+	// nativeHistogramZeroThreshold is the width of the zero bucket.
+	//
+	// This is the same value as Prometheus client_golang uses by default.
+	nativeHistogramZeroThreshold = 2.938735877055719e-39
+)
+
+// NativeHistogram is a histogram with exponential buckets compatible with Prometheus native histograms.
+//
+// See https://prometheus.io/docs/specs/native_histograms/
+//
+// Buckets are exposed only via Prometheus protobuf exposition format - see WritePrometheusProtobuf.
+// Prometheus text exposition format doesn't support native histograms, so only the following metrics
+// are exposed via WritePrometheus:
+//
+//	<metric_name>_sum{<optional_tags>} <sum>
+//	<metric_name>_count{<optional_tags>} <count>
+//
+// Zero NativeHistogram is usable and uses the default schema 3.
+type NativeHistogram struct {
+	mu sync.Mutex
+
+	// schema defines the bucket resolution - there are 2^schema buckets per each power of 2.
+	schema int
+
+	// isInitialized is set to true after the schema is initialized.
+	isInitialized bool
+
+	// positive and negative contain counters for buckets with positive and negative values keyed by bucket index.
+	positive map[int]uint64
+	negative map[int]uint64
+
+	// zeroCount is the number of values, which hit the zero bucket.
+	zeroCount uint64
+
+	count uint64
+	sum   float64
+}
+
+func newNativeHistogram(schema int) *NativeHistogram {
+	if schema < minNativeHistogramSchema || schema > maxNativeHistogramSchema {
+		panic(fmt.Errorf("BUG: schema must be in the range [%d..%d]; got %d", minNativeHistogramSchema, maxNativeHistogramSchema, schema))
+	}
+	return &NativeHistogram{
+		schema:        schema,
+		isInitialized: true,
+	}
+}
+
+// Update updates nh with v.
+//
+// NaNs are ignored.
+func (nh *NativeHistogram) Update(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	nh.mu.Lock()
+	nh.initLocked()
+	nh.count++
+	nh.sum += v
+	switch {
+	case math.Abs(v) <= nativeHistogramZeroThreshold:
+		nh.zeroCount++
+	case v > 0:
+		nh.positive[nh.bucketIdx(v)]++
+	default:
+		nh.negative[nh.bucketIdx(-v)]++
+	}
+	nh.mu.Unlock()
+}
+
+// UpdateDuration updates request duration based on the given startTime.
+func (nh *NativeHistogram) UpdateDuration(startTime time.Time) {
+	d := since(startTime).Seconds()
+	nh.Update(d)
+}
+
+// Reset resets nh.
+func (nh *NativeHistogram) Reset() {
+	nh.mu.Lock()
+	nh.positive = nil
+	nh.negative = nil
+	nh.zeroCount = 0
+	nh.count = 0
+	nh.sum = 0
+	nh.mu.Unlock()
+}
+
+// mergeAndReset merges src with the given name into nh and resets src.
+//
+// src is reset atomically with obtaining its state, so concurrent updates to src aren't lost.
+// nh and src must have the same schema.
+func (nh *NativeHistogram) mergeAndReset(name string, src *NativeHistogram) {
+	// Take the state of src under its lock in order to prevent from deadlock on concurrent cross-merge.
+	src.mu.Lock()
+	src.initLocked()
+	schema := src.schema
+	positive := src.positive
+	negative := src.negative
+	zeroCount := src.zeroCount
+	count := src.count
+	sum := src.sum
+	src.positive = nil
+	src.negative = nil
+	src.zeroCount = 0
+	src.count = 0
+	src.sum = 0
+	src.mu.Unlock()
+
+	nh.mu.Lock()
+	defer nh.mu.Unlock()
+
+	nh.initLocked()
+	if nh.schema != schema {
+		panic(fmt.Errorf("BUG: cannot merge native histogram %q with schema %d into native histogram with schema %d", name, schema, nh.schema))
+	}
+	for idx, n := range positive {
+		nh.positive[idx] += n
+	}
+	for idx, n := range negative {
+		nh.negative[idx] += n
+	}
+	nh.zeroCount += zeroCount
+	nh.count += count
+	nh.sum += sum
+}
+
+// Schema returns the schema for nh.
+func (nh *NativeHistogram) Schema() int {
+	nh.mu.Lock()
+	nh.initLocked()
+	schema := nh.schema
+	nh.mu.Unlock()
+	return schema
+}
+
+func (nh *NativeHistogram) initLocked() {
+	if !nh.isInitialized {
+		nh.schema = defaultNativeHistogramSchema
+		nh.isInitialized = true
+	}
+	if nh.positive == nil {
+		nh.positive = make(map[int]uint64)
+		nh.negative = make(map[int]uint64)
+	}
+}
+
+// bucketIdx returns bucket index for positive v.
+//
+// The bucket with index i contains values in the range (base^(i-1)..base^i], where base=2^(2^-schema).
+func (nh *NativeHistogram) bucketIdx(v float64) int {
+	if v > math.MaxFloat64 {
+		v = math.MaxFloat64
+	}
+	frac, exp := math.Frexp(v)
+	if nh.schema <= 0 {
+		// v is in the range [2^(exp-1)..2^exp)
+		if frac == 0.5 {
+			// Powers of 2 belong to the lower bucket.
+			exp--
+		}
+		offset := (1 << -nh.schema) - 1
+		return (exp + offset) >> -nh.schema
+	}
+	idx := int(math.Ceil(math.Log2(frac) * float64(int(1)<<nh.schema)))
+	return idx + (exp << nh.schema)
+}
+
+func (nh *NativeHistogram) marshalTo(prefix string, w io.Writer) {
+	nh.mu.Lock()
+	sum := nh.sum
+	count := nh.count
+	nh.mu.Unlock()
+
+	if count == 0 {
+		return
+	}
+	name, labels := splitMetricName(prefix)
+	if float64(int64(sum)) == sum {
+		fmt.Fprintf(w, "%s_sum%s %d\n", name, labels, int64(sum))
+	} else {
+		fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, sum)
+	}
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, count)
+}
+
+func (nh *NativeHistogram) metricType() string {
+	return "histogram"
+}
+
+func (nh *NativeHistogram) protobufType() uint64 {
+	return protobufTypeHistogram
+}
+
+// marshalProtobuf appends io.prometheus.client.Histogram message for nh to dst.
+func (nh *NativeHistogram) marshalProtobuf(dst []byte) []byte {
+	nh.mu.Lock()
+	nh.initLocked()
+	var h []byte
+	h = appendProtobufVarint(h, 1, nh.count)
+	h = appendProtobufDouble(h, 2, nh.sum)
+	h = appendProtobufSint(h, 5, int64(nh.schema))
+	h = appendProtobufDouble(h, 6, nativeHistogramZeroThreshold)
+	h = appendProtobufVarint(h, 7, nh.zeroCount)
+	h = appendNativeHistogramBuckets(h, 9, 10, nh.negative)
+	h = appendNativeHistogramBuckets(h, 12, 13, nh.positive)
+	nh.mu.Unlock()
+
+	return appendProtobufMessage(dst, 7, h)
+}
+
+// appendNativeHistogramBuckets appends buckets to dst in the form of spans and deltas.
+//
+// See https://prometheus.io/docs/specs/native_histograms/#buckets
+func appendNativeHistogramBuckets(dst []byte, spanField, deltaField uint64, buckets map[int]uint64) []byte {
+	if len(buckets) == 0 {
+		return dst
+	}
+	idxs := make([]int, 0, len(buckets))
+	for idx := range buckets {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+
+	var span, deltas []byte
+	spanStart := idxs[0]
+	spanOffset := idxs[0]
+	prevCount := int64(0)
+	for i, idx := range idxs {
+		if i > 0 && idx != idxs[i-1]+1 {
+			span = appendProtobufSint(span[:0], 1, int64(spanOffset))
+			span = appendProtobufVarint(span, 2, uint64(idxs[i-1]-spanStart+1))
+			dst = appendProtobufMessage(dst, spanField, span)
+			spanOffset = idx - idxs[i-1] - 1
+			spanStart = idx
+		}
+		count := int64(buckets[idx])
+		d := count - prevCount
+		deltas = appendUvarint(deltas, uint64(d<<1)^uint64(d>>63))
+		prevCount = count
+	}
+	span = appendProtobufSint(span[:0], 1, int64(spanOffset))
+	span = appendProtobufVarint(span, 2, uint64(idxs[len(idxs)-1]-spanStart+1))
+	dst = appendProtobufMessage(dst, spanField, span)
+
+	// Deltas are marshaled as packed repeated field.
+	return appendProtobufMessage(dst, deltaField, deltas)
+}
+
+// NewNativeHistogram registers and returns new NativeHistogram with the given name and the default schema 3.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned NativeHistogram is safe to use from concurrent goroutines.
+func NewNativeHistogram(name string) *NativeHistogram {
+	return defaultSet().NewNativeHistogram(name)
+}
+
+// NewNativeHistogramExt registers and returns new NativeHistogram with the given name and schema.
+//
+// schema must be in the range [-4..8]. Every power of 2 is split into 2^schema buckets.
+// Higher schema means higher resolution and bigger number of buckets.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned NativeHistogram is safe to use from concurrent goroutines.
+func NewNativeHistogramExt(name string, schema int) *NativeHistogram {
+	return defaultSet().NewNativeHistogramExt(name, schema)
+}
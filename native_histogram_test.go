@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestNativeHistogramBucketIdx(t *testing.T) {
+	f := func(schema int, v float64, idxExpected int) {
+		t.Helper()
+		nh := newNativeHistogram(schema)
+		if idx := nh.bucketIdx(v); idx != idxExpected {
+			t.Fatalf("unexpected bucket index for schema=%d, v=%g; got %d; want %d", schema, v, idx, idxExpected)
+		}
+	}
+	f(0, 1, 0)
+	f(0, 1.5, 1)
+	f(0, 2, 1)
+	f(0, 3, 2)
+	f(0, 0.25, -2)
+	f(3, 1, 0)
+	f(3, 1.1, 2)
+	f(3, 2, 8)
+	f(3, 0.5, -8)
+	f(-1, 1, 0)
+	f(-1, 4, 1)
+	f(-1, 5, 2)
+	f(8, 2, 256)
+	f(0, math.Inf(1), 1024)
+}
+
+func TestNativeHistogramSerial(t *testing.T) {
+	s := NewSet()
+	nh := s.NewNativeHistogram(`foo{bar="baz"}`)
+	if schema := nh.Schema(); schema != defaultNativeHistogramSchema {
+		t.Fatalf("unexpected schema; got %d; want %d", schema, defaultNativeHistogramSchema)
+	}
+
+	// Verify that empty histogram isn't marshaled.
+	testMarshalTo(t, nh, `foo{bar="baz"}`, "")
+
+	for i := 0; i < 10; i++ {
+		nh.Update(float64(i) - 2)
+	}
+	nh.Update(math.NaN())
+	testMarshalTo(t, nh, `foo{bar="baz"}`, `foo_sum{bar="baz"} 25
+foo_count{bar="baz"} 10
+`)
+
+	nh.Reset()
+	testMarshalTo(t, nh, `foo{bar="baz"}`, "")
+
+	expectPanic(t, "NewNativeHistogramExt_invalid_schema", func() {
+		s.NewNativeHistogramExt("bar", 9)
+	})
+
+	// Zero NativeHistogram must be usable.
+	var nhZero NativeHistogram
+	nhZero.Update(1)
+	if schema := nhZero.Schema(); schema != defaultNativeHistogramSchema {
+		t.Fatalf("unexpected schema for zero histogram; got %d; want %d", schema, defaultNativeHistogramSchema)
+	}
+}
+
+func TestAppendNativeHistogramBuckets(t *testing.T) {
+	buckets := map[int]uint64{
+		0: 1,
+		1: 2,
+		5: 1,
+	}
+	result := appendNativeHistogramBuckets(nil, 12, 13, buckets)
+
+	var expected []byte
+	// span{offset=0, length=2}
+	expected = append(expected, 0x62, 0x04, 0x08, 0x00, 0x10, 0x02)
+	// span{offset=3, length=1}
+	expected = append(expected, 0x62, 0x04, 0x08, 0x06, 0x10, 0x01)
+	// deltas [1, 1, -1]
+	expected = append(expected, 0x6a, 0x03, 0x02, 0x02, 0x01)
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected buckets marshaling;\ngot\n%x\nwant\n%x", result, expected)
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numaNodeStats contains memory stats for a NUMA node.
+type numaNodeStats struct {
+	node          string
+	residentBytes uint64
+}
+
+func writeNUMAMetrics(w io.Writer) {
+	nss, err := getNUMAStats("/proc/self/numa_maps")
+	if err != nil {
+		log.Printf("ERROR: metrics: cannot determine NUMA memory stats: %s", err)
+		return
+	}
+	writeNUMAStats(w, nss)
+}
+
+// writeNUMAStats writes metrics for the given nss to w.
+func writeNUMAStats(w io.Writer, nss []numaNodeStats) {
+	if len(nss) == 0 {
+		return
+	}
+	WriteMetadataIfNeeded(w, "process_numa_resident_bytes", "gauge")
+	for _, ns := range nss {
+		fmt.Fprintf(w, "process_numa_resident_bytes{%s} %d\n", appendLabel(nil, "node", ns.node), ns.residentBytes)
+	}
+}
+
+// getNUMAStats returns resident memory per NUMA node from numa_maps at path sorted by node number.
+//
+// See https://man7.org/linux/man-pages/man7/numa.7.html
+func getNUMAStats(path string) ([]numaNodeStats, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[int]uint64)
+	lines := strings.Split(string(data), "\n")
+	for _, s := range lines {
+		if s == "" {
+			continue
+		}
+		fields := strings.Fields(s)
+		pageSize := uint64(4096)
+		var pagesPerNode map[int]uint64
+		for _, field := range fields[1:] {
+			n := strings.IndexByte(field, '=')
+			if n < 0 {
+				continue
+			}
+			key, value := field[:n], field[n+1:]
+			switch {
+			case key == "kernelpagesize_kB":
+				v, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse page size from %q: %w", s, err)
+				}
+				pageSize = v * 1024
+			case len(key) > 1 && key[0] == 'N':
+				node, err := strconv.Atoi(key[1:])
+				if err != nil {
+					// Skip unrelated keys starting with N if any.
+					continue
+				}
+				pages, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse the number of pages for node %d from %q: %w", node, s, err)
+				}
+				if pagesPerNode == nil {
+					pagesPerNode = make(map[int]uint64)
+				}
+				pagesPerNode[node] += pages
+			}
+		}
+		// kernelpagesize_kB goes after per-node page counts, so the counts are converted to bytes after parsing the whole line.
+		for node, pages := range pagesPerNode {
+			m[node] += pages * pageSize
+		}
+	}
+	nodes := make([]int, 0, len(m))
+	for node := range m {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+	nss := make([]numaNodeStats, 0, len(nodes))
+	for _, node := range nodes {
+		nss = append(nss, numaNodeStats{
+			node:          strconv.Itoa(node),
+			residentBytes: m[node],
+		})
+	}
+	return nss, nil
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestGetNUMAStats(t *testing.T) {
+	f := func(want []numaNodeStats, path string, wantErr bool) {
+		t.Helper()
+		got, err := getNUMAStats(path)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result: %+v, want: %+v at getNUMAStats", got, want)
+		}
+	}
+	f([]numaNodeStats{
+		{node: "0", residentBytes: 7 * 4096},
+		{node: "1", residentBytes: 2*4096 + 2*2048*1024},
+		{node: "10", residentBytes: 6 * 4096},
+	}, "testdata/numa_maps", false)
+	f(nil, "testdata/numa_maps_bad", true)
+	f(nil, "testdata/bad_path", true)
+}
+
+func TestWriteNUMAStats(t *testing.T) {
+	ExposeMetadata(true)
+	defer ExposeMetadata(false)
+
+	var bb bytes.Buffer
+	writeNUMAStats(&bb, []numaNodeStats{
+		{node: "0", residentBytes: 4096},
+		{node: "1", residentBytes: 8192},
+	})
+	resultExpected := `# HELP process_numa_resident_bytes
+# TYPE process_numa_resident_bytes gauge
+process_numa_resident_bytes{node="0"} 4096
+process_numa_resident_bytes{node="1"} 8192
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
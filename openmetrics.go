@@ -0,0 +1,336 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// OpenMetricsContentType is the Content-Type for the output generated by WriteOpenMetrics.
+//
+// It must be set in the response to scrape requests, which accept application/openmetrics-text.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// WriteOpenMetrics writes all the metrics from the default set, all the added sets and metrics writers to w
+// in OpenMetrics text exposition format.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
+//
+// The output is terminated with `# EOF` line. The response must have OpenMetricsContentType Content-Type.
+//
+// If exposeProcessMetrics is true, then various `go_*` and `process_*` metrics
+// are exposed for the current process.
+//
+// See also WritePrometheus.
+func WriteOpenMetrics(w io.Writer, exposeProcessMetrics bool) {
+	writeGlobalOpenMetrics(w, exposeProcessMetrics, nil)
+}
+
+// writeGlobalOpenMetrics writes metrics from all the registered sets and metrics writers to w in OpenMetrics format.
+//
+// Only metrics from sets, for which keep returns true, are written. All the metrics are written if keep is nil.
+func writeGlobalOpenMetrics(w io.Writer, exposeProcessMetrics bool, keep func(name string) bool) {
+	var ow openMetricsWriter
+	for _, rs := range getRegisteredSets() {
+		ow.namePrefix = rs.prefix
+		rs.s.addToOpenMetricsWriter(&ow, "", rs.getKeep(keep))
+	}
+	ow.namePrefix = ""
+	if exposeProcessMetrics {
+		var bb bytes.Buffer
+		WriteProcessMetrics(&bb)
+		ow.addText(bb.Bytes())
+	}
+	ow.writeTo(w)
+}
+
+// WriteOpenMetrics writes all the metrics from s to w in OpenMetrics text exposition format.
+//
+// Samples for every metric family are grouped together and are preceded by `# TYPE` and `# UNIT` metadata.
+// Counter families are exposed without `_total` suffix, while counter samples always have `_total` suffix.
+// Histogram buckets are exposed as cumulative buckets with `le` labels.
+//
+// The output is terminated with `# EOF` line. The response must have OpenMetricsContentType Content-Type.
+func (s *Set) WriteOpenMetrics(w io.Writer) {
+	var ow openMetricsWriter
+	s.addToOpenMetricsWriter(&ow, "", nil)
+	ow.writeTo(w)
+}
+
+// addToOpenMetricsWriter adds metrics from s and its child sets to ow.
+//
+// extraLabels are added to all the metrics. They contain common labels inherited from the parent sets.
+// Only metrics, for which keep returns true, are added. All the metrics are added if keep is nil.
+func (s *Set) addToOpenMetricsWriter(ow *openMetricsWriter, extraLabels string, keep func(name string) bool) {
+	sa, metricsWriters := s.getSortedMetrics()
+	if keep != nil {
+		sa = filterMetrics(sa, keep)
+	}
+	extraLabels = joinLabels(extraLabels, s.getCommonLabels())
+	labels := joinLabels(extraLabels, s.labels)
+
+	var bb bytes.Buffer
+	for _, nm := range sa {
+		if nm.isAux {
+			// Summary quantiles are marshaled together with the summary.
+			continue
+		}
+		bb.Reset()
+		family, metricType := marshalOpenMetrics(&bb, nm.name, nm.metric)
+		if bb.Len() > 0 {
+			writeCreatedSeriesIfNeeded(&bb, nm)
+		}
+		data := bb.Bytes()
+		quoted := isQuotedMetricName(nm.name)
+		if quoted {
+			data = escapeMetricNames(nil, data)
+		}
+		ow.addSamples(family, metricType, data, labels, quoted)
+	}
+	bb.Reset()
+	for _, writeMetrics := range metricsWriters {
+		writeMetrics(&bb)
+	}
+	data := bb.Bytes()
+	if labels != "" {
+		data = addExtraLabels(nil, data, labels)
+	}
+	ow.addText(data)
+
+	for _, child := range s.getChildren() {
+		child.addToOpenMetricsWriter(ow, extraLabels, keep)
+	}
+}
+
+// marshalOpenMetrics writes samples for m with the given name to bb in OpenMetrics format.
+//
+// It returns metric family and metric type for the written samples.
+func marshalOpenMetrics(bb *bytes.Buffer, name string, m metric) (string, string) {
+	family := getMetricFamily(name)
+	switch t := m.(type) {
+	case *Histogram:
+		marshalHistogramOpenMetrics(bb, name, t)
+		return family, "histogram"
+	case *NativeHistogram:
+		t.mu.Lock()
+		sum := t.sum
+		count := t.count
+		t.mu.Unlock()
+		if count > 0 {
+			writeHistogramTotalsOpenMetrics(bb, name, sum, count)
+		}
+		return family, "histogram"
+	case *Summary:
+		marshalSummaryQuantiles(bb, name, t)
+		t.marshalTo(name, bb)
+		return family, "summary"
+	}
+
+	metricType := m.metricType()
+	switch metricType {
+	case "counter":
+		var tmp bytes.Buffer
+		m.marshalTo(name, &tmp)
+		visitLines(tmp.Bytes(), func(line []byte) {
+			bb.Write(addCounterSuffix(nil, line))
+			bb.WriteByte('\n')
+		})
+		return strings.TrimSuffix(family, "_total"), metricType
+	case "gauge":
+	default:
+		metricType = "unknown"
+	}
+	m.marshalTo(name, bb)
+	return family, metricType
+}
+
+// marshalHistogramOpenMetrics writes h with the given name to bb as OpenMetrics histogram with cumulative `le` buckets.
+func marshalHistogramOpenMetrics(bb *bytes.Buffer, name string, h *Histogram) {
+	family, labels := splitMetricName(name)
+	cumulativeCount := uint64(0)
+	lastLE := ""
+	h.VisitNonZeroBuckets(func(vmrange string, count uint64) {
+		cumulativeCount += count
+		lastLE = vmrange[strings.Index(vmrange, "...")+len("..."):]
+		bucketName := addTag(family+"_bucket"+labels, fmt.Sprintf("le=%q", lastLE))
+		fmt.Fprintf(bb, "%s %d\n", bucketName, cumulativeCount)
+	})
+	if cumulativeCount == 0 {
+		return
+	}
+	if lastLE != "+Inf" {
+		bucketName := addTag(family+"_bucket"+labels, `le="+Inf"`)
+		fmt.Fprintf(bb, "%s %d\n", bucketName, cumulativeCount)
+	}
+	sum := h.getSum()
+	if float64(int64(sum)) == sum {
+		fmt.Fprintf(bb, "%s_sum%s %d\n", family, labels, int64(sum))
+	} else {
+		fmt.Fprintf(bb, "%s_sum%s %g\n", family, labels, sum)
+	}
+	fmt.Fprintf(bb, "%s_count%s %d\n", family, labels, cumulativeCount)
+}
+
+// writeHistogramTotalsOpenMetrics writes OpenMetrics histogram with the given name, sum and count and with only `+Inf` bucket to bb.
+func writeHistogramTotalsOpenMetrics(bb *bytes.Buffer, name string, sum float64, count uint64) {
+	family, labels := splitMetricName(name)
+	fmt.Fprintf(bb, "%s %d\n", addTag(family+"_bucket"+labels, `le="+Inf"`), count)
+	if float64(int64(sum)) == sum {
+		fmt.Fprintf(bb, "%s_sum%s %d\n", family, labels, int64(sum))
+	} else {
+		fmt.Fprintf(bb, "%s_sum%s %g\n", family, labels, sum)
+	}
+	fmt.Fprintf(bb, "%s_count%s %d\n", family, labels, count)
+}
+
+// addCounterSuffix appends line to dst with `_total` suffix added to the metric name if it is missing.
+func addCounterSuffix(dst, line []byte) []byte {
+	if bytes.HasPrefix(line, quotedNamePrefixBytes) {
+		name, tail, err := readQuotedString(string(line[1:]))
+		if err != nil {
+			return append(dst, line...)
+		}
+		if !strings.HasSuffix(name, "_total") {
+			name += "_total"
+		}
+		dst = append(dst, '{')
+		dst = strconv.AppendQuote(dst, name)
+		return append(dst, tail...)
+	}
+	n := bytes.IndexAny(line, "{ ")
+	if n < 0 {
+		return append(dst, line...)
+	}
+	name := line[:n]
+	dst = append(dst, name...)
+	if !bytes.HasSuffix(name, totalSuffixBytes) {
+		dst = append(dst, totalSuffixBytes...)
+	}
+	return append(dst, line[n:]...)
+}
+
+var totalSuffixBytes = []byte("_total")
+
+// openMetricsWriter groups samples by metric families for OpenMetrics exposition.
+type openMetricsWriter struct {
+	families []*openMetricsFamily
+	m        map[string]*openMetricsFamily
+
+	// text contains samples in Prometheus text exposition format, which couldn't be grouped by metric families.
+	text []byte
+
+	// namePrefix is prepended to names of all the metrics.
+	namePrefix string
+}
+
+type openMetricsFamily struct {
+	name       string
+	metricType string
+	data       []byte
+
+	// quoted is set if the family name must be quoted when it cannot be written as is.
+	quoted bool
+}
+
+// addSamples adds samples in data for the given family and metricType to ow.
+//
+// labels are added to all the samples if non-empty.
+//
+// quoted must be set if family has been registered with quoted name according to Prometheus UTF-8 syntax.
+func (ow *openMetricsWriter) addSamples(family, metricType string, data []byte, labels string, quoted bool) {
+	if len(data) == 0 {
+		return
+	}
+	if labels != "" {
+		data = addExtraLabels(nil, data, labels)
+	}
+	if ow.namePrefix != "" {
+		data = addMetricNamePrefix(nil, data, ow.namePrefix)
+	}
+	family = ow.namePrefix + family
+	key := family + " " + metricType
+	if ow.m == nil {
+		ow.m = make(map[string]*openMetricsFamily)
+	}
+	of := ow.m[key]
+	if of == nil {
+		of = &openMetricsFamily{
+			name:       family,
+			metricType: metricType,
+			quoted:     quoted,
+		}
+		ow.m[key] = of
+		ow.families = append(ow.families, of)
+	}
+	of.data = append(of.data, data...)
+}
+
+// addText adds data in Prometheus text exposition format to ow.
+//
+// `# HELP` comments are dropped, since they have no help text, while `_total` suffix is removed
+// from counter family names in `# TYPE` comments in order to conform OpenMetrics.
+func (ow *openMetricsWriter) addText(data []byte) {
+	if ow.namePrefix != "" {
+		data = addMetricNamePrefix(nil, data, ow.namePrefix)
+	}
+	visitLines(data, func(line []byte) {
+		if bytes.HasPrefix(line, helpPrefixBytes) {
+			return
+		}
+		if bytes.HasPrefix(line, typePrefixBytes) {
+			fields := strings.Fields(string(line))
+			if len(fields) == 4 && fields[3] == "counter" {
+				ow.text = append(ow.text, fmt.Sprintf("# TYPE %s counter\n", strings.TrimSuffix(fields[2], "_total"))...)
+				return
+			}
+		}
+		ow.text = append(ow.text, line...)
+		ow.text = append(ow.text, '\n')
+	})
+}
+
+// writeTo writes metrics collected in ow to w and terminates them with `# EOF` line.
+func (ow *openMetricsWriter) writeTo(w io.Writer) {
+	var bb bytes.Buffer
+	for _, of := range ow.families {
+		name := of.name
+		if of.quoted && !isLegacyMetricName(name) {
+			name = strconv.Quote(name)
+		}
+		fmt.Fprintf(&bb, "# TYPE %s %s\n", name, of.metricType)
+		if unit := getOpenMetricsUnit(of.name); unit != "" {
+			fmt.Fprintf(&bb, "# UNIT %s %s\n", name, unit)
+		}
+		bb.Write(of.data)
+	}
+	bb.Write(ow.text)
+	bb.WriteString("# EOF\n")
+	w.Write(bb.Bytes())
+}
+
+// getOpenMetricsUnit returns the unit for the given metric family name according to its suffix.
+//
+// An empty string is returned if the family name has no well-known unit suffix.
+func getOpenMetricsUnit(family string) string {
+	for _, unit := range openMetricsUnits {
+		if strings.HasSuffix(family, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+// openMetricsUnits contains base units recommended by OpenMetrics.
+var openMetricsUnits = []string{
+	"seconds",
+	"bytes",
+	"ratio",
+	"meters",
+	"grams",
+	"joules",
+	"volts",
+	"amperes",
+	"celsius",
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSetWriteOpenMetrics(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo"}`).Add(3)
+	s.NewFloatCounter("processed_bytes").Add(1.5)
+	s.NewGauge("queue_size", nil).Set(2)
+	h := s.NewHistogram(`response_size_bytes{path="/foo"}`)
+	h.Update(1)
+	h.Update(100)
+	s.NewSummaryExt("duration_seconds", defaultSummaryWindow, []float64{0.5}).Update(2)
+	s.NewNativeHistogram("latency_seconds").Update(4)
+	s.NewCounter(`requests_total{path="/bar"}`).Add(1)
+	child := s.NewChildSet(`tenant="a"`)
+	child.NewCounter(`requests_total{path="/foo"}`).Add(5)
+	s.RegisterMetricsWriter(func(w io.Writer) {
+		WriteCounterUint64(w, "external_total", 7)
+	})
+
+	var bb bytes.Buffer
+	s.WriteOpenMetrics(&bb)
+	result := bb.String()
+	resultExpected := `# TYPE duration_seconds summary
+# UNIT duration_seconds seconds
+duration_seconds{quantile="0.5"} 2
+duration_seconds_sum 2
+duration_seconds_count 1
+# TYPE latency_seconds histogram
+# UNIT latency_seconds seconds
+latency_seconds_bucket{le="+Inf"} 1
+latency_seconds_sum 4
+latency_seconds_count 1
+# TYPE processed_bytes counter
+# UNIT processed_bytes bytes
+processed_bytes_total 1.5
+# TYPE queue_size gauge
+queue_size 2
+# TYPE requests counter
+requests_total{path="/bar"} 1
+requests_total{path="/foo"} 3
+requests_total{tenant="a",path="/foo"} 5
+# TYPE response_size_bytes histogram
+# UNIT response_size_bytes bytes
+response_size_bytes_bucket{path="/foo",le="1.000e+00"} 1
+response_size_bytes_bucket{path="/foo",le="1.000e+02"} 2
+response_size_bytes_bucket{path="/foo",le="+Inf"} 2
+response_size_bytes_sum{path="/foo"} 101
+response_size_bytes_count{path="/foo"} 2
+external_total 7
+# EOF
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	RegisterSetExt(s, &RegisterSetOpts{
+		Prefix: "myapp_",
+	})
+	defer UnregisterSet(s, true)
+
+	var bb bytes.Buffer
+	WriteOpenMetrics(&bb, true)
+	result := bb.String()
+	if !strings.Contains(result, "# TYPE myapp_foo counter\nmyapp_foo_total 1\n") {
+		t.Fatalf("missing prefixed counter in the output:\n%s", result)
+	}
+	if !strings.Contains(result, "go_goroutines ") {
+		t.Fatalf("missing process metrics in the output:\n%s", result)
+	}
+	if !strings.HasSuffix(result, "\n# EOF\n") {
+		t.Fatalf("missing `# EOF` at the end of the output:\n%s", result)
+	}
+}
+
+func TestSetWriteOpenMetricsUTF8Names(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`{"my.requests","label.name"="x"}`).Add(1)
+	child := s.NewChildSet(`tenant="a"`)
+	child.NewGauge(`{"my.size.bytes"}`, nil).Set(2)
+
+	var bb bytes.Buffer
+	s.WriteOpenMetrics(&bb)
+	result := bb.String()
+	resultExpected := `# TYPE "my.requests" counter
+{"my.requests_total","label.name"="x"} 1
+# TYPE "my.size.bytes" gauge
+{"my.size.bytes",tenant="a"} 2
+# EOF
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
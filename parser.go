@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// label is a label name and value pair.
+type label struct {
+	name  string
+	value string
+}
+
+// sample is a single sample parsed from a line in Prometheus text exposition format.
+type sample struct {
+	name   string
+	labels []label
+	value  float64
+
+	// timestamp is the optional sample timestamp in milliseconds. It is set only if hasTimestamp is true.
+	timestamp    int64
+	hasTimestamp bool
+}
+
+// fullName returns s name with labels in Prometheus text exposition format.
+func (s *sample) fullName() string {
+	if len(s.labels) == 0 {
+		return s.name
+	}
+	var sb strings.Builder
+	sb.WriteString(s.name)
+	sb.WriteByte('{')
+	for i, l := range s.labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.Write(appendLabel(nil, l.name, l.value))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// visitLines calls f for every non-empty line in data with trimmed whitespace.
+func visitLines(data []byte, f func(line []byte)) {
+	for len(data) > 0 {
+		var line []byte
+		n := bytes.IndexByte(data, '\n')
+		if n >= 0 {
+			line = data[:n]
+			data = data[n+1:]
+		} else {
+			line = data
+			data = nil
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		f(line)
+	}
+}
+
+// parseSample parses a sample line in Prometheus text exposition format generated by metrics from this package.
+//
+// The line must have the form `name{label1="value1",...,labelN="valueN"} value [timestamp]`.
+func parseSample(line string) (*sample, error) {
+	var s sample
+	if strings.HasPrefix(line, `{"`) {
+		return parseSampleWithQuotedName(line)
+	}
+	n := strings.IndexAny(line, "{ ")
+	if n <= 0 {
+		return nil, fmt.Errorf("missing metric name in %q", line)
+	}
+	s.name = line[:n]
+	tail := line[n:]
+	if tail[0] == '{' {
+		labels, tailLocal, err := parseLabels(tail[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse labels in %q: %w", line, err)
+		}
+		s.labels = labels
+		tail = tailLocal
+	}
+	return parseSampleValue(&s, line, tail)
+}
+
+// parseSampleWithQuotedName parses a sample line with quoted UTF-8 metric name,
+// e.g. `{"my.metric","label.name"="value"} 123`.
+func parseSampleWithQuotedName(line string) (*sample, error) {
+	var s sample
+	name, tail, err := readQuotedString(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse metric name in %q: %w", line, err)
+	}
+	s.name = name
+	tail = skipSpace(tail)
+	switch {
+	case strings.HasPrefix(tail, ","):
+		labels, tailLocal, err := parseLabels(tail[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse labels in %q: %w", line, err)
+		}
+		s.labels = labels
+		tail = tailLocal
+	case strings.HasPrefix(tail, "}"):
+		tail = tail[1:]
+	default:
+		return nil, fmt.Errorf("missing `,` or `}` after metric name in %q", line)
+	}
+	return parseSampleValue(&s, line, tail)
+}
+
+// parseSampleValue parses the value and the optional timestamp from the tail of the sample line into s.
+func parseSampleValue(s *sample, line, tail string) (*sample, error) {
+	fields := strings.Fields(tail)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("unexpected number of fields after metric name in %q; got %d; want 1 or 2", line, len(fields))
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse value in %q: %w", line, err)
+	}
+	s.value = v
+	if len(fields) == 2 {
+		ts, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse timestamp in %q: %w", line, err)
+		}
+		s.timestamp = ts
+		s.hasTimestamp = true
+	}
+	return s, nil
+}
+
+// parseLabels parses labels from s until the closing curly brace.
+//
+// It returns the parsed labels and the tail after the closing curly brace.
+func parseLabels(s string) ([]label, string, error) {
+	var labels []label
+	for {
+		s = skipSpace(s)
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+		var name string
+		if strings.HasPrefix(s, `"`) {
+			// Quoted UTF-8 label name
+			nameLocal, tail, err := readQuotedString(s)
+			if err != nil {
+				return nil, s, fmt.Errorf("cannot parse label name: %w", err)
+			}
+			name = nameLocal
+			s = skipSpace(tail)
+			if !strings.HasPrefix(s, "=") {
+				return nil, s, fmt.Errorf("missing `=` after %q", name)
+			}
+			s = s[1:]
+		} else {
+			n := strings.IndexByte(s, '=')
+			if n < 0 {
+				return nil, s, fmt.Errorf("missing `=` after %q", s)
+			}
+			name = strings.TrimSpace(s[:n])
+			s = s[n+1:]
+		}
+		s = skipSpace(s)
+		if len(s) == 0 || s[0] != '"' {
+			return nil, s, fmt.Errorf("missing starting `\"` for %q value; tail=%q", name, s)
+		}
+		value, tail, err := readQuotedString(s)
+		if err != nil {
+			return nil, s, fmt.Errorf("cannot parse %q value: %w", name, err)
+		}
+		labels = append(labels, label{
+			name:  name,
+			value: value,
+		})
+		s = skipSpace(tail)
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return nil, s, fmt.Errorf("missing `,` after %q value; tail=%q", name, s)
+		}
+	}
+}
+
+// readQuotedString reads a double-quoted string from the beginning of s.
+//
+// It returns the unquoted string and the tail after the closing quote.
+func readQuotedString(s string) (string, string, error) {
+	if len(s) == 0 || s[0] != '"' {
+		return "", s, fmt.Errorf("missing starting `\"`; tail=%q", s)
+	}
+	// Search for the closing quote, which isn't escaped.
+	i := 1
+	for i < len(s) && s[i] != '"' {
+		if s[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(s) {
+		return "", s, fmt.Errorf("missing trailing `\"`; tail=%q", s)
+	}
+	value, err := strconv.Unquote(s[:i+1])
+	if err != nil {
+		return "", s, fmt.Errorf("cannot unquote %s: %w", s[:i+1], err)
+	}
+	return value, s[i+1:], nil
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSampleSuccess(t *testing.T) {
+	f := func(line string, expected *sample) {
+		t.Helper()
+		s, err := parseSample(line)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", line, err)
+		}
+		if !reflect.DeepEqual(s, expected) {
+			t.Fatalf("unexpected sample parsed from %q;\ngot\n%+v\nwant\n%+v", line, s, expected)
+		}
+	}
+	f("foo 123", &sample{
+		name:  "foo",
+		value: 123,
+	})
+	f(`foo{bar="baz",a="b\"c"} -1.5e3 1234`, &sample{
+		name: "foo",
+		labels: []label{
+			{name: "bar", value: "baz"},
+			{name: "a", value: `b"c`},
+		},
+		value:        -1500,
+		timestamp:    1234,
+		hasTimestamp: true,
+	})
+	f(`foo{compiler="gc", GOOS="linux"} 1`, &sample{
+		name: "foo",
+		labels: []label{
+			{name: "compiler", value: "gc"},
+			{name: "GOOS", value: "linux"},
+		},
+		value: 1,
+	})
+
+	// quoted UTF-8 names
+	f(`{"my.metric"} 2`, &sample{
+		name:  "my.metric",
+		value: 2,
+	})
+	f(`{"my.metric","label.name"="x",foo="bar"} 3`, &sample{
+		name: "my.metric",
+		labels: []label{
+			{name: "label.name", value: "x"},
+			{name: "foo", value: "bar"},
+		},
+		value: 3,
+	})
+}
+
+func TestParseSampleFailure(t *testing.T) {
+	f := func(line string) {
+		t.Helper()
+		if _, err := parseSample(line); err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q", line)
+		}
+	}
+	f("")
+	f("foo")
+	f("foo bar")
+	f("foo 1 2 3")
+	f("foo 1 bar")
+	f(`foo{bar} 1`)
+	f(`foo{bar="baz} 1`)
+	f(`foo{bar="baz" a="b"} 1`)
+	f(`{"foo} 1`)
+	f(`{"foo" 1`)
+	f(`{"foo","bar"} 1`)
+}
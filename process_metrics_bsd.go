@@ -0,0 +1,39 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package metrics
+
+import (
+	"io"
+	"log"
+	"syscall"
+)
+
+func writeProcessMetrics(w io.Writer, _ *ProcessMetricsOptions) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		log.Printf("ERROR: metrics: cannot obtain process resource usage: %s", err)
+		return
+	}
+	utime := float64(ru.Utime.Nano()) / 1e9
+	stime := float64(ru.Stime.Nano()) / 1e9
+	WriteCounterFloat64(w, "process_cpu_seconds_system_total", stime)
+	WriteCounterFloat64(w, "process_cpu_seconds_total", utime+stime)
+	WriteCounterFloat64(w, "process_cpu_seconds_user_total", utime)
+	WriteCounterUint64(w, "process_major_pagefaults_total", uint64(ru.Majflt))
+	WriteCounterUint64(w, "process_minor_pagefaults_total", uint64(ru.Minflt))
+	// ru_maxrss is in kilobytes on BSD.
+	WriteGaugeUint64(w, "process_resident_memory_peak_bytes", uint64(ru.Maxrss)*1024)
+	writeKinfoProcMetrics(w)
+}
+
+// writeFDMetrics writes process_max_fds and process_open_fds metrics to w.
+func writeFDMetrics(w io.Writer) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		log.Printf("ERROR: metrics: cannot determine the limit on open file descritors: %s", err)
+		return
+	}
+	WriteGaugeUint64(w, "process_max_fds", uint64(rlimit.Cur))
+	writeOpenFDsMetric(w)
+}
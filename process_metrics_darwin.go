@@ -0,0 +1,152 @@
+//go:build darwin
+// +build darwin
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// See https://github.com/apple-oss-distributions/xnu/blob/main/bsd/sys/proc_info.h
+const (
+	procInfoCallPIDInfo = 2
+	procPIDTBSDInfo     = 3
+	procPIDTaskInfo     = 4
+)
+
+// procTaskInfo is struct proc_taskinfo from sys/proc_info.h
+type procTaskInfo struct {
+	VirtualSize      uint64
+	ResidentSize     uint64
+	TotalUser        uint64
+	TotalSystem      uint64
+	ThreadsUser      uint64
+	ThreadsSystem    uint64
+	Policy           int32
+	Faults           int32
+	Pageins          int32
+	CowFaults        int32
+	MessagesSent     int32
+	MessagesReceived int32
+	SyscallsMach     int32
+	SyscallsUnix     int32
+	Csw              int32
+	Threadnum        int32
+	Numrunning       int32
+	Priority         int32
+}
+
+// procBSDInfo is struct proc_bsdinfo from sys/proc_info.h
+type procBSDInfo struct {
+	Flags       uint32
+	Status      uint32
+	Xstatus     uint32
+	Pid         uint32
+	Ppid        uint32
+	UID         uint32
+	GID         uint32
+	RUID        uint32
+	RGID        uint32
+	SVUID       uint32
+	SVGID       uint32
+	Rfu1        uint32
+	Comm        [16]byte
+	Name        [32]byte
+	Nfiles      uint32
+	Pgid        uint32
+	Pjobc       uint32
+	ETdev       uint32
+	ETpgid      uint32
+	Nice        int32
+	StartTvsec  uint64
+	StartTvusec uint64
+}
+
+func writeProcessMetrics(w io.Writer, _ *ProcessMetricsOptions) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		log.Printf("ERROR: metrics: cannot obtain process resource usage: %s", err)
+		return
+	}
+	var ti procTaskInfo
+	if err := getProcInfo(procPIDTaskInfo, unsafe.Pointer(&ti), unsafe.Sizeof(ti)); err != nil {
+		log.Printf("ERROR: metrics: cannot obtain process task info: %s", err)
+		return
+	}
+	var bi procBSDInfo
+	if err := getProcInfo(procPIDTBSDInfo, unsafe.Pointer(&bi), unsafe.Sizeof(bi)); err != nil {
+		log.Printf("ERROR: metrics: cannot obtain process bsd info: %s", err)
+		return
+	}
+
+	// CPU times are obtained from rusage, since proc_taskinfo contains them in Mach absolute time units on arm64.
+	utime := float64(ru.Utime.Nano()) / 1e9
+	stime := float64(ru.Stime.Nano()) / 1e9
+	WriteCounterFloat64(w, "process_cpu_seconds_system_total", stime)
+	WriteCounterFloat64(w, "process_cpu_seconds_total", utime+stime)
+	WriteCounterFloat64(w, "process_cpu_seconds_user_total", utime)
+	WriteCounterUint64(w, "process_major_pagefaults_total", uint64(ru.Majflt))
+	WriteCounterUint64(w, "process_minor_pagefaults_total", uint64(ru.Minflt))
+	WriteGaugeUint64(w, "process_num_threads", uint64(ti.Threadnum))
+	WriteGaugeUint64(w, "process_resident_memory_bytes", ti.ResidentSize)
+	// ru_maxrss is in bytes on darwin.
+	WriteGaugeUint64(w, "process_resident_memory_peak_bytes", uint64(ru.Maxrss))
+	WriteGaugeUint64(w, "process_start_time_seconds", bi.StartTvsec)
+	WriteGaugeUint64(w, "process_virtual_memory_bytes", ti.VirtualSize)
+}
+
+// getProcInfo reads proc_pidinfo with the given flavor for the current process into buf with the given size.
+func getProcInfo(flavor int, buf unsafe.Pointer, size uintptr) error {
+	n, _, errno := syscall.Syscall6(syscall.SYS_PROC_INFO, procInfoCallPIDInfo, uintptr(os.Getpid()), uintptr(flavor), 0, uintptr(buf), size)
+	if errno != 0 {
+		return errno
+	}
+	if n != size {
+		return fmt.Errorf("unexpected size returned from proc_pidinfo; got %d; want %d", n, size)
+	}
+	return nil
+}
+
+// writeFDMetrics writes process_max_fds and process_open_fds metrics to w.
+func writeFDMetrics(w io.Writer) {
+	totalOpenFDs, err := getOpenFDsCount("/dev/fd")
+	if err != nil {
+		log.Printf("ERROR: metrics: cannot determine open file descriptors count: %s", err)
+		return
+	}
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		log.Printf("ERROR: metrics: cannot determine the limit on open file descritors: %s", err)
+		return
+	}
+	WriteGaugeUint64(w, "process_max_fds", rlimit.Cur)
+	WriteGaugeUint64(w, "process_open_fds", totalOpenFDs)
+}
+
+// getOpenFDsCount returns the number of open file descriptors listed at path.
+//
+// The file descriptor opened for reading path isn't counted.
+func getOpenFDsCount(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var totalOpenFDs uint64
+	for {
+		names, err := f.Readdirnames(512)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("unexpected error at Readdirnames: %s", err)
+		}
+		totalOpenFDs += uint64(len(names))
+	}
+	return totalOpenFDs - 1, nil
+}
@@ -0,0 +1,74 @@
+//go:build freebsd
+// +build freebsd
+
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// See https://github.com/freebsd/freebsd-src/blob/main/sys/sys/sysctl.h
+const (
+	ctlKern        = 1
+	kernProc       = 14
+	kernProcPID    = 1
+	kernProcNFDs   = 43
+	kinfoProcSize  = 1088
+	kiPIDOffset    = 72
+	kiSizeOffset   = 256
+	kiRSSizeOffset = 264
+	kiStartOffset  = 336
+)
+
+// writeKinfoProcMetrics writes metrics from struct kinfo_proc for the current process to w.
+//
+// See https://github.com/freebsd/freebsd-src/blob/main/sys/sys/user.h
+// Offsets are valid only for 64-bit architectures, so the metrics aren't written on 32-bit architectures.
+func writeKinfoProcMetrics(w io.Writer) {
+	pid := os.Getpid()
+	data, err := sysctlRaw([]int32{ctlKern, kernProc, kernProcPID, int32(pid)}, kinfoProcSize)
+	if err != nil {
+		log.Printf("ERROR: metrics: cannot read kern.proc.pid.%d: %s", pid, err)
+		return
+	}
+	if len(data) != kinfoProcSize || binary.LittleEndian.Uint32(data) != kinfoProcSize ||
+		binary.LittleEndian.Uint32(data[kiPIDOffset:]) != uint32(pid) {
+		// Unsupported architecture.
+		return
+	}
+	vsize := binary.LittleEndian.Uint64(data[kiSizeOffset:])
+	rssPages := binary.LittleEndian.Uint64(data[kiRSSizeOffset:])
+	startTimeSeconds := binary.LittleEndian.Uint64(data[kiStartOffset:])
+	WriteGaugeUint64(w, "process_resident_memory_bytes", rssPages*uint64(os.Getpagesize()))
+	WriteGaugeUint64(w, "process_start_time_seconds", startTimeSeconds)
+	WriteGaugeUint64(w, "process_virtual_memory_bytes", vsize)
+}
+
+// writeOpenFDsMetric writes process_open_fds metric to w.
+func writeOpenFDsMetric(w io.Writer) {
+	pid := os.Getpid()
+	data, err := sysctlRaw([]int32{ctlKern, kernProc, kernProcNFDs, int32(pid)}, 4)
+	if err != nil || len(data) != 4 {
+		log.Printf("ERROR: metrics: cannot determine open file descriptors count: %v", err)
+		return
+	}
+	WriteGaugeUint64(w, "process_open_fds", uint64(binary.LittleEndian.Uint32(data)))
+}
+
+// sysctlRaw returns up to size bytes of the sysctl value for the given mib.
+func sysctlRaw(mib []int32, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	n := uintptr(size)
+	_, _, errno := syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n)), 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("sysctl error: %w", errno)
+	}
+	return buf[:n], nil
+}
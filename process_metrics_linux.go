@@ -7,8 +7,10 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -47,7 +49,7 @@ type procStat struct {
 	Rss         int
 }
 
-func writeProcessMetrics(w io.Writer) {
+func writeProcessMetrics(w io.Writer, opts *ProcessMetricsOptions) {
 	statFilepath := "/proc/self/stat"
 	data, err := ioutil.ReadFile(statFilepath)
 	if err != nil {
@@ -90,6 +92,21 @@ func writeProcessMetrics(w io.Writer) {
 	WriteGaugeUint64(w, "process_virtual_memory_bytes", uint64(p.Vsize))
 	writeProcessMemMetrics(w)
 	writeIOMetrics(w)
+	if opts.EnableNetworkMetrics {
+		writeNetworkMetrics(w)
+	}
+	if opts.EnableSchedstat {
+		writeSchedstatMetrics(w)
+	}
+	if opts.EnableNUMA {
+		writeNUMAMetrics(w)
+	}
+	if opts.EnableSmaps {
+		writeSmapsMetrics(w, opts.SmapsRefreshInterval)
+	}
+	if opts.EnableCgroupMetrics {
+		writeCgroupMetrics(w)
+	}
 }
 
 var procSelfIOErrLogged uint32
@@ -146,6 +163,177 @@ func writeIOMetrics(w io.Writer) {
 	WriteGaugeUint64(w, "process_io_storage_written_bytes_total", uint64(writeBytes))
 }
 
+var procSelfNetDevErrLogged uint32
+
+// writeNetworkMetrics writes network I/O metrics per network interface to w.
+//
+// The metrics are obtained for the network namespace of the current process.
+func writeNetworkMetrics(w io.Writer) {
+	netDevFilepath := "/proc/self/net/dev"
+	nss, err := getNetDevStats(netDevFilepath)
+	if err != nil {
+		// Do not spam the logs with errors - this error cannot be fixed without process restart.
+		if atomic.CompareAndSwapUint32(&procSelfNetDevErrLogged, 0, 1) {
+			log.Printf("ERROR: metrics: cannot read process_network_* metrics from %q, so these metrics won't be updated until the error is fixed: %s", netDevFilepath, err)
+		}
+		return
+	}
+	for _, ns := range nss {
+		WriteCounterUint64(w, addLabel("process_network_receive_bytes_total", "interface", ns.iface), ns.receiveBytes)
+		WriteCounterUint64(w, addLabel("process_network_transmit_bytes_total", "interface", ns.iface), ns.transmitBytes)
+	}
+}
+
+type netDevStats struct {
+	iface         string
+	receiveBytes  uint64
+	transmitBytes uint64
+}
+
+// getNetDevStats returns per-interface stats from /proc/self/net/dev file at path.
+func getNetDevStats(path string) ([]netDevStats, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var nss []netDevStats
+	for _, s := range strings.Split(string(data), "\n") {
+		n := strings.IndexByte(s, ':')
+		if n < 0 {
+			// Skip header lines
+			continue
+		}
+		fields := strings.Fields(s[n+1:])
+		if len(fields) != 16 {
+			return nil, fmt.Errorf("unexpected number of fields in %q; got %d; want 16", s, len(fields))
+		}
+		receiveBytes, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse received bytes from %q: %w", s, err)
+		}
+		transmitBytes, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse transmitted bytes from %q: %w", s, err)
+		}
+		nss = append(nss, netDevStats{
+			iface:         strings.TrimSpace(s[:n]),
+			receiveBytes:  receiveBytes,
+			transmitBytes: transmitBytes,
+		})
+	}
+	return nss, nil
+}
+
+var procSelfSchedstatErrLogged uint32
+
+// procSelfSchedstat accumulates scheduler stats for threads of the current process.
+var procSelfSchedstat schedstatTracker
+
+// writeSchedstatMetrics writes scheduler stats for the current process to w.
+func writeSchedstatMetrics(w io.Writer) {
+	taskDir := "/proc/self/task"
+	threads, err := getThreadSchedstats(taskDir)
+	if err != nil {
+		// Do not spam the logs with errors - this error cannot be fixed without process restart.
+		if atomic.CompareAndSwapUint32(&procSelfSchedstatErrLogged, 0, 1) {
+			log.Printf("ERROR: metrics: cannot read process_schedstat_* metrics from %q, so these metrics won't be updated until the error is fixed: %s", taskDir, err)
+		}
+		return
+	}
+	ss := procSelfSchedstat.update(threads)
+	WriteCounterFloat64(w, "process_schedstat_running_seconds_total", float64(ss.runningNsecs)/1e9)
+	WriteCounterFloat64(w, "process_schedstat_waiting_seconds_total", float64(ss.waitingNsecs)/1e9)
+	WriteCounterUint64(w, "process_schedstat_timeslices_total", ss.timeslices)
+}
+
+type schedstat struct {
+	runningNsecs uint64
+	waitingNsecs uint64
+	timeslices   uint64
+}
+
+func (ss *schedstat) add(src *schedstat) {
+	ss.runningNsecs += src.runningNsecs
+	ss.waitingNsecs += src.waitingNsecs
+	ss.timeslices += src.timeslices
+}
+
+// schedstatTracker sums scheduler stats over threads, so the sums do not decrease when threads exit.
+type schedstatTracker struct {
+	mu sync.Mutex
+
+	// exited contains the sum of the last seen stats for exited threads.
+	exited schedstat
+
+	// threads contains the last seen stats per thread id.
+	threads map[string]schedstat
+}
+
+// update updates st with the current stats per thread id and returns the sum of stats for all the live and exited threads.
+func (st *schedstatTracker) update(threads map[string]schedstat) schedstat {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for tid, prev := range st.threads {
+		curr, ok := threads[tid]
+		if !ok || curr.runningNsecs < prev.runningNsecs || curr.waitingNsecs < prev.waitingNsecs || curr.timeslices < prev.timeslices {
+			// The thread exited. Its id may be re-used by a new thread.
+			st.exited.add(&prev)
+		}
+	}
+	st.threads = threads
+
+	ss := st.exited
+	for _, curr := range threads {
+		ss.add(&curr)
+	}
+	return ss
+}
+
+// getThreadSchedstats returns scheduler stats from schedstat files per thread id for all the threads at taskDir.
+//
+// /proc/self/schedstat contains stats only for the main thread, so stats are collected per thread.
+// See https://docs.kernel.org/scheduler/sched-stats.html
+func getThreadSchedstats(taskDir string) (map[string]schedstat, error) {
+	fis, err := ioutil.ReadDir(taskDir)
+	if err != nil {
+		return nil, err
+	}
+	threads := make(map[string]schedstat, len(fis))
+	var lastErr error
+	for _, fi := range fis {
+		schedstatFilepath := filepath.Join(taskDir, fi.Name(), "schedstat")
+		data, err := ioutil.ReadFile(schedstatFilepath)
+		if err != nil {
+			// The thread may exit after reading taskDir.
+			lastErr = err
+			continue
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected number of fields in %q at %s; got %d; want 3", data, schedstatFilepath, len(fields))
+		}
+		var values [3]uint64
+		for i, field := range fields {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %q at %s: %w", data, schedstatFilepath, err)
+			}
+			values[i] = v
+		}
+		threads[fi.Name()] = schedstat{
+			runningNsecs: values[0],
+			waitingNsecs: values[1],
+			timeslices:   values[2],
+		}
+	}
+	if len(threads) == 0 {
+		// The kernel may be built without CONFIG_SCHEDSTATS.
+		return nil, fmt.Errorf("cannot read schedstat for threads at %s: %w", taskDir, lastErr)
+	}
+	return threads, nil
+}
+
 var startTimeSeconds = time.Now().Unix()
 
 // writeFDMetrics writes process_max_fds and process_open_fds metrics to w.
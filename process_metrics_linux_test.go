@@ -1,6 +1,9 @@
 package metrics
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestGetMaxFilesLimit(t *testing.T) {
 	f := func(want uint64, path string, wantErr bool) {
@@ -49,3 +52,69 @@ func TestGetMemStats(t *testing.T) {
 	f(memStats{vmPeak: 2130489344, rssPeak: 200679424, rssAnon: 121602048, rssFile: 11362304}, "testdata/status", false)
 	f(memStats{}, "testdata/status_bad", true)
 }
+
+func TestGetNetDevStats(t *testing.T) {
+	f := func(want []netDevStats, path string, wantErr bool) {
+		t.Helper()
+		got, err := getNetDevStats(path)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result: %+v, want: %+v at getNetDevStats", got, want)
+		}
+	}
+	f([]netDevStats{
+		{iface: "lo", receiveBytes: 107145234, transmitBytes: 107145234},
+		{iface: "ifb0"},
+		{iface: "ifb1"},
+		{iface: "eth0", receiveBytes: 1934495, transmitBytes: 29380},
+	}, "testdata/net_dev", false)
+	f(nil, "testdata/net_dev_bad", true)
+	f(nil, "testdata/bad_path", true)
+}
+
+func TestGetThreadSchedstats(t *testing.T) {
+	f := func(want map[string]schedstat, path string, wantErr bool) {
+		t.Helper()
+		got, err := getThreadSchedstats(path)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result: %+v, want: %+v at getThreadSchedstats", got, want)
+		}
+	}
+	f(map[string]schedstat{
+		"100": {runningNsecs: 1500000000, waitingNsecs: 35346, timeslices: 10},
+		"101": {runningNsecs: 500000000, waitingNsecs: 1000000, timeslices: 5},
+		"102": {runningNsecs: 3000000000, waitingNsecs: 2000000000, timeslices: 20},
+	}, "testdata/task", false)
+	f(nil, "testdata/task_bad", true)
+	f(nil, "testdata/bad_path", true)
+}
+
+func TestSchedstatTracker(t *testing.T) {
+	var st schedstatTracker
+	f := func(threads map[string]schedstat, want schedstat) {
+		t.Helper()
+		if got := st.update(threads); got != want {
+			t.Fatalf("unexpected result: %+v, want: %+v", got, want)
+		}
+	}
+	f(map[string]schedstat{
+		"1": {runningNsecs: 10, waitingNsecs: 1, timeslices: 2},
+		"2": {runningNsecs: 20, waitingNsecs: 2, timeslices: 3},
+	}, schedstat{runningNsecs: 30, waitingNsecs: 3, timeslices: 5})
+
+	// Stats for the exited thread 2 are preserved
+	f(map[string]schedstat{
+		"1": {runningNsecs: 15, waitingNsecs: 1, timeslices: 4},
+	}, schedstat{runningNsecs: 35, waitingNsecs: 3, timeslices: 7})
+
+	// Thread id 1 is re-used by a new thread
+	f(map[string]schedstat{
+		"1": {runningNsecs: 5, waitingNsecs: 1, timeslices: 1},
+		"3": {runningNsecs: 1, waitingNsecs: 1, timeslices: 1},
+	}, schedstat{runningNsecs: 41, waitingNsecs: 5, timeslices: 9})
+}
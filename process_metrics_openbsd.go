@@ -0,0 +1,21 @@
+//go:build openbsd
+// +build openbsd
+
+package metrics
+
+import (
+	"io"
+)
+
+// writeKinfoProcMetrics writes metrics from struct kinfo_proc for the current process to w.
+//
+// OpenBSD doesn't allow direct syscalls, which are needed for reading kern.proc.pid sysctl without cgo,
+// so only the metrics from getrusage are exposed on OpenBSD.
+func writeKinfoProcMetrics(w io.Writer) {
+	// TODO: implement it
+}
+
+// writeOpenFDsMetric writes process_open_fds metric to w.
+func writeOpenFDsMetric(w io.Writer) {
+	// TODO: implement it
+}
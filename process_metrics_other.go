@@ -1,5 +1,5 @@
-//go:build !linux && !windows
-// +build !linux,!windows
+//go:build !linux && !windows && !darwin && !freebsd && !openbsd
+// +build !linux,!windows,!darwin,!freebsd,!openbsd
 
 package metrics
 
@@ -7,7 +7,7 @@ import (
 	"io"
 )
 
-func writeProcessMetrics(w io.Writer) {
+func writeProcessMetrics(w io.Writer, _ *ProcessMetricsOptions) {
 	// TODO: implement it
 }
 
@@ -0,0 +1,359 @@
+package metrics
+
+import (
+	"io"
+	"log"
+	"math"
+	"strings"
+)
+
+// ProtobufContentType is the Content-Type for the output generated by WritePrometheusProtobuf.
+//
+// It must be set in the response to Prometheus scrape requests, which accept protobuf exposition format.
+const ProtobufContentType = "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited"
+
+// WritePrometheusProtobuf writes all the metrics from the default set, all the added sets and metrics writers to w
+// in Prometheus protobuf exposition format.
+//
+// This format must be used for exposing NativeHistogram buckets to Prometheus,
+// since Prometheus text exposition format doesn't support native histograms.
+// The response must have ProtobufContentType Content-Type.
+//
+// If exposeProcessMetrics is true, then various `go_*` and `process_*` metrics
+// are exposed for the current process.
+//
+// See also WritePrometheus.
+func WritePrometheusProtobuf(w io.Writer, exposeProcessMetrics bool) {
+	writeGlobalPrometheusProtobuf(w, exposeProcessMetrics, nil)
+}
+
+// writeGlobalPrometheusProtobuf writes metrics from all the registered sets and metrics writers to w in Prometheus protobuf format.
+//
+// Only metrics from sets, for which keep returns true, are written. All the metrics are written if keep is nil.
+func writeGlobalPrometheusProtobuf(w io.Writer, exposeProcessMetrics bool, keep func(name string) bool) {
+	for _, rs := range getRegisteredSets() {
+		rs.s.writePrometheusProtobuf(w, rs.prefix, rs.getKeep(keep))
+	}
+	if exposeProcessMetrics {
+		var pw protobufWriter
+		bb := getBytesBuffer()
+		WriteProcessMetrics(bb)
+		pw.addText(bb.B, "", "")
+		putBytesBuffer(bb)
+		pw.writeTo(w)
+	}
+}
+
+// WritePrometheusProtobuf writes all the metrics from s to w in Prometheus protobuf exposition format.
+//
+// This format must be used for exposing NativeHistogram buckets to Prometheus,
+// since Prometheus text exposition format doesn't support native histograms.
+// The response must have ProtobufContentType Content-Type.
+//
+// Histogram buckets are exposed with cumulative `le` upper bounds in the same way as for OpenMetrics format.
+func (s *Set) WritePrometheusProtobuf(w io.Writer) {
+	s.writePrometheusProtobuf(w, "", nil)
+}
+
+// writePrometheusProtobuf writes metrics from s to w in Prometheus protobuf exposition format
+// with the given prefix prepended to metric names.
+//
+// Only metrics, for which keep returns true, are written. All the metrics are written if keep is nil.
+func (s *Set) writePrometheusProtobuf(w io.Writer, prefix string, keep func(name string) bool) {
+	pw := protobufWriter{
+		namePrefix: prefix,
+	}
+	s.addToProtobufWriter(&pw, "", keep)
+	pw.writeTo(w)
+}
+
+// addToProtobufWriter adds metrics from s and its child sets to pw.
+//
+// extraLabels are added to all the metrics. They contain common labels inherited from the parent sets.
+// Only metrics, for which keep returns true, are added. All the metrics are added if keep is nil.
+func (s *Set) addToProtobufWriter(pw *protobufWriter, extraLabels string, keep func(name string) bool) {
+	sa, metricsWriters := s.getSortedMetrics()
+	if keep != nil {
+		sa = filterMetrics(sa, keep)
+	}
+	extraLabels = joinLabels(extraLabels, s.getCommonLabels())
+	labels := joinLabels(extraLabels, s.labels)
+
+	bb := getBytesBuffer()
+	addText := func(family, metricType string) {
+		data := bb.B
+		if labels != "" {
+			data = addExtraLabels(nil, data, labels)
+		}
+		pw.addText(data, family, metricType)
+	}
+	for _, nm := range sa {
+		if nm.isAux {
+			// Summary quantiles are marshaled together with the summary.
+			continue
+		}
+		if pm, ok := nm.metric.(protobufMarshaler); ok {
+			name := nm.name
+			if labels != "" {
+				name = addLabelsPrefix(name, labels)
+			}
+			pw.addMetric(name, pm)
+			continue
+		}
+		bb.B = bb.B[:0]
+		nm.metric.marshalTo(nm.name, bb)
+		addText(getMetricFamily(nm.name), nm.metric.metricType())
+	}
+	s.removeIdleMetrics()
+	bb.B = bb.B[:0]
+	for _, writeMetrics := range metricsWriters {
+		writeMetrics(bb)
+	}
+	addText("", "")
+	putBytesBuffer(bb)
+
+	for _, child := range s.getChildren() {
+		child.addToProtobufWriter(pw, extraLabels, keep)
+	}
+}
+
+// protobufMarshaler must be implemented by metrics, which cannot be represented in Prometheus text exposition format.
+type protobufMarshaler interface {
+	// marshalProtobuf must append io.prometheus.client.Metric fields except of labels to dst and return the result.
+	//
+	// dst may be returned unchanged if the metric has no values to marshal yet.
+	marshalProtobuf(dst []byte) []byte
+
+	// protobufType must return io.prometheus.client.MetricType for the metric.
+	protobufType() uint64
+}
+
+// Values for io.prometheus.client.MetricType
+//
+// See https://github.com/prometheus/client_model/blob/master/io/prometheus/client/metrics.proto
+const (
+	protobufTypeCounter   = 0
+	protobufTypeGauge     = 1
+	protobufTypeSummary   = 2
+	protobufTypeUntyped   = 3
+	protobufTypeHistogram = 4
+)
+
+// protobufWriter groups metrics into io.prometheus.client.MetricFamily messages.
+type protobufWriter struct {
+	families []*protobufFamily
+	m        map[string]*protobufFamily
+
+	// types contains metric types obtained from `# TYPE` comments.
+	types map[string]string
+
+	// namePrefix is prepended to names of all the metric families.
+	namePrefix string
+}
+
+type protobufFamily struct {
+	name    string
+	typ     uint64
+	metrics [][]byte
+}
+
+// getFamily returns family with the given name from pw.
+//
+// The family is created with the given typ if it is missing in pw.
+// The type of the existing family is preserved, since MetricFamily names must be unique in the output.
+func (pw *protobufWriter) getFamily(name string, typ uint64) *protobufFamily {
+	name = pw.namePrefix + name
+	if pw.m == nil {
+		pw.m = make(map[string]*protobufFamily)
+	}
+	pf := pw.m[name]
+	if pf == nil {
+		pf = &protobufFamily{
+			name: name,
+			typ:  typ,
+		}
+		pw.m[name] = pf
+		pw.families = append(pw.families, pf)
+	}
+	return pf
+}
+
+// addMetric adds pm with the given name to pw.
+func (pw *protobufWriter) addMetric(name string, pm protobufMarshaler) {
+	family, labelsStr := splitMetricName(name)
+	var labels []label
+	if labelsStr != "" {
+		ls, _, err := parseLabels(labelsStr[1:])
+		if err != nil {
+			log.Printf("ERROR: metrics: cannot parse labels for %q: %s", name, err)
+			return
+		}
+		labels = ls
+	}
+	var dst []byte
+	dst = appendProtobufLabels(dst, labels)
+	n := len(dst)
+	dst = pm.marshalProtobuf(dst)
+	if len(dst) == n {
+		return
+	}
+	typ := pm.protobufType()
+	pf := pw.getFamily(family, typ)
+	if pf.typ != typ {
+		log.Printf("ERROR: metrics: cannot add metric %q with type %d to the family with type %d", name, typ, pf.typ)
+		return
+	}
+	pf.metrics = append(pf.metrics, dst)
+}
+
+// addText adds metrics from data in Prometheus text exposition format to pw.
+//
+// Samples for the given family are marshaled with the given metricType if it equals to counter or gauge.
+// Metric types for the rest of samples are obtained from `# TYPE` comments in data.
+// Samples without known metric type are marshaled as untyped.
+func (pw *protobufWriter) addText(data []byte, family, metricType string) {
+	visitLines(data, func(line []byte) {
+		s := string(line)
+		if strings.HasPrefix(s, "#") {
+			pw.addComment(s)
+			return
+		}
+		sm, err := parseSample(s)
+		if err != nil {
+			log.Printf("ERROR: metrics: cannot convert sample to protobuf: %s", err)
+			return
+		}
+		typ := metricType
+		if sm.name != family {
+			typ = pw.types[sm.name]
+		}
+		pw.addSample(sm, typ)
+	})
+}
+
+func (pw *protobufWriter) addComment(s string) {
+	fields := strings.Fields(s)
+	if len(fields) != 4 || fields[1] != "TYPE" {
+		return
+	}
+	if pw.types == nil {
+		pw.types = make(map[string]string)
+	}
+	pw.types[fields[2]] = fields[3]
+}
+
+func (pw *protobufWriter) addSample(sm *sample, metricType string) {
+	typ := uint64(protobufTypeUntyped)
+	switch metricType {
+	case "counter":
+		typ = protobufTypeCounter
+	case "gauge":
+		typ = protobufTypeGauge
+	}
+	pf := pw.getFamily(sm.name, typ)
+
+	var dst []byte
+	dst = appendProtobufLabels(dst, sm.labels)
+	v := appendProtobufDouble(nil, 1, sm.value)
+	switch pf.typ {
+	case protobufTypeCounter:
+		dst = appendProtobufMessage(dst, 3, v)
+	case protobufTypeGauge:
+		dst = appendProtobufMessage(dst, 2, v)
+	case protobufTypeUntyped:
+		dst = appendProtobufMessage(dst, 5, v)
+	default:
+		log.Printf("ERROR: metrics: cannot add sample %q to the family with type %d", sm.fullName(), pf.typ)
+		return
+	}
+	if sm.hasTimestamp {
+		dst = appendProtobufVarint(dst, 6, uint64(sm.timestamp))
+	}
+	pf.metrics = append(pf.metrics, dst)
+}
+
+// writeTo writes length-delimited io.prometheus.client.MetricFamily messages collected in pw to w.
+func (pw *protobufWriter) writeTo(w io.Writer) {
+	var dst, mf []byte
+	for _, pf := range pw.families {
+		mf = appendProtobufString(mf[:0], 1, pf.name)
+		mf = appendProtobufVarint(mf, 3, pf.typ)
+		for _, m := range pf.metrics {
+			mf = appendProtobufMessage(mf, 4, m)
+		}
+		dst = appendUvarint(dst, uint64(len(mf)))
+		dst = append(dst, mf...)
+	}
+	w.Write(dst)
+}
+
+// addLabelsPrefix adds labels in front of the labels in the given metric name in the same way as addExtraLabels does.
+func addLabelsPrefix(name, labels string) string {
+	family, labelsStr := splitMetricName(name)
+	if labelsStr == "" {
+		return family + "{" + labels + "}"
+	}
+	return family + "{" + labels + "," + labelsStr[1:]
+}
+
+func appendProtobufLabels(dst []byte, labels []label) []byte {
+	var lp []byte
+	for _, l := range labels {
+		lp = appendProtobufString(lp[:0], 1, l.name)
+		lp = appendProtobufString(lp, 2, l.value)
+		dst = appendProtobufMessage(dst, 1, lp)
+	}
+	return dst
+}
+
+// Protobuf wire types.
+//
+// See https://protobuf.dev/programming-guides/encoding/#structure
+const (
+	protobufWireVarint = 0
+	protobufWireI64    = 1
+	protobufWireLen    = 2
+)
+
+func appendProtobufTag(dst []byte, fieldNum, wireType uint64) []byte {
+	return appendUvarint(dst, fieldNum<<3|wireType)
+}
+
+func appendProtobufVarint(dst []byte, fieldNum, v uint64) []byte {
+	dst = appendProtobufTag(dst, fieldNum, protobufWireVarint)
+	return appendUvarint(dst, v)
+}
+
+func appendProtobufSint(dst []byte, fieldNum uint64, v int64) []byte {
+	dst = appendProtobufTag(dst, fieldNum, protobufWireVarint)
+	return appendUvarint(dst, uint64(v<<1)^uint64(v>>63))
+}
+
+func appendProtobufDouble(dst []byte, fieldNum uint64, v float64) []byte {
+	dst = appendProtobufTag(dst, fieldNum, protobufWireI64)
+	return appendUint64LE(dst, math.Float64bits(v))
+}
+
+func appendProtobufString(dst []byte, fieldNum uint64, s string) []byte {
+	dst = appendProtobufTag(dst, fieldNum, protobufWireLen)
+	dst = appendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+func appendProtobufMessage(dst []byte, fieldNum uint64, msg []byte) []byte {
+	dst = appendProtobufTag(dst, fieldNum, protobufWireLen)
+	dst = appendUvarint(dst, uint64(len(msg)))
+	return append(dst, msg...)
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
+
+func appendUint64LE(dst []byte, v uint64) []byte {
+	return append(dst, byte(v), byte(v>>8), byte(v>>16), byte(v>>24), byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56))
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSetWritePrometheusProtobuf(t *testing.T) {
+	f := func(s *Set, expected []byte) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheusProtobuf(&bb)
+		if result := bb.Bytes(); !bytes.Equal(result, expected) {
+			t.Fatalf("unexpected result;\ngot\n%x\nwant\n%x", result, expected)
+		}
+	}
+
+	// empty set
+	f(NewSet(), nil)
+
+	// counter
+	s := NewSet()
+	s.NewCounter(`foo{a="b"}`).Set(1)
+	f(s, []byte{
+		0x1c,                      // MetricFamily length
+		0x0a, 0x03, 'f', 'o', 'o', // name
+		0x18, 0x00, // type=COUNTER
+		0x22, 0x13, // metric
+		0x0a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b', // label
+		0x1a, 0x09, 0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // counter{value=1}
+	})
+
+	// metrics writer without metadata
+	s = NewSet()
+	s.RegisterMetricsWriter(func(w io.Writer) {
+		WriteGaugeUint64(w, "bar", 0)
+	})
+	f(s, []byte{
+		0x14,                      // MetricFamily length
+		0x0a, 0x03, 'b', 'a', 'r', // name
+		0x18, 0x03, // type=UNTYPED
+		0x22, 0x0b, // metric
+		0x2a, 0x09, 0x09, 0, 0, 0, 0, 0, 0, 0, 0, // untyped{value=0}
+	})
+
+	// native histogram
+	s = NewSet()
+	nh := s.NewNativeHistogramExt("baz", 0)
+	nh.Update(1)
+	nh.Update(0)
+	var expected []byte
+	expected = append(expected, 0x2c)                      // MetricFamily length
+	expected = append(expected, 0x0a, 0x03, 'b', 'a', 'z') // name
+	expected = append(expected, 0x18, 0x04)                // type=HISTOGRAM
+	expected = append(expected, 0x22, 0x23, 0x3a, 0x21)    // metric, histogram
+	expected = append(expected, 0x08, 0x02)                // sample_count=2
+	expected = append(expected, 0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f)
+	expected = append(expected, 0x28, 0x00)                         // schema=0
+	expected = append(expected, 0x31, 0, 0, 0, 0, 0, 0, 0xf0, 0x37) // zero_threshold
+	expected = append(expected, 0x38, 0x01)                         // zero_count=1
+	expected = append(expected, 0x62, 0x04, 0x08, 0x00, 0x10, 0x01) // positive_span
+	expected = append(expected, 0x6a, 0x01, 0x02)                   // positive_delta
+	f(s, expected)
+
+	// histogram
+	s = NewSet()
+	s.NewHistogram("hist")
+	f(s, nil)
+	s.GetOrCreateHistogram("hist").Update(1)
+	f(s, []byte{
+		0x24,                           // MetricFamily length
+		0x0a, 0x04, 'h', 'i', 's', 't', // name
+		0x18, 0x04, // type=HISTOGRAM
+		0x22, 0x1a, 0x3a, 0x18, // metric, histogram
+		0x08, 0x01, // sample_count=1
+		0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // sample_sum=1
+		0x1a, 0x0b, // bucket
+		0x08, 0x01, // cumulative_count=1
+		0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // upper_bound=1
+	})
+
+	// summary
+	s = NewSet()
+	sm := s.NewSummaryExt("sm", defaultSummaryWindow, []float64{0.5})
+	f(s, nil)
+	sm.Update(2)
+	f(s, []byte{
+		0x29,                 // MetricFamily length
+		0x0a, 0x02, 's', 'm', // name
+		0x18, 0x02, // type=SUMMARY
+		0x22, 0x21, 0x22, 0x1f, // metric, summary
+		0x08, 0x01, // sample_count=1
+		0x11, 0, 0, 0, 0, 0, 0, 0, 0x40, // sample_sum=2
+		0x1a, 0x12, // quantile
+		0x09, 0, 0, 0, 0, 0, 0, 0xe0, 0x3f, // quantile=0.5
+		0x11, 0, 0, 0, 0, 0, 0, 0, 0x40, // value=2
+	})
+}
+
+func TestSetWritePrometheusProtobufUniqueFamilies(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`foo{a="1"}`).Set(1)
+	s.NewGauge(`foo{a="2"}`, nil).Set(2)
+	s.RegisterMetricsWriter(func(w io.Writer) {
+		WriteGaugeUint64(w, `foo{a="3"}`, 3)
+	})
+	s.NewHistogram("bar").Update(1)
+	s.NewSummary("baz").Update(1)
+
+	var bb bytes.Buffer
+	s.WritePrometheusProtobuf(&bb)
+	var names []string
+	src := bb.Bytes()
+	for len(src) > 0 {
+		size, n := binary.Uvarint(src)
+		if n <= 0 || size > uint64(len(src)-n) {
+			t.Fatalf("cannot read MetricFamily length from %d bytes", len(src))
+		}
+		names = append(names, getProtobufFamilyName(src[n:n+int(size)]))
+		src = src[n+int(size):]
+	}
+	namesExpected := []string{"bar", "baz", "foo"}
+	if !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected MetricFamily names; got %q; want %q", names, namesExpected)
+	}
+}
+
+func TestSetWritePrometheusProtobufChildSet(t *testing.T) {
+	f := func(s, sExpected *Set) {
+		t.Helper()
+		var bb, bbExpected bytes.Buffer
+		s.WritePrometheusProtobuf(&bb)
+		sExpected.WritePrometheusProtobuf(&bbExpected)
+		if !bytes.Equal(bb.Bytes(), bbExpected.Bytes()) {
+			t.Fatalf("unexpected result;\ngot\n%x\nwant\n%x", bb.Bytes(), bbExpected.Bytes())
+		}
+	}
+
+	// Metrics in child sets must be marshaled in the same way as metrics with explicitly set labels.
+	s := NewSet()
+	child := s.NewChildSet(`a="b"`)
+	child.NewCounter("foo").Set(1)
+	child.NewNativeHistogramExt(`baz{c="d"}`, 0).Update(1)
+	sExpected := NewSet()
+	sExpected.NewCounter(`foo{a="b"}`).Set(1)
+	sExpected.NewNativeHistogramExt(`baz{a="b",c="d"}`, 0).Update(1)
+	f(s, sExpected)
+
+	// Common labels must be added in front of child set labels.
+	s.SetCommonLabels(`x="y"`)
+	sExpected = NewSet()
+	sExpected.NewCounter(`foo{x="y",a="b"}`).Set(1)
+	sExpected.NewNativeHistogramExt(`baz{x="y",a="b",c="d"}`, 0).Update(1)
+	f(s, sExpected)
+}
+
+func TestWritePrometheusProtobufWithPrefix(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`foo{a="b"}`).Set(1)
+
+	var bb bytes.Buffer
+	s.writePrometheusProtobuf(&bb, "x_", nil)
+	expected := []byte{
+		0x1e,                                // MetricFamily length
+		0x0a, 0x05, 'x', '_', 'f', 'o', 'o', // name
+		0x18, 0x00, // type=COUNTER
+		0x22, 0x13, // metric
+		0x0a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b', // label
+		0x1a, 0x09, 0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // counter{value=1}
+	}
+	if result := bb.Bytes(); !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected result;\ngot\n%x\nwant\n%x", result, expected)
+	}
+}
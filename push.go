@@ -3,11 +3,13 @@ package metrics
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
@@ -34,11 +36,148 @@ type PushOptions struct {
 
 	// Method is HTTP request method to use when pushing metrics to pushURL.
 	//
-	// By default the Method is GET.
+	// By default the Method is POST. Do not use GET, since many proxies drop request bodies for GET requests.
 	Method string
 
 	// Optional WaitGroup for waiting until all the push workers created with this WaitGroup are stopped.
 	WaitGroup *sync.WaitGroup
+
+	// SpoolDir is an optional directory for storing payloads, which couldn't be pushed to pushURL.
+	//
+	// The stored payloads are pushed in the order they were stored before the next payload, when pushURL becomes available.
+	// Samples in the stored payloads get timestamps of the failed push, so they are ingested with the original timestamps.
+	// This is useful for devices with flaky network connectivity.
+	//
+	// Payloads aren't stored on disk by default.
+	SpoolDir string
+
+	// SpoolMaxSize is the maximum size in bytes of payloads stored at SpoolDir. The oldest payloads are dropped when the limit is exceeded.
+	//
+	// By default the size is limited by 64MiB.
+	SpoolMaxSize int64
+
+	// SpoolMaxAge is the maximum age of payloads stored at SpoolDir. Older payloads are dropped.
+	//
+	// By default the age isn't limited.
+	SpoolMaxAge time.Duration
+
+	// Jitter is the maximum random delay added to every periodic push.
+	//
+	// This prevents from synchronized pushes from many clients started at the same time, which may overload pushURL.
+	// Jitter must be smaller than the push interval. By default pushes are performed exactly at the interval.
+	Jitter time.Duration
+
+	// MaxBlockSize is the maximum size in bytes of uncompressed metrics sent in a single request to pushURL.
+	//
+	// Bigger payloads are split into multiple requests at metric family boundaries, so they do not hit request size limits
+	// at pushURL. A single metric family bigger than MaxBlockSize is sent in a separate request.
+	//
+	// By default all the metrics are sent in a single request.
+	MaxBlockSize int
+
+	// BreakerMaxFailures is the number of consecutive failed periodic pushes, after which the periodic pushes are suspended.
+	//
+	// While pushes are suspended, metrics aren't collected and compressed at every push interval. Instead, a single probe push
+	// is performed every BreakerProbeInterval. Periodic pushes are resumed after a successful probe.
+	// The state is exposed via `metrics_push_breaker_open{url="..."}` metric.
+	//
+	// By default periodic pushes are never suspended.
+	BreakerMaxFailures int
+
+	// BreakerProbeInterval is the interval between probe pushes while periodic pushes are suspended because of BreakerMaxFailures.
+	//
+	// By default it equals to 10 push intervals.
+	BreakerProbeInterval time.Duration
+
+	// AuthProvider is an optional callback, which is called before every request to pushURL.
+	//
+	// It must return the name and the value of the header for authorizing the request, e.g. `Authorization` and `Bearer <token>`.
+	// This allows using short-lived tokens such as OIDC tokens or Kubernetes service account tokens, which must be refreshed periodically.
+	// The returned header overrides the header with the same name from Headers. The header isn't set if the returned headerName is empty.
+	// The request isn't sent if AuthProvider returns an error.
+	AuthProvider func(ctx context.Context) (headerName, headerValue string, err error)
+
+	// OnPush is an optional callback, which is called after every request to pushURL with the result of the request.
+	//
+	// It allows integrating push health into application logging and alerting. OnPush may be called from concurrent goroutines
+	// when metrics are pushed to multiple urls, so it must be safe for concurrent use.
+	OnPush func(result PushResult)
+
+	// DeltaPush enables pushing only the samples, which changed since the last successful push.
+	//
+	// This reduces payload sizes for big number of rarely changing series. `# HELP` and `# TYPE` lines are pushed
+	// only together with the changed samples of the corresponding metric families.
+	// All the samples are pushed every DeltaResyncInterval, so unchanged series remain visible at pushURL.
+	//
+	// DeltaPush is applied only to periodic pushes. By default all the samples are pushed.
+	DeltaPush bool
+
+	// DeltaResyncInterval is the interval between pushes of all the samples when DeltaPush is enabled.
+	//
+	// It must be smaller than the staleness interval at pushURL, e.g. the lookbehind window for queries.
+	// By default all the samples are pushed every 5 minutes.
+	DeltaResyncInterval time.Duration
+
+	// TLSConfig is an optional TLS config for https pushURL.
+	//
+	// TLSCAFile, TLSCertFile, TLSKeyFile and TLSInsecureSkipVerify are applied on top of a copy of TLSConfig.
+	TLSConfig *tls.Config
+
+	// TLSCAFile is an optional path to the file with PEM-encoded CA certificates for verifying the pushURL certificate.
+	//
+	// By default the system CA certificates are used.
+	TLSCAFile string
+
+	// TLSCertFile is an optional path to the file with PEM-encoded client certificate for mTLS.
+	//
+	// TLSKeyFile must be set together with TLSCertFile. Files are read only once when the push is set up.
+	TLSCertFile string
+
+	// TLSKeyFile is an optional path to the file with PEM-encoded private key for TLSCertFile.
+	TLSKeyFile string
+
+	// TLSInsecureSkipVerify disables verification of pushURL certificate. It is insecure, so use it only for testing.
+	TLSInsecureSkipVerify bool
+
+	// MaxBytesPerSecond is the maximum rate in bytes per second for sending request bodies to pushURL.
+	//
+	// This prevents from saturating network links shared with application traffic. The limit is applied to compressed
+	// request bodies if the compression is enabled. Periodic pushes fail with timeout if the pushed metrics
+	// cannot be sent during the push interval at the given rate.
+	//
+	// By default the rate isn't limited.
+	MaxBytesPerSecond int
+
+	// SelfMetricsSet is an optional set for registering `metrics_push_*` metrics, which describe pushes to pushURL.
+	//
+	// For example, pass the set exposed at the application's /metrics page in order to monitor pushes there.
+	// By default the metrics are registered in an internal set, which is exposed via WriteProcessMetrics.
+	SelfMetricsSet *Set
+
+	// DryRun enables validation of pushed metrics without sending them to pushURL.
+	//
+	// Metrics are generated, extended with ExtraLabels and split into blocks as usual. Then every block is checked
+	// for valid Prometheus text exposition format and for MaxBlockSize limit, and the result is logged instead of sending it.
+	// Push functions return an error for invalid blocks. This allows verifying push configuration, e.g. in CI, before enabling pushes.
+	DryRun bool
+}
+
+// PushResult is the result of a single request to push url. It is passed to PushOptions.OnPush.
+type PushResult struct {
+	// URL is the push url with redacted password.
+	URL string
+
+	// StatusCode is the response status code. It is zero if the response hasn't been received.
+	StatusCode int
+
+	// Duration is the request duration.
+	Duration time.Duration
+
+	// PayloadSize is the size of the request body in bytes. It is the compressed size if the compression is enabled.
+	PayloadSize int
+
+	// Err is the error for the failed request. It is nil for successful requests.
+	Err error
 }
 
 // InitPushWithOptions sets up periodic push for globally registered metrics to the given pushURL with the given interval.
@@ -170,7 +309,7 @@ func (s *Set) PushMetrics(ctx context.Context, pushURL string, opts *PushOptions
 // extraLabels may contain comma-separated list of `label="value"` labels, which will be added
 // to all the metrics before pushing them to pushURL.
 //
-// The writeMetrics callback must write metrics to w in Prometheus text exposition format without timestamps and trailing comments.
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format without trailing comments.
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md#text-based-format
 //
 // It is recommended pushing metrics to /api/v1/import/prometheus endpoint according to
@@ -190,7 +329,7 @@ func InitPushExt(pushURL string, interval time.Duration, extraLabels string, wri
 
 // InitPushExtWithOptions sets up periodic push for metrics obtained by calling writeMetrics with the given interval.
 //
-// The writeMetrics callback must write metrics to w in Prometheus text exposition format without timestamps and trailing comments.
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format without trailing comments.
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md#text-based-format
 //
 // The periodic push is stopped when the ctx is canceled.
@@ -206,53 +345,37 @@ func InitPushExt(pushURL string, interval time.Duration, extraLabels string, wri
 //
 // It is OK calling InitPushExtWithOptions multiple times with different writeMetrics -
 // in this case all the metrics generated by writeMetrics callbacks are written to pushURL.
+//
+// Use NewPusher if the push must be stopped, paused or triggered explicitly.
 func InitPushExtWithOptions(ctx context.Context, pushURL string, interval time.Duration, writeMetrics func(w io.Writer), opts *PushOptions) error {
-	pc, err := newPushContext(pushURL, opts)
-	if err != nil {
-		return err
-	}
+	_, err := NewPusher(ctx, pushURL, interval, writeMetrics, opts)
+	return err
+}
 
-	// validate interval
-	if interval <= 0 {
-		return fmt.Errorf("interval must be positive; got %s", interval)
+// waitJitter waits for a random duration in the range [0, jitter).
+//
+// It returns false if ctx is canceled during the wait.
+func waitJitter(ctx context.Context, jitter time.Duration) bool {
+	if jitter <= 0 {
+		return true
 	}
-	pushMetricsSet.GetOrCreateFloatCounter(fmt.Sprintf(`metrics_push_interval_seconds{url=%q}`, pc.pushURLRedacted)).Set(interval.Seconds())
-
-	var wg *sync.WaitGroup
-	if opts != nil {
-		wg = opts.WaitGroup
-		if wg != nil {
-			wg.Add(1)
-		}
+	d := time.Duration(rand.Int63n(int64(jitter)))
+	if d <= 0 {
+		return true
+	}
+	timerCh, stopTimer := getClock().NewTicker(d)
+	defer stopTimer()
+	select {
+	case <-timerCh:
+		return true
+	case <-ctx.Done():
+		return false
 	}
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		stopCh := ctx.Done()
-		for {
-			select {
-			case <-ticker.C:
-				ctxLocal, cancel := context.WithTimeout(ctx, interval+time.Second)
-				err := pc.pushMetrics(ctxLocal, writeMetrics)
-				cancel()
-				if err != nil {
-					log.Printf("ERROR: metrics.push: %s", err)
-				}
-			case <-stopCh:
-				if wg != nil {
-					wg.Done()
-				}
-				return
-			}
-		}
-	}()
-
-	return nil
 }
 
 // PushMetricsExt pushes metrics generated by wirteMetrics to pushURL.
 //
-// The writeMetrics callback must write metrics to w in Prometheus text exposition format without timestamps and trailing comments.
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format without trailing comments.
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md#text-based-format
 //
 // opts may contain additional configuration options if non-nil.
@@ -273,15 +396,32 @@ type pushContext struct {
 	pushURLRedacted    string
 	extraLabels        string
 	headers            http.Header
+	authProvider       func(ctx context.Context) (string, string, error)
+	onPush             func(result PushResult)
 	disableCompression bool
+	maxBlockSize       int
+	dryRun             bool
+
+	// spool stores payloads, which couldn't be pushed. It is nil if PushOptions.SpoolDir isn't set.
+	spool *pushSpool
+
+	// delta filters out unchanged samples. It is nil if PushOptions.DeltaPush isn't set.
+	delta *pushDelta
+
+	// rateLimiter limits the rate of sent bytes. It is nil if PushOptions.MaxBytesPerSecond isn't set.
+	rateLimiter *pushRateLimiter
 
 	client *http.Client
 
+	// selfMetricsSet is the set for `metrics_push_*` metrics.
+	selfMetricsSet *Set
+
 	pushesTotal      *Counter
 	bytesPushedTotal *Counter
 	pushBlockSize    *Histogram
 	pushDuration     *Histogram
 	pushErrors       *Counter
+	pushURLHealthy   *Gauge
 }
 
 func newPushContext(pushURL string, opts *PushOptions) (*pushContext, error) {
@@ -303,7 +443,7 @@ func newPushContext(pushURL string, opts *PushOptions) (*pushContext, error) {
 
 	method := opts.Method
 	if method == "" {
-		method = http.MethodGet
+		method = http.MethodPost
 	}
 
 	// validate ExtraLabels
@@ -324,23 +464,68 @@ func newPushContext(pushURL string, opts *PushOptions) (*pushContext, error) {
 		headers.Add(name, value)
 	}
 
+	if opts.MaxBlockSize < 0 {
+		return nil, fmt.Errorf("MaxBlockSize cannot be negative; got %d", opts.MaxBlockSize)
+	}
+
+	selfMetricsSet := opts.SelfMetricsSet
+	if selfMetricsSet == nil {
+		selfMetricsSet = pushMetricsSet
+	}
+
 	pushURLRedacted := pu.Redacted()
+	var spool *pushSpool
+	if opts.SpoolDir != "" {
+		spool, err = newPushSpool(opts.SpoolDir, opts.SpoolMaxSize, opts.SpoolMaxAge, selfMetricsSet, pushURLRedacted)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var delta *pushDelta
+	if opts.DeltaPush {
+		delta, err = newPushDelta(opts.DeltaResyncInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rateLimiter, err := newPushRateLimiter(opts.MaxBytesPerSecond)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newPushTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
 	client := &http.Client{}
+	if tlsConfig != nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = tlsConfig
+		client.Transport = tr
+	}
 	return &pushContext{
 		pushURL:            pu,
 		method:             method,
 		pushURLRedacted:    pushURLRedacted,
 		extraLabels:        extraLabels,
 		headers:            headers,
+		authProvider:       opts.AuthProvider,
+		onPush:             opts.OnPush,
 		disableCompression: opts.DisableCompression,
-
-		client: client,
-
-		pushesTotal:      pushMetricsSet.GetOrCreateCounter(fmt.Sprintf(`metrics_push_total{url=%q}`, pushURLRedacted)),
-		bytesPushedTotal: pushMetricsSet.GetOrCreateCounter(fmt.Sprintf(`metrics_push_bytes_pushed_total{url=%q}`, pushURLRedacted)),
-		pushBlockSize:    pushMetricsSet.GetOrCreateHistogram(fmt.Sprintf(`metrics_push_block_size_bytes{url=%q}`, pushURLRedacted)),
-		pushDuration:     pushMetricsSet.GetOrCreateHistogram(fmt.Sprintf(`metrics_push_duration_seconds{url=%q}`, pushURLRedacted)),
-		pushErrors:       pushMetricsSet.GetOrCreateCounter(fmt.Sprintf(`metrics_push_errors_total{url=%q}`, pushURLRedacted)),
+		maxBlockSize:       opts.MaxBlockSize,
+		dryRun:             opts.DryRun,
+		spool:              spool,
+		delta:              delta,
+		rateLimiter:        rateLimiter,
+
+		client:         client,
+		selfMetricsSet: selfMetricsSet,
+
+		pushesTotal:      selfMetricsSet.GetOrCreateCounter(fmt.Sprintf(`metrics_push_total{url=%q}`, pushURLRedacted)),
+		bytesPushedTotal: selfMetricsSet.GetOrCreateCounter(fmt.Sprintf(`metrics_push_bytes_pushed_total{url=%q}`, pushURLRedacted)),
+		pushBlockSize:    selfMetricsSet.GetOrCreateHistogram(fmt.Sprintf(`metrics_push_block_size_bytes{url=%q}`, pushURLRedacted)),
+		pushDuration:     selfMetricsSet.GetOrCreateHistogram(fmt.Sprintf(`metrics_push_duration_seconds{url=%q}`, pushURLRedacted)),
+		pushErrors:       selfMetricsSet.GetOrCreateCounter(fmt.Sprintf(`metrics_push_errors_total{url=%q}`, pushURLRedacted)),
+		pushURLHealthy:   selfMetricsSet.GetOrCreateGauge(fmt.Sprintf(`metrics_push_url_healthy{url=%q}`, pushURLRedacted), nil),
 	}, nil
 }
 
@@ -356,64 +541,261 @@ func (pc *pushContext) pushMetrics(ctx context.Context, writeMetrics func(w io.W
 		bb.B = addExtraLabels(bb.B[:0], bbTmp.B, pc.extraLabels)
 		putBytesBuffer(bbTmp)
 	}
-	if !pc.disableCompression {
-		bbTmp := getBytesBuffer()
-		bbTmp.B = append(bbTmp.B[:0], bb.B...)
-		bb.B = bb.B[:0]
-		zw := getGzipWriter(bb)
-		if _, err := zw.Write(bbTmp.B); err != nil {
-			panic(fmt.Errorf("BUG: cannot write %d bytes to gzip writer: %s", len(bbTmp.B), err))
+	st := applyPushDelta(pc.delta, bb)
+	if st != nil && len(bb.B) == 0 {
+		// Nothing changed since the last successful push.
+		pc.delta.commit(st)
+		return nil
+	}
+	if err := pc.pushPayload(ctx, bb.B); err != nil || ctx.Err() != nil {
+		return err
+	}
+	if st != nil {
+		pc.delta.commit(st)
+	}
+	return nil
+}
+
+// pushPayload pushes data in Prometheus text exposition format to pc.pushURL.
+//
+// The part of data, which cannot be pushed, is stored in pc.spool.
+func (pc *pushContext) pushPayload(ctx context.Context, data []byte) error {
+	if pc.spool == nil {
+		_, err := pc.pushText(ctx, data)
+		return err
+	}
+
+	// Push the previously spooled payloads at first in order to preserve the order of samples.
+	if err := pc.spool.replay(ctx, pc.pushText); err != nil {
+		pc.spool.add(data)
+		return err
+	}
+	n, err := pc.pushText(ctx, data)
+	if n < len(data) {
+		// Spool only the blocks, which weren't delivered, so the delivered blocks aren't duplicated on replay.
+		pc.spool.add(data[n:])
+	}
+	return err
+}
+
+// pushText pushes data in Prometheus text exposition format to pc.pushURL.
+//
+// data is split into blocks according to pc.maxBlockSize.
+// It returns the number of bytes at the beginning of data, which have been delivered.
+// The number is smaller than len(data) if some block cannot be pushed or if ctx is canceled.
+func (pc *pushContext) pushText(ctx context.Context, data []byte) (int, error) {
+	n := 0
+	for _, block := range splitPushBlocks(data, pc.maxBlockSize) {
+		if err := pc.pushBlock(ctx, block); err != nil || ctx.Err() != nil {
+			// The block may be not delivered because of canceled ctx.
+			return n, err
 		}
-		if err := zw.Close(); err != nil {
-			panic(fmt.Errorf("BUG: cannot flush metrics to gzip writer: %s", err))
+		n += len(block)
+	}
+	return n, nil
+}
+
+// pushBlock pushes data in Prometheus text exposition format to pc.pushURL in a single request.
+func (pc *pushContext) pushBlock(ctx context.Context, data []byte) error {
+	if pc.dryRun {
+		return pc.validateBlock(data)
+	}
+	if pc.disableCompression {
+		return pc.sendRequest(ctx, data, "text/plain", "", nil)
+	}
+	bb := getBytesBuffer()
+	defer putBytesBuffer(bb)
+	bb.B = appendGzipped(bb.B[:0], data)
+	return pc.sendRequest(ctx, bb.B, "text/plain", "gzip", nil)
+}
+
+// validateBlock validates data in Prometheus text exposition format, which would be pushed to pc.pushURL in a single request.
+//
+// It is used instead of sending data when PushOptions.DryRun is set.
+func (pc *pushContext) validateBlock(data []byte) error {
+	if pc.maxBlockSize > 0 && len(data) > pc.maxBlockSize {
+		return fmt.Errorf("dry run: block for %q has %d bytes, which exceeds MaxBlockSize=%d; reduce the size of the biggest metric family",
+			pc.pushURLRedacted, len(data), pc.maxBlockSize)
+	}
+	var err error
+	samples := 0
+	visitLines(data, func(line []byte) {
+		if err != nil || line[0] == '#' {
+			return
 		}
-		putGzipWriter(zw)
-		putBytesBuffer(bbTmp)
+		if _, errLocal := parseSample(string(line)); errLocal != nil {
+			err = fmt.Errorf("dry run: invalid sample in block for %q: %w", pc.pushURLRedacted, errLocal)
+			return
+		}
+		samples++
+	})
+	if err != nil {
+		return err
 	}
+	log.Printf("INFO: metrics.push: dry run: %d samples in %d bytes are valid for pushing to %q", samples, len(data), pc.pushURLRedacted)
+	return nil
+}
 
+// splitPushBlocks splits data in Prometheus text exposition format into blocks with up to maxBlockSize bytes.
+//
+// Blocks are split at metric family boundaries. A single metric family exceeding maxBlockSize is returned as a separate block.
+// data is returned as a single block if maxBlockSize is zero.
+func splitPushBlocks(data []byte, maxBlockSize int) [][]byte {
+	if maxBlockSize <= 0 || len(data) <= maxBlockSize {
+		return [][]byte{data}
+	}
+	var blocks [][]byte
+	blockStart := 0
+	familyStart := 0
+	prevFamily := ""
+	for offset := 0; offset < len(data); {
+		lineEnd := bytes.IndexByte(data[offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(data)
+		} else {
+			lineEnd += offset + 1
+		}
+		family := getPushFamily(string(data[offset:lineEnd]))
+		if family != prevFamily {
+			familyStart = offset
+			prevFamily = family
+		}
+		if lineEnd-blockStart > maxBlockSize && familyStart > blockStart {
+			blocks = append(blocks, data[blockStart:familyStart])
+			blockStart = familyStart
+		}
+		offset = lineEnd
+	}
+	return append(blocks, data[blockStart:])
+}
+
+// getPushFamily returns metric family name for the given line in Prometheus text exposition format.
+//
+// Histogram and summary samples with `_bucket`, `_sum` and `_count` suffixes belong to the same family as the metric without the suffix.
+func getPushFamily(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+		name, _ := splitMetadataName(line[len("# HELP "):])
+		return name
+	}
+	name := getSampleName(line)
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if strings.HasSuffix(name, suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// appendGzipped appends gzip-compressed data to dst and returns the result.
+func appendGzipped(dst, data []byte) []byte {
+	bb := &bytesBuffer{
+		B: dst,
+	}
+	zw := getGzipWriter(bb)
+	if _, err := zw.Write(data); err != nil {
+		panic(fmt.Errorf("BUG: cannot write %d bytes to gzip writer: %s", len(data), err))
+	}
+	if err := zw.Close(); err != nil {
+		panic(fmt.Errorf("BUG: cannot flush metrics to gzip writer: %s", err))
+	}
+	putGzipWriter(zw)
+	return bb.B
+}
+
+// sendRequest sends body with the given contentType and contentEncoding to pc.pushURL.
+//
+// extraHeaders are added to the request before the headers from pc.headers.
+func (pc *pushContext) sendRequest(ctx context.Context, body []byte, contentType, contentEncoding string, extraHeaders map[string]string) error {
+	startTime := now()
+	statusCode, err := pc.doRequest(ctx, body, contentType, contentEncoding, extraHeaders)
+	if pc.onPush != nil {
+		pc.onPush(PushResult{
+			URL:         pc.pushURLRedacted,
+			StatusCode:  statusCode,
+			Duration:    since(startTime),
+			PayloadSize: len(body),
+			Err:         err,
+		})
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// doRequest sends body to pc.pushURL and returns the response status code.
+//
+// Zero status code is returned if the response hasn't been received.
+func (pc *pushContext) doRequest(ctx context.Context, body []byte, contentType, contentEncoding string, extraHeaders map[string]string) (int, error) {
 	// Update metrics
 	pc.pushesTotal.Inc()
-	blockLen := len(bb.B)
+	blockLen := len(body)
 	pc.bytesPushedTotal.Add(blockLen)
 	pc.pushBlockSize.Update(float64(blockLen))
 
 	// Prepare the request to sent to pc.pushURL
-	reqBody := bytes.NewReader(bb.B)
+	var reqBody io.Reader = bytes.NewReader(body)
+	if pc.rateLimiter != nil {
+		reqBody = &rateLimitedReader{
+			ctx: ctx,
+			r:   reqBody,
+			rl:  pc.rateLimiter,
+		}
+	}
 	req, err := http.NewRequestWithContext(ctx, pc.method, pc.pushURL.String(), reqBody)
 	if err != nil {
 		panic(fmt.Errorf("BUG: metrics.push: cannot initialize request for metrics push to %q: %w", pc.pushURLRedacted, err))
 	}
+	req.ContentLength = int64(len(body))
 
-	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range extraHeaders {
+		req.Header.Set(name, value)
+	}
 	// Set the needed headers, and `Content-Type` allowed be overwrited.
 	for name, values := range pc.headers {
 		for _, value := range values {
 			req.Header.Add(name, value)
 		}
 	}
-	if !pc.disableCompression {
-		req.Header.Set("Content-Encoding", "gzip")
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if pc.authProvider != nil {
+		name, value, err := pc.authProvider(ctx)
+		if err != nil {
+			pc.pushErrors.Inc()
+			pc.pushURLHealthy.Set(0)
+			return 0, fmt.Errorf("cannot obtain auth header for pushing metrics to %q: %w", pc.pushURLRedacted, err)
+		}
+		if name != "" {
+			req.Header.Set(name, value)
+		}
 	}
 
 	// Perform the request
-	startTime := time.Now()
+	startTime := now()
 	resp, err := pc.client.Do(req)
 	pc.pushDuration.UpdateDuration(startTime)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
-			return nil
+			return 0, err
 		}
 		pc.pushErrors.Inc()
-		return fmt.Errorf("cannot push metrics to %q: %s", pc.pushURLRedacted, err)
+		pc.pushURLHealthy.Set(0)
+		return 0, fmt.Errorf("cannot push metrics to %q: %s", pc.pushURLRedacted, err)
 	}
 	if resp.StatusCode/100 != 2 {
 		body, _ := ioutil.ReadAll(resp.Body)
 		_ = resp.Body.Close()
 		pc.pushErrors.Inc()
-		return fmt.Errorf("unexpected status code in response from %q: %d; expecting 2xx; response body: %q", pc.pushURLRedacted, resp.StatusCode, body)
+		pc.pushURLHealthy.Set(0)
+		return resp.StatusCode, fmt.Errorf("unexpected status code in response from %q: %d; expecting 2xx; response body: %q", pc.pushURLRedacted, resp.StatusCode, body)
 	}
 	_ = resp.Body.Close()
-	return nil
+	pc.pushURLHealthy.Set(1)
+	return resp.StatusCode, nil
 }
 
 var pushMetricsSet = NewSet()
@@ -444,6 +826,20 @@ func addExtraLabels(dst, src []byte, extraLabels string) []byte {
 			dst = append(dst, '\n')
 			continue
 		}
+		if bytes.HasPrefix(line, quotedNamePrefixBytes) {
+			// Insert extraLabels after the quoted metric name.
+			_, tail, err := readQuotedString(string(line[1:]))
+			if err != nil {
+				panic(fmt.Errorf("BUG: cannot parse quoted metric name in Prometheus text exposition line %q: %s", line, err))
+			}
+			n = len(line) - len(tail)
+			dst = append(dst, line[:n]...)
+			dst = append(dst, ',')
+			dst = append(dst, extraLabels...)
+			dst = append(dst, line[n:]...)
+			dst = append(dst, '\n')
+			continue
+		}
 		n = bytes.IndexByte(line, '{')
 		if n >= 0 {
 			dst = append(dst, line[:n+1]...)
@@ -451,7 +847,7 @@ func addExtraLabels(dst, src []byte, extraLabels string) []byte {
 			dst = append(dst, ',')
 			dst = append(dst, line[n+1:]...)
 		} else {
-			n = bytes.LastIndexByte(line, ' ')
+			n = bytes.IndexByte(line, ' ')
 			if n < 0 {
 				panic(fmt.Errorf("BUG: missing whitespace between metric name and metric value in Prometheus text exposition line %q", line))
 			}
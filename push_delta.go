@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultDeltaResyncInterval is the default interval between full pushes in delta push mode.
+const defaultDeltaResyncInterval = 5 * time.Minute
+
+// pushDelta filters out samples, which didn't change since the last successful push.
+//
+// It is used only by a single push worker, so it doesn't need synchronization.
+type pushDelta struct {
+	resyncInterval time.Duration
+
+	// lastValues maps series to their values from the last successful push. It is nil until the first successful push.
+	lastValues map[string]string
+
+	// lastResyncTime is the time of the last successful full push.
+	lastResyncTime time.Time
+}
+
+func newPushDelta(resyncInterval time.Duration) (*pushDelta, error) {
+	if resyncInterval < 0 {
+		return nil, fmt.Errorf("DeltaResyncInterval cannot be negative; got %s", resyncInterval)
+	}
+	if resyncInterval == 0 {
+		resyncInterval = defaultDeltaResyncInterval
+	}
+	return &pushDelta{
+		resyncInterval: resyncInterval,
+	}, nil
+}
+
+// pushDeltaState is the state of series in a pending push. It is applied to pushDelta via commit after the successful push.
+type pushDeltaState struct {
+	values    map[string]string
+	isResync  bool
+	startTime time.Time
+}
+
+// filter appends samples from src in Prometheus text exposition format to dst if they changed since the last successful push.
+//
+// All the samples are appended if the full resync is due. `# HELP` and `# TYPE` lines are appended
+// only for metric families with appended samples.
+//
+// It returns the result and the state, which must be passed to commit after the successful push of the result.
+func (pd *pushDelta) filter(dst, src []byte) ([]byte, *pushDeltaState) {
+	st := &pushDeltaState{
+		values:    make(map[string]string, len(pd.lastValues)),
+		startTime: now(),
+	}
+	st.isResync = pd.lastValues == nil || st.startTime.Sub(pd.lastResyncTime) >= pd.resyncInterval
+
+	var metadata []byte
+	metadataFamily := ""
+	visitLines(src, func(line []byte) {
+		if line[0] == '#' {
+			family := getPushFamily(string(line))
+			if family != metadataFamily {
+				metadata = metadata[:0]
+				metadataFamily = family
+			}
+			metadata = append(metadata, line...)
+			metadata = append(metadata, '\n')
+			return
+		}
+
+		// The value is the last field in the line, while the series is the rest of the line.
+		// If the sample has a timestamp, then the value becomes a part of the series, so the sample is treated as changed
+		// when either the value or the timestamp changes.
+		s := string(line)
+		n := strings.LastIndexByte(s, ' ')
+		key, value := s[:n+1], s[n+1:]
+		st.values[key] = value
+		if !st.isResync {
+			if lastValue, ok := pd.lastValues[key]; ok && lastValue == value {
+				return
+			}
+		}
+		if len(metadata) > 0 && getPushFamily(s) == metadataFamily {
+			dst = append(dst, metadata...)
+			metadata = metadata[:0]
+		}
+		dst = append(dst, line...)
+		dst = append(dst, '\n')
+	})
+	return dst, st
+}
+
+// commit applies st obtained from filter after the successful push.
+func (pd *pushDelta) commit(st *pushDeltaState) {
+	pd.lastValues = st.values
+	if st.isResync {
+		pd.lastResyncTime = st.startTime
+	}
+}
+
+// applyPushDelta filters bb with pd if pd isn't nil.
+//
+// It returns the state, which must be passed to pd.commit after the successful push, or nil if pd is nil.
+func applyPushDelta(pd *pushDelta, bb *bytesBuffer) *pushDeltaState {
+	if pd == nil {
+		return nil
+	}
+	bbTmp := getBytesBuffer()
+	bbTmp.B = append(bbTmp.B[:0], bb.B...)
+	var st *pushDeltaState
+	bb.B, st = pd.filter(bb.B[:0], bbTmp.B)
+	putBytesBuffer(bbTmp)
+	return st
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPushDelta(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	pd, err := newPushDelta(time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(data string, isSuccess bool, resultExpected string) {
+		t.Helper()
+		result, st := pd.filter(nil, []byte(data))
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+		if isSuccess {
+			pd.commit(st)
+		}
+	}
+
+	data := "# HELP foo Foo\n# TYPE foo counter\nfoo{a=\"x y\"} 1\nfoo{a=\"b\"} 2\nbar 3\nbaz 4 1700000000000\n"
+
+	// The first push contains all the samples
+	f(data, true, data)
+
+	// Unchanged samples are filtered out
+	f(data, true, "")
+
+	// Changed samples are pushed with metadata for their families
+	data = "# HELP foo Foo\n# TYPE foo counter\nfoo{a=\"x y\"} 1\nfoo{a=\"b\"} 5\nbar 3\nbaz 4 1700000001000\nnew 1\n"
+	f(data, true, "# HELP foo Foo\n# TYPE foo counter\nfoo{a=\"b\"} 5\nbaz 4 1700000001000\nnew 1\n")
+
+	// Samples from failed push are pushed again
+	data = "# HELP foo Foo\n# TYPE foo counter\nfoo{a=\"x y\"} 1\nfoo{a=\"b\"} 5\nbar 4\nbaz 4 1700000001000\nnew 1\n"
+	f(data, false, "bar 4\n")
+	f(data, true, "bar 4\n")
+	f(data, true, "")
+
+	// All the samples are pushed after the resync interval
+	fc.Advance(time.Minute)
+	f(data, true, data)
+	f(data, true, "")
+}
+
+func TestPushMetricsDelta(t *testing.T) {
+	reqCh := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		reqCh <- string(data)
+	}))
+	defer srv.Close()
+
+	pc, err := newPushContext(srv.URL, &PushOptions{
+		DisableCompression: true,
+		DeltaPush:          true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s := NewSet()
+	c := s.NewCounter("foo_total")
+	s.NewCounter("bar_total").Inc()
+	f := func(dataExpected string) {
+		t.Helper()
+		if err := pc.pushMetrics(context.Background(), s.WritePrometheus); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if dataExpected == "" {
+			if n := len(reqCh); n > 0 {
+				t.Fatalf("unexpected %d pushes", n)
+			}
+			return
+		}
+		if data := <-reqCh; data != dataExpected {
+			t.Fatalf("unexpected data pushed;\ngot\n%s\nwant\n%s", data, dataExpected)
+		}
+	}
+
+	f("bar_total 1\nfoo_total 0\n")
+
+	// Nothing is pushed if samples didn't change
+	f("")
+
+	c.Inc()
+	f("foo_total 1\n")
+
+	// Negative DeltaResyncInterval
+	if _, err := newPushContext(srv.URL, &PushOptions{DeltaPush: true, DeltaResyncInterval: -time.Second}); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
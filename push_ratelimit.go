@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// pushRateLimiter limits the rate of bytes sent in push requests.
+type pushRateLimiter struct {
+	perSecond int64
+
+	mu sync.Mutex
+
+	// budget is the number of bytes, which may be sent until deadline. It may be negative after sending big chunks.
+	budget   int64
+	deadline time.Time
+}
+
+func newPushRateLimiter(perSecond int) (*pushRateLimiter, error) {
+	if perSecond < 0 {
+		return nil, fmt.Errorf("MaxBytesPerSecond cannot be negative; got %d", perSecond)
+	}
+	if perSecond == 0 {
+		return nil, nil
+	}
+	return &pushRateLimiter{
+		perSecond: int64(perSecond),
+	}, nil
+}
+
+// register registers sending n bytes at rl.
+//
+// It blocks until sending n bytes fits the rl limit or ctx is canceled.
+func (rl *pushRateLimiter) register(ctx context.Context, n int) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for rl.budget <= 0 {
+		if d := rl.deadline.Sub(now()); d > 0 {
+			timerCh, stopTimer := getClock().NewTicker(d)
+			select {
+			case <-timerCh:
+				stopTimer()
+			case <-ctx.Done():
+				stopTimer()
+				return ctx.Err()
+			}
+		}
+		rl.budget += rl.perSecond
+		rl.deadline = now().Add(time.Second)
+	}
+	rl.budget -= int64(n)
+	return nil
+}
+
+// rateLimitedReader reads from r with the rate limited by rl.
+type rateLimitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	rl  *pushRateLimiter
+}
+
+func (lr *rateLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > lr.rl.perSecond {
+		p = p[:lr.rl.perSecond]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if errLocal := lr.rl.register(lr.ctx, n); errLocal != nil {
+			return 0, errLocal
+		}
+	}
+	return n, err
+}
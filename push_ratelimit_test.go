@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPushRateLimiter(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	rl, err := newPushRateLimiter(100)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The first second budget is available immediately
+	if err := rl.register(context.Background(), 100); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The next bytes must wait for the next second
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- rl.register(context.Background(), 150)
+	}()
+	fc.waitForTickers(t, 1)
+	select {
+	case <-doneCh:
+		t.Fatalf("register must wait for the next second")
+	default:
+	}
+	fc.Advance(time.Second)
+	if err := <-doneCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The debt of 50 bytes must be paid off in the next second, so register must be canceled with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		doneCh <- rl.register(ctx, 1)
+	}()
+	fc.waitForTickers(t, 2)
+	cancel()
+	if err := <-doneCh; err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+
+	// Zero limit disables rate limiting, negative limit is invalid
+	if rl, err := newPushRateLimiter(0); err != nil || rl != nil {
+		t.Fatalf("unexpected result for zero limit: %v, %v", rl, err)
+	}
+	if _, err := newPushRateLimiter(-1); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	rl, err := newPushRateLimiter(1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data := bytes.Repeat([]byte("x"), 500)
+	lr := &rateLimitedReader{
+		ctx: context.Background(),
+		r:   bytes.NewReader(data),
+		rl:  rl,
+	}
+	result, err := io.ReadAll(lr)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(result, data) {
+		t.Fatalf("unexpected data read")
+	}
+}
+
+func TestPushMetricsMaxBytesPerSecond(t *testing.T) {
+	var contentLength int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	if err := s.PushMetrics(context.Background(), srv.URL, &PushOptions{DisableCompression: true, MaxBytesPerSecond: 1e6}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if contentLength != int64(len("foo_total 1\n")) {
+		t.Fatalf("unexpected Content-Length; got %d; want %d", contentLength, len("foo_total 1\n"))
+	}
+
+	if err := s.PushMetrics(context.Background(), srv.URL, &PushOptions{MaxBytesPerSecond: -1}); err == nil {
+		t.Fatalf("expecting non-nil error for negative MaxBytesPerSecond")
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -23,6 +26,7 @@ func TestAddExtraLabels(t *testing.T) {
 	f("", `foo="bar"`, "")
 	f("a 123", `foo="bar"`, `a{foo="bar"} 123`+"\n")
 	f(`a{b="c"} 1.3`, `foo="bar"`, `a{foo="bar",b="c"} 1.3`+"\n")
+	f("a 123 1700000000000", `foo="bar"`, `a{foo="bar"} 123 1700000000000`+"\n")
 	f(`a{b="c}{"} 1.3`, `foo="bar",baz="x"`, `a{foo="bar",baz="x",b="c}{"} 1.3`+"\n")
 	f(`foo 1
 bar{a="x"} 2
@@ -241,3 +245,274 @@ func TestPushMetrics(t *testing.T) {
 		Headers: []string{"Foo: Bar", "baz:aaaa-bbb"},
 	}, "Baz: aaaa-bbb\r\nContent-Encoding: gzip\r\nContent-Type: text/plain\r\nFoo: Bar\r\n", "bar 42.12\nfoo 1234\n")
 }
+
+func TestInitPushInvalidJitter(t *testing.T) {
+	f := func(jitter time.Duration) {
+		t.Helper()
+		opts := &PushOptions{
+			Jitter: jitter,
+		}
+		if err := InitPushWithOptions(context.Background(), "http://foobar", time.Second, false, opts); err == nil {
+			t.Fatalf("expecting non-nil error for jitter=%s", jitter)
+		}
+	}
+	f(-time.Millisecond)
+	f(time.Second)
+	f(2 * time.Second)
+}
+
+func TestWaitJitter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if !waitJitter(ctx, 0) {
+		t.Fatalf("waitJitter must return true for zero jitter")
+	}
+	if !waitJitter(ctx, time.Millisecond) {
+		t.Fatalf("waitJitter must return true if ctx isn't canceled")
+	}
+	cancel()
+	if waitJitter(ctx, time.Hour) {
+		t.Fatalf("waitJitter must return false if ctx is canceled")
+	}
+}
+
+func TestSplitPushBlocks(t *testing.T) {
+	f := func(data string, maxBlockSize int, blocksExpected []string) {
+		t.Helper()
+		var blocks []string
+		for _, block := range splitPushBlocks([]byte(data), maxBlockSize) {
+			blocks = append(blocks, string(block))
+		}
+		if !reflect.DeepEqual(blocks, blocksExpected) {
+			t.Fatalf("unexpected blocks;\ngot\n%q\nwant\n%q", blocks, blocksExpected)
+		}
+	}
+
+	data := "# TYPE foo counter\nfoo 1\nfoo{a=\"b\"} 2\nbar_bucket{le=\"1\"} 1\nbar_sum 1\nbar_count 1\nbaz 3\n"
+
+	// no limit
+	f(data, 0, []string{data})
+	f(data, len(data), []string{data})
+
+	// split at family boundaries
+	f(data, 50, []string{
+		"# TYPE foo counter\nfoo 1\nfoo{a=\"b\"} 2\n",
+		"bar_bucket{le=\"1\"} 1\nbar_sum 1\nbar_count 1\nbaz 3\n",
+	})
+
+	// families exceeding the limit are sent in separate blocks
+	f(data, 10, []string{
+		"# TYPE foo counter\nfoo 1\nfoo{a=\"b\"} 2\n",
+		"bar_bucket{le=\"1\"} 1\nbar_sum 1\nbar_count 1\n",
+		"baz 3\n",
+	})
+}
+
+func TestPushMetricsMaxBlockSize(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("cannot create gzip reader: %s", err)
+			return
+		}
+		data, _ := io.ReadAll(zr)
+		bodies = append(bodies, string(data))
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("aaa_total").Inc()
+	s.NewCounter("bbb_total").Inc()
+	s.NewCounter("ccc_total").Inc()
+	opts := &PushOptions{
+		MaxBlockSize: 30,
+	}
+	if err := s.PushMetrics(context.Background(), srv.URL, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	bodiesExpected := []string{
+		"aaa_total 1\nbbb_total 1\n",
+		"ccc_total 1\n",
+	}
+	if !reflect.DeepEqual(bodies, bodiesExpected) {
+		t.Fatalf("unexpected bodies;\ngot\n%q\nwant\n%q", bodies, bodiesExpected)
+	}
+
+	opts.MaxBlockSize = -1
+	if err := s.PushMetrics(context.Background(), srv.URL, opts); err == nil {
+		t.Fatalf("expecting non-nil error for negative MaxBlockSize")
+	}
+}
+
+func TestPushMetricsMethod(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	f := func(opts *PushOptions, methodExpected string) {
+		t.Helper()
+		methods = methods[:0]
+		if err := s.PushMetrics(context.Background(), srv.URL, opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(methods, []string{methodExpected}) {
+			t.Fatalf("unexpected methods; got %q; want %q", methods, methodExpected)
+		}
+	}
+
+	// default method
+	f(nil, http.MethodPost)
+	f(&PushOptions{}, http.MethodPost)
+
+	// custom method
+	f(&PushOptions{Method: http.MethodPut}, http.MethodPut)
+}
+
+func TestPushMetricsAuthProvider(t *testing.T) {
+	var authHeaders []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	tokens := 0
+	opts := &PushOptions{
+		Headers: []string{"Authorization: Bearer static"},
+		AuthProvider: func(ctx context.Context) (string, string, error) {
+			tokens++
+			return "Authorization", fmt.Sprintf("Bearer token-%d", tokens), nil
+		},
+	}
+
+	// The token must be obtained before every push.
+	for i := 0; i < 2; i++ {
+		if err := s.PushMetrics(context.Background(), srv.URL, opts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	authHeadersExpected := []string{"Bearer token-1", "Bearer token-2"}
+	if !reflect.DeepEqual(authHeaders, authHeadersExpected) {
+		t.Fatalf("unexpected Authorization headers; got %q; want %q", authHeaders, authHeadersExpected)
+	}
+
+	// The request mustn't be sent if AuthProvider returns an error.
+	authHeaders = authHeaders[:0]
+	opts.AuthProvider = func(ctx context.Context) (string, string, error) {
+		return "", "", fmt.Errorf("cannot refresh token")
+	}
+	if err := s.PushMetrics(context.Background(), srv.URL, opts); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if len(authHeaders) > 0 {
+		t.Fatalf("unexpected requests: %q", authHeaders)
+	}
+}
+
+func TestPushMetricsOnPush(t *testing.T) {
+	statusCode := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	var results []PushResult
+	opts := &PushOptions{
+		DisableCompression: true,
+		OnPush: func(result PushResult) {
+			results = append(results, result)
+		},
+	}
+	f := func(statusCodeExpected int, isErrExpected bool) {
+		t.Helper()
+		results = results[:0]
+		err := s.PushMetrics(context.Background(), srv.URL, opts)
+		if isErrExpected != (err != nil) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("unexpected number of results; got %d; want 1", len(results))
+		}
+		r := results[0]
+		if r.URL != srv.URL {
+			t.Fatalf("unexpected URL; got %q; want %q", r.URL, srv.URL)
+		}
+		if r.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected StatusCode; got %d; want %d", r.StatusCode, statusCodeExpected)
+		}
+		if r.PayloadSize != len("foo_total 1\n") {
+			t.Fatalf("unexpected PayloadSize; got %d; want %d", r.PayloadSize, len("foo_total 1\n"))
+		}
+		if isErrExpected != (r.Err != nil) {
+			t.Fatalf("unexpected Err: %v", r.Err)
+		}
+	}
+
+	// successful push
+	f(http.StatusOK, false)
+
+	// failed push
+	statusCode = http.StatusBadGateway
+	f(http.StatusBadGateway, true)
+}
+
+func TestPushMetricsSelfMetricsSet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	selfMetrics := NewSet()
+	if err := s.PushMetrics(context.Background(), srv.URL, &PushOptions{SelfMetricsSet: selfMetrics}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var bb bytes.Buffer
+	selfMetrics.WritePrometheus(&bb)
+	result := bb.String()
+	for _, name := range []string{"metrics_push_total", "metrics_push_bytes_pushed_total", "metrics_push_url_healthy"} {
+		if !strings.Contains(result, fmt.Sprintf(`%s{url=%q}`, name, srv.URL)) {
+			t.Fatalf("missing %s metric in SelfMetricsSet; got\n%s", name, result)
+		}
+	}
+}
+
+func TestPushMetricsDryRun(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	f := func(data string, opts *PushOptions, isErrExpected bool) {
+		t.Helper()
+		writeMetrics := func(w io.Writer) {
+			_, _ = io.WriteString(w, data)
+		}
+		opts.DryRun = true
+		err := PushMetricsExt(context.Background(), srv.URL, writeMetrics, opts)
+		if isErrExpected != (err != nil) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if requests > 0 {
+			t.Fatalf("unexpected %d requests in dry run", requests)
+		}
+	}
+
+	// valid metrics
+	f("# TYPE foo counter\nfoo{bar=\"baz\"} 1\nbar 2.5 1700000000000\n", &PushOptions{}, false)
+	f("foo 1\n", &PushOptions{ExtraLabels: `job="test"`}, false)
+
+	// invalid metrics
+	f("foo bar\n", &PushOptions{}, true)
+	f("foo{bar=\"baz} 1\n", &PushOptions{}, true)
+
+	// metric family exceeding MaxBlockSize
+	f("foo{a=\"1\"} 1\nfoo{a=\"2\"} 2\nbar 1\n", &PushOptions{MaxBlockSize: 20}, true)
+}
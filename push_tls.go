@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// newPushTLSConfig returns TLS config for push requests according to TLS options from opts.
+//
+// nil is returned if opts do not contain TLS options, so the default TLS config must be used.
+func newPushTLSConfig(opts *PushOptions) (*tls.Config, error) {
+	if opts.TLSConfig == nil && opts.TLSCAFile == "" && opts.TLSCertFile == "" && opts.TLSKeyFile == "" && !opts.TLSInsecureSkipVerify {
+		return nil, nil
+	}
+	var tlsConfig *tls.Config
+	if opts.TLSConfig != nil {
+		tlsConfig = opts.TLSConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+	if opts.TLSCAFile != "" {
+		data, err := ioutil.ReadFile(opts.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read TLSCAFile: %w", err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("cannot find PEM-encoded certificates in TLSCAFile=%q", opts.TLSCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if opts.TLSCertFile != "" || opts.TLSKeyFile != "" {
+		if opts.TLSCertFile == "" || opts.TLSKeyFile == "" {
+			return nil, fmt.Errorf("TLSCertFile and TLSKeyFile must be set together; got TLSCertFile=%q, TLSKeyFile=%q", opts.TLSCertFile, opts.TLSKeyFile)
+		}
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	if opts.TLSInsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
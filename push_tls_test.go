@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPushMetricsTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEMFile(t, caFile, "CERTIFICATE", srv.Certificate().Raw)
+	certFile, keyFile := writeClientCert(t, dir)
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	f := func(opts *PushOptions, isErrExpected bool) {
+		t.Helper()
+		err := s.PushMetrics(context.Background(), srv.URL, opts)
+		if isErrExpected != (err != nil) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// unknown server certificate
+	f(&PushOptions{TLSCertFile: certFile, TLSKeyFile: keyFile}, true)
+
+	// missing client certificate
+	f(&PushOptions{TLSCAFile: caFile}, true)
+	f(&PushOptions{TLSInsecureSkipVerify: true}, true)
+
+	// mTLS
+	f(&PushOptions{TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile}, false)
+	f(&PushOptions{TLSInsecureSkipVerify: true, TLSCertFile: certFile, TLSKeyFile: keyFile}, false)
+
+	// custom TLSConfig
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(srv.Certificate())
+	f(&PushOptions{TLSConfig: &tls.Config{RootCAs: rootCAs}, TLSCertFile: certFile, TLSKeyFile: keyFile}, false)
+}
+
+func TestNewPushTLSConfigFailure(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCert(t, dir)
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	if err := ioutil.WriteFile(invalidFile, []byte("foobar"), 0644); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+
+	f := func(opts *PushOptions) {
+		t.Helper()
+		if _, err := newPushTLSConfig(opts); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing files
+	f(&PushOptions{TLSCAFile: filepath.Join(dir, "missing.pem")})
+	f(&PushOptions{TLSCertFile: filepath.Join(dir, "missing.pem"), TLSKeyFile: keyFile})
+
+	// invalid CA file
+	f(&PushOptions{TLSCAFile: invalidFile})
+
+	// cert without key and key without cert
+	f(&PushOptions{TLSCertFile: certFile})
+	f(&PushOptions{TLSKeyFile: keyFile})
+}
+
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	writePEMFile(t, certFile, "CERTIFICATE", certDER)
+	writePEMFile(t, keyFile, "PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEMFile(t *testing.T, path, blockType string, data []byte) {
+	t.Helper()
+	pemData := pem.EncodeToMemory(&pem.Block{
+		Type:  blockType,
+		Bytes: data,
+	})
+	if err := ioutil.WriteFile(path, pemData, 0644); err != nil {
+		t.Fatalf("cannot write %q: %s", path, err)
+	}
+}
@@ -0,0 +1,455 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PushMode defines how metrics are pushed to multiple urls. See NewMultiPusher.
+type PushMode int
+
+const (
+	// PushModeReplicate pushes metrics to all the urls.
+	PushModeReplicate PushMode = iota
+
+	// PushModeFailover pushes metrics to the first url, which accepts them, in the order urls are passed to NewMultiPusher.
+	PushModeFailover
+)
+
+// Pusher periodically pushes metrics to the given urls.
+//
+// Pusher is created via NewPusher, NewMultiPusher or Set.NewPusher.
+type Pusher struct {
+	pcs          []*pushContext
+	mode         PushMode
+	jitter       time.Duration
+	writeMetrics func(w io.Writer)
+
+	// intervalLock protects interval, which may be changed via SetInterval.
+	intervalLock sync.Mutex
+	interval     time.Duration
+
+	// intervalCh receives notifications about interval changes from SetInterval.
+	intervalCh chan struct{}
+
+	ctx    context.Context
+	cancel func()
+
+	// triggerCh receives requests for immediate push from TriggerNow.
+	triggerCh chan struct{}
+
+	// paused is set to 1 when periodic pushes are paused via Pause.
+	paused uint32
+
+	// doneCh is closed when the background worker is stopped.
+	doneCh chan struct{}
+
+	// breaker suspends periodic pushes after consecutive failures. It is accessed only by the background worker.
+	breaker pushBreaker
+}
+
+// pushBreaker suspends periodic pushes after maxFailures consecutive failed pushes.
+type pushBreaker struct {
+	maxFailures   int
+	probeInterval time.Duration
+
+	failures        int
+	lastAttemptTime time.Time
+
+	// openGauges contain `metrics_push_breaker_open` gauges for push urls.
+	openGauges []*Gauge
+}
+
+// isOpen returns true if pushes must be suspended.
+func (pb *pushBreaker) isOpen() bool {
+	return pb.maxFailures > 0 && pb.failures >= pb.maxFailures
+}
+
+// shouldSkip returns true if the periodic push must be skipped, since pb is open and it is too early for probe push.
+func (pb *pushBreaker) shouldSkip() bool {
+	return pb.isOpen() && since(pb.lastAttemptTime) < pb.probeInterval
+}
+
+// update updates pb state after the push started at startTime with the given result.
+func (pb *pushBreaker) update(startTime time.Time, failed bool) {
+	pb.lastAttemptTime = startTime
+	if pb.maxFailures <= 0 {
+		return
+	}
+	wasOpen := pb.isOpen()
+	if failed {
+		pb.failures++
+	} else {
+		pb.failures = 0
+	}
+	isOpen := pb.isOpen()
+	if isOpen == wasOpen {
+		return
+	}
+	v := 0.0
+	if isOpen {
+		v = 1
+		log.Printf("WARN: metrics.push: suspending periodic pushes after %d consecutive failures; probing every %s", pb.failures, pb.probeInterval)
+	} else {
+		log.Printf("INFO: metrics.push: resuming periodic pushes after successful probe")
+	}
+	for _, g := range pb.openGauges {
+		g.Set(v)
+	}
+}
+
+// NewPusher starts periodic push for metrics obtained by calling writeMetrics with the given interval to pushURL.
+//
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format without trailing comments.
+// See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md#text-based-format
+//
+// The periodic push is stopped when ctx is canceled or when Pusher.Stop is called.
+// It is possible to wait until the background metrics push worker is stopped on a WaitGroup passed via opts.WaitGroup.
+//
+// opts may contain additional configuration options if non-nil.
+//
+// The returned Pusher allows pausing periodic pushes and pushing metrics immediately, e.g. after important events.
+//
+// See also InitPushExtWithOptions.
+func NewPusher(ctx context.Context, pushURL string, interval time.Duration, writeMetrics func(w io.Writer), opts *PushOptions) (*Pusher, error) {
+	return NewMultiPusher(ctx, []string{pushURL}, PushModeReplicate, interval, writeMetrics, opts)
+}
+
+// NewMultiPusher starts periodic push for metrics obtained by calling writeMetrics with the given interval to pushURLs.
+//
+// Metrics are pushed to all the pushURLs if mode is PushModeReplicate. Metrics are pushed to the first pushURL,
+// which accepts them, if mode is PushModeFailover. Metrics are generated and compressed only once per push
+// regardless of the number of pushURLs. The health of every pushURL is exposed via `metrics_push_url_healthy{url="..."}` metric.
+//
+// opts.SpoolDir cannot be used with multiple pushURLs.
+//
+// See NewPusher for details.
+func NewMultiPusher(ctx context.Context, pushURLs []string, mode PushMode, interval time.Duration, writeMetrics func(w io.Writer), opts *PushOptions) (*Pusher, error) {
+	if len(pushURLs) == 0 {
+		return nil, fmt.Errorf("pushURLs cannot be empty")
+	}
+	if mode != PushModeReplicate && mode != PushModeFailover {
+		return nil, fmt.Errorf("unsupported push mode: %d", mode)
+	}
+	if len(pushURLs) > 1 && opts != nil && opts.SpoolDir != "" {
+		return nil, fmt.Errorf("SpoolDir cannot be used with multiple push urls")
+	}
+	pcs := make([]*pushContext, len(pushURLs))
+	for i, pushURL := range pushURLs {
+		pc, err := newPushContext(pushURL, opts)
+		if err != nil {
+			return nil, err
+		}
+		pcs[i] = pc
+	}
+
+	// validate interval
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive; got %s", interval)
+	}
+	var jitter time.Duration
+	if opts != nil {
+		jitter = opts.Jitter
+	}
+	if jitter < 0 || jitter >= interval {
+		return nil, fmt.Errorf("jitter must be in the range [0, %s); got %s", interval, jitter)
+	}
+	var breakerMaxFailures int
+	var breakerProbeInterval time.Duration
+	if opts != nil {
+		breakerMaxFailures = opts.BreakerMaxFailures
+		breakerProbeInterval = opts.BreakerProbeInterval
+	}
+	if breakerMaxFailures < 0 {
+		return nil, fmt.Errorf("BreakerMaxFailures cannot be negative; got %d", breakerMaxFailures)
+	}
+	if breakerProbeInterval < 0 {
+		return nil, fmt.Errorf("BreakerProbeInterval cannot be negative; got %s", breakerProbeInterval)
+	}
+	if breakerProbeInterval == 0 {
+		breakerProbeInterval = 10 * interval
+	}
+	breakerOpenGauges := make([]*Gauge, len(pcs))
+	for i, pc := range pcs {
+		pc.selfMetricsSet.GetOrCreateFloatCounter(fmt.Sprintf(`metrics_push_interval_seconds{url=%q}`, pc.pushURLRedacted)).Set(interval.Seconds())
+		breakerOpenGauges[i] = pc.selfMetricsSet.GetOrCreateGauge(fmt.Sprintf(`metrics_push_breaker_open{url=%q}`, pc.pushURLRedacted), nil)
+		breakerOpenGauges[i].Set(0)
+	}
+
+	var wg *sync.WaitGroup
+	if opts != nil {
+		wg = opts.WaitGroup
+		if wg != nil {
+			wg.Add(1)
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pusher{
+		pcs:          pcs,
+		mode:         mode,
+		interval:     interval,
+		jitter:       jitter,
+		writeMetrics: writeMetrics,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		triggerCh:  make(chan struct{}, 1),
+		intervalCh: make(chan struct{}, 1),
+		doneCh:     make(chan struct{}),
+
+		breaker: pushBreaker{
+			maxFailures:   breakerMaxFailures,
+			probeInterval: breakerProbeInterval,
+			openGauges:    breakerOpenGauges,
+		},
+	}
+	go func() {
+		p.run()
+		if wg != nil {
+			wg.Done()
+		}
+	}()
+	return p, nil
+}
+
+// NewPusher starts periodic push for metrics from s to the given pushURL with the given interval.
+//
+// See NewPusher for details.
+func (s *Set) NewPusher(ctx context.Context, pushURL string, interval time.Duration, opts *PushOptions) (*Pusher, error) {
+	return NewPusher(ctx, pushURL, interval, s.WritePrometheus, opts)
+}
+
+// NewMultiPusher starts periodic push for metrics from s to the given pushURLs with the given interval.
+//
+// See NewMultiPusher for details.
+func (s *Set) NewMultiPusher(ctx context.Context, pushURLs []string, mode PushMode, interval time.Duration, opts *PushOptions) (*Pusher, error) {
+	return NewMultiPusher(ctx, pushURLs, mode, interval, s.WritePrometheus, opts)
+}
+
+func (p *Pusher) run() {
+	defer close(p.doneCh)
+
+	tickerCh, stopTicker := getClock().NewTicker(p.getInterval())
+	defer func() {
+		stopTicker()
+	}()
+	stopCh := p.ctx.Done()
+	for {
+		select {
+		case <-p.intervalCh:
+			stopTicker()
+			tickerCh, stopTicker = getClock().NewTicker(p.getInterval())
+		case <-tickerCh:
+			if atomic.LoadUint32(&p.paused) != 0 || p.breaker.shouldSkip() {
+				continue
+			}
+			if !waitJitter(p.ctx, p.jitter) {
+				return
+			}
+			p.push()
+		case <-p.triggerCh:
+			// Pushes requested via TriggerNow are performed even if the breaker is open.
+			p.push()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (p *Pusher) push() {
+	startTime := now()
+	ctx, cancel := context.WithTimeout(p.ctx, p.getInterval()+time.Second)
+	var err error
+	if len(p.pcs) == 1 {
+		err = p.pcs[0].pushMetrics(ctx, p.writeMetrics)
+	} else {
+		err = p.pushMulti(ctx)
+	}
+	cancel()
+	if err != nil {
+		log.Printf("ERROR: metrics.push: %s", err)
+	}
+	if p.ctx.Err() != nil {
+		// The push has been interrupted by Stop or by ctx cancelation, so it doesn't reflect the state of push urls.
+		return
+	}
+	var ppe *partialPushError
+	p.breaker.update(startTime, err != nil && !errors.As(err, &ppe))
+}
+
+// partialPushError is returned by Pusher.pushMulti in PushModeReplicate if some of push urls accepted metrics.
+type partialPushError struct {
+	err error
+}
+
+func (ppe *partialPushError) Error() string {
+	return ppe.err.Error()
+}
+
+// pushMulti pushes metrics to multiple urls according to p.mode.
+func (p *Pusher) pushMulti(ctx context.Context) error {
+	bb := getBytesBuffer()
+	defer putBytesBuffer(bb)
+	p.writeMetrics(bb)
+
+	// All the push contexts are created with the same options, so they share extra labels and compression settings.
+	pc0 := p.pcs[0]
+	if len(pc0.extraLabels) > 0 {
+		bbTmp := getBytesBuffer()
+		bbTmp.B = append(bbTmp.B[:0], bb.B...)
+		bb.B = addExtraLabels(bb.B[:0], bbTmp.B, pc0.extraLabels)
+		putBytesBuffer(bbTmp)
+	}
+	st := applyPushDelta(pc0.delta, bb)
+	if st != nil && len(bb.B) == 0 {
+		// Nothing changed since the last successful push.
+		pc0.delta.commit(st)
+		return nil
+	}
+	var partialErr error
+	for _, block := range splitPushBlocks(bb.B, pc0.maxBlockSize) {
+		err := p.pushMultiBlock(ctx, block)
+		if err == nil {
+			continue
+		}
+		var ppe *partialPushError
+		if !errors.As(err, &ppe) {
+			return err
+		}
+		// Continue pushing the remaining blocks to urls, which accept them.
+		partialErr = err
+	}
+	if partialErr == nil && ctx.Err() == nil && st != nil {
+		pc0.delta.commit(st)
+	}
+	return partialErr
+}
+
+// pushMultiBlock pushes data in Prometheus text exposition format in a single request per url according to p.mode.
+func (p *Pusher) pushMultiBlock(ctx context.Context, data []byte) error {
+	if p.pcs[0].dryRun {
+		for _, pc := range p.pcs {
+			if err := pc.validateBlock(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	body := data
+	contentEncoding := ""
+	if !p.pcs[0].disableCompression {
+		bb := getBytesBuffer()
+		defer putBytesBuffer(bb)
+		bb.B = appendGzipped(bb.B[:0], data)
+		body = bb.B
+		contentEncoding = "gzip"
+	}
+
+	if p.mode == PushModeFailover {
+		var errs []string
+		for _, pc := range p.pcs {
+			err := pc.sendRequest(ctx, body, "text/plain", contentEncoding, nil)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("cannot push metrics to any of %d urls: %s", len(p.pcs), strings.Join(errs, "; "))
+	}
+
+	errs := make([]error, len(p.pcs))
+	var wg sync.WaitGroup
+	for i, pc := range p.pcs {
+		wg.Add(1)
+		go func(i int, pc *pushContext) {
+			defer wg.Done()
+			errs[i] = pc.sendRequest(ctx, body, "text/plain", contentEncoding, nil)
+		}(i, pc)
+	}
+	wg.Wait()
+	var errStrs []string
+	for _, err := range errs {
+		if err != nil {
+			errStrs = append(errStrs, err.Error())
+		}
+	}
+	if len(errStrs) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("cannot push metrics to %d out of %d urls: %s", len(errStrs), len(p.pcs), strings.Join(errStrs, "; "))
+	if len(errStrs) < len(p.pcs) {
+		return &partialPushError{
+			err: err,
+		}
+	}
+	return err
+}
+
+// Stop stops periodic push and waits until the background worker is stopped.
+//
+// It is safe calling Stop multiple times.
+func (p *Pusher) Stop() {
+	p.cancel()
+	<-p.doneCh
+}
+
+// Pause pauses periodic pushes until Resume is called.
+//
+// Pushes requested via TriggerNow are performed while p is paused.
+func (p *Pusher) Pause() {
+	atomic.StoreUint32(&p.paused, 1)
+}
+
+// Resume resumes periodic pushes paused via Pause.
+func (p *Pusher) Resume() {
+	atomic.StoreUint32(&p.paused, 0)
+}
+
+// SetInterval changes the interval between periodic pushes to interval.
+//
+// The next periodic push is performed after the given interval since the SetInterval call.
+// The interval must be positive and bigger than PushOptions.Jitter.
+func (p *Pusher) SetInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive; got %s", interval)
+	}
+	if interval <= p.jitter {
+		return fmt.Errorf("interval must be bigger than jitter=%s; got %s", p.jitter, interval)
+	}
+	p.intervalLock.Lock()
+	p.interval = interval
+	p.intervalLock.Unlock()
+	for _, pc := range p.pcs {
+		pc.selfMetricsSet.GetOrCreateFloatCounter(fmt.Sprintf(`metrics_push_interval_seconds{url=%q}`, pc.pushURLRedacted)).Set(interval.Seconds())
+	}
+	select {
+	case p.intervalCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *Pusher) getInterval() time.Duration {
+	p.intervalLock.Lock()
+	defer p.intervalLock.Unlock()
+	return p.interval
+}
+
+// TriggerNow requests pushing metrics immediately without waiting for the next push interval.
+//
+// The push is performed in background, so TriggerNow doesn't wait until it is finished.
+// Multiple TriggerNow calls made before the push starts result in a single push.
+func (p *Pusher) TriggerNow() {
+	select {
+	case p.triggerCh <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,337 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPusher(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	reqCh := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		reqCh <- string(data)
+	}))
+	defer srv.Close()
+
+	expectPush := func() {
+		t.Helper()
+		select {
+		case data := <-reqCh:
+			if data != "foo_total 1\n" {
+				t.Fatalf("unexpected data pushed: %q", data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout when waiting for push")
+		}
+	}
+	expectNoPush := func() {
+		t.Helper()
+		if n := len(reqCh); n > 0 {
+			t.Fatalf("unexpected %d pushes", n)
+		}
+	}
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	p, err := s.NewPusher(context.Background(), srv.URL, 10*time.Second, &PushOptions{
+		DisableCompression: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fc.waitForTickers(t, 1)
+
+	// periodic push
+	fc.Advance(10 * time.Second)
+	expectPush()
+
+	// Periodic pushes must be skipped while p is paused, but TriggerNow must push.
+	p.Pause()
+	fc.Advance(10 * time.Second)
+	p.TriggerNow()
+	expectPush()
+	expectNoPush()
+
+	// Periodic pushes must be continued after Resume.
+	p.Resume()
+	fc.Advance(10 * time.Second)
+	expectPush()
+
+	p.Stop()
+	p.Stop()
+	expectNoPush()
+}
+
+func TestPusherStopOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := NewPusher(ctx, "http://localhost:1/", time.Hour, func(w io.Writer) {}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cancel()
+	select {
+	case <-p.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for pusher to stop")
+	}
+}
+
+func TestPusherBreaker(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	var isBroken uint32 = 1
+	reqCh := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCh <- struct{}{}
+		if atomic.LoadUint32(&isBroken) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// Advance delivers ticks synchronously, so the previous push is finished when Advance returns.
+	advance := func(pushesExpected int) {
+		t.Helper()
+		fc.Advance(10 * time.Second)
+		for i := 0; i < pushesExpected; i++ {
+			select {
+			case <-reqCh:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout when waiting for push")
+			}
+		}
+		if n := len(reqCh); n > 0 {
+			t.Fatalf("unexpected %d pushes", n)
+		}
+	}
+	breakerOpen := pushMetricsSet.GetOrCreateGauge(fmt.Sprintf(`metrics_push_breaker_open{url=%q}`, srv.URL), nil)
+	expectBreakerOpen := func(vExpected float64) {
+		t.Helper()
+		if v := breakerOpen.Get(); v != vExpected {
+			t.Fatalf("unexpected metrics_push_breaker_open; got %v; want %v", v, vExpected)
+		}
+	}
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	p, err := s.NewPusher(context.Background(), srv.URL, 10*time.Second, &PushOptions{
+		BreakerMaxFailures:   2,
+		BreakerProbeInterval: 30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer p.Stop()
+	fc.waitForTickers(t, 1)
+
+	// The breaker is opened after 2 failed pushes
+	advance(1)
+	advance(1)
+	advance(0)
+	expectBreakerOpen(1)
+
+	// The probe push is performed every BreakerProbeInterval
+	advance(0)
+	advance(1)
+	advance(0)
+	advance(0)
+
+	// The breaker is closed after successful probe
+	atomic.StoreUint32(&isBroken, 0)
+	advance(1)
+	advance(1)
+	expectBreakerOpen(0)
+}
+
+func TestPusherSetInterval(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	reqCh := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCh <- struct{}{}
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	selfMetrics := NewSet()
+	p, err := s.NewPusher(context.Background(), srv.URL, 10*time.Second, &PushOptions{
+		Jitter:         time.Second,
+		SelfMetricsSet: selfMetrics,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer p.Stop()
+	fc.waitForTickers(t, 1)
+
+	// invalid intervals
+	if err := p.SetInterval(0); err == nil {
+		t.Fatalf("expecting non-nil error for zero interval")
+	}
+	if err := p.SetInterval(time.Second); err == nil {
+		t.Fatalf("expecting non-nil error for interval not exceeding jitter")
+	}
+
+	if err := p.SetInterval(30 * time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fc.waitForTickers(t, 2)
+	intervalMetric := selfMetrics.GetOrCreateFloatCounter(fmt.Sprintf(`metrics_push_interval_seconds{url=%q}`, srv.URL))
+	if v := intervalMetric.Get(); v != 30 {
+		t.Fatalf("unexpected metrics_push_interval_seconds; got %v; want 30", v)
+	}
+
+	// The push must be performed only after the new interval
+	fc.Advance(20 * time.Second)
+	if n := len(reqCh); n > 0 {
+		t.Fatalf("unexpected %d pushes", n)
+	}
+	fc.Advance(10 * time.Second)
+
+	// Wait for jitter
+	fc.waitForTickers(t, 3)
+	fc.Advance(time.Second)
+	select {
+	case <-reqCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for push")
+	}
+}
+
+func TestNewPusherFailure(t *testing.T) {
+	f := func(pushURL string, interval time.Duration) {
+		t.Helper()
+		if _, err := NewPusher(context.Background(), pushURL, interval, func(w io.Writer) {}, nil); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f("foobar", time.Second)
+	f("http://foobar", 0)
+
+	// negative breaker options
+	if _, err := NewPusher(context.Background(), "http://foobar", time.Second, func(w io.Writer) {}, &PushOptions{BreakerMaxFailures: -1}); err == nil {
+		t.Fatalf("expecting non-nil error for negative BreakerMaxFailures")
+	}
+	if _, err := NewPusher(context.Background(), "http://foobar", time.Second, func(w io.Writer) {}, &PushOptions{BreakerProbeInterval: -time.Second}); err == nil {
+		t.Fatalf("expecting non-nil error for negative BreakerProbeInterval")
+	}
+}
+
+func TestMultiPusher(t *testing.T) {
+	newServer := func(isHealthy bool) (*httptest.Server, chan string) {
+		reqCh := make(chan string, 10)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isHealthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			reqCh <- string(data)
+		}))
+		return srv, reqCh
+	}
+	srvHealthy1, reqCh1 := newServer(true)
+	defer srvHealthy1.Close()
+	srvHealthy2, reqCh2 := newServer(true)
+	defer srvHealthy2.Close()
+	srvBroken, _ := newServer(false)
+	defer srvBroken.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	opts := &PushOptions{
+		DisableCompression: true,
+		ExtraLabels:        `job="x"`,
+	}
+
+	f := func(pushURLs []string, mode PushMode, pushesExpected1, pushesExpected2 int) {
+		t.Helper()
+		p, err := s.NewMultiPusher(context.Background(), pushURLs, mode, time.Hour, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		p.TriggerNow()
+		waitPushes := func(reqCh chan string, pushesExpected int) {
+			t.Helper()
+			for i := 0; i < pushesExpected; i++ {
+				select {
+				case data := <-reqCh:
+					if data != "foo_total{job=\"x\"} 1\n" {
+						t.Fatalf("unexpected data pushed: %q", data)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timeout when waiting for push")
+				}
+			}
+		}
+		waitPushes(reqCh1, pushesExpected1)
+		waitPushes(reqCh2, pushesExpected2)
+		p.Stop()
+		if n := len(reqCh1); n > 0 {
+			t.Fatalf("unexpected %d pushes to the first server", n)
+		}
+		if n := len(reqCh2); n > 0 {
+			t.Fatalf("unexpected %d pushes to the second server", n)
+		}
+	}
+
+	// replicate mode
+	f([]string{srvHealthy1.URL, srvHealthy2.URL}, PushModeReplicate, 1, 1)
+	f([]string{srvHealthy1.URL, srvBroken.URL, srvHealthy2.URL}, PushModeReplicate, 1, 1)
+
+	// failover mode
+	f([]string{srvHealthy1.URL, srvHealthy2.URL}, PushModeFailover, 1, 0)
+	f([]string{srvBroken.URL, srvHealthy2.URL}, PushModeFailover, 0, 1)
+
+	// url health metrics
+	p, err := s.NewMultiPusher(context.Background(), []string{srvBroken.URL, srvHealthy2.URL}, PushModeFailover, time.Hour, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer p.Stop()
+	p.TriggerNow()
+	<-reqCh2
+	waitForHealth := func(pushURL string, vExpected float64) {
+		t.Helper()
+		g := pushMetricsSet.GetOrCreateGauge(`metrics_push_url_healthy{url="`+pushURL+`"}`, nil)
+		deadline := time.Now().Add(5 * time.Second)
+		for g.Get() != vExpected {
+			if time.Now().After(deadline) {
+				t.Fatalf("unexpected health for %s; got %v; want %v", pushURL, g.Get(), vExpected)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitForHealth(srvBroken.URL, 0)
+	waitForHealth(srvHealthy2.URL, 1)
+}
+
+func TestNewMultiPusherFailure(t *testing.T) {
+	f := func(pushURLs []string, mode PushMode, opts *PushOptions) {
+		t.Helper()
+		if _, err := NewMultiPusher(context.Background(), pushURLs, mode, time.Second, func(w io.Writer) {}, opts); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f(nil, PushModeReplicate, nil)
+	f([]string{"http://foo", "bar"}, PushModeFailover, nil)
+	f([]string{"http://foo"}, PushMode(10), nil)
+	f([]string{"http://foo", "http://bar"}, PushModeReplicate, &PushOptions{
+		SpoolDir: t.TempDir(),
+	})
+}
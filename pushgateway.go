@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PushgatewayURL returns url for pushing metrics with the given job and groupingKey labels to Prometheus Pushgateway at baseURL.
+//
+// For example, PushgatewayURL("http://pushgateway:9091", "backup", map[string]string{"instance": "db1"}) returns
+// `http://pushgateway:9091/metrics/job/backup/instance/db1`. Label values containing `/` are base64-encoded
+// according to https://github.com/prometheus/pushgateway#url
+//
+// The returned url may be passed to NewPusher for periodic pushes to Pushgateway. Set PushOptions.Method to `PUT`
+// in this case in order to replace all the metrics for the group on every push.
+func PushgatewayURL(baseURL, job string, groupingKey map[string]string) (string, error) {
+	if job == "" {
+		return "", fmt.Errorf("job cannot be empty")
+	}
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(baseURL, "/"))
+	sb.WriteString("/metrics")
+	writePushgatewayLabel(&sb, "job", job)
+
+	names := make([]string, 0, len(groupingKey))
+	for name := range groupingKey {
+		if err := validateIdent(name); err != nil {
+			return "", fmt.Errorf("invalid grouping key label name %q: %w", name, err)
+		}
+		if name == "job" {
+			return "", fmt.Errorf("grouping key cannot contain `job` label; pass it via job arg instead")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writePushgatewayLabel(&sb, name, groupingKey[name])
+	}
+	return sb.String(), nil
+}
+
+func writePushgatewayLabel(sb *strings.Builder, name, value string) {
+	sb.WriteByte('/')
+	sb.WriteString(name)
+	if value == "" || strings.Contains(value, "/") {
+		sb.WriteString("@base64/")
+		if value == "" {
+			sb.WriteString("=")
+		} else {
+			sb.WriteString(base64.URLEncoding.EncodeToString([]byte(value)))
+		}
+		return
+	}
+	sb.WriteByte('/')
+	sb.WriteString(url.PathEscape(value))
+}
+
+// PushToGateway pushes metrics from s with the given job and groupingKey labels to Prometheus Pushgateway at baseURL.
+//
+// By default `PUT` request is used, which replaces all the previously pushed metrics for the group.
+// Set opts.Method to `POST` in order to replace only the metrics with the same names as the pushed metrics.
+//
+// opts may contain additional configuration options if non-nil. Note that Pushgateway may not accept
+// gzip-compressed requests, so opts.DisableCompression may be needed for older Pushgateway versions.
+func (s *Set) PushToGateway(ctx context.Context, baseURL, job string, groupingKey map[string]string, opts *PushOptions) error {
+	pushURL, err := PushgatewayURL(baseURL, job, groupingKey)
+	if err != nil {
+		return err
+	}
+	return PushMetricsExt(ctx, pushURL, s.WritePrometheus, withDefaultMethod(opts, http.MethodPut))
+}
+
+// DeleteFromGateway deletes all the metrics for the given job and groupingKey labels from Prometheus Pushgateway at baseURL.
+//
+// opts may contain additional configuration options if non-nil. opts.Method is ignored.
+func DeleteFromGateway(ctx context.Context, baseURL, job string, groupingKey map[string]string, opts *PushOptions) error {
+	pushURL, err := PushgatewayURL(baseURL, job, groupingKey)
+	if err != nil {
+		return err
+	}
+	optsCopy := withDefaultMethod(opts, http.MethodDelete)
+	optsCopy.Method = http.MethodDelete
+	pc, err := newPushContext(pushURL, optsCopy)
+	if err != nil {
+		return err
+	}
+	return pc.sendRequest(ctx, nil, "text/plain", "", nil)
+}
+
+// withDefaultMethod returns a copy of opts with the Method set to method if it is empty.
+func withDefaultMethod(opts *PushOptions, method string) *PushOptions {
+	var optsCopy PushOptions
+	if opts != nil {
+		optsCopy = *opts
+	}
+	if optsCopy.Method == "" {
+		optsCopy.Method = method
+	}
+	return &optsCopy
+}
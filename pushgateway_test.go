@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPushgatewayURL(t *testing.T) {
+	f := func(baseURL, job string, groupingKey map[string]string, resultExpected string) {
+		t.Helper()
+		result, err := PushgatewayURL(baseURL, job, groupingKey)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected url; got %s; want %s", result, resultExpected)
+		}
+	}
+	f("http://pgw:9091", "backup", nil, "http://pgw:9091/metrics/job/backup")
+	f("http://pgw:9091/", "backup", map[string]string{
+		"instance": "db1",
+		"dc":       "eu west",
+	}, "http://pgw:9091/metrics/job/backup/dc/eu%20west/instance/db1")
+	f("http://pgw:9091", "a/b", map[string]string{
+		"empty": "",
+	}, "http://pgw:9091/metrics/job@base64/YS9i/empty@base64/=")
+
+	fFailure := func(job string, groupingKey map[string]string) {
+		t.Helper()
+		if _, err := PushgatewayURL("http://pgw:9091", job, groupingKey); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	fFailure("", nil)
+	fFailure("backup", map[string]string{"job": "x"})
+	fFailure("backup", map[string]string{"bad-name": "x"})
+}
+
+func TestPushToGateway(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		body   string
+	}
+	var reqs []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		reqs = append(reqs, request{
+			method: r.Method,
+			path:   r.URL.EscapedPath(),
+			body:   string(data),
+		})
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	s.NewCounter("foo_total").Inc()
+	ctx := context.Background()
+	groupingKey := map[string]string{
+		"instance": "db1",
+	}
+	if err := s.PushToGateway(ctx, srv.URL, "backup", groupingKey, &PushOptions{DisableCompression: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.PushToGateway(ctx, srv.URL, "backup", groupingKey, &PushOptions{DisableCompression: true, Method: http.MethodPost}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := DeleteFromGateway(ctx, srv.URL, "backup", groupingKey, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reqsExpected := []request{
+		{http.MethodPut, "/metrics/job/backup/instance/db1", "foo_total 1\n"},
+		{http.MethodPost, "/metrics/job/backup/instance/db1", "foo_total 1\n"},
+		{http.MethodDelete, "/metrics/job/backup/instance/db1", ""},
+	}
+	if len(reqs) != len(reqsExpected) {
+		t.Fatalf("unexpected number of requests; got %d; want %d", len(reqs), len(reqsExpected))
+	}
+	for i, req := range reqs {
+		if req != reqsExpected[i] {
+			t.Fatalf("unexpected request #%d; got %+v; want %+v", i, req, reqsExpected[i])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateBucketsCount is the number of buckets the Rate window is split into.
+const rateBucketsCount = 10
+
+// NewRate registers and returns new Rate with the given name, which exposes events per second over the given window.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Rate is safe to use from concurrent goroutines.
+func NewRate(name string, window time.Duration) *Rate {
+	return defaultSet().NewRate(name, window)
+}
+
+// Rate tracks events and exposes the average number of events per second over a sliding window.
+//
+// The window is split into 10 buckets, so the oldest bucket is dropped from the window
+// every window/10 interval.
+//
+// Rate is useful for short-lived processes, which cannot rely on rate() calculation
+// over counters at query time.
+type Rate struct {
+	mu sync.Mutex
+
+	window         time.Duration
+	bucketDuration time.Duration
+
+	// counts contains the number of events per each bucket in the window.
+	counts [rateBucketsCount]uint64
+
+	// currBucket is the absolute number of the current bucket since unix epoch.
+	currBucket int64
+
+	// startTime is the Rate creation time.
+	startTime time.Time
+}
+
+func newRate(window time.Duration) *Rate {
+	if window < rateBucketsCount {
+		panic(fmt.Errorf("BUG: window must be at least %dns; got %s", rateBucketsCount, window))
+	}
+	startTime := now()
+	r := &Rate{
+		window:         window,
+		bucketDuration: window / rateBucketsCount,
+		startTime:      startTime,
+	}
+	r.currBucket = r.bucketAt(startTime)
+	return r
+}
+
+// Inc increments the number of events in r.
+func (r *Rate) Inc() {
+	r.Add(1)
+}
+
+// Add adds n events to r.
+func (r *Rate) Add(n int) {
+	r.addAt(now(), n)
+}
+
+// Get returns the average number of events per second over the window.
+func (r *Rate) Get() float64 {
+	return r.getAt(now())
+}
+
+func (r *Rate) addAt(now time.Time, n int) {
+	r.mu.Lock()
+	r.rotateLocked(now)
+	r.counts[r.currBucket%rateBucketsCount] += uint64(n)
+	r.mu.Unlock()
+}
+
+func (r *Rate) getAt(now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rotateLocked(now)
+	total := uint64(0)
+	for _, n := range r.counts[:] {
+		total += n
+	}
+
+	// The buckets cover the time range from the start of the oldest bucket till now.
+	currBucketStart := time.Unix(0, r.currBucket*int64(r.bucketDuration))
+	d := (rateBucketsCount-1)*r.bucketDuration + now.Sub(currBucketStart)
+	if dStart := now.Sub(r.startTime); dStart < d {
+		// The Rate has been created recently.
+		d = dStart
+	}
+	if d <= 0 {
+		return 0
+	}
+	return float64(total) / d.Seconds()
+}
+
+func (r *Rate) bucketAt(t time.Time) int64 {
+	return t.UnixNano() / int64(r.bucketDuration)
+}
+
+// rotateLocked resets buckets, which went out of the window at now.
+func (r *Rate) rotateLocked(now time.Time) {
+	b := r.bucketAt(now)
+	if b <= r.currBucket {
+		return
+	}
+	if b-r.currBucket >= rateBucketsCount {
+		r.counts = [rateBucketsCount]uint64{}
+	} else {
+		for i := r.currBucket + 1; i <= b; i++ {
+			r.counts[i%rateBucketsCount] = 0
+		}
+	}
+	r.currBucket = b
+}
+
+func (r *Rate) marshalTo(prefix string, w io.Writer) {
+	v := r.Get()
+	fmt.Fprintf(w, "%s %g\n", prefix, v)
+}
+
+func (r *Rate) metricType() string {
+	return "gauge"
+}
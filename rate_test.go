@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	r := newRate(10 * time.Second)
+	startTime := time.Unix(1000, 0)
+	r.startTime = startTime
+	r.currBucket = r.bucketAt(startTime)
+
+	f := func(d time.Duration, rateExpected float64) {
+		t.Helper()
+		if v := r.getAt(startTime.Add(d)); v != rateExpected {
+			t.Fatalf("unexpected rate at %s; got %g; want %g", d, v, rateExpected)
+		}
+	}
+
+	f(0, 0)
+
+	// The rate must be calculated over the time since the Rate creation.
+	r.addAt(startTime.Add(time.Second), 10)
+	f(2*time.Second, 5)
+
+	// The rate must be calculated over the whole window after it passes.
+	r.addAt(startTime.Add(9*time.Second), 10)
+	f(10*time.Second, 20.0/9)
+
+	// Old events must go out of the window.
+	f(11*time.Second, 10.0/9)
+	f(20*time.Second, 0)
+
+	r.addAt(startTime.Add(100*time.Second), 5)
+	f(100*time.Second+500*time.Millisecond, 5/9.5)
+}
+
+func TestRateMarshalTo(t *testing.T) {
+	s := NewSet()
+	r := s.NewRate("events_per_second", time.Hour)
+	testMarshalTo(t, r, "events_per_second", "events_per_second 0\n")
+
+	expectPanic(t, "NewRate_zero_window", func() {
+		s.NewRate("foo", 0)
+	})
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RemoteWriteOptions is the list of options, which may be applied to InitPushRemoteWrite.
+type RemoteWriteOptions struct {
+	// ExtraLabels is an optional comma-separated list of `label="value"` labels, which must be added to all the metrics before pushing them.
+	ExtraLabels string
+
+	// Headers is an optional list of HTTP headers to add to every remote_write request.
+	//
+	// Every item in the list must have the form `Header: value`. For example, `Authorization: Bearer my-top-secret`.
+	Headers []string
+
+	// PushProcessMetrics enables pushing `process_*` and `go_*` metrics for the current process.
+	//
+	// It is applied only to InitPushRemoteWrite.
+	PushProcessMetrics bool
+
+	// Optional WaitGroup for waiting until the push worker is stopped.
+	WaitGroup *sync.WaitGroup
+}
+
+// InitPushRemoteWrite sets up periodic push for globally registered metrics to the given remoteWriteURL
+// with the given interval via Prometheus remote_write protocol.
+//
+// opts may contain additional configuration options if non-nil.
+//
+// See InitPushRemoteWriteExt for details.
+func InitPushRemoteWrite(remoteWriteURL string, interval time.Duration, opts *RemoteWriteOptions) error {
+	pushProcessMetrics := opts != nil && opts.PushProcessMetrics
+	writeMetrics := func(w io.Writer) {
+		WritePrometheus(w, pushProcessMetrics)
+	}
+	return InitPushRemoteWriteExt(context.Background(), remoteWriteURL, interval, writeMetrics, opts)
+}
+
+// InitPushRemoteWrite sets up periodic push for metrics from s to the given remoteWriteURL
+// with the given interval via Prometheus remote_write protocol.
+//
+// opts may contain additional configuration options if non-nil.
+//
+// See InitPushRemoteWriteExt for details.
+func (s *Set) InitPushRemoteWrite(remoteWriteURL string, interval time.Duration, opts *RemoteWriteOptions) error {
+	return InitPushRemoteWriteExt(context.Background(), remoteWriteURL, interval, s.WritePrometheus, opts)
+}
+
+// InitPushRemoteWriteExt sets up periodic push for metrics obtained by calling writeMetrics with the given interval
+// to remoteWriteURL via Prometheus remote_write protocol.
+//
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format.
+// The metrics are sent as snappy-compressed protobuf WriteRequest messages, so they can be ingested directly
+// by any remote_write-compatible backend such as VictoriaMetrics, Prometheus, Mimir or Thanos.
+// See https://prometheus.io/docs/concepts/remote_write_spec/
+//
+// Series, which disappear between pushes, are sent with Prometheus staleness markers.
+// Staleness markers for all the pushed series are sent when ctx is canceled.
+//
+// The periodic push is stopped when ctx is canceled.
+// It is possible to wait until the background metrics push worker is stopped on a WaitGroup passed via opts.WaitGroup.
+//
+// opts may contain additional configuration options if non-nil.
+func InitPushRemoteWriteExt(ctx context.Context, remoteWriteURL string, interval time.Duration, writeMetrics func(w io.Writer), opts *RemoteWriteOptions) error {
+	rw, err := newRemoteWriter(remoteWriteURL, opts)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive; got %s", interval)
+	}
+	rw.pc.selfMetricsSet.GetOrCreateFloatCounter(fmt.Sprintf(`metrics_push_interval_seconds{url=%q}`, rw.pc.pushURLRedacted)).Set(interval.Seconds())
+
+	var wg *sync.WaitGroup
+	if opts != nil {
+		wg = opts.WaitGroup
+		if wg != nil {
+			wg.Add(1)
+		}
+	}
+	go func() {
+		tickerCh, stopTicker := getClock().NewTicker(interval)
+		defer stopTicker()
+		stopCh := ctx.Done()
+		for {
+			select {
+			case <-tickerCh:
+				ctxLocal, cancel := context.WithTimeout(ctx, interval+time.Second)
+				err := rw.push(ctxLocal, writeMetrics)
+				cancel()
+				if err != nil {
+					log.Printf("ERROR: metrics.push: %s", err)
+				}
+			case <-stopCh:
+				// Mark all the previously pushed series as stale. ctx is already canceled, so use a separate context.
+				ctxLocal, cancel := context.WithTimeout(context.Background(), interval+time.Second)
+				err := rw.push(ctxLocal, func(w io.Writer) {})
+				cancel()
+				if err != nil {
+					log.Printf("ERROR: metrics.push: cannot send staleness markers: %s", err)
+				}
+				if wg != nil {
+					wg.Done()
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// staleNaNBits is the bit representation of Prometheus staleness marker.
+//
+// See https://prometheus.io/docs/concepts/remote_write_spec/#stale-markers
+const staleNaNBits = 0x7ff0000000000002
+
+type remoteWriter struct {
+	pc *pushContext
+
+	// prevSeries contains labels for the series sent during the previous push.
+	prevSeries map[string][]label
+}
+
+func newRemoteWriter(remoteWriteURL string, opts *RemoteWriteOptions) (*remoteWriter, error) {
+	if opts == nil {
+		opts = &RemoteWriteOptions{}
+	}
+	pc, err := newPushContext(remoteWriteURL, &PushOptions{
+		ExtraLabels: opts.ExtraLabels,
+		Headers:     opts.Headers,
+		Method:      http.MethodPost,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &remoteWriter{
+		pc:         pc,
+		prevSeries: make(map[string][]label),
+	}, nil
+}
+
+// push sends metrics generated by writeMetrics to rw.pc.pushURL together with staleness markers
+// for the series, which were pushed previously, but are missing now.
+func (rw *remoteWriter) push(ctx context.Context, writeMetrics func(w io.Writer)) error {
+	bb := getBytesBuffer()
+	defer putBytesBuffer(bb)
+	writeMetrics(bb)
+	if rw.pc.extraLabels != "" {
+		bbTmp := getBytesBuffer()
+		bbTmp.B = append(bbTmp.B[:0], bb.B...)
+		bb.B = addExtraLabels(bb.B[:0], bbTmp.B, rw.pc.extraLabels)
+		putBytesBuffer(bbTmp)
+	}
+
+	timestamp := now().UnixNano() / 1e6
+	series := make(map[string][]label, len(rw.prevSeries))
+	var wr []byte
+	visitLines(bb.B, func(line []byte) {
+		if line[0] == '#' {
+			return
+		}
+		sm, err := parseSample(string(line))
+		if err != nil {
+			log.Printf("ERROR: metrics: cannot convert sample to remote_write format: %s", err)
+			return
+		}
+		labels := getRemoteWriteLabels(sm)
+		key := sm.fullName()
+		series[key] = labels
+		ts := timestamp
+		if sm.hasTimestamp {
+			ts = sm.timestamp
+		}
+		wr = appendRemoteWriteTimeSeries(wr, labels, sm.value, ts)
+	})
+	var staleKeys []string
+	for key := range rw.prevSeries {
+		if _, ok := series[key]; !ok {
+			staleKeys = append(staleKeys, key)
+		}
+	}
+	sort.Strings(staleKeys)
+	for _, key := range staleKeys {
+		wr = appendRemoteWriteTimeSeries(wr, rw.prevSeries[key], math.Float64frombits(staleNaNBits), timestamp)
+	}
+	if len(wr) == 0 {
+		rw.prevSeries = series
+		return nil
+	}
+
+	body := appendSnappyBlock(nil, wr)
+	headers := map[string]string{
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	}
+	if err := rw.pc.sendRequest(ctx, body, "application/x-protobuf", "snappy", headers); err != nil || ctx.Err() != nil {
+		// Keep the previously pushed series, so staleness markers for them are sent on the next push.
+		// sendRequest returns nil on canceled ctx, while the request may be not delivered.
+		return err
+	}
+	rw.prevSeries = series
+	return nil
+}
+
+// getRemoteWriteLabels returns labels for sm including `__name__` label sorted by name.
+func getRemoteWriteLabels(sm *sample) []label {
+	labels := make([]label, 0, len(sm.labels)+1)
+	labels = append(labels, label{
+		name:  "__name__",
+		value: sm.name,
+	})
+	labels = append(labels, sm.labels...)
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+	return labels
+}
+
+// appendRemoteWriteTimeSeries appends prometheus.TimeSeries message with a single sample as WriteRequest.timeseries field to dst.
+//
+// See https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto
+func appendRemoteWriteTimeSeries(dst []byte, labels []label, value float64, timestamp int64) []byte {
+	var ts, sample []byte
+	ts = appendProtobufLabels(ts, labels)
+	sample = appendProtobufDouble(sample, 1, value)
+	sample = appendProtobufVarint(sample, 2, uint64(timestamp))
+	ts = appendProtobufMessage(ts, 2, sample)
+	return appendProtobufMessage(dst, 1, ts)
+}
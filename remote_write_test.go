@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAppendRemoteWriteTimeSeries(t *testing.T) {
+	labels := []label{{name: "__name__", value: "foo"}}
+	result := appendRemoteWriteTimeSeries(nil, labels, 1, 2)
+	expected := []byte{
+		0x0a, 0x1e, // timeseries
+		0x0a, 0x0f, 0x0a, 0x08, '_', '_', 'n', 'a', 'm', 'e', '_', '_', 0x12, 0x03, 'f', 'o', 'o', // label
+		0x12, 0x0b, // sample
+		0x09, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // value=1
+		0x10, 0x02, // timestamp=2
+	}
+	if !bytes.Equal(result, expected) {
+		t.Fatalf("unexpected result;\ngot\n%x\nwant\n%x", result, expected)
+	}
+}
+
+func TestRemoteWriterPush(t *testing.T) {
+	SetClock(newFakeClock())
+	defer SetClock(nil)
+
+	var reqHeaders http.Header
+	var reqBody []byte
+	var fail bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reqHeaders = r.Header
+		reqBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	rw, err := newRemoteWriter(srv.URL, &RemoteWriteOptions{
+		ExtraLabels: `job="test"`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(s *Set, expected []byte) {
+		t.Helper()
+		reqBody = nil
+		if err := rw.push(context.Background(), s.WritePrometheus); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if expected == nil {
+			if reqBody != nil {
+				t.Fatalf("unexpected request with %d bytes body", len(reqBody))
+			}
+			return
+		}
+		for name, value := range map[string]string{
+			"Content-Type":                      "application/x-protobuf",
+			"Content-Encoding":                  "snappy",
+			"X-Prometheus-Remote-Write-Version": "0.1.0",
+		} {
+			if v := reqHeaders.Get(name); v != value {
+				t.Fatalf("unexpected %s header; got %q; want %q", name, v, value)
+			}
+		}
+		result, err := decodeSnappyBlock(reqBody)
+		if err != nil {
+			t.Fatalf("cannot decode request body: %s", err)
+		}
+		if !bytes.Equal(result, expected) {
+			t.Fatalf("unexpected request body;\ngot\n%x\nwant\n%x", result, expected)
+		}
+	}
+
+	const timestamp = 1700000000000
+	s := NewSet()
+	s.NewCounter("foo").Set(1)
+	s.NewCounter(`bar{a="b"}`).Set(2)
+	fooLabels := []label{{"__name__", "foo"}, {"job", "test"}}
+	barLabels := []label{{"__name__", "bar"}, {"a", "b"}, {"job", "test"}}
+
+	var expected []byte
+	expected = appendRemoteWriteTimeSeries(expected, barLabels, 2, timestamp)
+	expected = appendRemoteWriteTimeSeries(expected, fooLabels, 1, timestamp)
+	f(s, expected)
+
+	// Missing series must be sent with staleness markers.
+	s.UnregisterMetric(`bar{a="b"}`)
+	expected = appendRemoteWriteTimeSeries(expected[:0], fooLabels, 1, timestamp)
+	expected = appendRemoteWriteTimeSeries(expected, barLabels, math.Float64frombits(staleNaNBits), timestamp)
+	f(s, expected)
+
+	// Staleness markers are sent only once.
+	s.UnregisterMetric("foo")
+	expected = appendRemoteWriteTimeSeries(expected[:0], fooLabels, math.Float64frombits(staleNaNBits), timestamp)
+	f(s, expected)
+	f(s, nil)
+
+	// Staleness markers must be sent again after the failed push.
+	s.NewCounter("baz").Set(3)
+	bazLabels := []label{{"__name__", "baz"}, {"job", "test"}}
+	expected = appendRemoteWriteTimeSeries(expected[:0], bazLabels, 3, timestamp)
+	f(s, expected)
+	s.UnregisterMetric("baz")
+	fail = true
+	if err := rw.push(context.Background(), s.WritePrometheus); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	fail = false
+	expected = appendRemoteWriteTimeSeries(expected[:0], bazLabels, math.Float64frombits(staleNaNBits), timestamp)
+	f(s, expected)
+	f(s, nil)
+
+	// Staleness markers must be sent again after the canceled push.
+	s.NewCounter("qux").Set(4)
+	quxLabels := []label{{"__name__", "qux"}, {"job", "test"}}
+	expected = appendRemoteWriteTimeSeries(expected[:0], quxLabels, 4, timestamp)
+	f(s, expected)
+	s.UnregisterMetric("qux")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rw.push(ctx, s.WritePrometheus); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = appendRemoteWriteTimeSeries(expected[:0], quxLabels, math.Float64frombits(staleNaNBits), timestamp)
+	f(s, expected)
+	f(s, nil)
+}
+
+func TestInitPushRemoteWriteFailure(t *testing.T) {
+	f := func(remoteWriteURL string, interval time.Duration) {
+		t.Helper()
+		if err := InitPushRemoteWrite(remoteWriteURL, interval, nil); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f("foo", time.Second)
+	f("http://localhost:8428/api/v1/write", 0)
+}
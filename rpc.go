@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RPCMetrics records metrics for RPC calls such as gRPC calls.
+//
+// Ready-to-use gRPC interceptors are deliberately out of scope of this package, since it mustn't depend on gRPC.
+// RPCMetrics must be wired into gRPC via interceptors in the application code instead.
+// For example, the following interceptors record the same metrics as go-grpc-prometheus does:
+//
+//	import (
+//	    "context"
+//
+//	    "github.com/VictoriaMetrics/metrics"
+//	    "google.golang.org/grpc"
+//	    "google.golang.org/grpc/status"
+//	    "google.golang.org/protobuf/proto"
+//	)
+//
+//	var serverMetrics = metrics.NewRPCMetrics(nil, "grpc_server")
+//
+//	func unaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+//	    call := serverMetrics.StartCall(info.FullMethod, "unary")
+//	    if m, ok := req.(proto.Message); ok {
+//	        call.MsgReceived(proto.Size(m))
+//	    }
+//	    resp, err := handler(ctx, req)
+//	    if m, ok := resp.(proto.Message); ok && err == nil {
+//	        call.MsgSent(proto.Size(m))
+//	    }
+//	    call.Finish(status.Code(err).String())
+//	    return resp, err
+//	}
+//
+//	func streamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+//	    rpcType := "bidi_stream"
+//	    if !info.IsClientStream {
+//	        rpcType = "server_stream"
+//	    } else if !info.IsServerStream {
+//	        rpcType = "client_stream"
+//	    }
+//	    call := serverMetrics.StartCall(info.FullMethod, rpcType)
+//	    err := handler(srv, &monitoredServerStream{ServerStream: ss, call: call})
+//	    call.Finish(status.Code(err).String())
+//	    return err
+//	}
+//
+//	type monitoredServerStream struct {
+//	    grpc.ServerStream
+//	    call *metrics.RPCCall
+//	}
+//
+//	func (s *monitoredServerStream) SendMsg(m any) error {
+//	    err := s.ServerStream.SendMsg(m)
+//	    if pm, ok := m.(proto.Message); ok && err == nil {
+//	        s.call.MsgSent(proto.Size(pm))
+//	    }
+//	    return err
+//	}
+//
+//	func (s *monitoredServerStream) RecvMsg(m any) error {
+//	    err := s.ServerStream.RecvMsg(m)
+//	    if pm, ok := m.(proto.Message); ok && err == nil {
+//	        s.call.MsgReceived(proto.Size(pm))
+//	    }
+//	    return err
+//	}
+//
+// The interceptors are registered via grpc.ChainUnaryInterceptor(unaryServerInterceptor) and
+// grpc.ChainStreamInterceptor(streamServerInterceptor) options passed to grpc.NewServer.
+// Client interceptors are built in the same way with "grpc_client" prefix.
+type RPCMetrics struct {
+	s      *Set
+	prefix string
+}
+
+// NewRPCMetrics returns RPCMetrics, which registers metrics with the given prefix in s.
+//
+// The following metrics are registered:
+//
+//   - <prefix>_started_total{grpc_type,grpc_service,grpc_method} - the number of started calls
+//   - <prefix>_handled_total{grpc_type,grpc_service,grpc_method,grpc_code} - the number of finished calls
+//   - <prefix>_handling_seconds{grpc_type,grpc_service,grpc_method} - Histogram of call durations
+//   - <prefix>_msg_received_total{grpc_type,grpc_service,grpc_method} - the number of received messages
+//   - <prefix>_msg_sent_total{grpc_type,grpc_service,grpc_method} - the number of sent messages
+//   - <prefix>_msg_received_size_bytes{grpc_type,grpc_service,grpc_method} - Histogram of received message sizes
+//   - <prefix>_msg_sent_size_bytes{grpc_type,grpc_service,grpc_method} - Histogram of sent message sizes
+//
+// Metrics are registered in the default set if s is nil.
+func NewRPCMetrics(s *Set, prefix string) *RPCMetrics {
+	if err := validateIdent(prefix); err != nil {
+		panic(fmt.Errorf("BUG: invalid prefix %q: %s", prefix, err))
+	}
+	if s == nil {
+		s = defaultSet()
+	}
+	return &RPCMetrics{
+		s:      s,
+		prefix: prefix,
+	}
+}
+
+// StartCall registers the start of the call with the given fullMethod and rpcType.
+//
+// fullMethod must have the form `/package.Service/Method`. rpcType is usually one of `unary`, `client_stream`,
+// `server_stream` or `bidi_stream`.
+//
+// RPCCall.Finish must be called when the call is finished.
+func (rm *RPCMetrics) StartCall(fullMethod, rpcType string) *RPCCall {
+	service, method := splitFullMethod(fullMethod)
+	labels := appendLabel(nil, "grpc_type", rpcType)
+	labels = append(labels, ',')
+	labels = appendLabel(labels, "grpc_service", service)
+	labels = append(labels, ',')
+	labels = appendLabel(labels, "grpc_method", method)
+	c := &RPCCall{
+		rm:        rm,
+		labels:    string(labels),
+		startTime: now(),
+	}
+	rm.s.GetOrCreateCounter(c.metricName("started_total")).Inc()
+	return c
+}
+
+// splitFullMethod splits gRPC fullMethod `/package.Service/Method` into service and method names.
+func splitFullMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	n := strings.LastIndexByte(fullMethod, '/')
+	if n < 0 {
+		return "unknown", "unknown"
+	}
+	return fullMethod[:n], fullMethod[n+1:]
+}
+
+// RPCCall records metrics for a single RPC call started via RPCMetrics.StartCall.
+//
+// RPCCall methods may be called from concurrent goroutines.
+type RPCCall struct {
+	rm        *RPCMetrics
+	labels    string
+	startTime time.Time
+}
+
+// MsgReceived registers the received message with the given size in bytes.
+func (c *RPCCall) MsgReceived(size int) {
+	c.rm.s.GetOrCreateCounter(c.metricName("msg_received_total")).Inc()
+	c.rm.s.GetOrCreateHistogram(c.metricName("msg_received_size_bytes")).Update(float64(size))
+}
+
+// MsgSent registers the sent message with the given size in bytes.
+func (c *RPCCall) MsgSent(size int) {
+	c.rm.s.GetOrCreateCounter(c.metricName("msg_sent_total")).Inc()
+	c.rm.s.GetOrCreateHistogram(c.metricName("msg_sent_size_bytes")).Update(float64(size))
+}
+
+// Finish registers the end of the call with the given status code such as `OK` or `Unavailable`.
+func (c *RPCCall) Finish(code string) {
+	c.rm.s.GetOrCreateHistogram(c.metricName("handling_seconds")).UpdateDuration(c.startTime)
+	name := c.rm.prefix + "_handled_total{" + c.labels + "," + string(appendLabel(nil, "grpc_code", code)) + "}"
+	c.rm.s.GetOrCreateCounter(name).Inc()
+}
+
+func (c *RPCCall) metricName(suffix string) string {
+	return c.rm.prefix + "_" + suffix + "{" + c.labels + "}"
+}
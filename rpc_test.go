@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRPCMetrics(t *testing.T) {
+	s := NewSet()
+	rm := NewRPCMetrics(s, "grpc_server")
+
+	call := rm.StartCall("/pkg.Greeter/SayHello", "unary")
+	call.MsgReceived(10)
+	call.MsgSent(20)
+	call.Finish("OK")
+
+	call = rm.StartCall("/pkg.Greeter/SayHello", "unary")
+	call.Finish("Unavailable")
+
+	var bb bytes.Buffer
+	s.WritePrometheusFiltered(&bb, func(name string) bool {
+		return strings.Contains(name, "_total")
+	})
+	resultExpected := `grpc_server_handled_total{grpc_type="unary",grpc_service="pkg.Greeter",grpc_method="SayHello",grpc_code="OK"} 1
+grpc_server_handled_total{grpc_type="unary",grpc_service="pkg.Greeter",grpc_method="SayHello",grpc_code="Unavailable"} 1
+grpc_server_msg_received_total{grpc_type="unary",grpc_service="pkg.Greeter",grpc_method="SayHello"} 1
+grpc_server_msg_sent_total{grpc_type="unary",grpc_service="pkg.Greeter",grpc_method="SayHello"} 1
+grpc_server_started_total{grpc_type="unary",grpc_service="pkg.Greeter",grpc_method="SayHello"} 2
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	labels := `{grpc_type="unary",grpc_service="pkg.Greeter",grpc_method="SayHello"}`
+	if n := getHistogramCount(s.GetOrCreateHistogram("grpc_server_handling_seconds" + labels)); n != 2 {
+		t.Fatalf("unexpected number of handled calls; got %d; want 2", n)
+	}
+	if sum := s.GetOrCreateHistogram("grpc_server_msg_sent_size_bytes" + labels).getSum(); sum != 20 {
+		t.Fatalf("unexpected sum of sent message sizes; got %v; want 20", sum)
+	}
+
+	expectPanic(t, "NewRPCMetrics_invalid_prefix", func() {
+		NewRPCMetrics(s, "grpc-server")
+	})
+}
+
+func TestSplitFullMethod(t *testing.T) {
+	f := func(fullMethod, serviceExpected, methodExpected string) {
+		t.Helper()
+		service, method := splitFullMethod(fullMethod)
+		if service != serviceExpected || method != methodExpected {
+			t.Fatalf("unexpected result for %q; got %q, %q; want %q, %q", fullMethod, service, method, serviceExpected, methodExpected)
+		}
+	}
+	f("/pkg.Service/Method", "pkg.Service", "Method")
+	f("pkg.Service/Method", "pkg.Service", "Method")
+	f("/a.b.Service/Method", "a.b.Service", "Method")
+	f("invalid", "unknown", "unknown")
+}
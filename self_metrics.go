@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// ExposeSelfMetrics enables exposing stats for s itself at s.WritePrometheus.
+//
+// The following metrics are exposed if v is true:
+//
+//   - metrics_set_entries - the number of metrics registered in s
+//   - metrics_set_writes_total - the number of s.WritePrometheus calls
+//   - metrics_set_write_duration_seconds - histogram for the duration of s.WritePrometheus calls
+//   - metrics_set_limit_exceeded_total - the number of registrations rejected because of the limit set via SetMaxMetrics
+//
+// These metrics allow detecting cardinality growth and slow scrapes caused by expensive gauge callbacks.
+// The write duration includes the duration of metrics writers registered in s, while it excludes the duration
+// for child sets. Use NewChildSet or SetCommonLabels for distinguishing self metrics for multiple sets.
+//
+// It is safe to call this method multiple times. It is allowed to change it in runtime.
+// Self metrics aren't exposed by default.
+func (s *Set) ExposeSelfMetrics(v bool) {
+	n := uint32(0)
+	if v {
+		n = 1
+	}
+	atomic.StoreUint32(&s.selfMetrics.enabled, n)
+}
+
+// setSelfMetrics contains stats for the Set.
+type setSelfMetrics struct {
+	enabled       uint32
+	writes        uint64
+	writeDuration Histogram
+}
+
+func (sm *setSelfMetrics) isEnabled() bool {
+	return atomic.LoadUint32(&sm.enabled) != 0
+}
+
+// writeTo writes self metrics for the set with the given entries and limitExceeded to w.
+//
+// Metrics are written only if keep returns true for their names. All the metrics are written if keep is nil.
+func (sm *setSelfMetrics) writeTo(w io.Writer, entries int, limitExceeded uint64, keep func(name string) bool) {
+	isKept := func(name string) bool {
+		return keep == nil || keep(name)
+	}
+	if isKept("metrics_set_entries") {
+		WriteGaugeUint64(w, "metrics_set_entries", uint64(entries))
+	}
+	if isKept("metrics_set_writes_total") {
+		WriteCounterUint64(w, "metrics_set_writes_total", atomic.LoadUint64(&sm.writes))
+	}
+	if isKept("metrics_set_limit_exceeded_total") {
+		WriteCounterUint64(w, "metrics_set_limit_exceeded_total", limitExceeded)
+	}
+	if isKept("metrics_set_write_duration_seconds") {
+		WriteMetadataIfNeeded(w, "metrics_set_write_duration_seconds", sm.writeDuration.metricType())
+		sm.writeDuration.marshalTo("metrics_set_write_duration_seconds", w)
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSetExposeSelfMetrics(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	s := NewSet()
+	s.NewCounter("requests_total").Inc()
+	s.NewGauge("slow_gauge", func() float64 {
+		fc.Advance(2 * time.Second)
+		return 1
+	})
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// Self metrics are disabled by default
+	f(`requests_total 1
+slow_gauge 1
+`)
+
+	s.ExposeSelfMetrics(true)
+	f(`requests_total 1
+slow_gauge 1
+metrics_set_entries 2
+metrics_set_writes_total 0
+metrics_set_limit_exceeded_total 0
+`)
+	f(`requests_total 1
+slow_gauge 1
+metrics_set_entries 2
+metrics_set_writes_total 1
+metrics_set_limit_exceeded_total 0
+metrics_set_write_duration_seconds_bucket{vmrange="1.896e+00...2.154e+00"} 1
+metrics_set_write_duration_seconds_sum 2
+metrics_set_write_duration_seconds_count 1
+`)
+
+	s.ExposeSelfMetrics(false)
+	f(`requests_total 1
+slow_gauge 1
+`)
+}
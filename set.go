@@ -6,6 +6,7 @@ import (
 	"io"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,12 +16,56 @@ import (
 //
 // Set.WritePrometheus must be called for exporting metrics from the set.
 type Set struct {
+	// mu protects the rest of fields in s.
+	//
+	// Modifications of m must be performed under mu, while lookups in m may be performed without mu,
+	// since m has its own sharded locks. This allows fast lookups of the registered metrics by name.
 	mu        sync.Mutex
 	a         []*namedMetric
-	m         map[string]*namedMetric
+	m         *metricsMap
 	summaries []*Summary
 
 	metricsWriters []func(w io.Writer)
+
+	// labels contains comma-separated `label="value"` pairs, which are added to all the metrics in s.
+	//
+	// It is set for child sets created via NewChildSet.
+	labels string
+
+	// children contains child sets created via NewChildSet.
+	children []*Set
+
+	// commonLabels contains comma-separated `label="value"` pairs set via SetCommonLabels.
+	commonLabels string
+
+	// metricTTL is the duration after which idle metrics are unregistered from s. See SetMetricTTL.
+	metricTTL time.Duration
+
+	// vecs contains metric vectors created in s keyed by metric family name.
+	// They are notified when idle or renamed metrics are unregistered.
+	vecs map[string][]*metricVec
+
+	// selfMetrics contains stats for s. See ExposeSelfMetrics.
+	selfMetrics setSelfMetrics
+
+	// registerHooks and unregisterHooks contain callbacks registered via OnRegister and OnUnregister.
+	registerHooks   []func(name string)
+	unregisterHooks []func(name string)
+
+	// metricsCount is the number of non-auxiliary metrics in s.
+	metricsCount int
+
+	// maxMetrics and onLimit are set via SetMaxMetrics.
+	maxMetrics int
+	onLimit    func(name string)
+
+	// limitExceeded is the number of registrations rejected because of maxMetrics limit.
+	limitExceeded uint64
+
+	// help contains help texts for metric families set via SetHelp.
+	//
+	// The map is replaced on every update, so it may be read without holding mu after obtaining it under mu.
+	help map[string]string
 }
 
 // NewSet creates new set of metrics.
@@ -28,46 +73,210 @@ type Set struct {
 // Pass the set to RegisterSet() function in order to export its metrics via global WritePrometheus() call.
 func NewSet() *Set {
 	return &Set{
-		m: make(map[string]*namedMetric),
+		m: newMetricsMap(),
 	}
 }
 
 // WritePrometheus writes all the metrics from s to w in Prometheus format.
 func (s *Set) WritePrometheus(w io.Writer) {
-	// Collect all the metrics in in-memory buffer in order to prevent from long locking due to slow w.
-	var bb bytes.Buffer
-	lessFunc := func(i, j int) bool {
-		return s.a[i].name < s.a[j].name
+	s.writePrometheusFiltered(w, nil)
+}
+
+// WritePrometheusFiltered writes metrics from s to w in Prometheus format if keep returns true for their names.
+//
+// keep is called with metric names passed at registration, e.g. `foo{bar="baz"}`. It is also applied to metrics in child sets.
+// Summary quantiles are written if keep returns true for the summary name.
+// The output of callbacks registered via RegisterMetricsWriter is written unconditionally, since it isn't bound to metric names.
+//
+// This allows serving distinct subsets of metrics from a single Set at multiple scrape endpoints,
+// e.g. `/metrics/critical` and `/metrics/full`.
+func (s *Set) WritePrometheusFiltered(w io.Writer, keep func(name string) bool) {
+	if keep == nil {
+		panic(fmt.Errorf("BUG: keep cannot be nil"))
 	}
-	s.mu.Lock()
-	for _, sm := range s.summaries {
-		sm.updateQuantiles()
+	s.writePrometheusFiltered(w, keep)
+}
+
+// writePrometheusFiltered writes metrics from s to w. All the metrics are written if keep is nil.
+func (s *Set) writePrometheusFiltered(w io.Writer, keep func(name string) bool) {
+	commonLabels := s.getCommonLabels()
+	if commonLabels == "" {
+		s.writePrometheus(w, keep)
+		return
 	}
-	if !sort.SliceIsSorted(s.a, lessFunc) {
-		sort.Slice(s.a, lessFunc)
+	var bb bytes.Buffer
+	s.writePrometheus(newMetadataWriter(&bb, isMetadataEnabledFor(w)), keep)
+	w.Write(addExtraLabels(nil, bb.Bytes(), commonLabels))
+}
+
+func (s *Set) writePrometheus(w io.Writer, keep func(name string) bool) {
+	// Collect all the metrics in in-memory buffer in order to prevent from long locking due to slow w.
+	var bb bytes.Buffer
+	mw := newMetadataWriter(&bb, isMetadataEnabledFor(w))
+	startTime := now()
+	sa, metricsWriters := s.getSortedMetrics()
+	entries := len(sa)
+	if keep != nil {
+		sa = filterMetrics(sa, keep)
 	}
-	sa := append([]*namedMetric(nil), s.a...)
-	metricsWriters := s.metricsWriters
-	s.mu.Unlock()
+	help := s.getHelp()
 
 	prevMetricFamily := ""
 	for _, nm := range sa {
+		n := bb.Len()
 		metricFamily := getMetricFamily(nm.name)
 		if metricFamily != prevMetricFamily {
 			// write meta info only once per metric family
 			metricType := nm.metric.metricType()
-			WriteMetadataIfNeeded(&bb, nm.name, metricType)
+			writeMetadataIfNeeded(mw, nm.name, metricType, help[metricFamily])
 			prevMetricFamily = metricFamily
 		}
 		// Call marshalTo without the global lock, since certain metric types such as Gauge
 		// can call a callback, which, in turn, can try calling s.mu.Lock again.
+		m := bb.Len()
 		nm.metric.marshalTo(nm.name, &bb)
+		if bb.Len() > m {
+			writeCreatedSeriesIfNeeded(&bb, nm)
+		}
+		if isQuotedMetricName(nm.name) {
+			escaped := escapeMetricNames(nil, bb.Bytes()[n:])
+			bb.Truncate(n)
+			bb.Write(escaped)
+		}
+	}
+	s.removeIdleMetrics()
+	if s.selfMetrics.isEnabled() {
+		s.selfMetrics.writeTo(mw, entries, atomic.LoadUint64(&s.limitExceeded), keep)
+	}
+	if s.labels == "" {
+		w.Write(bb.Bytes())
+		for _, writeMetrics := range metricsWriters {
+			writeMetrics(w)
+		}
+	} else {
+		for _, writeMetrics := range metricsWriters {
+			writeMetrics(mw)
+		}
+		w.Write(addExtraLabels(nil, bb.Bytes(), s.labels))
+	}
+	if s.selfMetrics.isEnabled() {
+		atomic.AddUint64(&s.selfMetrics.writes, 1)
+		s.selfMetrics.writeDuration.UpdateDuration(startTime)
+	}
+
+	for _, child := range s.getChildren() {
+		child.writePrometheusFiltered(w, keep)
+	}
+}
+
+// filterMetrics returns metrics from sa with names, for which keep returns true.
+//
+// Auxiliary summary quantiles are returned if keep returns true for the parent summary.
+func filterMetrics(sa []*namedMetric, keep func(name string) bool) []*namedMetric {
+	keptSummaries := make(map[*Summary]bool)
+	for _, nm := range sa {
+		if sm, ok := nm.metric.(*Summary); ok && keep(nm.name) {
+			keptSummaries[sm] = true
+		}
+	}
+	dst := sa[:0]
+	for _, nm := range sa {
+		switch t := nm.metric.(type) {
+		case *Summary:
+			if !keptSummaries[t] {
+				continue
+			}
+		case *quantileValue:
+			if !keptSummaries[t.sm] {
+				continue
+			}
+		default:
+			if !keep(nm.name) {
+				continue
+			}
+		}
+		dst = append(dst, nm)
+	}
+	return dst
+}
+
+// NewChildSet creates and returns new child set for s.
+//
+// labels must contain comma-separated list of `label="value"` pairs, for example `tenant="foo",module="bar"`.
+// These labels are added to all the metrics exported from the child set together with the labels inherited from s,
+// so they needn't be repeated in every metric name registered in the child set.
+//
+// Metrics from the child set are exported together with metrics from s.
+func (s *Set) NewChildSet(labels string) *Set {
+	if err := validateTags(labels); err != nil {
+		panic(fmt.Errorf("BUG: invalid labels %q for child set: %s", labels, err))
+	}
+	child := NewSet()
+	child.labels = joinLabels(s.labels, labels)
+	s.mu.Lock()
+	s.children = append(s.children, child)
+	s.mu.Unlock()
+	return child
+}
+
+// SetCommonLabels sets labels, which are added to every metric exported from s, including metrics from child sets.
+//
+// labels must contain comma-separated list of `label="value"` pairs, for example `instance="host1",env="prod"`.
+// Pass empty labels in order to stop adding common labels.
+//
+// This is similar to PushOptions.ExtraLabels for scrape-based exposition.
+func (s *Set) SetCommonLabels(labels string) {
+	if err := validateTags(labels); err != nil {
+		panic(fmt.Errorf("BUG: invalid common labels %q: %s", labels, err))
 	}
-	w.Write(bb.Bytes())
+	s.mu.Lock()
+	s.commonLabels = labels
+	s.mu.Unlock()
+}
+
+func (s *Set) getCommonLabels() string {
+	s.mu.Lock()
+	commonLabels := s.commonLabels
+	s.mu.Unlock()
+	return commonLabels
+}
+
+// joinLabels joins comma-separated lists of `label="value"` pairs a and b.
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "," + b
+}
 
-	for _, writeMetrics := range metricsWriters {
-		writeMetrics(w)
+func (s *Set) getChildren() []*Set {
+	s.mu.Lock()
+	children := append([]*Set(nil), s.children...)
+	s.mu.Unlock()
+	return children
+}
+
+// getSortedMetrics returns a copy of metrics from s sorted by name and metrics writers registered in s.
+//
+// It also updates quantiles for summaries in s.
+func (s *Set) getSortedMetrics() ([]*namedMetric, []func(w io.Writer)) {
+	lessFunc := func(i, j int) bool {
+		return s.a[i].sortKey < s.a[j].sortKey
+	}
+	s.mu.Lock()
+	for _, sm := range s.summaries {
+		sm.updateQuantiles()
+	}
+	if !sort.SliceIsSorted(s.a, lessFunc) {
+		sort.Slice(s.a, lessFunc)
 	}
+	sa := append([]*namedMetric(nil), s.a...)
+	metricsWriters := s.metricsWriters
+	s.mu.Unlock()
+	return sa, metricsWriters
 }
 
 // NewHistogram creates and returns new histogram in s with the given name.
@@ -86,6 +295,24 @@ func (s *Set) NewHistogram(name string) *Histogram {
 	return h
 }
 
+// NewHistogramExt creates and returns new histogram in s with the given name and opts.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// opts may contain additional configuration options if non-nil.
+//
+// The returned histogram is safe to use from concurrent goroutines.
+func (s *Set) NewHistogramExt(name string, opts *HistogramOpts) *Histogram {
+	h := newHistogram(opts)
+	s.registerMetric(name, h)
+	return h
+}
+
 // GetOrCreateHistogram returns registered histogram in s with the given name
 // or creates new histogram if s doesn't contain histogram with the given name.
 //
@@ -100,34 +327,71 @@ func (s *Set) NewHistogram(name string) *Histogram {
 //
 // Performance tip: prefer NewHistogram instead of GetOrCreateHistogram.
 func (s *Set) GetOrCreateHistogram(name string) *Histogram {
-	s.mu.Lock()
-	nm := s.m[name]
-	s.mu.Unlock()
+	nm := s.m.get(name)
 	if nm == nil {
 		// Slow path - create and register missing histogram.
 		if err := validateMetric(name); err != nil {
 			panic(fmt.Errorf("BUG: invalid metric name %q: %s", name, err))
 		}
 		nmNew := &namedMetric{
-			name:   name,
-			metric: &Histogram{},
-		}
-		s.mu.Lock()
-		nm = s.m[name]
-		if nm == nil {
-			nm = nmNew
-			s.m[name] = nm
-			s.a = append(s.a, nm)
+			name:      name,
+			metric:    &Histogram{},
+			expirable: true,
 		}
-		s.mu.Unlock()
+		nm = s.getOrAddMetric(nmNew, nil)
 	}
 	h, ok := nm.metric.(*Histogram)
 	if !ok {
 		panic(fmt.Errorf("BUG: metric %q isn't a Histogram. It is %T", name, nm.metric))
 	}
+	h.markAccessed()
 	return h
 }
 
+// NewHistogramVec creates and returns new HistogramVec in s with the given name and labelNames.
+//
+// name must be valid Prometheus-compatible metric name without labels.
+// Histograms for distinct label values are registered in s on the first access via HistogramVec methods.
+//
+// The returned HistogramVec is safe to use from concurrent goroutines.
+func (s *Set) NewHistogramVec(name string, labelNames []string) *HistogramVec {
+	return &HistogramVec{
+		mv: newMetricVec(s, name, labelNames),
+	}
+}
+
+// NewNativeHistogram creates and returns new NativeHistogram in s with the given name and the default schema 3.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned NativeHistogram is safe to use from concurrent goroutines.
+func (s *Set) NewNativeHistogram(name string) *NativeHistogram {
+	return s.NewNativeHistogramExt(name, defaultNativeHistogramSchema)
+}
+
+// NewNativeHistogramExt creates and returns new NativeHistogram in s with the given name and schema.
+//
+// schema must be in the range [-4..8]. Every power of 2 is split into 2^schema buckets.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned NativeHistogram is safe to use from concurrent goroutines.
+func (s *Set) NewNativeHistogramExt(name string, schema int) *NativeHistogram {
+	nh := newNativeHistogram(schema)
+	s.registerMetric(name, nh)
+	return nh
+}
+
 // NewCounter registers and returns new counter with the given name in the s.
 //
 // name must be valid Prometheus-compatible metric with possible labels.
@@ -158,31 +422,24 @@ func (s *Set) NewCounter(name string) *Counter {
 //
 // Performance tip: prefer NewCounter instead of GetOrCreateCounter.
 func (s *Set) GetOrCreateCounter(name string) *Counter {
-	s.mu.Lock()
-	nm := s.m[name]
-	s.mu.Unlock()
+	nm := s.m.get(name)
 	if nm == nil {
 		// Slow path - create and register missing counter.
 		if err := validateMetric(name); err != nil {
 			panic(fmt.Errorf("BUG: invalid metric name %q: %s", name, err))
 		}
 		nmNew := &namedMetric{
-			name:   name,
-			metric: &Counter{},
+			name:      name,
+			metric:    &Counter{},
+			expirable: true,
 		}
-		s.mu.Lock()
-		nm = s.m[name]
-		if nm == nil {
-			nm = nmNew
-			s.m[name] = nm
-			s.a = append(s.a, nm)
-		}
-		s.mu.Unlock()
+		nm = s.getOrAddMetric(nmNew, nil)
 	}
 	c, ok := nm.metric.(*Counter)
 	if !ok {
 		panic(fmt.Errorf("BUG: metric %q isn't a Counter. It is %T", name, nm.metric))
 	}
+	c.markAccessed()
 	return c
 }
 
@@ -216,31 +473,24 @@ func (s *Set) NewFloatCounter(name string) *FloatCounter {
 //
 // Performance tip: prefer NewFloatCounter instead of GetOrCreateFloatCounter.
 func (s *Set) GetOrCreateFloatCounter(name string) *FloatCounter {
-	s.mu.Lock()
-	nm := s.m[name]
-	s.mu.Unlock()
+	nm := s.m.get(name)
 	if nm == nil {
 		// Slow path - create and register missing counter.
 		if err := validateMetric(name); err != nil {
 			panic(fmt.Errorf("BUG: invalid metric name %q: %s", name, err))
 		}
 		nmNew := &namedMetric{
-			name:   name,
-			metric: &FloatCounter{},
-		}
-		s.mu.Lock()
-		nm = s.m[name]
-		if nm == nil {
-			nm = nmNew
-			s.m[name] = nm
-			s.a = append(s.a, nm)
+			name:      name,
+			metric:    &FloatCounter{},
+			expirable: true,
 		}
-		s.mu.Unlock()
+		nm = s.getOrAddMetric(nmNew, nil)
 	}
 	c, ok := nm.metric.(*FloatCounter)
 	if !ok {
 		panic(fmt.Errorf("BUG: metric %q isn't a Counter. It is %T", name, nm.metric))
 	}
+	c.markAccessed()
 	return c
 }
 
@@ -265,6 +515,23 @@ func (s *Set) NewGauge(name string, f func() float64) *Gauge {
 	return g
 }
 
+// NewCachedGauge registers and returns gauge with the given name in s, which calls f
+// to obtain gauge value at most once per ttl.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// f must be safe for concurrent calls.
+//
+// The returned gauge is safe to use from concurrent goroutines.
+func (s *Set) NewCachedGauge(name string, f func() float64, ttl time.Duration) *Gauge {
+	return s.NewGauge(name, newCachedGaugeFunc(f, ttl))
+}
+
 // GetOrCreateGauge returns registered gauge with the given name in s
 // or creates new gauge if s doesn't contain gauge with the given name.
 //
@@ -279,9 +546,7 @@ func (s *Set) NewGauge(name string, f func() float64) *Gauge {
 //
 // Performance tip: prefer NewGauge instead of GetOrCreateGauge.
 func (s *Set) GetOrCreateGauge(name string, f func() float64) *Gauge {
-	s.mu.Lock()
-	nm := s.m[name]
-	s.mu.Unlock()
+	nm := s.m.get(name)
 	if nm == nil {
 		// Slow path - create and register missing gauge.
 		if err := validateMetric(name); err != nil {
@@ -292,23 +557,192 @@ func (s *Set) GetOrCreateGauge(name string, f func() float64) *Gauge {
 			metric: &Gauge{
 				f: f,
 			},
+			// Gauges with callbacks cannot be re-created by the caller on the next access, so they never expire.
+			expirable: f == nil,
 		}
-		s.mu.Lock()
-		nm = s.m[name]
-		if nm == nil {
-			nm = nmNew
-			s.m[name] = nm
-			s.a = append(s.a, nm)
-		}
-		s.mu.Unlock()
+		nm = s.getOrAddMetric(nmNew, nil)
 	}
 	g, ok := nm.metric.(*Gauge)
 	if !ok {
 		panic(fmt.Errorf("BUG: metric %q isn't a Gauge. It is %T", name, nm.metric))
 	}
+	g.markAccessed()
+	return g
+}
+
+// NewGaugeVec creates and returns new GaugeVec in s with the given name and labelNames.
+//
+// name must be valid Prometheus-compatible metric name without labels.
+// Gauges for distinct label values are registered in s on the first access via GaugeVec methods.
+//
+// The returned GaugeVec is safe to use from concurrent goroutines.
+func (s *Set) NewGaugeVec(name string, labelNames []string) *GaugeVec {
+	return &GaugeVec{
+		mv: newMetricVec(s, name, labelNames),
+	}
+}
+
+// NewInfo registers and returns new Info metric with the given name and labels in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Info is safe to use from concurrent goroutines.
+func (s *Set) NewInfo(name string, labels map[string]string) *Info {
+	i := &Info{}
+	i.Set(labels)
+	s.registerMetric(name, i)
+	return i
+}
+
+// NewStateSet registers and returns new StateSet with the given name and states in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// states must contain at least one state. The first state is active after the StateSet creation.
+//
+// The returned StateSet is safe to use from concurrent goroutines.
+func (s *Set) NewStateSet(name string, states []string) *StateSet {
+	ss := newStateSet(states)
+	s.registerMetric(name, ss)
+	return ss
+}
+
+// NewRate registers and returns new Rate in s with the given name, which exposes events per second over the given window.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Rate is safe to use from concurrent goroutines.
+func (s *Set) NewRate(name string, window time.Duration) *Rate {
+	r := newRate(window)
+	s.registerMetric(name, r)
+	return r
+}
+
+// NewWriteCallback registers writeMetrics callback with the given name and metricType in s.
+//
+// The writeMetrics callback is called at s.WritePrometheus for writing pre-computed samples to w.
+// This is useful for exporters, which obtain metric values from an external snapshot at scrape time.
+//
+// name must be valid Prometheus-compatible metric name without labels. The samples written by writeMetrics
+// must belong to the name metric family, e.g. `name` or `name{label="value"}`. The samples are written
+// at the position of name among the rest of metrics in s, after `# HELP` and `# TYPE` metadata
+// for the given metricType if metadata exposition is enabled via ExposeMetadata().
+//
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format without comments and metadata.
+// The last line generated by writeMetrics must end with \n.
+//
+// The registered callback can be removed via s.UnregisterMetric(name).
+//
+// See also RegisterMetricsWriter.
+func (s *Set) NewWriteCallback(name, metricType string, writeMetrics func(w io.Writer)) {
+	if err := validateIdent(name); err != nil {
+		panic(fmt.Errorf("BUG: invalid metric name %q: %s", name, err))
+	}
+	if metricType == "" {
+		panic(fmt.Errorf("BUG: metricType cannot be empty for metric %q", name))
+	}
+	wc := &writeCallback{
+		metricTypeStr: metricType,
+		writeMetrics:  writeMetrics,
+	}
+	s.registerMetric(name, wc)
+}
+
+// NewMaxGauge registers and returns new MaxGauge with the given name in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned MaxGauge is safe to use from concurrent goroutines.
+func (s *Set) NewMaxGauge(name string) *MaxGauge {
+	mg := &MaxGauge{}
+	s.registerMetric(name, mg)
+	return mg
+}
+
+// NewMinGauge registers and returns new MinGauge with the given name in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned MinGauge is safe to use from concurrent goroutines.
+func (s *Set) NewMinGauge(name string) *MinGauge {
+	mg := &MinGauge{}
+	s.registerMetric(name, mg)
+	return mg
+}
+
+// NewInt64Gauge registers and returns new Int64Gauge with the given name in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Int64Gauge is safe to use from concurrent goroutines.
+func (s *Set) NewInt64Gauge(name string) *Int64Gauge {
+	g := &Int64Gauge{}
+	s.registerMetric(name, g)
+	return g
+}
+
+// NewUint64Gauge registers and returns new Uint64Gauge with the given name in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned Uint64Gauge is safe to use from concurrent goroutines.
+func (s *Set) NewUint64Gauge(name string) *Uint64Gauge {
+	g := &Uint64Gauge{}
+	s.registerMetric(name, g)
 	return g
 }
 
+// NewBoolGauge registers and returns new BoolGauge with the given name in s.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// The returned BoolGauge is safe to use from concurrent goroutines.
+func (s *Set) NewBoolGauge(name string) *BoolGauge {
+	bg := &BoolGauge{}
+	s.registerMetric(name, bg)
+	return bg
+}
+
 // NewSummary creates and returns new summary with the given name in s.
 //
 // name must be valid Prometheus-compatible metric with possible labels.
@@ -340,15 +774,21 @@ func (s *Set) NewSummaryExt(name string, window time.Duration, quantiles []float
 	}
 	sm := newSummary(window, quantiles)
 
-	s.mu.Lock()
-	// defer will unlock in case of panic
-	// checks in tests
-	defer s.mu.Unlock()
+	ok := func() bool {
+		s.mu.Lock()
+		// defer will unlock in case of panic
+		// checks in tests
+		defer s.mu.Unlock()
 
-	s.mustRegisterLocked(name, sm, false)
-	registerSummaryLocked(sm)
-	s.registerSummaryQuantilesLocked(name, sm)
-	s.summaries = append(s.summaries, sm)
+		if !s.mustRegisterLocked(name, sm, false) {
+			return false
+		}
+		registerSummaryLocked(sm)
+		s.registerSummaryQuantilesLocked(name, sm)
+		s.summaries = append(s.summaries, sm)
+		return true
+	}()
+	s.notifyRegisterOrLimit(name, ok)
 	return sm
 }
 
@@ -384,9 +824,7 @@ func (s *Set) GetOrCreateSummary(name string) *Summary {
 //
 // Performance tip: prefer NewSummaryExt instead of GetOrCreateSummaryExt.
 func (s *Set) GetOrCreateSummaryExt(name string, window time.Duration, quantiles []float64) *Summary {
-	s.mu.Lock()
-	nm := s.m[name]
-	s.mu.Unlock()
+	nm := s.m.get(name)
 	if nm == nil {
 		// Slow path - create and register missing summary.
 		if err := validateMetric(name); err != nil {
@@ -394,20 +832,15 @@ func (s *Set) GetOrCreateSummaryExt(name string, window time.Duration, quantiles
 		}
 		sm := newSummary(window, quantiles)
 		nmNew := &namedMetric{
-			name:   name,
-			metric: sm,
+			name:      name,
+			metric:    sm,
+			expirable: true,
 		}
-		s.mu.Lock()
-		nm = s.m[name]
-		if nm == nil {
-			nm = nmNew
-			s.m[name] = nm
-			s.a = append(s.a, nm)
+		nm = s.getOrAddMetric(nmNew, func() {
 			registerSummaryLocked(sm)
 			s.registerSummaryQuantilesLocked(name, sm)
-		}
-		s.summaries = append(s.summaries, sm)
-		s.mu.Unlock()
+			s.summaries = append(s.summaries, sm)
+		})
 	}
 	sm, ok := nm.metric.(*Summary)
 	if !ok {
@@ -419,6 +852,7 @@ func (s *Set) GetOrCreateSummaryExt(name string, window time.Duration, quantiles
 	if !isEqualQuantiles(sm.quantiles, quantiles) {
 		panic(fmt.Errorf("BUG: invalid quantiles requested from the summary %q; requested %v; need %v", name, quantiles, sm.quantiles))
 	}
+	sm.markAccessed()
 	return sm
 }
 
@@ -437,29 +871,71 @@ func (s *Set) registerMetric(name string, m metric) {
 	if err := validateMetric(name); err != nil {
 		panic(fmt.Errorf("BUG: invalid metric name %q: %s", name, err))
 	}
-	s.mu.Lock()
-	// defer will unlock in case of panic
-	// checks in test
-	defer s.mu.Unlock()
-	s.mustRegisterLocked(name, m, false)
+	ok := func() bool {
+		s.mu.Lock()
+		// defer will unlock in case of panic
+		// checks in test
+		defer s.mu.Unlock()
+		return s.mustRegisterLocked(name, m, false)
+	}()
+	s.notifyRegisterOrLimit(name, ok)
 }
 
 // mustRegisterLocked registers given metric with the given name.
 //
 // Panics if the given name was already registered before.
-func (s *Set) mustRegisterLocked(name string, m metric, isAux bool) {
-	nm, ok := s.m[name]
-	if !ok {
-		nm = &namedMetric{
-			name:   name,
-			metric: m,
-			isAux:  isAux,
-		}
-		s.m[name] = nm
-		s.a = append(s.a, nm)
+// False is returned without registering the metric if the limit set via SetMaxMetrics is exceeded.
+// Auxiliary metrics aren't limited.
+func (s *Set) mustRegisterLocked(name string, m metric, isAux bool) bool {
+	if s.m.get(name) != nil {
+		panic(fmt.Errorf("BUG: metric %q is already registered", name))
 	}
+	if !isAux && s.isLimitExceededLocked() {
+		return false
+	}
+	nm := &namedMetric{
+		name:   name,
+		metric: m,
+		isAux:  isAux,
+	}
+	s.addMetricLocked(nm)
+	return true
+}
+
+// getOrAddMetric returns registered metric with nmNew.name or registers nmNew if s doesn't contain such a metric.
+//
+// addLocked is called under s.mu after nmNew registration if it is non-nil.
+// nmNew is returned without registration if the limit set via SetMaxMetrics is exceeded.
+func (s *Set) getOrAddMetric(nmNew *namedMetric, addLocked func()) *namedMetric {
+	s.mu.Lock()
+	nm := s.m.get(nmNew.name)
+	if nm != nil {
+		s.mu.Unlock()
+		return nm
+	}
+	ok := !s.isLimitExceededLocked()
 	if ok {
-		panic(fmt.Errorf("BUG: metric %q is already registered", name))
+		s.addMetricLocked(nmNew)
+		if addLocked != nil {
+			addLocked()
+		}
+	}
+	s.mu.Unlock()
+
+	s.notifyRegisterOrLimit(nmNew.name, ok)
+	return nmNew
+}
+
+// addMetricLocked adds nm to s.
+func (s *Set) addMetricLocked(nm *namedMetric) {
+	if atomic.LoadInt64(&nm.created) == 0 {
+		nm.resetCreated()
+	}
+	nm.sortKey = getMetricSortKey(nm.name, nm.isAux)
+	s.m.add(nm)
+	s.a = append(s.a, nm)
+	if !nm.isAux {
+		s.metricsCount++
 	}
 }
 
@@ -469,23 +945,30 @@ func (s *Set) mustRegisterLocked(name string, m metric, isAux bool) {
 // False is returned if the given metric is missing in s.
 func (s *Set) UnregisterMetric(name string) bool {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	nm, ok := s.m[name]
-	if !ok {
+	nm := s.m.get(name)
+	if nm == nil {
+		s.mu.Unlock()
 		return false
 	}
 	if nm.isAux {
 		// Do not allow deleting auxiliary metrics such as summary_metric{quantile="..."}
 		// Such metrics must be deleted via parent metric name, e.g. summary_metric .
+		s.mu.Unlock()
 		return false
 	}
-	return s.unregisterMetricLocked(nm)
+	ok := s.unregisterMetricLocked(nm)
+	s.mu.Unlock()
+
+	if ok {
+		s.notifyUnregister(name)
+	}
+	return ok
 }
 
 func (s *Set) unregisterMetricLocked(nm *namedMetric) bool {
 	name := nm.name
-	delete(s.m, name)
+	s.m.delete(name)
+	s.metricsCount--
 
 	deleteFromList := func(metricName string) {
 		for i, nm := range s.a {
@@ -509,7 +992,7 @@ func (s *Set) unregisterMetricLocked(nm *namedMetric) bool {
 	// cleanup registry from per-quantile metrics
 	for _, q := range sm.quantiles {
 		quantileValueName := addTag(name, fmt.Sprintf(`quantile="%g"`, q))
-		delete(s.m, quantileValueName)
+		s.m.delete(quantileValueName)
 		deleteFromList(quantileValueName)
 	}
 
@@ -529,6 +1012,105 @@ func (s *Set) unregisterMetricLocked(nm *namedMetric) bool {
 	return true
 }
 
+// RenameMetric renames metric with oldName to newName in s.
+//
+// The metric object and its value are preserved, so the metric can be renamed without losing its state,
+// e.g. when migrating to another naming scheme. Summary quantiles are renamed together with the summary.
+//
+// newName must be valid Prometheus-compatible metric with possible labels.
+// An error is returned if s doesn't contain metric with oldName or if it already contains metric with newName.
+//
+// Metrics renamed in metric vectors such as GaugeVec or HistogramVec are no longer returned from the vectors.
+func (s *Set) RenameMetric(oldName, newName string) error {
+	if err := validateMetric(newName); err != nil {
+		return fmt.Errorf("invalid metric name %q: %w", newName, err)
+	}
+
+	s.mu.Lock()
+	nm := s.m.get(oldName)
+	if nm == nil || nm.isAux {
+		s.mu.Unlock()
+		return fmt.Errorf("cannot find metric %q", oldName)
+	}
+	renames := map[string]string{
+		oldName: newName,
+	}
+	if sm, ok := nm.metric.(*Summary); ok {
+		for _, q := range sm.quantiles {
+			tag := fmt.Sprintf(`quantile="%g"`, q)
+			renames[addTag(oldName, tag)] = addTag(newName, tag)
+		}
+	}
+	for _, name := range renames {
+		if s.m.get(name) != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("metric %q is already registered", name)
+		}
+	}
+	for i, nmOld := range s.a {
+		name, ok := renames[nmOld.name]
+		if !ok {
+			continue
+		}
+		// Create new namedMetric instead of updating nmOld.name, since nmOld.name
+		// may be read without the lock by concurrently running WritePrometheus.
+		nmNew := &namedMetric{
+			created:    atomic.LoadInt64(&nmOld.created),
+			name:       name,
+			metric:     nmOld.metric,
+			isAux:      nmOld.isAux,
+			sortKey:    getMetricSortKey(name, nmOld.isAux),
+			expirable:  nmOld.expirable,
+			lastAccess: nmOld.lastAccess,
+		}
+		s.m.delete(nmOld.name)
+		s.m.add(nmNew)
+		s.a[i] = nmNew
+	}
+	vecs := s.vecs[getMetricFamily(oldName)]
+	s.mu.Unlock()
+
+	for _, mv := range vecs {
+		mv.forgetMetric(oldName, nm.metric)
+	}
+	s.notifyUnregister(oldName)
+	s.notifyRegister(newName)
+	return nil
+}
+
+// ResetAll resets counters, histograms and summaries registered in s and in its child sets.
+//
+// Gauges and other metrics, which reflect the current state, aren't changed.
+// Metrics are reset under s lock, so new metrics cannot be registered in s while ResetAll is in progress.
+//
+// This is useful for test harnesses and for batch jobs, which reuse the process between runs.
+func (s *Set) ResetAll() {
+	s.mu.Lock()
+	for _, nm := range s.a {
+		switch t := nm.metric.(type) {
+		case *Counter:
+			t.Set(0)
+		case *FloatCounter:
+			t.Set(0)
+		case *Histogram:
+			t.Reset()
+		case *NativeHistogram:
+			t.Reset()
+		case *Summary:
+			t.Reset()
+		default:
+			continue
+		}
+		nm.resetCreated()
+	}
+	children := append([]*Set(nil), s.children...)
+	s.mu.Unlock()
+
+	for _, child := range children {
+		child.ResetAll()
+	}
+}
+
 // UnregisterAllMetrics de-registers all metrics registered in s.
 //
 // It also de-registers writeMetrics callbacks passed to RegisterMetricsWriter.
@@ -547,22 +1129,19 @@ func (s *Set) UnregisterAllMetrics() {
 //
 // The returned list doesn't include metrics generated by metricsWriter passed to RegisterMetricsWriter.
 func (s *Set) ListMetricNames() []string {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	metricNames := make([]string, 0, len(s.m))
-	for _, nm := range s.m {
-		if nm.isAux {
-			continue
+	metricNames := []string{}
+	s.m.forEach(func(nm *namedMetric) {
+		if !nm.isAux {
+			metricNames = append(metricNames, nm.name)
 		}
-		metricNames = append(metricNames, nm.name)
-	}
+	})
 	sort.Strings(metricNames)
 	return metricNames
 }
 
 // RegisterMetricsWriter registers writeMetrics callback for including metrics in the output generated by s.WritePrometheus.
 //
-// The writeMetrics callback must write metrics to w in Prometheus text exposition format without timestamps and trailing comments.
+// The writeMetrics callback must write metrics to w in Prometheus text exposition format without trailing comments.
 // The last line generated by writeMetrics must end with \n.
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md#text-based-format
 //
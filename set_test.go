@@ -1,7 +1,11 @@
 package metrics
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -111,8 +115,8 @@ func TestSetUnregisterMetric(t *testing.T) {
 	}
 
 	// verify that registry is empty
-	if len(s.m) != 0 {
-		t.Fatalf("expected metrics map to be empty; got %d elements", len(s.m))
+	if s.m.len() != 0 {
+		t.Fatalf("expected metrics map to be empty; got %d elements", s.m.len())
 	}
 	if len(s.a) != 0 {
 		t.Fatalf("expected metrics list to be empty; got %d elements", len(s.a))
@@ -171,3 +175,253 @@ func TestRegisterUnregister(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestSetNewChildSet(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("requests_total").Add(1)
+
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewCounter("requests_total").Add(2)
+	child.NewCounter(`errors_total{code="500"}`).Add(3)
+	child.RegisterMetricsWriter(func(w io.Writer) {
+		WriteGaugeUint64(w, "writer_gauge", 4)
+	})
+
+	grandChild := child.NewChildSet(`module="bar"`)
+	grandChild.NewGauge("queue_size", func() float64 { return 5 })
+
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	result := bb.String()
+	resultExpected := `requests_total 1
+errors_total{tenant="foo",code="500"} 3
+requests_total{tenant="foo"} 2
+writer_gauge{tenant="foo"} 4
+queue_size{tenant="foo",module="bar"} 5
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	expectPanic(t, "NewChildSet(invalid labels)", func() { s.NewChildSet(`foo`) })
+}
+
+func TestSetSetCommonLabels(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("requests_total").Add(1)
+	s.NewCounter(`errors_total{code="500"}`).Add(2)
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewCounter("requests_total").Add(3)
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	s.SetCommonLabels(`instance="host1",env="prod"`)
+	f(`errors_total{instance="host1",env="prod",code="500"} 2
+requests_total{instance="host1",env="prod"} 1
+requests_total{instance="host1",env="prod",tenant="foo"} 3
+`)
+
+	s.SetCommonLabels("")
+	f(`errors_total{code="500"} 2
+requests_total 1
+requests_total{tenant="foo"} 3
+`)
+
+	expectPanic(t, "SetCommonLabels(invalid labels)", func() { s.SetCommonLabels(`foo="bar`) })
+}
+
+func TestSetWritePrometheusFiltered(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`critical_requests_total`).Add(1)
+	s.NewCounter(`debug_requests_total`).Add(2)
+	s.NewSummaryExt(`critical_duration_seconds{path="/foo"}`, defaultSummaryWindow, []float64{0.5}).Update(3)
+	s.NewSummaryExt(`debug_duration_seconds`, defaultSummaryWindow, []float64{0.5}).Update(4)
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewCounter(`critical_errors_total`).Add(5)
+	child.NewCounter(`debug_errors_total`).Add(6)
+
+	var bb bytes.Buffer
+	s.WritePrometheusFiltered(&bb, func(name string) bool {
+		return strings.HasPrefix(name, "critical_")
+	})
+	result := bb.String()
+	resultExpected := `critical_duration_seconds_sum{path="/foo"} 3
+critical_duration_seconds_count{path="/foo"} 1
+critical_duration_seconds{path="/foo",quantile="0.5"} 3
+critical_requests_total 1
+critical_errors_total{tenant="foo"} 5
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	expectPanic(t, "WritePrometheusFiltered(nil)", func() { s.WritePrometheusFiltered(&bb, nil) })
+}
+
+func TestSetResetAll(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("requests_total").Add(1)
+	s.NewFloatCounter("bytes_total").Add(1.5)
+	s.NewGauge("temperature", nil).Set(20)
+	s.NewHistogram("response_size").Update(10)
+	s.NewSummaryExt("duration_seconds", defaultSummaryWindow, []float64{0.5}).Update(2)
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewCounter("errors_total").Add(3)
+
+	s.ResetAll()
+
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	result := bb.String()
+	resultExpected := `bytes_total 0
+requests_total 0
+temperature 20
+errors_total{tenant="foo"} 0
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestSetRenameMetric(t *testing.T) {
+	s := NewSet()
+	c := s.NewCounter(`requests{path="/foo"}`)
+	c.Add(5)
+	s.NewCounter("errors_total").Add(1)
+	s.NewSummaryExt("duration", defaultSummaryWindow, []float64{0.5}).Update(2)
+
+	if err := s.RenameMetric(`requests{path="/foo"}`, `requests_total{path="/foo"}`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.RenameMetric("duration", "duration_seconds"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c.Inc()
+
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	result := bb.String()
+	resultExpected := `duration_seconds_sum 2
+duration_seconds_count 1
+duration_seconds{quantile="0.5"} 2
+errors_total 1
+requests_total{path="/foo"} 6
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+	if !s.UnregisterMetric("duration_seconds") {
+		t.Fatalf("cannot unregister renamed summary")
+	}
+
+	f := func(oldName, newName string) {
+		t.Helper()
+		if err := s.RenameMetric(oldName, newName); err == nil {
+			t.Fatalf("expecting non-nil error when renaming %q to %q", oldName, newName)
+		}
+	}
+	f("missing", "foo")
+	f("errors_total", `requests_total{path="/foo"}`)
+	f("errors_total", "invalid{")
+}
+
+func TestSetWritePrometheusUTF8Names(t *testing.T) {
+	s := NewSet()
+	s.NewCounter(`{"my.requests","label.name"="x"}`).Add(1)
+	s.NewCounter(`{"legacy_name"}`).Add(2)
+	s.NewHistogram(`{"my.size"}`).Update(1)
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewGauge(`{"my.temperature"}`, nil).Set(4)
+
+	ExposeMetadata(true)
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	ExposeMetadata(false)
+	result := bb.String()
+	resultExpected := `# HELP legacy_name
+# TYPE legacy_name counter
+legacy_name 2
+# HELP "my.requests"
+# TYPE "my.requests" counter
+{"my.requests","label.name"="x"} 1
+# HELP "my.size"
+# TYPE "my.size" histogram
+{"my.size_bucket",vmrange="8.799e-01...1.000e+00"} 1
+{"my.size_sum"} 1
+{"my.size_count"} 1
+# HELP "my.temperature"
+# TYPE "my.temperature" gauge
+{"my.temperature",tenant="foo"} 4
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Verify that quoted names are unquoted in parsed samples.
+	var families []string
+	s.Visit(func(_ string, value MetricValue) {
+		families = append(families, value.Family)
+	})
+	familiesExpected := []string{"legacy_name", "my.requests", "my.size", "my.temperature"}
+	if !reflect.DeepEqual(families, familiesExpected) {
+		t.Fatalf("unexpected families;\ngot\n%q\nwant\n%q", families, familiesExpected)
+	}
+	if _, ok := s.GetCounterValue(`{"my.requests","label.name"="x"}`); !ok {
+		t.Fatalf("cannot find counter with quoted name")
+	}
+
+	// summary
+	s = NewSet()
+	s.NewSummaryExt(`{"my.duration"}`, defaultSummaryWindow, []float64{0.5}).Update(3)
+	bb.Reset()
+	s.WritePrometheus(&bb)
+	result = bb.String()
+	resultExpected = `{"my.duration_sum"} 3
+{"my.duration_count"} 1
+{"my.duration",quantile="0.5"} 3
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestSetWritePrometheusGroupsFamilies(t *testing.T) {
+	s := NewSet()
+	s.NewGauge(`used_bytes{type="heap"}`, nil).Set(1)
+	s.NewGauge(`used_bytes_limit`, nil).Set(2)
+	s.NewGauge(`used_bytes`, nil).Set(3)
+	s.NewSummaryExt(`duration_seconds{path="/foo"}`, defaultSummaryWindow, []float64{0.5}).Update(4)
+	s.NewSummaryExt(`duration_seconds{path="/bar"}`, defaultSummaryWindow, []float64{0.5}).Update(5)
+
+	var bb bytes.Buffer
+	s.WritePrometheusWithOptions(&bb, &WriteOptions{
+		ExposeMetadata: true,
+	})
+	result := bb.String()
+	resultExpected := `# HELP duration_seconds
+# TYPE duration_seconds summary
+duration_seconds_sum{path="/bar"} 5
+duration_seconds_count{path="/bar"} 1
+duration_seconds{path="/bar",quantile="0.5"} 5
+duration_seconds_sum{path="/foo"} 4
+duration_seconds_count{path="/foo"} 1
+duration_seconds{path="/foo",quantile="0.5"} 4
+# HELP used_bytes
+# TYPE used_bytes gauge
+used_bytes 3
+used_bytes{type="heap"} 1
+# HELP used_bytes_limit
+# TYPE used_bytes_limit gauge
+used_bytes_limit 2
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
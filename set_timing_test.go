@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func BenchmarkSetGetOrCreateCounter(b *testing.B) {
+	s := NewSet()
+	const namesCount = 10000
+	names := make([]string, namesCount)
+	for i := range names {
+		names[i] = fmt.Sprintf(`BenchmarkSetGetOrCreateCounter{path="/foo/%d"}`, i)
+		s.GetOrCreateCounter(names[i])
+	}
+	var workerID uint32
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddUint32(&workerID, 1)) * 997
+		for pb.Next() {
+			s.GetOrCreateCounter(names[i%namesCount]).Inc()
+			i++
+		}
+	})
+}
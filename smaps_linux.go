@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultSmapsRefreshInterval is the default interval for updating metrics obtained from /proc/self/smaps_rollup.
+const defaultSmapsRefreshInterval = time.Minute
+
+var procSelfSmapsCache = &smapsCache{
+	path: "/proc/self/smaps_rollup",
+}
+
+func writeSmapsMetrics(w io.Writer, refreshInterval time.Duration) {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultSmapsRefreshInterval
+	}
+	ss := procSelfSmapsCache.get(refreshInterval)
+	if ss == nil {
+		return
+	}
+	WriteGaugeUint64(w, "process_anon_rss_bytes", ss.anonymous)
+	WriteGaugeUint64(w, "process_pagecache_rss_bytes", ss.rss-ss.anonymous)
+	WriteGaugeUint64(w, "process_hugepages_anon_bytes", ss.anonHugePages)
+	WriteGaugeUint64(w, "process_hugepages_shmem_bytes", ss.shmemPmdMapped)
+	WriteGaugeUint64(w, "process_hugepages_file_bytes", ss.filePmdMapped)
+	WriteGaugeUint64(w, "process_hugetlb_bytes", ss.sharedHugetlb+ss.privateHugetlb)
+}
+
+// smapsCache caches smapsStats, since reading smaps_rollup is expensive for processes with big number of memory mappings.
+type smapsCache struct {
+	path string
+
+	// errLogged is set to 1 after the first error is logged.
+	errLogged uint32
+
+	mu             sync.Mutex
+	ss             *smapsStats
+	lastUpdateTime time.Time
+	isUpdating     bool
+}
+
+// get returns cached stats.
+//
+// Stats are read synchronously on the first call. After that they are updated in background if they are older than refreshInterval,
+// so get doesn't block on reading smaps_rollup.
+//
+// nil is returned if stats couldn't be read.
+func (sc *smapsCache) get(refreshInterval time.Duration) *smapsStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.lastUpdateTime.IsZero() {
+		sc.updateLocked()
+		return sc.ss
+	}
+	if !sc.isUpdating && since(sc.lastUpdateTime) >= refreshInterval {
+		sc.isUpdating = true
+		go func() {
+			sc.mu.Lock()
+			sc.updateLocked()
+			sc.isUpdating = false
+			sc.mu.Unlock()
+		}()
+	}
+	return sc.ss
+}
+
+func (sc *smapsCache) updateLocked() {
+	sc.lastUpdateTime = now()
+	ss, err := getSmapsStats(sc.path)
+	if err != nil {
+		// Do not spam the logs with errors - this error cannot be fixed without process restart.
+		if atomic.CompareAndSwapUint32(&sc.errLogged, 0, 1) {
+			log.Printf("ERROR: metrics: cannot read smaps metrics from %q, so these metrics won't be updated until the error is fixed: %s", sc.path, err)
+		}
+		sc.ss = nil
+		return
+	}
+	sc.ss = ss
+}
+
+// smapsStats contains memory stats from smaps_rollup in bytes.
+//
+// See https://docs.kernel.org/filesystems/proc.html
+type smapsStats struct {
+	rss       uint64
+	anonymous uint64
+
+	// Memory backed by transparent huge pages.
+	anonHugePages  uint64
+	shmemPmdMapped uint64
+	filePmdMapped  uint64
+
+	// Memory backed by hugetlbfs pages. It isn't accounted in rss.
+	sharedHugetlb  uint64
+	privateHugetlb uint64
+}
+
+func getSmapsStats(path string) (*smapsStats, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ss smapsStats
+	lines := strings.Split(string(data), "\n")
+	for _, s := range lines {
+		if !strings.HasSuffix(s, " kB") {
+			// Skip the header line with the address range.
+			continue
+		}
+		line := strings.Fields(s)
+		if len(line) != 3 {
+			return nil, fmt.Errorf("unexpected number of fields found in %q; got %d; want %d", s, len(line), 3)
+		}
+		value, err := strconv.ParseUint(line[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse number from %q: %w", s, err)
+		}
+		value *= 1024
+		switch line[0] {
+		case "Rss:":
+			ss.rss = value
+		case "Anonymous:":
+			ss.anonymous = value
+		case "AnonHugePages:":
+			ss.anonHugePages = value
+		case "ShmemPmdMapped:":
+			ss.shmemPmdMapped = value
+		case "FilePmdMapped:":
+			ss.filePmdMapped = value
+		case "Shared_Hugetlb:":
+			ss.sharedHugetlb = value
+		case "Private_Hugetlb:":
+			ss.privateHugetlb = value
+		}
+	}
+	if ss.rss < ss.anonymous {
+		return nil, fmt.Errorf("Rss cannot be smaller than Anonymous in %q", data)
+	}
+	return &ss, nil
+}
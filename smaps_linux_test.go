@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetSmapsStats(t *testing.T) {
+	f := func(want *smapsStats, path string, wantErr bool) {
+		t.Helper()
+		got, err := getSmapsStats(path)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result: %+v, want: %+v at getSmapsStats", got, want)
+		}
+	}
+	f(&smapsStats{
+		rss:            8120 * 1024,
+		anonymous:      2196 * 1024,
+		anonHugePages:  2048 * 1024,
+		shmemPmdMapped: 4096 * 1024,
+		sharedHugetlb:  2048 * 1024,
+		privateHugetlb: 8192 * 1024,
+	}, "testdata/smaps_rollup", false)
+	f(nil, "testdata/smaps_rollup_bad", true)
+	f(nil, "testdata/bad_path", true)
+}
+
+func TestSmapsCache(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	path := filepath.Join(t.TempDir(), "smaps_rollup")
+	writeSmaps := func(rss, anonymous int) {
+		t.Helper()
+		data := fmt.Sprintf("Rss: %d kB\nAnonymous: %d kB\n", rss, anonymous)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("cannot write %q: %s", path, err)
+		}
+	}
+	sc := &smapsCache{
+		path: path,
+	}
+	f := func(want *smapsStats) {
+		t.Helper()
+		if got := sc.get(time.Minute); !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result: %+v, want: %+v", got, want)
+		}
+	}
+	waitForUpdate := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			sc.mu.Lock()
+			isUpdating := sc.isUpdating
+			sc.mu.Unlock()
+			if !isUpdating {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout while waiting for smaps update")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The first call reads stats synchronously
+	writeSmaps(10, 4)
+	f(&smapsStats{rss: 10 * 1024, anonymous: 4 * 1024})
+
+	// Stats aren't updated until the refresh interval passes
+	writeSmaps(20, 8)
+	fc.Advance(30 * time.Second)
+	f(&smapsStats{rss: 10 * 1024, anonymous: 4 * 1024})
+
+	// Stale stats are returned while the update is in progress
+	fc.Advance(30 * time.Second)
+	f(&smapsStats{rss: 10 * 1024, anonymous: 4 * 1024})
+	waitForUpdate()
+	f(&smapsStats{rss: 20 * 1024, anonymous: 8 * 1024})
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"encoding/binary"
+)
+
+// appendSnappyBlock appends src compressed in snappy block format to dst and returns the result.
+//
+// This is a simple greedy encoder, which is good enough for compressing metrics sent via Prometheus remote_write protocol.
+// It doesn't depend on external packages.
+//
+// See https://github.com/google/snappy/blob/main/format_description.txt
+func appendSnappyBlock(dst, src []byte) []byte {
+	dst = appendUvarint(dst, uint64(len(src)))
+
+	const tableBits = 14
+	var table [1 << tableBits]int32
+	hash := func(u uint32) uint32 {
+		return (u * 0x1e35a7bd) >> (32 - tableBits)
+	}
+
+	litStart := 0
+	i := 0
+	for i+4 <= len(src) {
+		u := binary.LittleEndian.Uint32(src[i:])
+		h := hash(u)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || i-candidate > snappyMaxOffset || binary.LittleEndian.Uint32(src[candidate:]) != u {
+			i++
+			continue
+		}
+		n := 4
+		for i+n < len(src) && src[candidate+n] == src[i+n] {
+			n++
+		}
+		dst = appendSnappyLiteral(dst, src[litStart:i])
+		dst = appendSnappyCopy(dst, i-candidate, n)
+		i += n
+		litStart = i
+	}
+	return appendSnappyLiteral(dst, src[litStart:])
+}
+
+// snappyMaxOffset is the maximum offset, which can be encoded in snappy copy element with 2-byte offset.
+const snappyMaxOffset = 1<<16 - 1
+
+func appendSnappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n<<2))
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// appendSnappyCopy appends copy elements with 2-byte offset for copying n bytes at the given offset to dst.
+func appendSnappyCopy(dst []byte, offset, n int) []byte {
+	for n > 0 {
+		length := n
+		if length > 64 {
+			length = 64
+		}
+		dst = append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+		n -= length
+	}
+	return dst
+}
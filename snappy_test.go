@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAppendSnappyBlock(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		compressed := appendSnappyBlock(nil, []byte(s))
+		result, err := decodeSnappyBlock(compressed)
+		if err != nil {
+			t.Fatalf("cannot decode compressed data: %s", err)
+		}
+		if string(result) != s {
+			t.Fatalf("unexpected decoded data;\ngot\n%q\nwant\n%q", result, s)
+		}
+	}
+	f("")
+	f("a")
+	f("abcd")
+	f("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	f(strings.Repeat(`foo_bar{baz="aaa"} 123`+"\n", 1000))
+	f(strings.Repeat("x", 70000) + "abc" + strings.Repeat("0123456789", 10000))
+
+	// Verify that repeated data is compressed.
+	data := []byte(strings.Repeat("foobar", 1000))
+	if n := len(appendSnappyBlock(nil, data)); n >= len(data)/10 {
+		t.Fatalf("too big compressed size for repeated data: %d bytes", n)
+	}
+}
+
+// decodeSnappyBlock decodes data in snappy block format.
+func decodeSnappyBlock(src []byte) ([]byte, error) {
+	n, nSize := binary.Uvarint(src)
+	if nSize <= 0 {
+		return nil, fmt.Errorf("cannot read decoded length")
+	}
+	src = src[nSize:]
+	var dst []byte
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0:
+			length := int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				lenBytes := length - 59
+				if len(src) < lenBytes {
+					return nil, fmt.Errorf("too short literal length")
+				}
+				length = 0
+				for i := 0; i < lenBytes; i++ {
+					length |= int(src[i]) << (8 * i)
+				}
+				src = src[lenBytes:]
+			}
+			length++
+			if len(src) < length {
+				return nil, fmt.Errorf("too short literal")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+		case 2:
+			if len(src) < 3 {
+				return nil, fmt.Errorf("too short copy")
+			}
+			length := int(tag>>2) + 1
+			offset := int(src[1]) | int(src[2])<<8
+			src = src[3:]
+			if offset <= 0 || offset > len(dst) {
+				return nil, fmt.Errorf("invalid offset %d", offset)
+			}
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		default:
+			return nil, fmt.Errorf("unsupported tag %d", tag&3)
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, fmt.Errorf("unexpected decoded length; got %d; want %d", len(dst), n)
+	}
+	return dst, nil
+}
+
@@ -0,0 +1,221 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"sync/atomic"
+
+	"github.com/valyala/histogram"
+)
+
+// Snapshot returns a new Set with copies of all the metrics registered in s.
+//
+// The returned Set contains point-in-time values of the metrics, which aren't changed by subsequent updates
+// of the metrics in s. This is useful for capturing a consistent view for diffing, testing or delta calculation.
+//
+// Gauges with callbacks are copied as gauges without callbacks holding the value returned by the callback.
+// Summary quantiles are frozen at the snapshot time. Output of metrics writers and write callbacks
+// is captured at the snapshot time.
+//
+// Child sets are copied recursively.
+//
+// The returned Set isn't registered for export. Pass it to RegisterSet if it must be exported via WritePrometheus.
+func (s *Set) Snapshot() *Set {
+	sa, metricsWriters := s.getSortedMetrics()
+
+	dst := NewSet()
+	summaries := make(map[*Summary]*Summary)
+	getSummarySnapshot := func(sm *Summary) *Summary {
+		smCopy := summaries[sm]
+		if smCopy == nil {
+			smCopy = snapshotSummary(sm)
+			summaries[sm] = smCopy
+		}
+		return smCopy
+	}
+	for _, nm := range sa {
+		var m metric
+		switch t := nm.metric.(type) {
+		case *Summary:
+			m = getSummarySnapshot(t)
+		case *quantileValue:
+			m = &quantileValue{
+				sm:  getSummarySnapshot(t.sm),
+				idx: t.idx,
+			}
+		default:
+			m = snapshotMetric(nm.name, nm.metric)
+		}
+		dst.mustRegisterLocked(nm.name, m, nm.isAux)
+	}
+
+	if len(metricsWriters) > 0 {
+		var bb bytes.Buffer
+		for _, writeMetrics := range metricsWriters {
+			writeMetrics(&bb)
+		}
+		dst.metricsWriters = append(dst.metricsWriters, newStaticWriter(bb.Bytes()))
+	}
+
+	dst.labels = s.labels
+	dst.commonLabels = s.getCommonLabels()
+	for _, child := range s.getChildren() {
+		dst.children = append(dst.children, child.Snapshot())
+	}
+	return dst
+}
+
+// snapshotMetric returns a copy of m with the given name.
+func snapshotMetric(name string, m metric) metric {
+	switch t := m.(type) {
+	case *Counter:
+		return &Counter{
+			n: t.Get(),
+		}
+	case *FloatCounter:
+		return &FloatCounter{
+			n: t.Get(),
+		}
+	case *Gauge:
+		return &Gauge{
+			valueBits: math.Float64bits(t.Get()),
+		}
+	case *Int64Gauge:
+		return &Int64Gauge{
+			n: t.Get(),
+		}
+	case *Uint64Gauge:
+		return &Uint64Gauge{
+			n: t.Get(),
+		}
+	case *BoolGauge:
+		return &BoolGauge{
+			n: atomic.LoadUint32(&t.n),
+		}
+	case *MaxGauge:
+		t.mu.Lock()
+		mg := &MaxGauge{
+			max:      t.max,
+			hasValue: t.hasValue,
+		}
+		t.mu.Unlock()
+		return mg
+	case *MinGauge:
+		t.mu.Lock()
+		mg := &MinGauge{
+			min:      t.min,
+			hasValue: t.hasValue,
+		}
+		t.mu.Unlock()
+		return mg
+	case *Histogram:
+		t.mu.Lock()
+		h := &Histogram{
+			lower:                     t.lower,
+			upper:                     t.upper,
+			sum:                       t.sum,
+			exportedBucketsPerDecimal: t.exportedBucketsPerDecimal,
+		}
+		for i, db := range t.decimalBuckets[:] {
+			if db != nil {
+				dbCopy := *db
+				h.decimalBuckets[i] = &dbCopy
+			}
+		}
+		t.mu.Unlock()
+		return h
+	case *NativeHistogram:
+		t.mu.Lock()
+		t.initLocked()
+		nh := &NativeHistogram{
+			schema:        t.schema,
+			isInitialized: true,
+			positive:      copyNativeHistogramBuckets(t.positive),
+			negative:      copyNativeHistogramBuckets(t.negative),
+			zeroCount:     t.zeroCount,
+			count:         t.count,
+			sum:           t.sum,
+		}
+		t.mu.Unlock()
+		return nh
+	case *Rate:
+		t.mu.Lock()
+		r := &Rate{
+			window:         t.window,
+			bucketDuration: t.bucketDuration,
+			counts:         t.counts,
+			currBucket:     t.currBucket,
+			startTime:      t.startTime,
+		}
+		t.mu.Unlock()
+		return r
+	case *Info:
+		// infoLabels are immutable, so they can be shared.
+		var i Info
+		i.v.Store(t.v.Load())
+		return &i
+	case *StateSet:
+		// states are immutable, so they can be shared.
+		return &StateSet{
+			states: t.states,
+			idx:    atomic.LoadUint32(&t.idx),
+		}
+	default:
+		// Capture the marshaled representation for the rest of metrics such as write callbacks.
+		var bb bytes.Buffer
+		m.marshalTo(name, &bb)
+		return &writeCallback{
+			metricTypeStr: m.metricType(),
+			writeMetrics:  newStaticWriter(bb.Bytes()),
+		}
+	}
+}
+
+// snapshotSamples is the number of samples used for approximating Summary window in snapshots.
+const snapshotSamples = 1000
+
+// snapshotSummary returns a copy of sm with frozen quantile values.
+//
+// histogram.Fast used by Summary cannot be copied, so the returned Summary window is approximated
+// by evenly spaced quantiles of sm window.
+func snapshotSummary(sm *Summary) *Summary {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	smCopy := &Summary{
+		curr:           histogram.NewFast(),
+		next:           histogram.NewFast(),
+		quantiles:      sm.quantiles,
+		quantileValues: append([]float64{}, sm.quantileValues...),
+		sum:            sm.sum,
+		count:          sm.count,
+		window:         sm.window,
+	}
+	phis := make([]float64, snapshotSamples)
+	for i := range phis {
+		phis[i] = float64(i) / (snapshotSamples - 1)
+	}
+	for _, v := range sm.curr.Quantiles(nil, phis) {
+		if !math.IsNaN(v) {
+			smCopy.curr.Update(v)
+		}
+	}
+	return smCopy
+}
+
+func copyNativeHistogramBuckets(src map[int]uint64) map[int]uint64 {
+	dst := make(map[int]uint64, len(src))
+	for idx, count := range src {
+		dst[idx] = count
+	}
+	return dst
+}
+
+// newStaticWriter returns a function, which writes a copy of data to w.
+func newStaticWriter(data []byte) func(w io.Writer) {
+	data = append([]byte{}, data...)
+	return func(w io.Writer) {
+		w.Write(data)
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSetSnapshot(t *testing.T) {
+	s := NewSet()
+	c := s.NewCounter("counter")
+	fc := s.NewFloatCounter("float_counter")
+	g := s.NewGauge("gauge", nil)
+	gValue := 10.0
+	s.NewGauge("callback_gauge", func() float64 { return gValue })
+	h := s.NewHistogram("histogram")
+	sm := s.NewSummaryExt("summary", defaultSummaryWindow, []float64{0.5, 1})
+	mg := s.NewMaxGauge("max_gauge")
+	ss := s.NewStateSet("state", []string{"ok", "failed"})
+	bg := s.NewBoolGauge("bool_gauge")
+	s.RegisterMetricsWriter(func(w io.Writer) {
+		WriteGaugeFloat64(w, "writer_gauge", gValue)
+	})
+
+	c.Set(5)
+	fc.Add(1.5)
+	g.Set(2)
+	h.Update(1)
+	sm.Update(3)
+	sm.Update(7)
+	mg.Update(4)
+	bg.True()
+
+	snapshot := s.Snapshot()
+
+	c.Inc()
+	fc.Add(1)
+	g.Set(3)
+	gValue = 20
+	h.Update(2)
+	sm.Update(100)
+	mg.Update(40)
+	ss.Set("failed")
+	bg.False()
+
+	var bb bytes.Buffer
+	snapshot.WritePrometheus(&bb)
+	result := bb.String()
+	resultExpected := `bool_gauge 1
+callback_gauge 10
+counter 5
+float_counter 1.5
+gauge 2
+histogram_bucket{vmrange="8.799e-01...1.000e+00"} 1
+histogram_sum 1
+histogram_count 1
+max_gauge 4
+state{state="ok"} 1
+state{state="failed"} 0
+summary_sum 10
+summary_count 2
+summary{quantile="0.5"} 7
+summary{quantile="1"} 7
+writer_gauge 10
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected snapshot;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+	if q := snapshot.GetOrCreateSummaryExt("summary", defaultSummaryWindow, []float64{0.5, 1}).Quantile(0); q != 3 {
+		t.Fatalf("unexpected min value for summary snapshot; got %v; want 3", q)
+	}
+}
@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSpoolMaxSize is the default limit on the size of push spool.
+const defaultSpoolMaxSize = 64 * 1024 * 1024
+
+// pushSpool is on-disk queue for push payloads, which couldn't be delivered.
+//
+// Payloads are stored in Prometheus text exposition format with sample timestamps,
+// so they are ingested with the original timestamps when replayed.
+type pushSpool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	// mu serializes access to files in dir.
+	mu  sync.Mutex
+	seq uint64
+
+	spooledTotal *Counter
+	droppedTotal *Counter
+}
+
+func newPushSpool(dir string, maxSize int64, maxAge time.Duration, selfMetricsSet *Set, pushURLRedacted string) (*pushSpool, error) {
+	if maxSize < 0 {
+		return nil, fmt.Errorf("SpoolMaxSize cannot be negative; got %d", maxSize)
+	}
+	if maxSize == 0 {
+		maxSize = defaultSpoolMaxSize
+	}
+	if maxAge < 0 {
+		return nil, fmt.Errorf("SpoolMaxAge cannot be negative; got %s", maxAge)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create SpoolDir=%q: %w", dir, err)
+	}
+	return &pushSpool{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+
+		spooledTotal: selfMetricsSet.GetOrCreateCounter(addLabel("metrics_push_spooled_total", "url", pushURLRedacted)),
+		droppedTotal: selfMetricsSet.GetOrCreateCounter(addLabel("metrics_push_spool_dropped_total", "url", pushURLRedacted)),
+	}, nil
+}
+
+// spoolFile is a file with a single push payload in pushSpool.
+type spoolFile struct {
+	name string
+	size int64
+
+	// timestamp is the time when the payload has been spooled.
+	timestamp time.Time
+}
+
+// add stores data in Prometheus text exposition format at ps.
+//
+// The current timestamp is added to samples without timestamps.
+func (ps *pushSpool) add(data []byte) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ts := now()
+	data = addTimestamps(nil, data, ts.UnixNano()/1e6)
+	ps.seq++
+	name := fmt.Sprintf("%020d-%08d.prom", ts.UnixNano(), ps.seq)
+	path := filepath.Join(ps.dir, name)
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		log.Printf("ERROR: metrics.push: cannot spool %d bytes: %s", len(data), err)
+		_ = os.Remove(tmpPath)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("ERROR: metrics.push: cannot spool %d bytes: %s", len(data), err)
+		_ = os.Remove(tmpPath)
+		return
+	}
+	ps.spooledTotal.Inc()
+	ps.enforceLimitsLocked()
+}
+
+// replay sends spooled payloads with send in the order they were added to ps.
+//
+// send must return the number of bytes at the beginning of data, which have been delivered.
+// Successfully sent payloads are removed from ps, while partially sent payloads are replaced with their undelivered parts.
+// It stops on the first error and returns it.
+func (ps *pushSpool) replay(ctx context.Context, send func(ctx context.Context, data []byte) (int, error)) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.enforceLimitsLocked()
+	for _, sf := range ps.listFilesLocked() {
+		path := filepath.Join(ps.dir, sf.name)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read spooled payload: %w", err)
+		}
+		n, err := send(ctx, data)
+		if n < len(data) {
+			if n > 0 {
+				ps.truncateLocked(path, data[n:])
+			}
+			if err != nil {
+				return err
+			}
+			// The payload may be not delivered because of canceled ctx, so keep it in the spool.
+			return ctx.Err()
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("cannot remove replayed payload: %w", err)
+		}
+	}
+	return nil
+}
+
+// truncateLocked replaces the spooled payload at path with its undelivered part data.
+//
+// The file name is preserved, so the payload keeps its position and age in ps.
+func (ps *pushSpool) truncateLocked(path string, data []byte) {
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		log.Printf("ERROR: metrics.push: cannot update partially replayed payload: %s", err)
+		_ = os.Remove(tmpPath)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("ERROR: metrics.push: cannot update partially replayed payload: %s", err)
+		_ = os.Remove(tmpPath)
+	}
+}
+
+// enforceLimitsLocked drops the oldest files from ps if they exceed ps.maxAge or ps.maxSize.
+func (ps *pushSpool) enforceLimitsLocked() {
+	files := ps.listFilesLocked()
+	totalSize := int64(0)
+	for _, sf := range files {
+		totalSize += sf.size
+	}
+	for _, sf := range files {
+		isTooOld := ps.maxAge > 0 && since(sf.timestamp) > ps.maxAge
+		if !isTooOld && totalSize <= ps.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(ps.dir, sf.name)); err != nil {
+			log.Printf("ERROR: metrics.push: cannot drop spooled payload: %s", err)
+			return
+		}
+		totalSize -= sf.size
+		ps.droppedTotal.Inc()
+	}
+}
+
+// listFilesLocked returns spooled files sorted by the time they were added to ps.
+func (ps *pushSpool) listFilesLocked() []spoolFile {
+	des, err := ioutil.ReadDir(ps.dir)
+	if err != nil {
+		log.Printf("ERROR: metrics.push: cannot read SpoolDir=%q: %s", ps.dir, err)
+		return nil
+	}
+	var files []spoolFile
+	for _, fi := range des {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(name, ".prom") {
+			continue
+		}
+		n := strings.IndexByte(name, '-')
+		if n < 0 {
+			continue
+		}
+		nsecs, err := strconv.ParseInt(name[:n], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{
+			name:      name,
+			size:      fi.Size(),
+			timestamp: time.Unix(0, nsecs),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	return files
+}
+
+// addTimestamps appends lines from src in Prometheus text exposition format to dst
+// with timestampMs added to samples without timestamps and returns the result.
+func addTimestamps(dst, src []byte, timestampMs int64) []byte {
+	visitLines(src, func(line []byte) {
+		dst = append(dst, line...)
+		if len(line) > 0 && line[0] != '#' {
+			if s, err := parseSample(string(line)); err == nil && !s.hasTimestamp {
+				dst = append(dst, ' ')
+				dst = strconv.AppendInt(dst, timestampMs, 10)
+			}
+		}
+		dst = append(dst, '\n')
+	})
+	return dst
+}
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddTimestamps(t *testing.T) {
+	f := func(src, resultExpected string) {
+		t.Helper()
+		result := addTimestamps(nil, []byte(src), 1700000000000)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f("", "")
+	f("foo 1\n", "foo 1 1700000000000\n")
+	f(`foo{bar="baz qux"} 1`+"\n", `foo{bar="baz qux"} 1 1700000000000`+"\n")
+
+	// Samples with timestamps and comments must be left as is.
+	f("# TYPE foo gauge\nfoo 1 123\nbar 2\n", "# TYPE foo gauge\nfoo 1 123\nbar 2 1700000000000\n")
+}
+
+func TestPushMetricsSpool(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	var mu sync.Mutex
+	isAvailable := false
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !isAvailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+	}))
+	defer srv.Close()
+	setAvailable := func(v bool) {
+		mu.Lock()
+		isAvailable = v
+		mu.Unlock()
+	}
+
+	s := NewSet()
+	c := s.NewCounter("foo_total")
+	opts := &PushOptions{
+		DisableCompression: true,
+		SpoolDir:           t.TempDir(),
+	}
+	push := func() error {
+		c.Inc()
+		return s.PushMetrics(context.Background(), srv.URL, opts)
+	}
+
+	// Failed pushes must be spooled.
+	if err := push(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	fc.Advance(time.Second)
+	if err := push(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	fc.Advance(time.Second)
+
+	// Spooled payloads must be pushed in order before the current payload.
+	setAvailable(true)
+	if err := push(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	bodiesExpected := []string{
+		"foo_total 1 1700000000000\n",
+		"foo_total 2 1700000001000\n",
+		"foo_total 3\n",
+	}
+	if !reflect.DeepEqual(bodies, bodiesExpected) {
+		t.Fatalf("unexpected bodies;\ngot\n%q\nwant\n%q", bodies, bodiesExpected)
+	}
+
+	// The spool must be empty after successful replay.
+	bodies = nil
+	if err := push(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(bodies, []string{"foo_total 4\n"}) {
+		t.Fatalf("unexpected bodies: %q", bodies)
+	}
+}
+
+func TestPushMetricsSpoolPartialDelivery(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	var mu sync.Mutex
+	failOn := ""
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		data, _ := io.ReadAll(r.Body)
+		if failOn != "" && strings.Contains(string(data), failOn) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bodies = append(bodies, string(data))
+	}))
+	defer srv.Close()
+
+	s := NewSet()
+	a := s.NewCounter("aaa_total")
+	b := s.NewCounter("bbb_total")
+	c := s.NewCounter("ccc_total")
+	opts := &PushOptions{
+		DisableCompression: true,
+		SpoolDir:           t.TempDir(),
+		MaxBlockSize:       12,
+	}
+	f := func(fail string, errExpected bool, bodiesExpected []string) {
+		t.Helper()
+		mu.Lock()
+		failOn = fail
+		bodies = nil
+		mu.Unlock()
+
+		a.Inc()
+		b.Inc()
+		c.Inc()
+		err := s.PushMetrics(context.Background(), srv.URL, opts)
+		if errExpected && err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !errExpected && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !reflect.DeepEqual(bodies, bodiesExpected) {
+			t.Fatalf("unexpected bodies;\ngot\n%q\nwant\n%q", bodies, bodiesExpected)
+		}
+		fc.Advance(time.Second)
+	}
+
+	// Only the undelivered blocks must be spooled.
+	f("ccc_total", true, []string{
+		"aaa_total 1\n",
+		"bbb_total 1\n",
+	})
+	f("bbb_total 2", true, []string{
+		"ccc_total 1 1700000000000\n",
+		"aaa_total 2\n",
+	})
+
+	// Blocks delivered during replay mustn't be replayed again.
+	f("ccc_total 2", true, []string{
+		"bbb_total 2 1700000001000\n",
+	})
+	f("", false, []string{
+		"ccc_total 2 1700000001000\n",
+		"aaa_total 3 1700000002000\n",
+		"bbb_total 3 1700000002000\n",
+		"ccc_total 3 1700000002000\n",
+		"aaa_total 4\n",
+		"bbb_total 4\n",
+		"ccc_total 4\n",
+	})
+}
+
+func TestPushSpoolLimits(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	getNames := func(ps *pushSpool) []string {
+		t.Helper()
+		var names []string
+		ps.replay(context.Background(), func(_ context.Context, data []byte) (int, error) {
+			names = append(names, string(data))
+			return len(data), nil
+		})
+		return names
+	}
+
+	// size limit
+	ps, err := newPushSpool(t.TempDir(), 40, 0, pushMetricsSet, "http://localhost")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ps.add([]byte("a 1\n"))
+	ps.add([]byte("b 1\n"))
+	ps.add([]byte("c 1\n"))
+	namesExpected := []string{"b 1 1700000000000\n", "c 1 1700000000000\n"}
+	if names := getNames(ps); !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected payloads; got %q; want %q", names, namesExpected)
+	}
+
+	// age limit
+	ps, err = newPushSpool(t.TempDir(), 0, time.Minute, pushMetricsSet, "http://localhost")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ps.add([]byte("a 1\n"))
+	fc.Advance(50 * time.Second)
+	ps.add([]byte("b 1\n"))
+	fc.Advance(20 * time.Second)
+	namesExpected = []string{"b 1 1700000050000\n"}
+	if names := getNames(ps); !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected payloads; got %q; want %q", names, namesExpected)
+	}
+
+	// invalid limits
+	if _, err := newPushSpool(t.TempDir(), -1, 0, pushMetricsSet, "http://localhost"); err == nil {
+		t.Fatalf("expecting non-nil error for negative size limit")
+	}
+	if _, err := newPushSpool(t.TempDir(), 0, -time.Second, pushMetricsSet, "http://localhost"); err == nil {
+		t.Fatalf("expecting non-nil error for negative age limit")
+	}
+}
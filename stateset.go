@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// NewStateSet registers and returns new StateSet with the given name and states.
+//
+// name must be valid Prometheus-compatible metric with possible labels.
+// For instance,
+//
+//   - foo
+//   - foo{bar="baz"}
+//   - foo{bar="baz",aaa="b"}
+//
+// states must contain at least one state. The first state is active after the StateSet creation.
+//
+// The returned StateSet is safe to use from concurrent goroutines.
+func NewStateSet(name string, states []string) *StateSet {
+	return defaultSet().NewStateSet(name, states)
+}
+
+// StateSet is a metric, where exactly one of the given states is active.
+//
+// StateSet is exposed as a series per each state with the label named after the metric.
+// The series for the active state has value 1, while the rest of series have value 0.
+// For example, the following series are exposed for NewStateSet("service_mode", []string{"ok", "degraded"}) after Set("degraded") call:
+//
+//	service_mode{service_mode="ok"} 0
+//	service_mode{service_mode="degraded"} 1
+type StateSet struct {
+	states []string
+
+	// idx is the index of the active state in states
+	idx uint32
+}
+
+func newStateSet(states []string) *StateSet {
+	if len(states) == 0 {
+		panic(fmt.Errorf("BUG: states cannot be empty"))
+	}
+	m := make(map[string]struct{}, len(states))
+	for _, state := range states {
+		if _, ok := m[state]; ok {
+			panic(fmt.Errorf("BUG: duplicate state %q", state))
+		}
+		m[state] = struct{}{}
+	}
+	return &StateSet{
+		// Make a copy of states in order to prevent from their modification by the caller.
+		states: append([]string{}, states...),
+	}
+}
+
+// Set makes the given state active in ss.
+//
+// The state must be one of states passed to NewStateSet.
+func (ss *StateSet) Set(state string) {
+	for i, s := range ss.states {
+		if s == state {
+			atomic.StoreUint32(&ss.idx, uint32(i))
+			return
+		}
+	}
+	panic(fmt.Errorf("BUG: unknown state %q; must be one of %q", state, ss.states))
+}
+
+// Get returns the active state for ss.
+func (ss *StateSet) Get() string {
+	idx := atomic.LoadUint32(&ss.idx)
+	return ss.states[idx]
+}
+
+func (ss *StateSet) marshalTo(prefix string, w io.Writer) {
+	idx := int(atomic.LoadUint32(&ss.idx))
+	labelName := getMetricFamily(prefix)
+	for i, state := range ss.states {
+		v := 0
+		if i == idx {
+			v = 1
+		}
+		metricName := addLabel(prefix, labelName, state)
+		fmt.Fprintf(w, "%s %d\n", metricName, v)
+	}
+}
+
+func (ss *StateSet) metricType() string {
+	return "gauge"
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestStateSet(t *testing.T) {
+	s := NewSet()
+	ss := s.NewStateSet("service_mode", []string{"ok", "degraded", "maintenance"})
+	if state := ss.Get(); state != "ok" {
+		t.Fatalf("unexpected initial state; got %q; want %q", state, "ok")
+	}
+	testMarshalTo(t, ss, "service_mode", `service_mode{service_mode="ok"} 1
+service_mode{service_mode="degraded"} 0
+service_mode{service_mode="maintenance"} 0
+`)
+
+	ss.Set("degraded")
+	if state := ss.Get(); state != "degraded" {
+		t.Fatalf("unexpected state; got %q; want %q", state, "degraded")
+	}
+	testMarshalTo(t, ss, `service_mode{job="foo"}`, `service_mode{job="foo",service_mode="ok"} 0
+service_mode{job="foo",service_mode="degraded"} 1
+service_mode{job="foo",service_mode="maintenance"} 0
+`)
+
+	// State names must be properly escaped.
+	ss = s.NewStateSet("escaped_mode", []string{`a"b`, "c\\d\ne"})
+	testMarshalTo(t, ss, "escaped_mode", `escaped_mode{escaped_mode="a\"b"} 1
+escaped_mode{escaped_mode="c\\d\ne"} 0
+`)
+
+	expectPanic(t, "Set_unknown_state", func() {
+		ss.Set("unknown")
+	})
+	expectPanic(t, "NewStateSet_empty_states", func() {
+		s.NewStateSet("foo", nil)
+	})
+	expectPanic(t, "NewStateSet_duplicate_states", func() {
+		s.NewStateSet("bar", []string{"a", "b", "a"})
+	})
+}
@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatsDOptions contains options for InitPushStatsD.
+type StatsDOptions struct {
+	// Prefix is an optional prefix for all the metric names, e.g. `myapp.`.
+	Prefix string
+
+	// DisableTags disables sending metric labels as DogStatsD tags.
+	//
+	// Label values are appended to metric names via `.` in this case, since plain StatsD doesn't support tags.
+	DisableTags bool
+
+	// MaxPacketSize is the maximum size of UDP packets to send.
+	//
+	// By default 1432 bytes are used, which fits a typical Ethernet MTU.
+	MaxPacketSize int
+
+	// Optional WaitGroup for waiting until the push worker created by InitPushStatsD is stopped.
+	WaitGroup *sync.WaitGroup
+}
+
+// InitPushStatsD sets up periodic export of metrics from s to the StatsD agent at addr with the given interval.
+//
+// addr must have the form `host:port`, e.g. `localhost:8125`. The metrics are sent over UDP.
+//
+// Counters, histogram buckets and sums/counts of histograms and summaries are sent as StatsD counters (`|c`)
+// containing the increase since the previous export. Gauges and summary quantiles are sent as StatsD gauges (`|g`).
+// Metric labels are sent as DogStatsD tags (`|#label:value`) unless opts.DisableTags is set.
+// Samples with NaN or Inf values are skipped.
+//
+// The periodic export is stopped when ctx is canceled.
+// It is possible to wait until the background worker is stopped on a WaitGroup passed via opts.WaitGroup.
+//
+// opts may contain additional configuration options if non-nil.
+//
+// See https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+// and https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+func (s *Set) InitPushStatsD(ctx context.Context, addr string, interval time.Duration, opts *StatsDOptions) error {
+	se, err := newStatsDExporter(s, addr, opts)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive; got %s", interval)
+	}
+	wg := se.opts.WaitGroup
+	if wg != nil {
+		wg.Add(1)
+	}
+	go func() {
+		tickerCh, stopTicker := getClock().NewTicker(interval)
+		defer stopTicker()
+		stopCh := ctx.Done()
+		for {
+			select {
+			case <-tickerCh:
+				if err := se.push(); err != nil {
+					log.Printf("ERROR: metrics.push: %s", err)
+				}
+			case <-stopCh:
+				if wg != nil {
+					wg.Done()
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+const defaultStatsDMaxPacketSize = 1432
+
+type statsdExporter struct {
+	s    *Set
+	addr string
+	opts StatsDOptions
+
+	// prevValues contains counter values sent during the previous export.
+	prevValues map[string]float64
+}
+
+func newStatsDExporter(s *Set, addr string, opts *StatsDOptions) (*statsdExporter, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid StatsD addr=%q: %w", addr, err)
+	}
+	se := &statsdExporter{
+		s:          s,
+		addr:       addr,
+		prevValues: make(map[string]float64),
+	}
+	if opts != nil {
+		se.opts = *opts
+	}
+	if se.opts.MaxPacketSize <= 0 {
+		se.opts.MaxPacketSize = defaultStatsDMaxPacketSize
+	}
+	return se, nil
+}
+
+// push sends metrics from se.s to se.addr.
+func (se *statsdExporter) push() error {
+	packets := se.marshalPackets()
+	if len(packets) == 0 {
+		return nil
+	}
+	conn, err := net.Dial("udp", se.addr)
+	if err != nil {
+		return fmt.Errorf("cannot connect to StatsD at %q: %w", se.addr, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	for _, packet := range packets {
+		if _, err := conn.Write(packet); err != nil {
+			return fmt.Errorf("cannot send %d bytes to StatsD at %q: %w", len(packet), se.addr, err)
+		}
+	}
+	return nil
+}
+
+// marshalPackets returns StatsD packets for the metrics from se.s.
+//
+// Every packet contains newline-delimited lines and doesn't exceed se.opts.MaxPacketSize unless it contains lines for a single sample.
+func (se *statsdExporter) marshalPackets() [][]byte {
+	var packets [][]byte
+	var packet, line []byte
+	seen := make(map[string]struct{}, len(se.prevValues))
+	se.s.Visit(func(_ string, value MetricValue) {
+		for i := range value.Samples {
+			sample := &value.Samples[i]
+			line = se.appendLine(line[:0], &value, sample, seen)
+			if len(line) == 0 {
+				continue
+			}
+			if len(packet) > 0 && len(packet)+1+len(line) > se.opts.MaxPacketSize {
+				packets = append(packets, packet)
+				packet = nil
+			}
+			if len(packet) > 0 {
+				packet = append(packet, '\n')
+			}
+			packet = append(packet, line...)
+		}
+	})
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+
+	// Forget counters, which are no longer exported.
+	for key := range se.prevValues {
+		if _, ok := seen[key]; !ok {
+			delete(se.prevValues, key)
+		}
+	}
+	return packets
+}
+
+// appendLine appends StatsD line for the given sample to dst.
+//
+// Nothing is appended if the sample cannot be represented in StatsD.
+func (se *statsdExporter) appendLine(dst []byte, mv *MetricValue, sample *Sample, seen map[string]struct{}) []byte {
+	v := sample.Value
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return dst
+	}
+	metricType := "g"
+	if isStatsDCounter(mv, sample) {
+		metricType = "c"
+		key := sample.Name
+		seen[key] = struct{}{}
+		prevValue := se.prevValues[key]
+		se.prevValues[key] = v
+		if v >= prevValue {
+			v -= prevValue
+		}
+	}
+
+	if metricType == "g" && v < 0 {
+		// StatsD treats gauge values with a leading sign as relative changes,
+		// so negative gauges must be reset to zero before sending the actual value.
+		// Both lines are kept together, so they are sent in the same packet.
+		dst = se.appendStatsDLine(dst, sample, 0, metricType)
+		dst = append(dst, '\n')
+	}
+	return se.appendStatsDLine(dst, sample, v, metricType)
+}
+
+// appendStatsDLine appends StatsD line with the given value v and metricType for the given sample to dst.
+func (se *statsdExporter) appendStatsDLine(dst []byte, sample *Sample, v float64, metricType string) []byte {
+	dst = append(dst, se.opts.Prefix...)
+	dst = appendStatsDSanitized(dst, getMetricFamily(sample.Name))
+	if se.opts.DisableTags {
+		for _, l := range sample.Labels {
+			dst = append(dst, '.')
+			dst = appendStatsDSanitized(dst, l.Value)
+		}
+	}
+	dst = append(dst, ':')
+	dst = strconv.AppendFloat(dst, v, 'g', -1, 64)
+	dst = append(dst, '|')
+	dst = append(dst, metricType...)
+	if !se.opts.DisableTags && len(sample.Labels) > 0 {
+		dst = append(dst, "|#"...)
+		for i, l := range sample.Labels {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendStatsDSanitized(dst, l.Name)
+			dst = append(dst, ':')
+			dst = appendStatsDSanitized(dst, l.Value)
+		}
+	}
+	return dst
+}
+
+// isStatsDCounter returns true if the given sample must be sent as StatsD counter.
+func isStatsDCounter(mv *MetricValue, sample *Sample) bool {
+	switch mv.Type {
+	case "counter", "histogram":
+		return true
+	case "summary":
+		// Quantiles are sent as gauges, while _sum and _count are sent as counters.
+		return getMetricFamily(sample.Name) != mv.Family
+	default:
+		return false
+	}
+}
+
+// appendStatsDSanitized appends s to dst, replacing chars with special meaning in StatsD protocol with `_`.
+func appendStatsDSanitized(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case ':', '|', '@', '#', ',', '\n':
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
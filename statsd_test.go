@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsDExporterMarshalPackets(t *testing.T) {
+	s := NewSet()
+	c := s.NewCounter(`requests_total{path="/foo",code="200"}`)
+	c.Add(10)
+	g := s.NewGauge("temperature", nil)
+	g.Set(20.5)
+	sm := s.NewSummaryExt("duration_seconds", defaultSummaryWindow, []float64{0.5})
+	sm.Update(2)
+
+	se, err := newStatsDExporter(s, "localhost:8125", &StatsDOptions{
+		Prefix: "app.",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var lines []string
+		for _, packet := range se.marshalPackets() {
+			lines = append(lines, string(packet))
+		}
+		if result := strings.Join(lines, "\n"); result != resultExpected {
+			t.Fatalf("unexpected packets;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(`app.duration_seconds:2|g|#quantile:0.5
+app.duration_seconds_sum:2|c
+app.duration_seconds_count:1|c
+app.requests_total:10|c|#path:/foo,code:200
+app.temperature:20.5|g`)
+
+	// Counters must contain increases since the previous export.
+	c.Add(5)
+	g.Set(21)
+	f(`app.duration_seconds:2|g|#quantile:0.5
+app.duration_seconds_sum:0|c
+app.duration_seconds_count:0|c
+app.requests_total:5|c|#path:/foo,code:200
+app.temperature:21|g`)
+
+	// Counter reset
+	c.Set(3)
+	se.opts.DisableTags = true
+	se.opts.MaxPacketSize = 1
+	f(`app.duration_seconds.0.5:2|g
+app.duration_seconds_sum:0|c
+app.duration_seconds_count:0|c
+app.requests_total./foo.200:3|c
+app.temperature:21|g`)
+
+	// Negative gauges must be reset to zero in the same packet before sending the actual value.
+	g.Set(-1.5)
+	f(`app.duration_seconds.0.5:2|g
+app.duration_seconds_sum:0|c
+app.duration_seconds_count:0|c
+app.requests_total./foo.200:0|c
+app.temperature:0|g
+app.temperature:-1.5|g`)
+	packets := se.marshalPackets()
+	if len(packets) != 5 {
+		t.Fatalf("unexpected number of packets; got %d; want 5", len(packets))
+	}
+	if packet := string(packets[4]); packet != "app.temperature:0|g\napp.temperature:-1.5|g" {
+		t.Fatalf("unexpected packet for negative gauge; got %q", packet)
+	}
+
+	if _, err := newStatsDExporter(s, "missing-port", nil); err == nil {
+		t.Fatalf("expecting non-nil error for invalid addr")
+	}
+}
+
+func TestSetInitPushStatsD(t *testing.T) {
+	fc := newFakeClock()
+	SetClock(fc)
+	defer SetClock(nil)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start UDP listener: %s", err)
+	}
+	defer conn.Close()
+
+	s := NewSet()
+	s.NewCounter(`requests_total{path="/foo"}`).Add(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.InitPushStatsD(ctx, conn.LocalAddr().String(), time.Second, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fc.waitForTickers(t, 1)
+	fc.Advance(time.Second)
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("cannot read StatsD packet: %s", err)
+	}
+	resultExpected := "requests_total:1|c|#path:/foo"
+	if result := string(buf[:n]); result != resultExpected {
+		t.Fatalf("unexpected packet;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	if err := s.InitPushStatsD(ctx, conn.LocalAddr().String(), 0, nil); err == nil {
+		t.Fatalf("expecting non-nil error for zero interval")
+	}
+}
@@ -29,6 +29,8 @@ type Summary struct {
 	count uint64
 
 	window time.Duration
+
+	accessTracker
 }
 
 // NewSummary creates and returns new summary with the given name.
@@ -42,7 +44,7 @@ type Summary struct {
 //
 // The returned summary is safe to use from concurrent goroutines.
 func NewSummary(name string) *Summary {
-	return defaultSet.NewSummary(name)
+	return defaultSet().NewSummary(name)
 }
 
 // NewSummaryExt creates and returns new summary with the given name,
@@ -57,7 +59,7 @@ func NewSummary(name string) *Summary {
 //
 // The returned summary is safe to use from concurrent goroutines.
 func NewSummaryExt(name string, window time.Duration, quantiles []float64) *Summary {
-	return defaultSet.NewSummaryExt(name, window, quantiles)
+	return defaultSet().NewSummaryExt(name, window, quantiles)
 }
 
 func newSummary(window time.Duration, quantiles []float64) *Summary {
@@ -84,6 +86,7 @@ func validateQuantiles(quantiles []float64) {
 
 // Update updates the summary.
 func (sm *Summary) Update(v float64) {
+	sm.markAccessed()
 	sm.mu.Lock()
 	sm.curr.Update(v)
 	sm.next.Update(v)
@@ -92,9 +95,80 @@ func (sm *Summary) Update(v float64) {
 	sm.mu.Unlock()
 }
 
+// UpdateWithWeight updates the summary with v, which is counted weight times.
+//
+// This is useful for batch processors, which record aggregated observations,
+// e.g. a single value representing 1000 identical events.
+//
+// sum and count are updated exactly, while quantiles are approximated: v is added to quantile calculations
+// at most 1000 times, so the call takes constant time for arbitrary big weight.
+// This means that quantiles may be skewed towards values with smaller weights if the summary
+// is updated with weights exceeding 1000.
+func (sm *Summary) UpdateWithWeight(v float64, weight uint64) {
+	sm.markAccessed()
+	if weight == 0 {
+		return
+	}
+	samples := weight
+	if samples > maxSummaryWeightSamples {
+		samples = maxSummaryWeightSamples
+	}
+	sm.mu.Lock()
+	for i := uint64(0); i < samples; i++ {
+		sm.curr.Update(v)
+		sm.next.Update(v)
+	}
+	sm.sum += v * float64(weight)
+	sm.count += weight
+	sm.mu.Unlock()
+}
+
+// maxSummaryWeightSamples is the maximum number of samples added to quantile calculations per UpdateWithWeight call.
+//
+// It matches the number of samples histogram.Fast keeps for quantile calculations,
+// so bigger number of samples cannot improve the precision of the calculated quantiles.
+const maxSummaryWeightSamples = 1000
+
+// Reset resets sm.
+//
+// It clears both the current and the next windows, the cached quantile values, sum and count.
+func (sm *Summary) Reset() {
+	sm.markAccessed()
+	sm.mu.Lock()
+	sm.curr.Reset()
+	sm.next.Reset()
+	for i := range sm.quantileValues {
+		sm.quantileValues[i] = math.NaN()
+	}
+	sm.sum = 0
+	sm.count = 0
+	sm.mu.Unlock()
+}
+
+// Quantile returns the value for the given quantile phi over the summary window.
+//
+// phi must be in the range [0..1]. NaN is returned if the summary has no values in the current window.
+func (sm *Summary) Quantile(phi float64) float64 {
+	validateQuantiles([]float64{phi})
+	sm.mu.Lock()
+	v := sm.curr.Quantile(phi)
+	sm.mu.Unlock()
+	return v
+}
+
+// Quantiles returns values for the quantiles sm has been created with, in the same order.
+//
+// NaN values are returned if the summary has no values in the current window.
+func (sm *Summary) Quantiles() []float64 {
+	sm.mu.Lock()
+	values := sm.curr.Quantiles(nil, sm.quantiles)
+	sm.mu.Unlock()
+	return values
+}
+
 // UpdateDuration updates request duration based on the given startTime.
 func (sm *Summary) UpdateDuration(startTime time.Time) {
-	d := time.Since(startTime).Seconds()
+	d := since(startTime).Seconds()
 	sm.Update(d)
 }
 
@@ -123,7 +197,52 @@ func (sm *Summary) metricType() string {
 	return "summary"
 }
 
+func (sm *Summary) protobufType() uint64 {
+	return protobufTypeSummary
+}
+
+// marshalProtobuf appends io.prometheus.client.Summary message for sm to dst.
+//
+// Quantile values should be already updated by the caller via sm.updateQuantiles() call.
+// dst is returned unchanged if sm is empty.
+func (sm *Summary) marshalProtobuf(dst []byte) []byte {
+	sm.mu.Lock()
+	sum := sm.sum
+	count := sm.count
+	quantileValues := append([]float64{}, sm.quantileValues...)
+	sm.mu.Unlock()
+
+	if count == 0 {
+		return dst
+	}
+	var sp, qp []byte
+	sp = appendProtobufVarint(sp, 1, count)
+	sp = appendProtobufDouble(sp, 2, sum)
+	for i, q := range sm.quantiles {
+		v := quantileValues[i]
+		if math.IsNaN(v) {
+			continue
+		}
+		qp = appendProtobufDouble(qp[:0], 1, q)
+		qp = appendProtobufDouble(qp, 2, v)
+		sp = appendProtobufMessage(sp, 3, qp)
+	}
+	return appendProtobufMessage(dst, 4, sp)
+}
+
+// splitMetricName splits the given metric name into metric family and labels in curly braces.
+//
+// Metric family is returned in unquoted form if name uses Prometheus UTF-8 syntax, e.g. `{"my.metric","label"="value"}`.
 func splitMetricName(name string) (string, string) {
+	if strings.HasPrefix(name, `{"`) {
+		family, tail, err := readQuotedString(name[1:])
+		if err == nil {
+			if strings.HasPrefix(tail, ",") {
+				return family, "{" + tail[1:]
+			}
+			return family, ""
+		}
+	}
 	n := strings.IndexByte(name, '{')
 	if n < 0 {
 		return name, ""
@@ -152,7 +271,7 @@ func (sm *Summary) updateQuantiles() {
 //
 // Performance tip: prefer NewSummary instead of GetOrCreateSummary.
 func GetOrCreateSummary(name string) *Summary {
-	return defaultSet.GetOrCreateSummary(name)
+	return defaultSet().GetOrCreateSummary(name)
 }
 
 // GetOrCreateSummaryExt returns registered summary with the given name,
@@ -170,7 +289,7 @@ func GetOrCreateSummary(name string) *Summary {
 //
 // Performance tip: prefer NewSummaryExt instead of GetOrCreateSummaryExt.
 func GetOrCreateSummaryExt(name string, window time.Duration, quantiles []float64) *Summary {
-	return defaultSet.GetOrCreateSummaryExt(name, window, quantiles)
+	return defaultSet().GetOrCreateSummaryExt(name, window, quantiles)
 }
 
 func isEqualQuantiles(a, b []float64) bool {
@@ -211,6 +330,13 @@ func addTag(name, tag string) string {
 	return fmt.Sprintf("%s,%s}", name[:len(name)-1], tag)
 }
 
+// addLabel returns name with the added labelName="labelValue" label.
+//
+// labelValue is escaped according to Prometheus text exposition format, so it may contain arbitrary chars.
+func addLabel(name, labelName, labelValue string) string {
+	return addTag(name, string(appendLabel(nil, labelName, labelValue)))
+}
+
 func registerSummaryLocked(sm *Summary) {
 	window := sm.window
 	summariesLock.Lock()
@@ -241,8 +367,9 @@ func unregisterSummary(sm *Summary) {
 }
 
 func summariesSwapCron(window time.Duration) {
+	tickerCh, _ := getClock().NewTicker(window / 2)
 	for {
-		time.Sleep(window / 2)
+		<-tickerCh
 		summariesLock.Lock()
 		for _, sm := range summaries[window] {
 			sm.mu.Lock()
@@ -3,6 +3,8 @@ package metrics
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -153,3 +155,89 @@ func testGetOrCreateSummary(name string) error {
 	}
 	return nil
 }
+
+func TestSummaryUpdateWithWeight(t *testing.T) {
+	s := NewSet()
+	sm := s.NewSummaryExt("foo", time.Minute, []float64{0.5, 1})
+	sm.UpdateWithWeight(10, 3)
+	sm.UpdateWithWeight(100, 0)
+	sm.UpdateWithWeight(1, 1)
+
+	testMarshalTo(t, sm, "foo", "foo_sum 31\nfoo_count 4\n")
+	sm.updateQuantiles()
+	if v := sm.quantileValues[0]; v != 10 {
+		t.Fatalf("unexpected median; got %g; want 10", v)
+	}
+	if v := sm.quantileValues[1]; v != 10 {
+		t.Fatalf("unexpected max; got %g; want 10", v)
+	}
+}
+
+func TestSummaryUpdateWithBigWeight(t *testing.T) {
+	s := NewSet()
+	sm := s.NewSummaryExt("foo", time.Minute, []float64{0.5})
+	sm.UpdateWithWeight(2, 1e12)
+	sm.UpdateWithWeight(1, 1)
+
+	testMarshalTo(t, sm, "foo", "foo_sum 2000000000001\nfoo_count 1000000000001\n")
+	sm.updateQuantiles()
+	if v := sm.quantileValues[0]; v != 2 {
+		t.Fatalf("unexpected median; got %g; want 2", v)
+	}
+}
+
+func TestSummaryReset(t *testing.T) {
+	s := NewSet()
+	sm := s.NewSummaryExt("foo", time.Minute, []float64{0.5, 1})
+	for i := 0; i < 10; i++ {
+		sm.Update(float64(i))
+	}
+	sm.updateQuantiles()
+
+	sm.Reset()
+
+	// Cached quantiles mustn't be exposed after the reset.
+	var bb bytes.Buffer
+	s.WritePrometheus(&bb)
+	if result := bb.String(); result != "" {
+		t.Fatalf("unexpected non-empty result after Reset; got\n%s", result)
+	}
+
+	sm.Update(42)
+	bb.Reset()
+	s.WritePrometheus(&bb)
+	resultExpected := `foo_sum 42
+foo_count 1
+foo{quantile="0.5"} 42
+foo{quantile="1"} 42
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestSummaryQuantile(t *testing.T) {
+	s := NewSet()
+	sm := s.NewSummaryExt("foo", time.Minute, []float64{0, 0.5, 1})
+	if v := sm.Quantile(0.5); !math.IsNaN(v) {
+		t.Fatalf("unexpected quantile for empty summary; got %g; want NaN", v)
+	}
+	for i := 0; i <= 100; i++ {
+		sm.Update(float64(i))
+	}
+	if v := sm.Quantile(0.5); v != 50 {
+		t.Fatalf("unexpected median; got %g; want 50", v)
+	}
+	if v := sm.Quantile(0.9); v != 90 {
+		t.Fatalf("unexpected 0.9 quantile; got %g; want 90", v)
+	}
+	values := sm.Quantiles()
+	valuesExpected := []float64{0, 50, 100}
+	if !reflect.DeepEqual(values, valuesExpected) {
+		t.Fatalf("unexpected quantiles; got %v; want %v", values, valuesExpected)
+	}
+
+	expectPanic(t, "Quantile_invalid_phi", func() {
+		sm.Quantile(1.5)
+	})
+}
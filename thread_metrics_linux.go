@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// threadCPUStats contains CPU stats for threads with the same name.
+type threadCPUStats struct {
+	comm    string
+	threads uint64
+	utime   uint64
+	stime   uint64
+}
+
+func writeThreadCPUMetrics(w io.Writer) {
+	tss, err := getThreadCPUStats("/proc/self/task")
+	if err != nil {
+		log.Printf("ERROR: metrics: cannot determine per-thread CPU stats: %s", err)
+		return
+	}
+	writeThreadCPUStats(w, tss)
+}
+
+// writeThreadCPUStats writes metrics for the given tss to w.
+func writeThreadCPUStats(w io.Writer, tss []*threadCPUStats) {
+	labels := make([]string, len(tss))
+	for i, ts := range tss {
+		labels[i] = string(appendLabel(nil, "comm", ts.comm))
+	}
+
+	// Write every metric family as a single block, so metadata is written only once per family.
+	WriteMetadataIfNeeded(w, "process_thread_cpu_seconds_system_total", "counter")
+	for i, ts := range tss {
+		fmt.Fprintf(w, "process_thread_cpu_seconds_system_total{%s} %g\n", labels[i], float64(ts.stime)/userHZ)
+	}
+	WriteMetadataIfNeeded(w, "process_thread_cpu_seconds_total", "counter")
+	for i, ts := range tss {
+		fmt.Fprintf(w, "process_thread_cpu_seconds_total{%s} %g\n", labels[i], float64(ts.utime+ts.stime)/userHZ)
+	}
+	WriteMetadataIfNeeded(w, "process_thread_cpu_seconds_user_total", "counter")
+	for i, ts := range tss {
+		fmt.Fprintf(w, "process_thread_cpu_seconds_user_total{%s} %g\n", labels[i], float64(ts.utime)/userHZ)
+	}
+	WriteMetadataIfNeeded(w, "process_threads", "gauge")
+	for i, ts := range tss {
+		fmt.Fprintf(w, "process_threads{%s} %d\n", labels[i], ts.threads)
+	}
+}
+
+// getThreadCPUStats returns CPU stats for threads listed at taskDir grouped by thread name and sorted by name.
+func getThreadCPUStats(taskDir string) ([]*threadCPUStats, error) {
+	fis, err := ioutil.ReadDir(taskDir)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]*threadCPUStats)
+	for _, fi := range fis {
+		statFilepath := filepath.Join(taskDir, fi.Name(), "stat")
+		data, err := ioutil.ReadFile(statFilepath)
+		if err != nil {
+			// The thread may exit after reading taskDir.
+			continue
+		}
+		comm, utime, stime, err := parseThreadStat(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", statFilepath, err)
+		}
+		ts := m[comm]
+		if ts == nil {
+			ts = &threadCPUStats{
+				comm: comm,
+			}
+			m[comm] = ts
+		}
+		ts.threads++
+		ts.utime += utime
+		ts.stime += stime
+	}
+	tss := make([]*threadCPUStats, 0, len(m))
+	for _, ts := range m {
+		tss = append(tss, ts)
+	}
+	sort.Slice(tss, func(i, j int) bool {
+		return tss[i].comm < tss[j].comm
+	})
+	return tss, nil
+}
+
+// parseThreadStat returns thread name, user and system CPU time in clock ticks from /proc/self/task/*/stat contents.
+//
+// See http://man7.org/linux/man-pages/man5/proc.5.html
+func parseThreadStat(data []byte) (string, uint64, uint64, error) {
+	n := bytes.IndexByte(data, '(')
+	m := bytes.LastIndex(data, []byte(") "))
+	if n < 0 || m < n {
+		return "", 0, 0, fmt.Errorf("cannot find thread name in parentheses in %q", data)
+	}
+	comm := string(data[n+1 : m])
+	fields := bytes.Fields(data[m+2:])
+	// utime and stime are 14th and 15th fields, while the fields start from the 3rd field after the thread name.
+	if len(fields) < 13 {
+		return "", 0, 0, fmt.Errorf("unexpected number of fields after thread name in %q; got %d; want at least 13", data, len(fields))
+	}
+	utime, err := strconv.ParseUint(string(fields[11]), 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("cannot parse utime: %w", err)
+	}
+	stime, err := strconv.ParseUint(string(fields[12]), 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("cannot parse stime: %w", err)
+	}
+	return comm, utime, stime, nil
+}
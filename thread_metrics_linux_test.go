@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetThreadCPUStats(t *testing.T) {
+	f := func(want []*threadCPUStats, path string, wantErr bool) {
+		t.Helper()
+		got, err := getThreadCPUStats(path)
+		if (err != nil && !wantErr) || (err == nil && wantErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected result: %+v, want: %+v at getThreadCPUStats", got, want)
+		}
+	}
+	f([]*threadCPUStats{
+		{comm: "cgo (worker)", threads: 1, utime: 200, stime: 100},
+		{comm: "myapp", threads: 2, utime: 200, stime: 50},
+	}, "testdata/task", false)
+	f(nil, "testdata/task_bad", true)
+	f(nil, "testdata/bad_path", true)
+}
+
+func TestWriteThreadCPUMetrics(t *testing.T) {
+	var bb bytes.Buffer
+	WriteThreadCPUMetrics(&bb)
+	if !strings.Contains(bb.String(), "process_thread_cpu_seconds_total{comm=") {
+		t.Fatalf("missing process_thread_cpu_seconds_total metric in the output:\n%s", bb.String())
+	}
+
+}
+
+func TestWriteThreadCPUStats(t *testing.T) {
+	ExposeMetadata(true)
+	defer ExposeMetadata(false)
+
+	tss := []*threadCPUStats{
+		{comm: "foo", threads: 2, utime: 100, stime: 50},
+		{comm: `bar"baz`, threads: 1, utime: 300, stime: 0},
+	}
+	var bb bytes.Buffer
+	writeThreadCPUStats(&bb, tss)
+	resultExpected := `# HELP process_thread_cpu_seconds_system_total
+# TYPE process_thread_cpu_seconds_system_total counter
+process_thread_cpu_seconds_system_total{comm="foo"} 0.5
+process_thread_cpu_seconds_system_total{comm="bar\"baz"} 0
+# HELP process_thread_cpu_seconds_total
+# TYPE process_thread_cpu_seconds_total counter
+process_thread_cpu_seconds_total{comm="foo"} 1.5
+process_thread_cpu_seconds_total{comm="bar\"baz"} 3
+# HELP process_thread_cpu_seconds_user_total
+# TYPE process_thread_cpu_seconds_user_total counter
+process_thread_cpu_seconds_user_total{comm="foo"} 1
+process_thread_cpu_seconds_user_total{comm="bar\"baz"} 3
+# HELP process_threads
+# TYPE process_threads gauge
+process_threads{comm="foo"} 2
+process_threads{comm="bar\"baz"} 1
+`
+	if result := bb.String(); result != resultExpected {
+		t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
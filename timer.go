@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Updater is a metric, which can be updated with float64 values.
+//
+// Histogram, NativeHistogram and Summary implement Updater.
+type Updater interface {
+	Update(v float64)
+}
+
+// Timer measures the duration since its start.
+//
+// Usage:
+//
+//	t := metrics.StartTimer()
+//	defer t.ObserveTo(requestDuration)
+type Timer struct {
+	startTime time.Time
+}
+
+// StartTimer returns new Timer started at the current time.
+func StartTimer() Timer {
+	return Timer{
+		startTime: now(),
+	}
+}
+
+// ObserveTo updates u with the duration in seconds since t start.
+func (t Timer) ObserveTo(u Updater) {
+	d := since(t.startTime).Seconds()
+	u.Update(d)
+}
+
+// ObserveDuration calls f and updates u with the duration of f call in seconds.
+func ObserveDuration(u Updater, f func()) {
+	t := StartTimer()
+	defer t.ObserveTo(u)
+	f()
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	s := NewSet()
+	h := s.NewHistogram("histogram")
+	sm := s.NewSummary("summary")
+
+	timer := StartTimer()
+	time.Sleep(10 * time.Millisecond)
+	timer.ObserveTo(h)
+	timer.ObserveTo(sm)
+	if sum := h.getSum(); sum < 0.01 {
+		t.Fatalf("unexpected histogram sum; got %g; want at least 0.01", sum)
+	}
+	if sm.count != 1 || sm.sum < 0.01 {
+		t.Fatalf("unexpected summary state; got count=%d, sum=%g; want count=1 and sum at least 0.01", sm.count, sm.sum)
+	}
+}
+
+func TestObserveDuration(t *testing.T) {
+	s := NewSet()
+	nh := s.NewNativeHistogram("native_histogram")
+
+	called := false
+	ObserveDuration(nh, func() {
+		called = true
+	})
+	if !called {
+		t.Fatalf("ObserveDuration must call f")
+	}
+	if nh.count != 1 {
+		t.Fatalf("unexpected count; got %d; want 1", nh.count)
+	}
+}
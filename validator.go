@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 func validateMetric(s string) error {
 	if len(s) == 0 {
 		return fmt.Errorf("metric cannot be empty")
 	}
+	if s[0] == '{' {
+		return validateMetricWithQuotedName(s)
+	}
 	n := strings.IndexByte(s, '{')
 	if n < 0 {
 		return validateIdent(s)
@@ -25,26 +29,82 @@ func validateMetric(s string) error {
 	return validateTags(s[:len(s)-1])
 }
 
+// validateMetricWithQuotedName validates metric name in Prometheus UTF-8 syntax,
+// e.g. `{"my.metric","label.name"="value"}`.
+func validateMetricWithQuotedName(s string) error {
+	if s[len(s)-1] != '}' {
+		return fmt.Errorf("missing closing curly brace at the end of %q", s)
+	}
+	name, tail, err := readQuotedString(s[1:])
+	if err != nil {
+		return fmt.Errorf("cannot parse quoted metric name in %q: %w", s, err)
+	}
+	if err := validateQuotedName(name); err != nil {
+		return err
+	}
+	if tail == "}" {
+		return nil
+	}
+	if !strings.HasPrefix(tail, ",") {
+		return fmt.Errorf("missing `,` after metric name %q; tail=%q", name, tail)
+	}
+	tags := skipSpace(tail[1 : len(tail)-1])
+	if len(tags) == 0 {
+		return fmt.Errorf("missing labels after `,` in %q", s)
+	}
+	return validateTags(tags)
+}
+
+// validateQuotedName validates metric or label name, which has been passed in quoted form.
+func validateQuotedName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("quoted name cannot be empty")
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("quoted name %q must contain valid UTF-8 chars", name)
+	}
+	if strings.ContainsAny(name, "{}") {
+		return fmt.Errorf("quoted name %q cannot contain curly braces", name)
+	}
+	return nil
+}
+
 func validateTags(s string) error {
 	if len(s) == 0 {
 		return nil
 	}
 	for {
-		n := strings.IndexByte(s, '=')
-		if n < 0 {
-			return fmt.Errorf("missing `=` after %q", s)
-		}
-		ident := s[:n]
-		s = s[n+1:]
-		if err := validateIdent(ident); err != nil {
-			return err
+		var ident string
+		if strings.HasPrefix(s, `"`) {
+			name, tail, err := readQuotedString(s)
+			if err != nil {
+				return fmt.Errorf("cannot parse quoted label name: %w", err)
+			}
+			if err := validateQuotedName(name); err != nil {
+				return err
+			}
+			if !strings.HasPrefix(tail, "=") {
+				return fmt.Errorf("missing `=` after %q", name)
+			}
+			ident = name
+			s = tail[1:]
+		} else {
+			n := strings.IndexByte(s, '=')
+			if n < 0 {
+				return fmt.Errorf("missing `=` after %q", s)
+			}
+			ident = s[:n]
+			s = s[n+1:]
+			if err := validateIdent(ident); err != nil {
+				return err
+			}
 		}
 		if len(s) == 0 || s[0] != '"' {
 			return fmt.Errorf("missing starting `\"` for %q value; tail=%q", ident, s)
 		}
 		s = s[1:]
 	again:
-		n = strings.IndexByte(s, '"')
+		n := strings.IndexByte(s, '"')
 		if n < 0 {
 			return fmt.Errorf("missing trailing `\"` for %q value; tail=%q", ident, s)
 		}
@@ -19,6 +19,13 @@ func TestValidateMetricSuccess(t *testing.T) {
 	f(`foo{bar="b}az"}`)
 	f(`:foo:bar{bar="a",baz="b"}`)
 	f(`some.foo{bar="baz"}`)
+
+	// quoted UTF-8 names
+	f(`{"my.metric"}`)
+	f(`{"my.metric","label.name"="x"}`)
+	f(`{"my metric", "метка"="x",foo="bar"}`)
+	f(`{"quote\"d"}`)
+	f(`foo{"label.name"="x"}`)
 }
 
 func TestValidateMetricError(t *testing.T) {
@@ -58,4 +65,15 @@ func TestValidateMetricError(t *testing.T) {
 	f(`a{foo="bar", x=`)
 	f(`a{foo="bar", x="`)
 	f(`a{foo="bar", x="}`)
+
+	// invalid quoted UTF-8 names
+	f(`{""}`)
+	f(`{"my.metric"`)
+	f(`{"my.metric}`)
+	f(`{"my.metric",}`)
+	f(`{"my.metric" x}`)
+	f(`{"my{metric}"}`)
+	f(`{"my.metric","label.name"}`)
+	f(`{"my.metric",""="x"}`)
+	f(`foo{"label.name"}`)
 }
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+)
+
+// metricVec holds metrics with the same name partitioned by label values.
+//
+// It caches the created metrics by label values in order to avoid
+// constructing metric names and looking them up in the Set on every access.
+type metricVec struct {
+	s          *Set
+	name       string
+	labelNames []string
+
+	mu sync.Mutex
+	m  map[string]metric
+
+	// keys maps full metric names to keys in m. It is used for fast removal of unregistered metrics from m.
+	keys map[string]string
+}
+
+func newMetricVec(s *Set, name string, labelNames []string) *metricVec {
+	if err := validateIdent(name); err != nil {
+		panic(fmt.Errorf("BUG: invalid metric name %q: %s", name, err))
+	}
+	if len(labelNames) == 0 {
+		panic(fmt.Errorf("BUG: missing label names for metric %q", name))
+	}
+	for _, labelName := range labelNames {
+		if err := validateIdent(labelName); err != nil {
+			panic(fmt.Errorf("BUG: invalid label name %q for metric %q: %s", labelName, name, err))
+		}
+	}
+	mv := &metricVec{
+		s:          s,
+		name:       name,
+		labelNames: append([]string{}, labelNames...),
+		m:          make(map[string]metric),
+		keys:       make(map[string]string),
+	}
+	s.mu.Lock()
+	if s.vecs == nil {
+		s.vecs = make(map[string][]*metricVec)
+	}
+	s.vecs[name] = append(s.vecs[name], mv)
+	s.mu.Unlock()
+	return mv
+}
+
+// getOrCreate returns metric for the given labelValues.
+//
+// If the metric is missing, then it is created via create callback, which receives the full metric name.
+func (mv *metricVec) getOrCreate(labelValues []string, create func(name string) metric) metric {
+	var buf [128]byte
+	key := mv.marshalKey(buf[:0], labelValues)
+	mv.mu.Lock()
+	// The compiler optimizes map lookup by string(key) without memory allocation.
+	m := mv.m[string(key)]
+	mv.mu.Unlock()
+	if m != nil {
+		markMetricAccessed(m)
+		return m
+	}
+
+	// Slow path - create and register missing metric.
+	name := mv.metricName(labelValues)
+	mNew := create(name)
+	if nm := mv.s.m.get(name); nm == nil || nm.metric != mNew {
+		// The metric hasn't been registered in mv.s, e.g. because of the limit set via Set.SetMaxMetrics.
+		// Do not cache it in order to prevent from unbounded memory usage on label explosion.
+		return mNew
+	}
+	mv.mu.Lock()
+	m = mv.m[string(key)]
+	if m == nil {
+		m = mNew
+		mv.m[string(key)] = m
+		mv.keys[name] = string(key)
+	}
+	mv.mu.Unlock()
+	return m
+}
+
+// deleteLabelValues unregisters the metric for the given labelValues.
+//
+// False is returned if there is no metric for the given labelValues.
+func (mv *metricVec) deleteLabelValues(labelValues []string) bool {
+	key := string(mv.marshalKey(nil, labelValues))
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+
+	if _, ok := mv.m[key]; !ok {
+		return false
+	}
+	delete(mv.m, key)
+	name := mv.metricName(labelValues)
+	delete(mv.keys, name)
+	return mv.s.UnregisterMetric(name)
+}
+
+// forgetMetric removes m with the given name from mv cache after m has been unregistered from mv.s.
+func (mv *metricVec) forgetMetric(name string, m metric) {
+	mv.mu.Lock()
+	key, ok := mv.keys[name]
+	if ok && mv.m[key] == m {
+		delete(mv.m, key)
+		delete(mv.keys, name)
+	}
+	mv.mu.Unlock()
+}
+
+func (mv *metricVec) marshalKey(dst []byte, labelValues []string) []byte {
+	if len(labelValues) != len(mv.labelNames) {
+		panic(fmt.Errorf("BUG: unexpected number of label values for metric %q; got %d; want %d", mv.name, len(labelValues), len(mv.labelNames)))
+	}
+	for _, v := range labelValues {
+		dst = append(dst, v...)
+		dst = append(dst, 0xff)
+	}
+	return dst
+}
+
+func (mv *metricVec) metricName(labelValues []string) string {
+	dst := append([]byte{}, mv.name...)
+	dst = append(dst, '{')
+	for i, labelName := range mv.labelNames {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendLabel(dst, labelName, labelValues[i])
+	}
+	dst = append(dst, '}')
+	return string(dst)
+}
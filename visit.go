@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"fmt"
+)
+
+// MetricValue contains point-in-time values for a metric passed to the callback at Set.Visit.
+type MetricValue struct {
+	// Family is the metric name without labels.
+	Family string
+
+	// Labels contains the metric labels including labels added to the Set via NewChildSet and SetCommonLabels.
+	Labels []Label
+
+	// Type is the metric type such as "counter", "gauge", "histogram" or "summary".
+	Type string
+
+	// Samples contains samples exported by the metric.
+	//
+	// For example, histograms export `_bucket`, `_sum` and `_count` samples,
+	// while summaries export per-quantile, `_sum` and `_count` samples.
+	Samples []Sample
+}
+
+// Visit calls f for every metric in the default set.
+//
+// See Set.Visit for details.
+func Visit(f func(name string, value MetricValue)) {
+	defaultSet().Visit(f)
+}
+
+// Visit calls f for every metric in s and in its child sets in the order of metric names.
+//
+// name is the metric name passed to f, while value contains parsed metric values.
+// This allows exporting metrics to custom backends without parsing the output of WritePrometheus.
+//
+// Output of metrics writers registered via RegisterMetricsWriter isn't passed to f.
+//
+// f is called without holding s locks, so it may access s.
+func (s *Set) Visit(f func(name string, value MetricValue)) {
+	s.visit(f, "")
+}
+
+func (s *Set) visit(f func(name string, value MetricValue), extraLabels string) {
+	sa, _ := s.getSortedMetrics()
+	extraLabels = joinLabels(extraLabels, s.getCommonLabels())
+	labels := joinLabels(extraLabels, s.labels)
+	for _, nm := range sa {
+		if nm.isAux {
+			// Auxiliary metrics are included in the samples of the parent metric.
+			continue
+		}
+		name := nm.name
+		if labels != "" {
+			name = addLabelsPrefix(name, labels)
+		}
+		family, labelsStr := splitMetricName(name)
+		var metricLabels []label
+		if labelsStr != "" {
+			ls, _, err := parseLabels(labelsStr[1:])
+			if err != nil {
+				panic(fmt.Errorf("BUG: cannot parse labels for metric %q: %s", name, err))
+			}
+			metricLabels = ls
+		}
+		value := MetricValue{
+			Family:  family,
+			Labels:  publicLabels(metricLabels),
+			Type:    nm.metric.metricType(),
+			Samples: getMetricSamples(nm.name, nm.metric, labels),
+		}
+		f(nm.name, value)
+	}
+
+	for _, child := range s.getChildren() {
+		child.visit(f, extraLabels)
+	}
+}
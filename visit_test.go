@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetVisit(t *testing.T) {
+	s := NewSet()
+	s.SetCommonLabels(`instance="host1"`)
+	s.NewCounter(`foo_total{bar="baz"}`).Add(3)
+	s.NewSummaryExt("summary", defaultSummaryWindow, []float64{0.5}).Update(2)
+	child := s.NewChildSet(`tenant="a"`)
+	child.NewGauge("gauge", func() float64 { return 1.5 })
+
+	var names []string
+	var values []MetricValue
+	s.Visit(func(name string, value MetricValue) {
+		names = append(names, name)
+		values = append(values, value)
+	})
+
+	namesExpected := []string{`foo_total{bar="baz"}`, "summary", "gauge"}
+	if !reflect.DeepEqual(names, namesExpected) {
+		t.Fatalf("unexpected names; got %q; want %q", names, namesExpected)
+	}
+	valuesExpected := []MetricValue{
+		{
+			Family: "foo_total",
+			Labels: []Label{{Name: "instance", Value: "host1"}, {Name: "bar", Value: "baz"}},
+			Type:   "counter",
+			Samples: []Sample{
+				{
+					Name:   `foo_total{instance="host1",bar="baz"}`,
+					Labels: []Label{{Name: "instance", Value: "host1"}, {Name: "bar", Value: "baz"}},
+					Value:  3,
+				},
+			},
+		},
+		{
+			Family: "summary",
+			Labels: []Label{{Name: "instance", Value: "host1"}},
+			Type:   "summary",
+			Samples: []Sample{
+				{
+					Name:   `summary{instance="host1",quantile="0.5"}`,
+					Labels: []Label{{Name: "instance", Value: "host1"}, {Name: "quantile", Value: "0.5"}},
+					Value:  2,
+				},
+				{
+					Name:   `summary_sum{instance="host1"}`,
+					Labels: []Label{{Name: "instance", Value: "host1"}},
+					Value:  2,
+				},
+				{
+					Name:   `summary_count{instance="host1"}`,
+					Labels: []Label{{Name: "instance", Value: "host1"}},
+					Value:  1,
+				},
+			},
+		},
+		{
+			Family: "gauge",
+			Labels: []Label{{Name: "instance", Value: "host1"}, {Name: "tenant", Value: "a"}},
+			Type:   "gauge",
+			Samples: []Sample{
+				{
+					Name:   `gauge{instance="host1",tenant="a"}`,
+					Labels: []Label{{Name: "instance", Value: "host1"}, {Name: "tenant", Value: "a"}},
+					Value:  1.5,
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(values, valuesExpected) {
+		t.Fatalf("unexpected values;\ngot\n%+v\nwant\n%+v", values, valuesExpected)
+	}
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"io"
+)
+
+// NewWriteCallback registers writeMetrics callback with the given name and metricType for writing pre-computed samples at scrape time.
+//
+// See Set.NewWriteCallback for details.
+func NewWriteCallback(name, metricType string, writeMetrics func(w io.Writer)) {
+	defaultSet().NewWriteCallback(name, metricType, writeMetrics)
+}
+
+// writeCallback is a metric, which writes samples generated by a user-supplied callback.
+type writeCallback struct {
+	metricTypeStr string
+	writeMetrics  func(w io.Writer)
+}
+
+func (wc *writeCallback) marshalTo(prefix string, w io.Writer) {
+	wc.writeMetrics(w)
+}
+
+func (wc *writeCallback) metricType() string {
+	return wc.metricTypeStr
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestSetNewWriteCallback(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("aaa_total").Set(1)
+	s.NewWriteCallback("bbb", "gauge", func(w io.Writer) {
+		fmt.Fprintf(w, "bbb{instance=%q} %d\n", "x", 12)
+		fmt.Fprintf(w, "bbb{instance=%q} %d\n", "y", 34)
+	})
+	s.NewCounter("ccc_total").Set(2)
+
+	f := func(resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheus(&bb)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(`aaa_total 1
+bbb{instance="x"} 12
+bbb{instance="y"} 34
+ccc_total 2
+`)
+
+	ExposeMetadata(true)
+	f(`# HELP aaa_total
+# TYPE aaa_total counter
+aaa_total 1
+# HELP bbb
+# TYPE bbb gauge
+bbb{instance="x"} 12
+bbb{instance="y"} 34
+# HELP ccc_total
+# TYPE ccc_total counter
+ccc_total 2
+`)
+	ExposeMetadata(false)
+
+	if !s.UnregisterMetric("bbb") {
+		t.Fatalf("UnregisterMetric must return true for the registered callback")
+	}
+	f(`aaa_total 1
+ccc_total 2
+`)
+
+	expectPanic(t, "NewWriteCallback_invalid_name", func() {
+		s.NewWriteCallback(`foo{bar="baz"}`, "gauge", func(w io.Writer) {})
+	})
+	expectPanic(t, "NewWriteCallback_empty_type", func() {
+		s.NewWriteCallback("foo", "", func(w io.Writer) {})
+	})
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// WriteSummary writes summary metric with the given name, quantiles, sum and count to w in Prometheus text exposition format.
+//
+// quantiles must contain values for phi quantiles in the range [0..1], e.g. {0.5: 0.12, 0.99: 1.5}.
+// Quantiles are written in ascending order of phi. Quantiles with NaN values are skipped.
+//
+// This is useful for exporting summaries computed by external systems.
+func WriteSummary(w io.Writer, name string, quantiles map[float64]float64, sum float64, count uint64) {
+	WriteMetadataIfNeeded(w, name, "summary")
+	phis := make([]float64, 0, len(quantiles))
+	for phi := range quantiles {
+		phis = append(phis, phi)
+	}
+	sort.Float64s(phis)
+	for _, phi := range phis {
+		v := quantiles[phi]
+		if math.IsNaN(v) {
+			continue
+		}
+		fmt.Fprintf(w, "%s %g\n", addTag(name, fmt.Sprintf(`quantile="%g"`, phi)), v)
+	}
+	writeSumAndCount(w, name, sum, count)
+}
+
+// HistogramBucket is a bucket for WriteHistogram.
+type HistogramBucket struct {
+	// UpperBound is the inclusive upper bound of the bucket.
+	UpperBound float64
+
+	// Count is the cumulative number of observations less than or equal to UpperBound.
+	Count uint64
+}
+
+// WriteHistogram writes Prometheus histogram with the given name, buckets, sum and count to w in Prometheus text exposition format.
+//
+// buckets must contain cumulative counts for upper bounds. They are written as `name_bucket{le="..."}` series
+// in ascending order of upper bounds. The `+Inf` bucket with count is added automatically if it is missing in buckets.
+//
+// This is useful for exporting histograms computed by external systems.
+func WriteHistogram(w io.Writer, name string, buckets []HistogramBucket, sum float64, count uint64) {
+	WriteMetadataIfNeeded(w, name, "histogram")
+	buckets = append([]HistogramBucket{}, buckets...)
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].UpperBound < buckets[j].UpperBound
+	})
+	if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].UpperBound, 1) {
+		buckets = append(buckets, HistogramBucket{
+			UpperBound: math.Inf(1),
+			Count:      count,
+		})
+	}
+	family, labels := splitMetricName(name)
+	bucketName := family + "_bucket" + labels
+	for _, b := range buckets {
+		le := "+Inf"
+		if !math.IsInf(b.UpperBound, 1) {
+			le = fmt.Sprintf("%g", b.UpperBound)
+		}
+		fmt.Fprintf(w, "%s %d\n", addTag(bucketName, fmt.Sprintf(`le=%q`, le)), b.Count)
+	}
+	writeSumAndCount(w, name, sum, count)
+}
+
+// writeSumAndCount writes `_sum` and `_count` series for the given name to w.
+func writeSumAndCount(w io.Writer, name string, sum float64, count uint64) {
+	family, labels := splitMetricName(name)
+	if float64(int64(sum)) == sum {
+		// Marshal integer sum without scientific notation
+		fmt.Fprintf(w, "%s_sum%s %d\n", family, labels, int64(sum))
+	} else {
+		fmt.Fprintf(w, "%s_sum%s %g\n", family, labels, sum)
+	}
+	fmt.Fprintf(w, "%s_count%s %d\n", family, labels, count)
+}
+
+// WriteGaugeWithLabels writes gauge metric with the given name, labels and value to w in Prometheus text exposition format.
+//
+// Labels are written in the sorted order of their names. Label values are escaped properly,
+// so they may contain arbitrary chars. name may contain labels in curly braces - labels are appended to them.
+func WriteGaugeWithLabels(w io.Writer, name string, labels map[string]string, value float64) {
+	writeMetricFloat64(w, addLabelsMap(name, labels), "gauge", value)
+}
+
+// WriteCounterWithLabels writes counter metric with the given name, labels and value to w in Prometheus text exposition format.
+//
+// Labels are written in the sorted order of their names. Label values are escaped properly,
+// so they may contain arbitrary chars. name may contain labels in curly braces - labels are appended to them.
+func WriteCounterWithLabels(w io.Writer, name string, labels map[string]string, value float64) {
+	writeMetricFloat64(w, addLabelsMap(name, labels), "counter", value)
+}
+
+// addLabelsMap returns name with the given labels added in the sorted order of their names.
+func addLabelsMap(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+	var dst []byte
+	for i, labelName := range labelNames {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendLabel(dst, labelName, labels[labelName])
+	}
+	return addTag(name, string(dst))
+}
+
+// appendLabel appends `name="value"` label with properly escaped value to dst.
+//
+// The label name is quoted if it contains chars, which aren't allowed in unquoted label names.
+func appendLabel(dst []byte, name, value string) []byte {
+	if identRegexp.MatchString(name) {
+		dst = append(dst, name...)
+	} else {
+		dst = appendQuotedLabelValue(dst, name)
+	}
+	dst = append(dst, '=')
+	return appendQuotedLabelValue(dst, value)
+}
+
+// appendQuotedLabelValue appends s to dst in double quotes with `\`, `"` and `\n` chars escaped
+// according to Prometheus text exposition format.
+func appendQuotedLabelValue(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			dst = append(dst, `\\`...)
+		case '"':
+			dst = append(dst, `\"`...)
+		case '\n':
+			dst = append(dst, `\n`...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
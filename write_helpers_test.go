@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWriteSummary(t *testing.T) {
+	f := func(name string, quantiles map[float64]float64, sum float64, count uint64, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteSummary(&bb, name, quantiles, sum, count)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f("foo", nil, 0, 0, `foo_sum 0
+foo_count 0
+`)
+	f(`foo{bar="baz"}`, map[float64]float64{
+		0.99: 1.5,
+		0.5:  0.25,
+		0.9:  math.NaN(),
+	}, 12.5, 42, `foo{bar="baz",quantile="0.5"} 0.25
+foo{bar="baz",quantile="0.99"} 1.5
+foo_sum{bar="baz"} 12.5
+foo_count{bar="baz"} 42
+`)
+}
+
+func TestWriteHistogram(t *testing.T) {
+	f := func(name string, buckets []HistogramBucket, sum float64, count uint64, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteHistogram(&bb, name, buckets, sum, count)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f("foo", nil, 0, 0, `foo_bucket{le="+Inf"} 0
+foo_sum 0
+foo_count 0
+`)
+	f(`foo{bar="baz"}`, []HistogramBucket{
+		{UpperBound: 1, Count: 5},
+		{UpperBound: 0.1, Count: 2},
+	}, 3.5, 7, `foo_bucket{bar="baz",le="0.1"} 2
+foo_bucket{bar="baz",le="1"} 5
+foo_bucket{bar="baz",le="+Inf"} 7
+foo_sum{bar="baz"} 3.5
+foo_count{bar="baz"} 7
+`)
+	f("foo", []HistogramBucket{
+		{UpperBound: 1, Count: 1},
+		{UpperBound: math.Inf(1), Count: 3},
+	}, 10, 3, `foo_bucket{le="1"} 1
+foo_bucket{le="+Inf"} 3
+foo_sum 10
+foo_count 3
+`)
+}
+
+func TestAddLabel(t *testing.T) {
+	f := func(name, labelName, labelValue, resultExpected string) {
+		t.Helper()
+		if result := addLabel(name, labelName, labelValue); result != resultExpected {
+			t.Fatalf("unexpected result; got %s; want %s", result, resultExpected)
+		}
+	}
+
+	f("foo", "a", "b", `foo{a="b"}`)
+	f(`foo{x="y"}`, "a", "b", `foo{x="y",a="b"}`)
+	f("foo", "a", "quote\"backslash\\newline\ntab\t", `foo{a="quote\"backslash\\newline\ntab	"}`)
+	f("foo", "label-name", "b", `foo{"label-name"="b"}`)
+}
+
+func TestWriteWithLabels(t *testing.T) {
+	f := func(name string, labels map[string]string, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteGaugeWithLabels(&bb, name, labels, 1.5)
+		WriteCounterWithLabels(&bb, name, labels, 2)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f("foo", nil, `foo 1.5
+foo 2
+`)
+	f("foo", map[string]string{
+		"b": "x",
+		"a": "quote\"backslash\\newline\nunicodeé",
+	}, `foo{a="quote\"backslash\\newline\nunicodeé",b="x"} 1.5
+foo{a="quote\"backslash\\newline\nunicodeé",b="x"} 2
+`)
+	f(`foo{x="y"}`, map[string]string{
+		"label-name": "z",
+	}, `foo{x="y","label-name"="z"} 1.5
+foo{x="y","label-name"="z"} 2
+`)
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"io"
+)
+
+// WriteOptions contains options for WritePrometheusWithOptions.
+type WriteOptions struct {
+	// ExposeMetadata enables exposing TYPE and HELP metadata for the written metrics.
+	//
+	// It overrides the global setting made via ExposeMetadata(), so distinct handlers may expose metadata independently.
+	ExposeMetadata bool
+}
+
+// WritePrometheusWithOptions writes all the metrics in Prometheus format from the default set, all the added sets and metrics writers to w.
+//
+// If exposeProcessMetrics is true, then various `go_*` and `process_*` metrics are exposed for the current process.
+//
+// opts may contain additional options if non-nil. The global settings such as ExposeMetadata() are used if opts is nil.
+//
+// See also WritePrometheus.
+func WritePrometheusWithOptions(w io.Writer, exposeProcessMetrics bool, opts *WriteOptions) {
+	WritePrometheus(newOptionsWriter(w, opts), exposeProcessMetrics)
+}
+
+// WritePrometheusWithOptions writes all the metrics from s to w in Prometheus format.
+//
+// opts may contain additional options if non-nil. The global settings such as ExposeMetadata() are used if opts is nil.
+func (s *Set) WritePrometheusWithOptions(w io.Writer, opts *WriteOptions) {
+	s.WritePrometheus(newOptionsWriter(w, opts))
+}
+
+// metadataWriter passes exposeMetadata option to functions writing metadata such as WriteMetadataIfNeeded.
+//
+// It allows passing the option through metrics writers registered via RegisterMetricsWriter.
+type metadataWriter struct {
+	w              io.Writer
+	exposeMetadata bool
+}
+
+func (mw *metadataWriter) Write(p []byte) (int, error) {
+	return mw.w.Write(p)
+}
+
+func newOptionsWriter(w io.Writer, opts *WriteOptions) io.Writer {
+	if opts == nil {
+		return w
+	}
+	return newMetadataWriter(w, opts.ExposeMetadata)
+}
+
+func newMetadataWriter(w io.Writer, exposeMetadata bool) *metadataWriter {
+	if mw, ok := w.(*metadataWriter); ok {
+		w = mw.w
+	}
+	return &metadataWriter{
+		w:              w,
+		exposeMetadata: exposeMetadata,
+	}
+}
+
+// isMetadataEnabledFor returns whether metadata must be written to w.
+//
+// The global setting made via ExposeMetadata() is used unless w has been passed with WriteOptions.
+func isMetadataEnabledFor(w io.Writer) bool {
+	if mw, ok := w.(*metadataWriter); ok {
+		return mw.exposeMetadata
+	}
+	return isMetadataEnabled()
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSetWritePrometheusWithOptions(t *testing.T) {
+	s := NewSet()
+	s.NewCounter("requests_total").Add(1)
+	s.RegisterMetricsWriter(func(w io.Writer) {
+		WriteGaugeUint64(w, "external_gauge", 2)
+	})
+	child := s.NewChildSet(`tenant="foo"`)
+	child.NewGauge("queue_size", nil).Set(3)
+	child.RegisterMetricsWriter(func(w io.Writer) {
+		WriteCounterUint64(w, "external_total", 4)
+	})
+
+	f := func(opts *WriteOptions, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		s.WritePrometheusWithOptions(&bb, opts)
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected output;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	withMetadata := `# HELP requests_total
+# TYPE requests_total counter
+requests_total 1
+# HELP external_gauge
+# TYPE external_gauge gauge
+external_gauge 2
+# HELP queue_size
+# TYPE queue_size gauge
+queue_size{tenant="foo"} 3
+# HELP external_total
+# TYPE external_total counter
+external_total{tenant="foo"} 4
+`
+	withoutMetadata := `requests_total 1
+external_gauge 2
+queue_size{tenant="foo"} 3
+external_total{tenant="foo"} 4
+`
+
+	// Global settings are used for nil opts
+	f(nil, withoutMetadata)
+
+	// opts override global settings
+	f(&WriteOptions{
+		ExposeMetadata: true,
+	}, withMetadata)
+
+	ExposeMetadata(true)
+	f(&WriteOptions{}, withoutMetadata)
+	f(nil, withMetadata)
+	ExposeMetadata(false)
+}
+
+func TestWritePrometheusWithOptions(t *testing.T) {
+	var bb bytes.Buffer
+	WritePrometheusWithOptions(&bb, true, &WriteOptions{
+		ExposeMetadata: true,
+	})
+	result := bb.String()
+	if !strings.Contains(result, "# TYPE go_goroutines gauge\n") {
+		t.Fatalf("missing metadata for process metrics in the output:\n%s", result)
+	}
+}